@@ -59,6 +59,64 @@ type Header struct {
 	AccessTime time.Time // access time
 	ChangeTime time.Time // status change time
 	Xattrs     map[string]string
+
+	// SparseHoles describes the holes of a sparse regular file,
+	// in ascending order of offset. Size is the logical size of
+	// the file, holes included. The Reader fills in SparseHoles
+	// for sparse entries; the Writer encodes entries that have
+	// holes in the PAX 1.0 sparse format, in which case the data
+	// written for the holes must be all zeros and is not stored.
+	SparseHoles []SparseEntry
+
+	// Format selects the archive format that the Writer uses for
+	// this entry. It is not set by the Reader.
+	Format Format
+}
+
+// A SparseEntry represents a single region of a sparse file,
+// Length bytes long and starting at Offset.
+type SparseEntry struct {
+	Offset int64
+	Length int64
+}
+
+// Format represents a tar archive format.
+type Format int
+
+const (
+	// FormatUnknown lets the Writer choose: it writes USTAR
+	// headers, adding PAX records for strings that do not fit
+	// and using the GNU binary encoding for numbers that do not
+	// fit.
+	FormatUnknown Format = iota
+
+	// FormatUSTAR is the POSIX.1-1988 format. Entries whose
+	// fields do not fit are rejected.
+	FormatUSTAR
+
+	// FormatPAX is the POSIX.1-2001 format. Fields that do not
+	// fit USTAR are stored as PAX records, as are sub-second
+	// modification times and access and change times.
+	FormatPAX
+
+	// FormatGNU is the GNU tar format. Long names and link
+	// targets are stored in separate GNU long name entries and
+	// large numbers in base-256.
+	FormatGNU
+)
+
+var formatNames = []string{
+	FormatUnknown: "<unknown>",
+	FormatUSTAR:   "USTAR",
+	FormatPAX:     "PAX",
+	FormatGNU:     "GNU",
+}
+
+func (f Format) String() string {
+	if f >= 0 && int(f) < len(formatNames) {
+		return formatNames[f]
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
 }
 
 // File name constants from the tar spec.
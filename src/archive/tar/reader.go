@@ -123,6 +123,7 @@ func (tr *Reader) Next() (*Header, error) {
 			// Current file is a PAX format GNU sparse file.
 			// Set the current file reader to a sparse file reader.
 			tr.curr = &sparseFileReader{rfr: tr.curr.(*regFileReader), sp: sp, tot: hdr.Size}
+			hdr.SparseHoles = sparseHoles(sp, hdr.Size)
 		}
 		return hdr, nil
 	case TypeGNULongName:
@@ -303,6 +304,10 @@ func parsePAXTime(t string) (time.Time, error) {
 		if err != nil {
 			return time.Time{}, err
 		}
+		// The fraction has the sign of the whole number.
+		if len(t) > 0 && t[0] == '-' {
+			nanoseconds = -nanoseconds
+		}
 	}
 	ts := time.Unix(seconds, nanoseconds)
 	return ts, nil
@@ -533,6 +538,7 @@ func (tr *Reader) readHeader() *Header {
 		}
 		// Current file is a GNU sparse file. Update the current file reader.
 		tr.curr = &sparseFileReader{rfr: tr.curr.(*regFileReader), sp: sp, tot: hdr.Size}
+		hdr.SparseHoles = sparseHoles(sp, hdr.Size)
 	}
 
 	return hdr
@@ -678,6 +684,25 @@ func readGNUSparseMap1x0(r io.Reader) ([]sparseEntry, error) {
 	return sp, nil
 }
 
+// sparseHoles returns the holes left by the data fragments in sp
+// of a sparse file of the given size.
+func sparseHoles(sp []sparseEntry, size int64) []SparseEntry {
+	var holes []SparseEntry
+	var off int64
+	for _, s := range sp {
+		if s.offset > off {
+			holes = append(holes, SparseEntry{off, s.offset - off})
+		}
+		if end := s.offset + s.numBytes; end > off {
+			off = end
+		}
+	}
+	if size > off {
+		holes = append(holes, SparseEntry{off, size - off})
+	}
+	return holes
+}
+
 // readGNUSparseMap0x1 reads the sparse map as stored in GNU's PAX sparse format version 0.1.
 // The sparse map is stored in the PAX headers.
 func readGNUSparseMap0x1(headers map[string]string) ([]sparseEntry, error) {
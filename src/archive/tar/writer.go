@@ -25,12 +25,19 @@ var (
 	ErrWriteAfterClose = errors.New("archive/tar: write after close")
 	errNameTooLong     = errors.New("archive/tar: name too long")
 	errInvalidHeader   = errors.New("archive/tar: header field too long or contains invalid values")
+	errSparseFormat    = errors.New("archive/tar: sparse files require the PAX format")
+	errSparseHoles     = errors.New("archive/tar: invalid sparse holes")
+	errWriteHole       = errors.New("archive/tar: non-zero data written in sparse hole")
 )
 
 // A Writer provides sequential writing of a tar archive in POSIX.1 format.
 // A tar archive consists of a sequence of files.
 // Call WriteHeader to begin a new file, and then call Write to supply that file's data,
 // writing at most hdr.Size bytes in total.
+//
+// For a sparse file, Write is supplied the file's full logical contents;
+// the bytes that fall in the holes listed in hdr.SparseHoles must be zero
+// and are not stored in the archive.
 type Writer struct {
 	w          io.Writer
 	err        error
@@ -38,7 +45,9 @@ type Writer struct {
 	pad        int64 // amount of padding to write after current file entry
 	closed     bool
 	usedBinary bool            // whether the binary numeric field extension was used
-	preferPax  bool            // use pax header instead of binary numeric header
+	format     Format          // format of the current file entry
+	holes      []SparseEntry   // remaining holes of the current sparse file entry
+	off        int64           // logical offset in the current sparse file entry
 	hdrBuff    [blockSize]byte // buffer to use in writeHeader when writing a regular header
 	paxHdrBuff [blockSize]byte // buffer to use in writeHeader when writing a pax header
 }
@@ -65,13 +74,15 @@ func (tw *Writer) Flush() error {
 	}
 	tw.nb = 0
 	tw.pad = 0
+	tw.holes = nil
 	return tw.err
 }
 
 // Write s into b, terminating it with a NUL if there is room.
-// If the value is too long for the field and allowPax is true add a paxheader record instead
+// If the value is too long for the field and allowPax is true add a paxheader record instead.
+// The GNU format stores non-ASCII strings as is.
 func (tw *Writer) cString(b []byte, s string, allowPax bool, paxKeyword string, paxHeaders map[string]string) {
-	needsPaxHeader := allowPax && len(s) > len(b) || !isASCII(s)
+	needsPaxHeader := allowPax && len(s) > len(b) || !isASCII(s) && tw.format != FormatGNU
 	if needsPaxHeader {
 		paxHeaders[paxKeyword] = s
 		return
@@ -82,7 +93,10 @@ func (tw *Writer) cString(b []byte, s string, allowPax bool, paxKeyword string,
 		}
 		return
 	}
-	ascii := toASCII(s)
+	ascii := s
+	if tw.format != FormatGNU {
+		ascii = toASCII(s)
+	}
 	copy(b, ascii)
 	if len(ascii) < len(b) {
 		b[len(ascii)] = 0
@@ -110,7 +124,7 @@ func (tw *Writer) numeric(b []byte, x int64, allowPax bool, paxKeyword string, p
 	}
 
 	// If it is too long for octal, and pax is preferred, use a pax header
-	if allowPax && tw.preferPax {
+	if allowPax && tw.format == FormatPAX {
 		tw.octal(b, 0)
 		s := strconv.FormatInt(x, 10)
 		paxHeaders[paxKeyword] = s
@@ -158,9 +172,65 @@ func (tw *Writer) writeHeader(hdr *Header, allowPax bool) error {
 	// a map to hold pax header records, if any are needed
 	paxHeaders := make(map[string]string)
 
-	// TODO(shanemhansen): we might want to use PAX headers for
-	// subsecond time resolution, but for now let's just capture
-	// too long fields or non ascii characters
+	// The sparse map and GNU long names of the entry, if any.
+	var sparseMap []byte
+	var holes []SparseEntry
+	var longName, longLink string
+	logicalSize := hdr.Size
+	if allowPax {
+		switch hdr.Format {
+		case FormatUnknown, FormatUSTAR, FormatPAX, FormatGNU:
+		default:
+			return errInvalidHeader
+		}
+		tw.format = hdr.Format
+		tw.usedBinary = false
+		if hdr.Typeflag == TypeGNUSparse {
+			// The Reader returns old GNU sparse files as such,
+			// with their holes in SparseHoles. Write them as
+			// regular files, with those holes if there are any.
+			reg := *hdr
+			reg.Typeflag = TypeReg
+			hdr = &reg
+		}
+		if len(hdr.SparseHoles) > 0 {
+			if tw.format != FormatUnknown && tw.format != FormatPAX {
+				return errSparseFormat
+			}
+			var size int64
+			var err error
+			holes, sparseMap, size, err = encodeSparseMap(hdr)
+			if err != nil {
+				return err
+			}
+			// GNU tar stores the real name in a PAX record and
+			// names the entry itself after it.
+			dir, file := path.Split(hdr.Name)
+			sph := *hdr
+			sph.Name = path.Join(dir, "GNUSparseFile.0", file)
+			sph.Size = size
+			paxHeaders[paxGNUSparseMajor] = "1"
+			paxHeaders[paxGNUSparseMinor] = "0"
+			paxHeaders[paxGNUSparseName] = hdr.Name
+			paxHeaders[paxGNUSparseRealSize] = strconv.FormatInt(hdr.Size, 10)
+			hdr = &sph
+		}
+		if tw.format == FormatGNU {
+			if len(hdr.Name) > fileNameSize {
+				longName = hdr.Name
+			}
+			if len(hdr.Linkname) > fileNameSize {
+				longLink = hdr.Linkname
+			}
+		}
+	}
+	name, linkname := hdr.Name, hdr.Linkname
+	if longName != "" {
+		name = name[:fileNameSize]
+	}
+	if longLink != "" {
+		linkname = linkname[:fileNameSize]
+	}
 
 	var header []byte
 
@@ -179,13 +249,27 @@ func (tw *Writer) writeHeader(hdr *Header, allowPax bool) error {
 	// keep a reference to the filename to allow to overwrite it later if we detect that we can use ustar longnames instead of pax
 	pathHeaderBytes := s.next(fileNameSize)
 
-	tw.cString(pathHeaderBytes, hdr.Name, true, paxPath, paxHeaders)
+	tw.cString(pathHeaderBytes, name, true, paxPath, paxHeaders)
 
 	// Handle out of range ModTime carefully.
 	var modTime int64
 	if !hdr.ModTime.Before(minTime) && !hdr.ModTime.After(maxTime) {
 		modTime = hdr.ModTime.Unix()
 	}
+	if allowPax && tw.format == FormatPAX {
+		// Record what the USTAR fields cannot hold: times before
+		// 1970 or too far in the future, sub-second precision,
+		// and access and change times.
+		if modTime != hdr.ModTime.Unix() || hdr.ModTime.Nanosecond() != 0 {
+			paxHeaders[paxMtime] = formatPAXTime(hdr.ModTime)
+		}
+		if !hdr.AccessTime.IsZero() {
+			paxHeaders[paxAtime] = formatPAXTime(hdr.AccessTime)
+		}
+		if !hdr.ChangeTime.IsZero() {
+			paxHeaders[paxCtime] = formatPAXTime(hdr.ChangeTime)
+		}
+	}
 
 	tw.octal(s.next(8), hdr.Mode)                                   // 100:108
 	tw.numeric(s.next(8), int64(hdr.Uid), true, paxUid, paxHeaders) // 108:116
@@ -195,7 +279,7 @@ func (tw *Writer) writeHeader(hdr *Header, allowPax bool) error {
 	s.next(8)                                                       // chksum (148:156)
 	s.next(1)[0] = hdr.Typeflag                                     // 156:157
 
-	tw.cString(s.next(100), hdr.Linkname, true, paxLinkpath, paxHeaders)
+	tw.cString(s.next(100), linkname, true, paxLinkpath, paxHeaders)
 
 	copy(s.next(8), []byte("ustar\x0000"))                        // 257:265
 	tw.cString(s.next(32), hdr.Uname, true, paxUname, paxHeaders) // 265:297
@@ -208,13 +292,13 @@ func (tw *Writer) writeHeader(hdr *Header, allowPax bool) error {
 	tw.cString(prefixHeaderBytes, "", false, paxNone, nil) // 345:500  prefix
 
 	// Use the GNU magic instead of POSIX magic if we used any GNU extensions.
-	if tw.usedBinary {
+	if tw.usedBinary || tw.format == FormatGNU {
 		copy(header[257:265], []byte("ustar  \x00"))
 	}
 
 	_, paxPathUsed := paxHeaders[paxPath]
 	// try to use a ustar header when only the name is too long
-	if !tw.preferPax && len(paxHeaders) == 1 && paxPathUsed {
+	if tw.format != FormatPAX && len(paxHeaders) == 1 && paxPathUsed {
 		suffix := hdr.Name
 		prefix := ""
 		if len(hdr.Name) > fileNameSize && isASCII(hdr.Name) {
@@ -255,6 +339,19 @@ func (tw *Writer) writeHeader(hdr *Header, allowPax bool) error {
 		}
 	}
 
+	// USTAR and GNU entries cannot carry PAX records,
+	// and USTAR has no binary numbers either.
+	switch tw.format {
+	case FormatUSTAR:
+		if len(paxHeaders) > 0 || tw.usedBinary {
+			return errInvalidHeader
+		}
+	case FormatGNU:
+		if len(paxHeaders) > 0 {
+			return errInvalidHeader
+		}
+	}
+
 	if len(paxHeaders) > 0 {
 		if !allowPax {
 			return errInvalidHeader
@@ -263,13 +360,107 @@ func (tw *Writer) writeHeader(hdr *Header, allowPax bool) error {
 			return err
 		}
 	}
-	tw.nb = int64(hdr.Size)
-	tw.pad = (blockSize - (tw.nb % blockSize)) % blockSize
+	if longName != "" {
+		if err := tw.writeGNULongName(TypeGNULongName, longName); err != nil {
+			return err
+		}
+	}
+	if longLink != "" {
+		if err := tw.writeGNULongName(TypeGNULongLink, longLink); err != nil {
+			return err
+		}
+	}
+	tw.nb = logicalSize
+	tw.pad = (blockSize - (hdr.Size % blockSize)) % blockSize
+	tw.holes, tw.off = holes, 0
 
-	_, tw.err = tw.w.Write(header)
+	if _, tw.err = tw.w.Write(header); tw.err != nil {
+		return tw.err
+	}
+	if sparseMap != nil {
+		// The sparse map precedes the file data and is itself
+		// a whole number of blocks, so it leaves tw.pad unchanged.
+		_, tw.err = tw.w.Write(sparseMap)
+	}
 	return tw.err
 }
 
+// encodeSparseMap validates the holes of the sparse file described by
+// hdr. It returns them without empty holes, along with the file's
+// sparse map in the PAX 1.0 format and the number of bytes that the
+// map and the data regions take up in the archive.
+func encodeSparseMap(hdr *Header) (holes []SparseEntry, sparseMap []byte, size int64, err error) {
+	if hdr.Typeflag != TypeReg && hdr.Typeflag != TypeRegA {
+		return nil, nil, 0, errSparseHoles
+	}
+	// The data regions are the gaps between the holes.
+	var data []SparseEntry
+	var off int64
+	for _, h := range hdr.SparseHoles {
+		if h.Offset < off || h.Length < 0 || h.Offset+h.Length > hdr.Size {
+			return nil, nil, 0, errSparseHoles
+		}
+		if h.Length == 0 {
+			continue
+		}
+		if h.Offset > off {
+			data = append(data, SparseEntry{off, h.Offset - off})
+		}
+		holes = append(holes, h)
+		off = h.Offset + h.Length
+	}
+	// Like GNU tar, always end the map with a data region, even
+	// an empty one, so that it reaches the end of the file.
+	data = append(data, SparseEntry{off, hdr.Size - off})
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d\n", len(data))
+	for _, d := range data {
+		fmt.Fprintf(&buf, "%d\n%d\n", d.Offset, d.Length)
+		size += d.Length
+	}
+	if n := buf.Len() % blockSize; n > 0 {
+		buf.Write(zeroBlock[n:])
+	}
+	return holes, buf.Bytes(), size + int64(buf.Len()), nil
+}
+
+// writeGNULongName writes a GNU long name or long link entry
+// holding name, which precedes the entry it applies to.
+func (tw *Writer) writeGNULongName(typeflag byte, name string) error {
+	ext := &Header{
+		Name:     "././@LongLink",
+		Typeflag: typeflag,
+		Size:     int64(len(name)) + 1,
+	}
+	if err := tw.writeHeader(ext, false); err != nil {
+		return err
+	}
+	if _, err := tw.Write([]byte(name + "\x00")); err != nil {
+		return err
+	}
+	return tw.Flush()
+}
+
+// formatPAXTime formats t as a PAX time: the seconds since the epoch,
+// with as many fractional digits as needed.
+func formatPAXTime(t time.Time) string {
+	sec, nsec := t.Unix(), int64(t.Nanosecond())
+	if nsec == 0 {
+		return strconv.FormatInt(sec, 10)
+	}
+	sign := ""
+	if sec < 0 {
+		// Unix rounds toward negative infinity; the
+		// fraction follows the sign instead.
+		sign = "-"
+		sec = -(sec + 1)
+		nsec = 1e9 - nsec
+	}
+	frac := strings.TrimRight(fmt.Sprintf("%09d", nsec), "0")
+	return fmt.Sprintf("%s%d.%s", sign, sec, frac)
+}
+
 // writeUSTARLongName splits a USTAR long name hdr.Name.
 // name must be < 256 characters. errNameTooLong is returned
 // if hdr.Name can't be split. The splitting heuristic
@@ -363,7 +554,11 @@ func (tw *Writer) Write(b []byte) (n int, err error) {
 		b = b[0:tw.nb]
 		overwrite = true
 	}
-	n, err = tw.w.Write(b)
+	if tw.holes != nil {
+		n, err = tw.writeSparse(b)
+	} else {
+		n, err = tw.w.Write(b)
+	}
 	tw.nb -= int64(n)
 	if err == nil && overwrite {
 		err = ErrWriteTooLong
@@ -373,6 +568,45 @@ func (tw *Writer) Write(b []byte) (n int, err error) {
 	return
 }
 
+// writeSparse writes b at the current logical offset of a sparse file
+// entry, storing only the bytes that fall outside the holes.
+func (tw *Writer) writeSparse(b []byte) (n int, err error) {
+	for len(b) > 0 {
+		if len(tw.holes) > 0 && tw.off >= tw.holes[0].Offset {
+			// In a hole: check the bytes and skip them.
+			end := tw.holes[0].Offset + tw.holes[0].Length
+			chunk := b
+			if int64(len(chunk)) > end-tw.off {
+				chunk = chunk[:end-tw.off]
+			}
+			for _, c := range chunk {
+				if c != 0 {
+					return n, errWriteHole
+				}
+			}
+			n += len(chunk)
+			tw.off += int64(len(chunk))
+			b = b[len(chunk):]
+			if tw.off == end {
+				tw.holes = tw.holes[1:]
+			}
+			continue
+		}
+		chunk := b
+		if len(tw.holes) > 0 && int64(len(chunk)) > tw.holes[0].Offset-tw.off {
+			chunk = chunk[:tw.holes[0].Offset-tw.off]
+		}
+		nw, err := tw.w.Write(chunk)
+		n += nw
+		tw.off += int64(nw)
+		b = b[nw:]
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
 // Close closes the tar archive, flushing any unwritten
 // data to the underlying writer.
 func (tw *Writer) Close() error {
@@ -489,3 +489,294 @@ func TestValidTypeflagWithPAXHeader(t *testing.T) {
 		}
 	}
 }
+
+func TestSparseWriter(t *testing.T) {
+	const size = 1 << 20
+	holes := []SparseEntry{{0, 4096}, {8192, 0}, {10000, size - 10000 - 100}, {size - 50, 50}}
+	data := make([]byte, size)
+	for i := 4096; i < 10000; i++ {
+		data[i] = byte(i)
+	}
+	for i := size - 100; i < size-50; i++ {
+		data[i] = 'x'
+	}
+
+	var buf bytes.Buffer
+	tw := NewWriter(&buf)
+	hdr := &Header{
+		Name:        "disk.img",
+		Mode:        0644,
+		Size:        size,
+		Typeflag:    TypeReg,
+		SparseHoles: holes,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatal(err)
+	}
+	// Write in odd-sized pieces to cross the hole boundaries.
+	for b := data; len(b) > 0; {
+		n := 3333
+		if n > len(b) {
+			n = len(b)
+		}
+		if _, err := tw.Write(b[:n]); err != nil {
+			t.Fatal(err)
+		}
+		b = b[n:]
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() > 32*blockSize {
+		t.Errorf("archive is %d bytes; want the holes left out", buf.Len())
+	}
+
+	tr := NewReader(&buf)
+	got, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != hdr.Name || got.Size != size {
+		t.Errorf("got name %q, size %d; want %q, %d", got.Name, got.Size, hdr.Name, size)
+	}
+	want := []SparseEntry{{0, 4096}, {10000, size - 10000 - 100}, {size - 50, 50}}
+	if !reflect.DeepEqual(got.SparseHoles, want) {
+		t.Errorf("got holes %v; want %v", got.SparseHoles, want)
+	}
+	rdata, err := ioutil.ReadAll(tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rdata, data) {
+		t.Error("sparse file contents differ")
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Errorf("got %v after the sparse file; want EOF", err)
+	}
+}
+
+// Copying an archive entry by entry must keep sparse files sparse,
+// whatever format they were read in.
+func TestSparseRoundTrip(t *testing.T) {
+	f, err := os.Open("testdata/sparse-formats.tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	type entry struct {
+		hdr  *Header
+		data []byte
+	}
+	var entries []entry
+	var buf bytes.Buffer
+	tr := NewReader(f)
+	tw := NewWriter(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry{hdr, data})
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("WriteHeader(%q): %v", hdr.Name, err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatalf("Write(%q): %v", hdr.Name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tr = NewReader(&buf)
+	for _, e := range entries {
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name != e.hdr.Name || hdr.Size != e.hdr.Size {
+			t.Errorf("got %q of size %d; want %q of size %d", hdr.Name, hdr.Size, e.hdr.Name, e.hdr.Size)
+		}
+		if !reflect.DeepEqual(hdr.SparseHoles, e.hdr.SparseHoles) {
+			t.Errorf("%s: got holes %v; want %v", hdr.Name, hdr.SparseHoles, e.hdr.SparseHoles)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, e.data) {
+			t.Errorf("%s: contents differ", hdr.Name)
+		}
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Errorf("got %v after the last entry; want EOF", err)
+	}
+}
+
+func TestSparseWriterErrors(t *testing.T) {
+	tests := []struct {
+		hdr  Header
+		data []byte
+		err  error
+	}{
+		{
+			hdr: Header{Name: "f", Size: 4, Typeflag: TypeReg, SparseHoles: []SparseEntry{{0, 2}}, Format: FormatGNU},
+			err: errSparseFormat,
+		},
+		{
+			hdr: Header{Name: "f", Size: 4, Typeflag: TypeReg, SparseHoles: []SparseEntry{{2, 3}}},
+			err: errSparseHoles,
+		},
+		{
+			hdr: Header{Name: "f", Size: 4, Typeflag: TypeReg, SparseHoles: []SparseEntry{{2, 1}, {1, 1}}},
+			err: errSparseHoles,
+		},
+		{
+			hdr: Header{Name: "f", Typeflag: TypeDir, SparseHoles: []SparseEntry{{0, 0}}},
+			err: errSparseHoles,
+		},
+		{
+			hdr:  Header{Name: "f", Size: 4, Typeflag: TypeReg, SparseHoles: []SparseEntry{{1, 2}}},
+			data: []byte("a\x00b!"),
+			err:  errWriteHole,
+		},
+	}
+	for i, tt := range tests {
+		tw := NewWriter(ioutil.Discard)
+		err := tw.WriteHeader(&tt.hdr)
+		if err == nil {
+			_, err = tw.Write(tt.data)
+		}
+		if err != tt.err {
+			t.Errorf("test %d: got %v; want %v", i, err, tt.err)
+		}
+	}
+}
+
+func TestWriterFormats(t *testing.T) {
+	longName := strings.Repeat("d/", 60) + "file"
+	nonASCII := "☺.txt"
+	mtime := time.Unix(1400000000, 123456789)
+	atime := time.Unix(1400000001, 500000000)
+	ctime := time.Unix(-1, -500000000)
+	tests := []struct {
+		hdr  Header
+		want *Header // nil if WriteHeader should fail
+	}{{
+		hdr:  Header{Name: "big-uid", Uid: 1 << 30, Typeflag: TypeReg, Format: FormatUSTAR},
+		want: nil,
+	}, {
+		hdr:  Header{Name: nonASCII, Typeflag: TypeReg, Format: FormatUSTAR},
+		want: nil,
+	}, {
+		hdr:  Header{Name: longName, Typeflag: TypeReg, Format: FormatUSTAR},
+		want: &Header{Name: longName, Typeflag: TypeReg},
+	}, {
+		hdr:  Header{Name: "x", Uname: strings.Repeat("u", 40), Typeflag: TypeReg, Format: FormatGNU},
+		want: nil,
+	}, {
+		hdr: Header{
+			Name:     strings.Repeat("n", 150),
+			Linkname: strings.Repeat("l", 150),
+			Uid:      1 << 30,
+			Typeflag: TypeSymlink,
+			Format:   FormatGNU,
+		},
+		want: &Header{
+			Name:     strings.Repeat("n", 150),
+			Linkname: strings.Repeat("l", 150),
+			Uid:      1 << 30,
+			Typeflag: TypeSymlink,
+		},
+	}, {
+		hdr:  Header{Name: nonASCII, Typeflag: TypeReg, Format: FormatGNU},
+		want: &Header{Name: nonASCII, Typeflag: TypeReg},
+	}, {
+		hdr: Header{
+			Name:       "times",
+			Uid:        1 << 30,
+			Gid:        1 << 31,
+			ModTime:    mtime,
+			AccessTime: atime,
+			ChangeTime: ctime,
+			Typeflag:   TypeReg,
+			Format:     FormatPAX,
+		},
+		want: &Header{
+			Name:       "times",
+			Uid:        1 << 30,
+			Gid:        1 << 31,
+			ModTime:    mtime,
+			AccessTime: atime,
+			ChangeTime: ctime,
+			Typeflag:   TypeReg,
+		},
+	}}
+	for i, tt := range tests {
+		var buf bytes.Buffer
+		tw := NewWriter(&buf)
+		err := tw.WriteHeader(&tt.hdr)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("test %d: %v header %q written; want error", i, tt.hdr.Format, tt.hdr.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		got, err := NewReader(&buf).Next()
+		if err != nil {
+			t.Errorf("test %d: %v", i, err)
+			continue
+		}
+		if got.Name != tt.want.Name || got.Linkname != tt.want.Linkname ||
+			got.Uid != tt.want.Uid || got.Gid != tt.want.Gid || got.Typeflag != tt.want.Typeflag {
+			t.Errorf("test %d: got %+v; want %+v", i, got, tt.want)
+		}
+		if !tt.want.ModTime.IsZero() && !got.ModTime.Equal(tt.want.ModTime) {
+			t.Errorf("test %d: got mtime %v; want %v", i, got.ModTime, tt.want.ModTime)
+		}
+		if !got.AccessTime.Equal(tt.want.AccessTime) {
+			t.Errorf("test %d: got atime %v; want %v", i, got.AccessTime, tt.want.AccessTime)
+		}
+		if !got.ChangeTime.Equal(tt.want.ChangeTime) {
+			t.Errorf("test %d: got ctime %v; want %v", i, got.ChangeTime, tt.want.ChangeTime)
+		}
+	}
+}
+
+func TestFormatPAXTime(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		want string
+	}{
+		{time.Unix(1350244992, 0), "1350244992"},
+		{time.Unix(1350244992, 23960100), "1350244992.0239601"},
+		{time.Unix(1350244992, 300000000), "1350244992.3"},
+		{time.Unix(-1, -500000000), "-1.5"},
+		{time.Unix(0, -1), "-0.000000001"},
+	}
+	for _, tt := range tests {
+		got := formatPAXTime(tt.t)
+		if got != tt.want {
+			t.Errorf("formatPAXTime(%v) = %q; want %q", tt.t, got, tt.want)
+		}
+		back, err := parsePAXTime(got)
+		if err != nil || !back.Equal(tt.t) {
+			t.Errorf("parsePAXTime(%q) = %v, %v; want %v", got, back, err, tt.t)
+		}
+	}
+}
@@ -7,6 +7,8 @@ package zip_test
 import (
 	"archive/zip"
 	"bytes"
+	"compress/xz"
+	"compress/zstd"
 	"fmt"
 	"io"
 	"log"
@@ -73,3 +75,10 @@ func ExampleReader() {
 	// Contents of README:
 	// This is the source code repository for the Go programming language.
 }
+
+func ExampleRegisterDecompressor() {
+	// Register the Zstandard and xz decompressors, usually in an init
+	// function, so that entries compressed with them can be read.
+	zip.RegisterDecompressor(zip.Zstd, zstd.NewReader)
+	zip.RegisterDecompressor(zip.XZ, xz.NewReader)
+}
@@ -12,18 +12,21 @@ import (
 	"hash/crc32"
 	"io"
 	"os"
+	"time"
 )
 
 var (
 	ErrFormat    = errors.New("zip: not a valid zip file")
 	ErrAlgorithm = errors.New("zip: unsupported compression algorithm")
 	ErrChecksum  = errors.New("zip: checksum error")
+	ErrPassword  = errors.New("zip: invalid password")
 )
 
 type Reader struct {
-	r       io.ReaderAt
-	File    []*File
-	Comment string
+	r         io.ReaderAt
+	File      []*File
+	Comment   string
+	dirOffset int64 // offset of the central directory
 }
 
 type ReadCloser struct {
@@ -80,6 +83,7 @@ func (z *Reader) init(r io.ReaderAt, size int64) error {
 	z.r = r
 	z.File = make([]*File, 0, end.directoryRecords)
 	z.Comment = end.comment
+	z.dirOffset = int64(end.directoryOffset)
 	rs := io.NewSectionReader(r, 0, size)
 	if _, err = rs.Seek(int64(end.directoryOffset), os.SEEK_SET); err != nil {
 		return err
@@ -129,14 +133,44 @@ func (f *File) DataOffset() (offset int64, err error) {
 
 // Open returns a ReadCloser that provides access to the File's contents.
 // Multiple files may be read concurrently.
+// Encrypted files are opened with an empty password; see OpenPassword.
 func (f *File) Open() (rc io.ReadCloser, err error) {
+	return f.OpenPassword("")
+}
+
+// OpenPassword is like Open but decrypts the contents of an encrypted
+// File with password, using the Decrypter registered for its encryption
+// method. It returns ErrAlgorithm if there is none.
+func (f *File) OpenPassword(password string) (rc io.ReadCloser, err error) {
 	bodyOffset, err := f.findBodyOffset()
 	if err != nil {
 		return
 	}
 	size := int64(f.CompressedSize64)
-	r := io.NewSectionReader(f.zipr, f.headerOffset+bodyOffset, size)
-	dcomp := decompressor(f.Method)
+	var r io.Reader = io.NewSectionReader(f.zipr, f.headerOffset+bodyOffset, size)
+	method, checkCRC := f.Method, true
+	if f.isEncrypted() {
+		enc := ZipCrypto
+		if f.Method == winZipAESMethod {
+			enc = WinZipAES
+			var version uint16
+			if version, method, err = f.aesExtra(); err != nil {
+				return
+			}
+			// AE-2 sets the CRC-32 to zero and relies on
+			// the authentication code instead.
+			checkCRC = version != 2
+		}
+		dec := decrypter(enc)
+		if dec == nil {
+			err = ErrAlgorithm
+			return
+		}
+		if r, err = dec(r, &f.FileHeader, password); err != nil {
+			return
+		}
+	}
+	dcomp := decompressor(method)
 	if dcomp == nil {
 		err = ErrAlgorithm
 		return
@@ -146,16 +180,55 @@ func (f *File) Open() (rc io.ReadCloser, err error) {
 	if f.hasDataDescriptor() {
 		desr = io.NewSectionReader(f.zipr, f.headerOffset+bodyOffset+size, dataDescriptorLen)
 	}
-	rc = &checksumReader{rc, crc32.NewIEEE(), f, desr, nil}
+	rc = &checksumReader{
+		rc:       rc,
+		hash:     crc32.NewIEEE(),
+		f:        f,
+		desr:     desr,
+		checkCRC: checkCRC,
+	}
 	return
 }
 
+// aesExtra returns the vendor version (1 for AE-1, 2 for AE-2) and the
+// actual compression method from the WinZip AES extra field.
+func (f *File) aesExtra() (version, method uint16, err error) {
+	b := readBuf(f.Extra)
+	for len(b) >= 4 {
+		tag := b.uint16()
+		size := int(b.uint16())
+		if size > len(b) {
+			break
+		}
+		if tag == winzipAesExtraId && size >= 7 {
+			eb := readBuf(b[:size])
+			version = eb.uint16()
+			eb = eb[3:] // skip vendor ID "AE" and key strength
+			return version, eb.uint16(), nil
+		}
+		b = b[size:]
+	}
+	return 0, 0, ErrFormat
+}
+
+// OpenRaw returns a Reader that provides access to the File's contents
+// without decompression.
+func (f *File) OpenRaw() (io.Reader, error) {
+	bodyOffset, err := f.findBodyOffset()
+	if err != nil {
+		return nil, err
+	}
+	r := io.NewSectionReader(f.zipr, f.headerOffset+bodyOffset, int64(f.CompressedSize64))
+	return r, nil
+}
+
 type checksumReader struct {
-	rc   io.ReadCloser
-	hash hash.Hash32
-	f    *File
-	desr io.Reader // if non-nil, where to read the data descriptor
-	err  error     // sticky error
+	rc       io.ReadCloser
+	hash     hash.Hash32
+	f        *File
+	desr     io.Reader // if non-nil, where to read the data descriptor
+	checkCRC bool      // whether to verify the CRC-32 at EOF
+	err      error     // sticky error
 }
 
 func (r *checksumReader) Read(b []byte) (n int, err error) {
@@ -167,7 +240,7 @@ func (r *checksumReader) Read(b []byte) (n int, err error) {
 	if err == nil {
 		return
 	}
-	if err == io.EOF {
+	if err == io.EOF && r.checkCRC {
 		if r.desr != nil {
 			if err1 := readDataDescriptor(r.desr, r.f); err1 != nil {
 				err = err1
@@ -243,6 +316,22 @@ func readDirectoryHeader(f *File, r io.Reader) error {
 	f.Extra = d[filenameLen : filenameLen+extraLen]
 	f.Comment = string(d[filenameLen+extraLen:])
 
+	utf8Valid1, utf8Require1 := detectUTF8(f.Name)
+	utf8Valid2, utf8Require2 := detectUTF8(f.Comment)
+	switch {
+	case !utf8Valid1 || !utf8Valid2:
+		// Name and Comment are definitely not UTF-8.
+		f.NonUTF8 = true
+	case !utf8Require1 && !utf8Require2:
+		// Name and Comment read the same in UTF-8 and common code pages.
+		f.NonUTF8 = false
+	default:
+		// Valid UTF-8 may still be in another encoding, such as
+		// Shift-JIS; trust the flag.
+		f.NonUTF8 = f.Flags&0x800 == 0
+	}
+
+	var modified time.Time
 	if len(f.Extra) > 0 {
 		b := readBuf(f.Extra)
 		for len(b) >= 4 { // need at least tag and size
@@ -264,6 +353,9 @@ func readDirectoryHeader(f *File, r io.Reader) error {
 					f.headerOffset = int64(eb.uint64())
 				}
 			}
+			if t, ok := extraModTime(tag, b[:size]); ok {
+				modified = t
+			}
 			b = b[size:]
 		}
 		// Should have consumed the whole header.
@@ -276,9 +368,58 @@ func readDirectoryHeader(f *File, r io.Reader) error {
 			}
 		}
 	}
+	if modified.IsZero() {
+		modified = f.ModTime()
+	}
+	f.Modified = modified.UTC()
 	return nil
 }
 
+// ntfsEpoch is the start of NTFS time, counted in 100ns ticks.
+var ntfsEpoch = time.Date(1601, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// extraModTime returns the modification time stored in the extra field
+// with the given tag and data, if it is a timestamp field holding one.
+func extraModTime(tag uint16, data []byte) (time.Time, bool) {
+	b := readBuf(data)
+	switch tag {
+	case extTimeExtraId:
+		// flags, then the times they select, modification time first
+		if len(b) < 5 || b[0]&0x1 == 0 {
+			break
+		}
+		b = b[1:]
+		return time.Unix(int64(b.uint32()), 0), true
+	case ntfsExtraId:
+		if len(b) < 4 {
+			break
+		}
+		b = b[4:] // reserved
+		for len(b) >= 4 {
+			attrTag := b.uint16()
+			attrSize := int(b.uint16())
+			if attrSize > len(b) {
+				break
+			}
+			if attrTag == 1 && attrSize >= 8 {
+				// modification, access and creation times
+				ticks := int64(binary.LittleEndian.Uint64(b))
+				secs, rem := ticks/1e7, ticks%1e7
+				return time.Unix(ntfsEpoch.Unix()+secs, rem*100), true
+			}
+			b = b[attrSize:]
+		}
+	case unixExtraId, infoZipUnixExtraId:
+		// access time, then modification time
+		if len(b) < 8 {
+			break
+		}
+		b = b[4:]
+		return time.Unix(int64(b.uint32()), 0), true
+	}
+	return time.Time{}, false
+}
+
 func readDataDescriptor(r io.Reader, f *File) error {
 	var buf [dataDescriptorLen]byte
 
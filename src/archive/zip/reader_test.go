@@ -30,8 +30,9 @@ type ZipTestFile struct {
 	Name       string
 	Content    []byte // if blank, will attempt to compare against File
 	ContentErr error
-	File       string // name of file to compare to (relative to testdata/)
-	Mtime      string // modified time in format "mm-dd-yy hh:mm:ss"
+	File       string    // name of file to compare to (relative to testdata/)
+	Mtime      string    // modified time in format "mm-dd-yy hh:mm:ss"
+	Modified   time.Time // if non-zero, the expected Modified field
 	Mode       os.FileMode
 }
 
@@ -51,16 +52,18 @@ var tests = []ZipTest{
 		Comment: "This is a zipfile comment.",
 		File: []ZipTestFile{
 			{
-				Name:    "test.txt",
-				Content: []byte("This is a test text file.\n"),
-				Mtime:   "09-05-10 12:12:02",
-				Mode:    0644,
+				Name:     "test.txt",
+				Content:  []byte("This is a test text file.\n"),
+				Mtime:    "09-05-10 12:12:02",
+				Modified: time.Date(2010, 9, 5, 2, 12, 1, 0, time.UTC),
+				Mode:     0644,
 			},
 			{
-				Name:  "gophercolor16x16.png",
-				File:  "gophercolor16x16.png",
-				Mtime: "09-05-10 15:52:58",
-				Mode:  0644,
+				Name:     "gophercolor16x16.png",
+				File:     "gophercolor16x16.png",
+				Mtime:    "09-05-10 15:52:58",
+				Modified: time.Date(2010, 9, 5, 5, 52, 58, 0, time.UTC),
+				Mode:     0644,
 			},
 		},
 	},
@@ -353,6 +356,9 @@ func readTestFile(t *testing.T, zt ZipTest, ft ZipTestFile, f *File) {
 			t.Errorf("%s: %s: mtime=%s, want %s", zt.Name, f.Name, ft, mtime)
 		}
 	}
+	if !ft.Modified.IsZero() && f.Modified != ft.Modified {
+		t.Errorf("%s: %s: Modified=%s, want %s", zt.Name, f.Name, f.Modified, ft.Modified)
+	}
 
 	testFileMode(t, zt.Name, f, ft.Mode)
 
@@ -531,3 +537,153 @@ func TestIssue8186(t *testing.T) {
 		}
 	}
 }
+
+func TestZipCrypto(t *testing.T) {
+	r, err := OpenReader("testdata/crypto.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	want := map[string]string{
+		"secret.txt": strings.Repeat("This is a secret text file.\n", 8),
+		"short.txt":  "stored\n",
+	}
+	for _, f := range r.File {
+		if _, err := f.Open(); err != ErrPassword {
+			t.Errorf("%s: Open = %v, want ErrPassword", f.Name, err)
+		}
+		if _, err := f.OpenPassword("gopher"); err != ErrPassword {
+			t.Errorf("%s: OpenPassword with wrong password = %v, want ErrPassword", f.Name, err)
+		}
+		rc, err := f.OpenPassword("golang")
+		if err != nil {
+			t.Errorf("%s: %v", f.Name, err)
+			continue
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Errorf("%s: %v", f.Name, err)
+			continue
+		}
+		if string(b) != want[f.Name] {
+			t.Errorf("%s: got %q, want %q", f.Name, b, want[f.Name])
+		}
+	}
+}
+
+// xorAESDecrypter stands in for a WinZip AES implementation: the
+// contents are a one-byte password check followed by the data XORed
+// with the password.
+func xorAESDecrypter(r io.Reader, fh *FileHeader, password string) (io.Reader, error) {
+	if password == "" {
+		return nil, ErrPassword
+	}
+	var check [1]byte
+	if _, err := io.ReadFull(r, check[:]); err != nil {
+		return nil, err
+	}
+	if check[0] != password[0] {
+		return nil, ErrPassword
+	}
+	return &xorReader{r, password[0]}, nil
+}
+
+type xorReader struct {
+	r io.Reader
+	k byte
+}
+
+func (x *xorReader) Read(b []byte) (int, error) {
+	n, err := x.r.Read(b)
+	for i := range b[:n] {
+		b[i] ^= x.k
+	}
+	return n, err
+}
+
+func TestDecrypter(t *testing.T) {
+	const content = "This is a test text file.\n"
+	raw := append([]byte{'k'}, content...)
+	for i := range raw[1:] {
+		raw[1+i] ^= 'k'
+	}
+
+	var zbuf bytes.Buffer
+	w := NewWriter(&zbuf)
+	fh := &FileHeader{
+		Name:               "secret.txt",
+		Flags:              0x1,
+		Method:             winZipAESMethod,
+		CompressedSize64:   uint64(len(raw)),
+		UncompressedSize64: uint64(len(content)),
+		// AE-2, AES-256, stored
+		Extra: []byte{0x01, 0x99, 7, 0, 2, 0, 'A', 'E', 3, 0, 0},
+	}
+	fw, err := w.CreateRaw(fh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write(raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(bytes.NewReader(zbuf.Bytes()), int64(zbuf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := r.File[0]
+	if _, err := f.OpenPassword("key"); err != ErrAlgorithm {
+		t.Fatalf("OpenPassword without decrypter = %v, want ErrAlgorithm", err)
+	}
+	if _, err := f.Open(); err != ErrAlgorithm {
+		t.Fatalf("Open without decrypter = %v, want ErrAlgorithm", err)
+	}
+
+	RegisterDecrypter(WinZipAES, xorAESDecrypter)
+	if _, err := f.OpenPassword("password"); err != ErrPassword {
+		t.Errorf("OpenPassword with wrong password = %v, want ErrPassword", err)
+	}
+	rc, err := f.OpenPassword("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != content {
+		t.Errorf("got %q, want %q", b, content)
+	}
+}
+
+func TestReadNTFSTime(t *testing.T) {
+	want := time.Date(2015, 6, 1, 12, 34, 56, 789012300, time.UTC)
+	ticks := uint64((want.Unix()-ntfsEpoch.Unix())*1e7 + int64(want.Nanosecond()/100))
+	extra := []byte{0x0a, 0x00, 32, 0, 0, 0, 0, 0, 1, 0, 24, 0}
+	for i := 0; i < 3; i++ {
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], ticks)
+		extra = append(extra, b[:]...)
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if _, err := w.CreateHeader(&FileHeader{Name: "ntfs.txt", Extra: extra}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.File[0].Modified; got != want {
+		t.Errorf("Modified = %v, want %v", got, want)
+	}
+}
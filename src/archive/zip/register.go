@@ -22,6 +22,18 @@ type Compressor func(io.Writer) (io.WriteCloser, error)
 // when they're finished reading.
 type Decompressor func(io.Reader) io.ReadCloser
 
+// Decrypter is a function that wraps a Reader of the raw contents of the
+// encrypted file described by fh with a Reader of the decrypted, but still
+// compressed, contents, using the given password.
+// For ZipCrypto the raw contents start with the 12-byte encryption header.
+// For WinZipAES they include the salt, password verifier and trailing
+// authentication code, and the key strength is found in the WinZip AES
+// extra field of fh.Extra; the returned Reader should report an error
+// instead of io.EOF if authentication fails.
+// A Decrypter should return ErrPassword if it can tell that the password
+// is wrong.
+type Decrypter func(r io.Reader, fh *FileHeader, password string) (io.Reader, error)
+
 var flateWriterPool sync.Pool
 
 func newFlateWriter(w io.Writer) io.WriteCloser {
@@ -61,7 +73,7 @@ func (w *pooledFlateWriter) Close() error {
 }
 
 var (
-	mu sync.RWMutex // guards compressor and decompressor maps
+	mu sync.RWMutex // guards compressor, decompressor and decrypter maps
 
 	compressors = map[uint16]Compressor{
 		Store:   func(w io.Writer) (io.WriteCloser, error) { return &nopCloser{w}, nil },
@@ -72,6 +84,10 @@ var (
 		Store:   ioutil.NopCloser,
 		Deflate: flate.NewReader,
 	}
+
+	decrypters = map[EncryptionMethod]Decrypter{
+		ZipCrypto: newZipCryptoReader,
+	}
 )
 
 // RegisterDecompressor allows custom decompressors for a specified method ID.
@@ -85,6 +101,21 @@ func RegisterDecompressor(method uint16, d Decompressor) {
 	decompressors[method] = d
 }
 
+// RegisterDecrypter allows custom decrypters for a specified encryption
+// method. ZipCrypto is built in; WinZipAES, which needs AES-CTR
+// decryption and an HMAC-SHA1 check keyed with PBKDF2, is not, and
+// files encrypted with it can only be read once a Decrypter for it is
+// registered.
+func RegisterDecrypter(method EncryptionMethod, d Decrypter) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := decrypters[method]; ok {
+		panic("decrypter already registered")
+	}
+	decrypters[method] = d
+}
+
 // RegisterCompressor registers custom compressors for a specified method ID.
 // The common methods Store and Deflate are built in.
 func RegisterCompressor(method uint16, comp Compressor) {
@@ -108,3 +139,9 @@ func decompressor(method uint16) Decompressor {
 	defer mu.RUnlock()
 	return decompressors[method]
 }
+
+func decrypter(method EncryptionMethod) Decrypter {
+	mu.RLock()
+	defer mu.RUnlock()
+	return decrypters[method]
+}
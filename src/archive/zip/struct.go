@@ -29,8 +29,34 @@ import (
 const (
 	Store   uint16 = 0
 	Deflate uint16 = 8
+
+	// Methods without a built-in decompressor. The decompressors in
+	// compress/zstd and compress/xz can be registered for them with
+	// RegisterDecompressor.
+	Zstd uint16 = 93
+	XZ   uint16 = 95
+)
+
+// An EncryptionMethod identifies how an encrypted file is encrypted,
+// for RegisterDecrypter. Encryption methods are not compression methods.
+type EncryptionMethod uint16
+
+// Encryption methods.
+const (
+	// ZipCrypto is the traditional PKWARE encryption. A Decrypter
+	// for it is built in.
+	ZipCrypto EncryptionMethod = 1
+
+	// WinZipAES is WinZip's AES encryption. No Decrypter for it is
+	// built in; opening a file encrypted with it returns
+	// ErrAlgorithm unless one is registered with RegisterDecrypter.
+	WinZipAES EncryptionMethod = 99
 )
 
+// winZipAESMethod is the compression method recorded for files
+// encrypted with WinZipAES; the actual one is in their extra field.
+const winZipAESMethod uint16 = 99
+
 const (
 	fileHeaderSignature      = 0x04034b50
 	directoryHeaderSignature = 0x02014b50
@@ -62,7 +88,12 @@ const (
 	uint32max = (1 << 32) - 1
 
 	// extra header id's
-	zip64ExtraId = 0x0001 // zip64 Extended Information Extra Field
+	zip64ExtraId       = 0x0001 // zip64 Extended Information Extra Field
+	ntfsExtraId        = 0x000a // NTFS Extra Field
+	unixExtraId        = 0x000d // UNIX Extra Field
+	extTimeExtraId     = 0x5455 // Extended Timestamp Extra Field
+	infoZipUnixExtraId = 0x5855 // Info-ZIP UNIX Extra Field (original)
+	winzipAesExtraId   = 0x9901 // WinZip AES Extra Field
 )
 
 // FileHeader describes a file within a zip file.
@@ -74,12 +105,34 @@ type FileHeader struct {
 	// are allowed.
 	Name string
 
-	CreatorVersion     uint16
-	ReaderVersion      uint16
-	Flags              uint16
-	Method             uint16
-	ModifiedTime       uint16 // MS-DOS time
-	ModifiedDate       uint16 // MS-DOS date
+	// Comment is any arbitrary user-defined string shorter than 64KiB.
+	Comment string
+
+	// NonUTF8 indicates that Name and Comment are not encoded in UTF-8.
+	//
+	// The zip format marks UTF-8 names with a flag; other names are in
+	// the archiver's local code page. When reading, NonUTF8 is set if
+	// Name or Comment is not valid UTF-8, or if the flag is unset and
+	// they contain characters that code pages disagree on. When
+	// writing, setting NonUTF8 keeps the flag clear.
+	NonUTF8 bool
+
+	CreatorVersion uint16
+	ReaderVersion  uint16
+	Flags          uint16
+	Method         uint16
+
+	// Modified is the modification time of the file.
+	//
+	// When reading, it is taken from the extended timestamp, NTFS or
+	// UNIX extra fields if present, and from the MS-DOS fields
+	// otherwise, and is always in UTC. When writing, a non-zero
+	// Modified sets the MS-DOS fields and is stored in an extended
+	// timestamp extra field with one second resolution.
+	Modified time.Time
+
+	ModifiedTime       uint16 // MS-DOS time (deprecated; use Modified)
+	ModifiedDate       uint16 // MS-DOS date (deprecated; use Modified)
 	CRC32              uint32
 	CompressedSize     uint32 // deprecated; use CompressedSize64
 	UncompressedSize   uint32 // deprecated; use UncompressedSize64
@@ -87,7 +140,6 @@ type FileHeader struct {
 	UncompressedSize64 uint64
 	Extra              []byte
 	ExternalAttrs      uint32 // Meaning depends on CreatorVersion
-	Comment            string
 }
 
 // FileInfo returns an os.FileInfo for the FileHeader.
@@ -107,10 +159,15 @@ func (fi headerFileInfo) Size() int64 {
 	}
 	return int64(fi.fh.UncompressedSize)
 }
-func (fi headerFileInfo) IsDir() bool        { return fi.Mode().IsDir() }
-func (fi headerFileInfo) ModTime() time.Time { return fi.fh.ModTime() }
-func (fi headerFileInfo) Mode() os.FileMode  { return fi.fh.Mode() }
-func (fi headerFileInfo) Sys() interface{}   { return fi.fh }
+func (fi headerFileInfo) IsDir() bool { return fi.Mode().IsDir() }
+func (fi headerFileInfo) ModTime() time.Time {
+	if fi.fh.Modified.IsZero() {
+		return fi.fh.ModTime()
+	}
+	return fi.fh.Modified.UTC()
+}
+func (fi headerFileInfo) Mode() os.FileMode { return fi.fh.Mode() }
+func (fi headerFileInfo) Sys() interface{}  { return fi.fh }
 
 // FileInfoHeader creates a partially-populated FileHeader from an
 // os.FileInfo.
@@ -174,15 +231,21 @@ func timeToMsDosTime(t time.Time) (fDate uint16, fTime uint16) {
 	return
 }
 
-// ModTime returns the modification time in UTC.
+// ModTime returns the modification time in UTC using the MS-DOS
+// ModifiedDate and ModifiedTime fields.
 // The resolution is 2s.
+//
+// Deprecated: Use Modified instead.
 func (h *FileHeader) ModTime() time.Time {
 	return msDosTimeToTime(h.ModifiedDate, h.ModifiedTime)
 }
 
-// SetModTime sets the ModifiedTime and ModifiedDate fields to the given time in UTC.
-// The resolution is 2s.
+// SetModTime sets the Modified, ModifiedTime and ModifiedDate fields to
+// the given time in UTC.
+//
+// Deprecated: Use Modified instead.
 func (h *FileHeader) SetModTime(t time.Time) {
+	h.Modified = t
 	h.ModifiedDate, h.ModifiedTime = timeToMsDosTime(t)
 }
 
@@ -233,6 +296,11 @@ func (h *FileHeader) SetMode(mode os.FileMode) {
 	}
 }
 
+// isEncrypted reports whether the file contents are encrypted.
+func (fh *FileHeader) isEncrypted() bool {
+	return fh.Flags&0x1 != 0 || fh.Method == winZipAESMethod
+}
+
 // isZip64 returns true if the file size exceeds the 32 bit limit
 func (fh *FileHeader) isZip64() bool {
 	return fh.CompressedSize64 > uint32max || fh.UncompressedSize64 > uint32max
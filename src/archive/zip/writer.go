@@ -11,17 +11,19 @@ import (
 	"hash"
 	"hash/crc32"
 	"io"
+	"os"
+	"unicode/utf8"
 )
 
-// TODO(adg): support zip file comments
 // TODO(adg): support specifying deflate level
 
 // Writer implements a zip file writer.
 type Writer struct {
-	cw     *countWriter
-	dir    []*header
-	last   *fileWriter
-	closed bool
+	cw      *countWriter
+	dir     []*header
+	last    *fileWriter
+	closed  bool
+	comment string
 }
 
 type header struct {
@@ -34,12 +36,57 @@ func NewWriter(w io.Writer) *Writer {
 	return &Writer{cw: &countWriter{w: bufio.NewWriter(w)}}
 }
 
+// NewAppendWriter returns a Writer that adds files to the existing zip
+// file read by r. The files already in r are kept in place; the new
+// files and, on Close, the central directory listing all of them are
+// written over r's central directory. w must write to the same file
+// that r reads; it is positioned with Seek before the first write.
+//
+// The comment of r is kept unless replaced with SetComment. If the
+// result is shorter than the original file, the caller must truncate
+// the file after Close.
+func NewAppendWriter(w io.WriteSeeker, r *Reader) (*Writer, error) {
+	if _, err := w.Seek(r.dirOffset, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+	zw := NewWriter(w)
+	zw.SetOffset(r.dirOffset)
+	for _, f := range r.File {
+		fh := f.FileHeader
+		fh.Extra = stripExtra(fh.Extra, zip64ExtraId)
+		zw.dir = append(zw.dir, &header{FileHeader: &fh, offset: uint64(f.headerOffset)})
+	}
+	zw.comment = r.Comment
+	return zw, nil
+}
+
+// SetOffset sets the offset of the beginning of the zip data within the
+// underlying writer. It should be used when the zip data is appended to an
+// existing file, such as a binary executable.
+// It must be called before any data is written.
+func (w *Writer) SetOffset(n int64) {
+	if w.cw.count != 0 {
+		panic("zip: SetOffset called after data was written")
+	}
+	w.cw.count = n
+}
+
 // Flush flushes any buffered data to the underlying writer.
 // Calling Flush is not normally necessary; calling Close is sufficient.
 func (w *Writer) Flush() error {
 	return w.cw.w.(*bufio.Writer).Flush()
 }
 
+// SetComment sets the end-of-central-directory comment field.
+// It can only be called before Close.
+func (w *Writer) SetComment(comment string) error {
+	if len(comment) > uint16max {
+		return errors.New("zip: Writer.Comment too long")
+	}
+	w.comment = comment
+	return nil
+}
+
 // Close finishes writing the zip file by writing the central directory.
 // It does not (and can not) close the underlying writer.
 func (w *Writer) Close() error {
@@ -158,10 +205,13 @@ func (w *Writer) Close() error {
 	b.uint16(uint16(records)) // number of entries total
 	b.uint32(uint32(size))    // size of directory
 	b.uint32(uint32(offset))  // start of directory
-	// skipped size of comment (always zero)
+	b.uint16(uint16(len(w.comment)))
 	if _, err := w.cw.Write(buf[:]); err != nil {
 		return err
 	}
+	if _, err := io.WriteString(w.cw, w.comment); err != nil {
+		return err
+	}
 
 	return w.cw.w.(*bufio.Writer).Flush()
 }
@@ -172,7 +222,7 @@ func (w *Writer) Close() error {
 // letter (e.g. C:) or leading slash, and only forward slashes are
 // allowed.
 // The file's contents must be written to the io.Writer before the next
-// call to Create, CreateHeader, or Close.
+// call to Create, CreateHeader, CreateRaw, Copy or Close.
 func (w *Writer) Create(name string) (io.Writer, error) {
 	header := &FileHeader{
 		Name:   name,
@@ -185,16 +235,41 @@ func (w *Writer) Create(name string) (io.Writer, error) {
 // for the file metadata.
 // It returns a Writer to which the file contents should be written.
 // The file's contents must be written to the io.Writer before the next
-// call to Create, CreateHeader, or Close.
+// call to Create, CreateHeader, CreateRaw, Copy or Close.
+//
+// If fh.Modified is set, any timestamp extra fields in fh.Extra are
+// replaced with an extended timestamp field holding it.
 func (w *Writer) CreateHeader(fh *FileHeader) (io.Writer, error) {
-	if w.last != nil && !w.last.closed {
-		if err := w.last.close(); err != nil {
-			return nil, err
-		}
+	if err := w.prepare(); err != nil {
+		return nil, err
 	}
 
 	fh.Flags |= 0x8 // we will write a data descriptor
 
+	// Set the UTF-8 flag only if it makes a difference to readers
+	// that would otherwise use a code page, like the zip tools do.
+	utf8Valid1, utf8Require1 := detectUTF8(fh.Name)
+	utf8Valid2, utf8Require2 := detectUTF8(fh.Comment)
+	switch {
+	case fh.NonUTF8:
+		fh.Flags &^= 0x800
+	case (utf8Require1 || utf8Require2) && utf8Valid1 && utf8Valid2:
+		fh.Flags |= 0x800
+	}
+
+	if !fh.Modified.IsZero() {
+		fh.ModifiedDate, fh.ModifiedTime = timeToMsDosTime(fh.Modified)
+
+		var buf [9]byte // 2x uint16 + uint8 + uint32
+		eb := writeBuf(buf[:])
+		eb.uint16(extTimeExtraId)
+		eb.uint16(5) // size = uint8 + uint32
+		eb.uint8(1)  // flags: modification time only
+		eb.uint32(uint32(fh.Modified.Unix()))
+		fh.Extra = stripExtra(fh.Extra, ntfsExtraId, unixExtraId, extTimeExtraId, infoZipUnixExtraId)
+		fh.Extra = append(fh.Extra, buf[:]...)
+	}
+
 	fh.CreatorVersion = fh.CreatorVersion&0xff00 | zipVersion20 // preserve compatibility byte
 	fh.ReaderVersion = zipVersion20
 
@@ -229,6 +304,126 @@ func (w *Writer) CreateHeader(fh *FileHeader) (io.Writer, error) {
 	return fw, nil
 }
 
+// CreateRaw adds a file to the zip archive using the provided FileHeader
+// and returns a Writer to which the file contents should be written.
+// Unlike with CreateHeader, the bytes passed to the Writer are not
+// compressed: they must already be compressed with fh.Method, and
+// fh.CRC32, fh.CompressedSize64 and fh.UncompressedSize64 must be set
+// to describe them.
+// The file's contents must be written to the io.Writer before the next
+// call to Create, CreateHeader, CreateRaw, Copy or Close.
+func (w *Writer) CreateRaw(fh *FileHeader) (io.Writer, error) {
+	if err := w.prepare(); err != nil {
+		return nil, err
+	}
+
+	// Work on a copy: the header is kept until Close and the
+	// caller may reuse fh, as Copy does with a Reader's File.
+	h := &header{
+		FileHeader: new(FileHeader),
+		offset:     uint64(w.cw.count),
+	}
+	*h.FileHeader = *fh
+	fh = h.FileHeader
+	fh.Extra = stripExtra(fh.Extra, zip64ExtraId)
+	if fh.isZip64() {
+		// Sizes that need 64 bits go in a data descriptor.
+		fh.Flags |= 0x8
+		fh.CompressedSize = uint32max
+		fh.UncompressedSize = uint32max
+		fh.ReaderVersion = zipVersion45
+	} else {
+		fh.CompressedSize = uint32(fh.CompressedSize64)
+		fh.UncompressedSize = uint32(fh.UncompressedSize64)
+	}
+	w.dir = append(w.dir, h)
+
+	if err := writeHeader(w.cw, fh); err != nil {
+		return nil, err
+	}
+
+	fw := &fileWriter{
+		header:    h,
+		zipw:      w.cw,
+		compCount: &countWriter{w: w.cw},
+		raw:       true,
+	}
+	w.last = fw
+	return fw, nil
+}
+
+// Copy copies the file f (obtained from a Reader) into w. It copies the
+// raw form directly, bypassing decompression, compression and validation.
+func (w *Writer) Copy(f *File) error {
+	r, err := f.OpenRaw()
+	if err != nil {
+		return err
+	}
+	fw, err := w.CreateRaw(&f.FileHeader)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, r)
+	return err
+}
+
+// prepare finishes writing the previous file, if any.
+func (w *Writer) prepare() error {
+	if w.last != nil && !w.last.closed {
+		if err := w.last.close(); err != nil {
+			return err
+		}
+	}
+	if w.closed {
+		return errors.New("zip: write to closed writer")
+	}
+	return nil
+}
+
+// stripExtra returns a copy of extra without the fields with the given
+// ids, such as the zip64 extended information fields, which the Writer
+// adds back as needed. Malformed trailing data is kept as is.
+func stripExtra(extra []byte, ids ...uint16) []byte {
+	var out []byte
+	b := readBuf(extra)
+fields:
+	for len(b) >= 4 {
+		field := b
+		tag := b.uint16()
+		size := int(b.uint16())
+		if size > len(b) {
+			b = field
+			break
+		}
+		b = b[size:]
+		for _, id := range ids {
+			if tag == id {
+				continue fields
+			}
+		}
+		out = append(out, field[:4+size]...)
+	}
+	return append(out, b...)
+}
+
+// detectUTF8 reports whether s is valid UTF-8, and whether it needs to
+// be marked as UTF-8: that is, whether it contains characters outside
+// the printable ASCII range shared by common code pages. Shift-JIS and
+// EUC-KR replace 0x5c and 0x7e, so those count as outside the range.
+func detectUTF8(s string) (valid, require bool) {
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		if r < 0x20 || r > 0x7d || r == 0x5c {
+			if r == utf8.RuneError && size == 1 {
+				return false, false
+			}
+			require = true
+		}
+	}
+	return true, require
+}
+
 func writeHeader(w io.Writer, h *FileHeader) error {
 	var buf [fileHeaderLen]byte
 	b := writeBuf(buf[:])
@@ -238,9 +433,15 @@ func writeHeader(w io.Writer, h *FileHeader) error {
 	b.uint16(h.Method)
 	b.uint16(h.ModifiedTime)
 	b.uint16(h.ModifiedDate)
-	b.uint32(0) // since we are writing a data descriptor crc32,
-	b.uint32(0) // compressed size,
-	b.uint32(0) // and uncompressed size should be zero
+	if h.Flags&0x8 != 0 {
+		b.uint32(0) // since we are writing a data descriptor crc32,
+		b.uint32(0) // compressed size,
+		b.uint32(0) // and uncompressed size should be zero
+	} else {
+		b.uint32(h.CRC32)
+		b.uint32(h.CompressedSize)
+		b.uint32(h.UncompressedSize)
+	}
 	b.uint16(uint16(len(h.Name)))
 	b.uint16(uint16(len(h.Extra)))
 	if _, err := w.Write(buf[:]); err != nil {
@@ -261,12 +462,16 @@ type fileWriter struct {
 	compCount *countWriter
 	crc32     hash.Hash32
 	closed    bool
+	raw       bool // contents are written as is, see CreateRaw
 }
 
 func (w *fileWriter) Write(p []byte) (int, error) {
 	if w.closed {
 		return 0, errors.New("zip: write to closed file")
 	}
+	if w.raw {
+		return w.compCount.Write(p)
+	}
 	w.crc32.Write(p)
 	return w.rawCount.Write(p)
 }
@@ -276,6 +481,15 @@ func (w *fileWriter) close() error {
 		return errors.New("zip: file closed twice")
 	}
 	w.closed = true
+	if w.raw {
+		if uint64(w.compCount.count) != w.CompressedSize64 {
+			return errors.New("zip: raw file size does not match CompressedSize64")
+		}
+		if w.Flags&0x8 == 0 {
+			return nil
+		}
+		return w.writeDataDescriptor()
+	}
 	if err := w.comp.Close(); err != nil {
 		return err
 	}
@@ -294,6 +508,11 @@ func (w *fileWriter) close() error {
 		fh.CompressedSize = uint32(fh.CompressedSize64)
 		fh.UncompressedSize = uint32(fh.UncompressedSize64)
 	}
+	return w.writeDataDescriptor()
+}
+
+func (w *fileWriter) writeDataDescriptor() error {
+	fh := w.header.FileHeader
 
 	// Write data descriptor. This is more complicated than one would
 	// think, see e.g. comments in zipfile.c:putextended() and
@@ -341,6 +560,11 @@ func (w nopCloser) Close() error {
 
 type writeBuf []byte
 
+func (b *writeBuf) uint8(v uint8) {
+	(*b)[0] = v
+	*b = (*b)[1:]
+}
+
 func (b *writeBuf) uint16(v uint16) {
 	binary.LittleEndian.PutUint16(*b, v)
 	*b = (*b)[2:]
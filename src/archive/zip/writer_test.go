@@ -6,11 +6,16 @@ package zip
 
 import (
 	"bytes"
+	"compress/flate"
+	"fmt"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"math/rand"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TODO(adg): a more sophisticated test suite
@@ -162,3 +167,329 @@ func BenchmarkCompressedZipGarbage(b *testing.B) {
 		zw.Close()
 	}
 }
+
+func TestWriterComment(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.SetComment(strings.Repeat("x", uint16max+1)); err == nil {
+		t.Error("SetComment accepted a comment longer than 65535 bytes")
+	}
+	const comment = "archive comment"
+	if err := w.SetComment(comment); err != nil {
+		t.Fatal(err)
+	}
+	testCreate(t, w, &writeTests[0])
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Comment != comment {
+		t.Errorf("got comment %q; want %q", r.Comment, comment)
+	}
+	testReadFile(t, r.File[0], &writeTests[0])
+}
+
+func TestWriterOffset(t *testing.T) {
+	prefix := []byte("#!/bin/sh\nexit 0\n")
+	var buf bytes.Buffer
+	buf.Write(prefix)
+	w := NewWriter(&buf)
+	w.SetOffset(int64(len(prefix)))
+	for i := range writeTests[2:] {
+		testCreate(t, w, &writeTests[2+i])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range r.File {
+		testReadFile(t, f, &writeTests[2+i])
+	}
+}
+
+func TestWriterCreateRaw(t *testing.T) {
+	data := bytes.Repeat([]byte("compressed once, stored as is. "), 100)
+	var comp bytes.Buffer
+	fw, err := flate.NewWriter(&comp, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(data)
+	fw.Close()
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, flags := range []uint16{0, 0x8} {
+		fh := &FileHeader{
+			Name:               fmt.Sprintf("raw%d", flags),
+			Method:             Deflate,
+			Flags:              flags,
+			CRC32:              crc32.ChecksumIEEE(data),
+			CompressedSize64:   uint64(comp.Len()),
+			UncompressedSize64: uint64(len(data)),
+		}
+		rw, err := w.CreateRaw(fh)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rw.Write(comp.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range r.File[:2] {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%s: contents differ", f.Name)
+		}
+	}
+
+	w = NewWriter(ioutil.Discard)
+	if _, err := w.CreateRaw(&FileHeader{Name: "short", CompressedSize64: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err == nil {
+		t.Error("Close succeeded after writing fewer raw bytes than CompressedSize64")
+	}
+}
+
+func TestWriterCopy(t *testing.T) {
+	// make a zip file
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for i := range writeTests {
+		testCreate(t, w, &writeTests[i])
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// read it back and copy its files
+	src, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf2 bytes.Buffer
+	w = NewWriter(&buf2)
+	for _, f := range src.File {
+		if err := w.Copy(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the copies must be identical, down to the compressed bytes
+	dst, err := NewReader(bytes.NewReader(buf2.Bytes()), int64(buf2.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range dst.File {
+		testReadFile(t, f, &writeTests[i])
+		want, err := src.File[i].OpenRaw()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := f.OpenRaw()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantb, _ := ioutil.ReadAll(want)
+		gotb, _ := ioutil.ReadAll(got)
+		if !bytes.Equal(gotb, wantb) {
+			t.Errorf("%s: raw contents differ", f.Name)
+		}
+	}
+}
+
+func TestAppendWriter(t *testing.T) {
+	f, err := ioutil.TempFile("", "zip-append")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w := NewWriter(f)
+	w.SetComment("before")
+	testCreate(t, w, &writeTests[0])
+	testCreate(t, w, &writeTests[2])
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(f, fi.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err = NewAppendWriter(f, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCreate(t, w, &writeTests[3])
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err = f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = NewReader(f, fi.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Comment != "before" {
+		t.Errorf("got comment %q; want %q", r.Comment, "before")
+	}
+	want := []*WriteTest{&writeTests[0], &writeTests[2], &writeTests[3]}
+	if len(r.File) != len(want) {
+		t.Fatalf("got %d files; want %d", len(r.File), len(want))
+	}
+	for i, f := range r.File {
+		testReadFile(t, f, want[i])
+	}
+}
+
+func TestWriterModified(t *testing.T) {
+	modified := time.Date(2015, 6, 1, 12, 34, 56, 789, time.FixedZone("UTC-8", -8*60*60))
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	fh := &FileHeader{
+		Name:     "file.txt",
+		Modified: modified,
+		// A stale extended timestamp that should be replaced.
+		Extra: []byte{0x55, 0x54, 5, 0, 1, 0, 0, 0, 0},
+	}
+	if _, err := w.CreateHeader(fh); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := r.File[0]
+	want := time.Date(2015, 6, 1, 20, 34, 56, 0, time.UTC)
+	if f.Modified != want {
+		t.Errorf("Modified = %v, want %v", f.Modified, want)
+	}
+	if got := f.ModTime(); !got.Equal(want) {
+		t.Errorf("ModTime = %v, want %v", got, want)
+	}
+	if got := f.FileInfo().ModTime(); !got.Equal(want) {
+		t.Errorf("FileInfo().ModTime = %v, want %v", got, want)
+	}
+	if len(f.Extra) != 9 {
+		t.Errorf("len(Extra) = %d, want a single extended timestamp field", len(f.Extra))
+	}
+}
+
+func TestWriterUTF8(t *testing.T) {
+	var utf8Tests = []struct {
+		name    string
+		comment string
+		nonUTF8 bool
+		flags   uint16
+		readNon bool // NonUTF8 as read back
+	}{
+		{
+			name:    "hi, hello",
+			comment: "in the world",
+			flags:   0x8,
+		},
+		{
+			name:    "hi, こんにちわ",
+			comment: "in the world",
+			flags:   0x808,
+		},
+		{
+			name:    "hi, こんにちわ",
+			comment: "in the world",
+			nonUTF8: true,
+			flags:   0x8,
+			readNon: true,
+		},
+		{
+			name:    "hi, hello",
+			comment: "in the 世界",
+			flags:   0x808,
+		},
+		{
+			name:    "hi, こんにちわ",
+			comment: "in the 世界",
+			flags:   0x808,
+		},
+		{
+			name:    "the replacement rune is \uFFFD",
+			comment: "the replacement rune is \uFFFD",
+			flags:   0x808,
+		},
+		{
+			// Name is Japanese encoded in Shift JIS.
+			name:    "\x93\xfa\x96{\x8c\xea.txt",
+			comment: "in the 世界",
+			flags:   0x008, // UTF-8 must not be set
+			readNon: true,
+		},
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, test := range utf8Tests {
+		h := &FileHeader{
+			Name:    test.name,
+			Comment: test.comment,
+			NonUTF8: test.nonUTF8,
+			Method:  Deflate,
+		}
+		if _, err := w.CreateHeader(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range utf8Tests {
+		f := r.File[i]
+		if got, want := f.Flags, test.flags; got != want {
+			t.Errorf("%q: Flags = %#x, want %#x", test.name, got, want)
+		}
+		if got, want := f.NonUTF8, test.readNon; got != want {
+			t.Errorf("%q: NonUTF8 = %v, want %v", test.name, got, want)
+		}
+	}
+}
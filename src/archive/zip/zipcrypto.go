@@ -0,0 +1,81 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zip
+
+import (
+	"hash/crc32"
+	"io"
+)
+
+// Traditional PKWARE encryption, called ZipCrypto by most tools.
+// It is weak and supported for reading existing archives only.
+// See section 6.1 of the zip spec.
+
+const zipCryptoHeaderLen = 12
+
+type zipCryptoKeys [3]uint32
+
+func newZipCryptoKeys(password string) *zipCryptoKeys {
+	k := &zipCryptoKeys{305419896, 591751049, 878082192}
+	for i := 0; i < len(password); i++ {
+		k.update(password[i])
+	}
+	return k
+}
+
+func crc32Byte(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ crc>>8
+}
+
+func (k *zipCryptoKeys) update(b byte) {
+	k[0] = crc32Byte(k[0], b)
+	k[1] = (k[1]+k[0]&0xff)*134775813 + 1
+	k[2] = crc32Byte(k[2], byte(k[1]>>24))
+}
+
+// decrypt decrypts b in place.
+func (k *zipCryptoKeys) decrypt(b []byte) {
+	for i, c := range b {
+		t := uint16(k[2]) | 2
+		c ^= byte(t * (t ^ 1) >> 8)
+		k.update(c)
+		b[i] = c
+	}
+}
+
+type zipCryptoReader struct {
+	r    io.Reader
+	keys *zipCryptoKeys
+}
+
+// newZipCryptoReader is the Decrypter for ZipCrypto.
+func newZipCryptoReader(r io.Reader, fh *FileHeader, password string) (io.Reader, error) {
+	keys := newZipCryptoKeys(password)
+	var hdr [zipCryptoHeaderLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	keys.decrypt(hdr[:])
+
+	// The last header byte is the high byte of the CRC-32, or of
+	// the MS-DOS time if the CRC-32 follows in a data descriptor.
+	check := byte(fh.CRC32 >> 24)
+	if fh.Flags&0x8 != 0 {
+		check = byte(fh.ModifiedTime >> 8)
+	}
+	if hdr[zipCryptoHeaderLen-1] != check {
+		return nil, ErrPassword
+	}
+	return &zipCryptoReader{r: r, keys: keys}, nil
+}
+
+func (z *zipCryptoReader) Read(b []byte) (int, error) {
+	n, err := z.r.Read(b)
+	z.keys.decrypt(b[:n])
+	return n, err
+}
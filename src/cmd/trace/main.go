@@ -0,0 +1,154 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Trace is a tool for viewing execution traces.
+//
+// Usage:
+//
+//	go tool trace [-http=addr] binary trace.out
+//
+// Trace files are generated with runtime/trace.Start or fetched from
+// the /debug/pprof/trace endpoint registered by net/http/pprof.
+// The binary is the program that produced the trace; it is used to
+// symbolize stack traces.
+//
+// Trace parses the trace and serves an HTML interface that shows a
+// timeline of goroutine execution on each P, per-goroutine latency
+// analysis (execution, scheduler wait, network, synchronization and
+// syscall blocking, GC time), and blocking profiles rendered with
+// go tool pprof. The timeline is also available in the Trace Event
+// Format understood by chrome://tracing.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"html/template"
+	"internal/trace"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+)
+
+var httpFlag = flag.String("http", "localhost:0", "HTTP service address (e.g., ':6060')")
+
+var (
+	// programBinary is the binary that produced the trace,
+	// used for symbolization and by go tool pprof.
+	programBinary string
+	traceFile     string
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: go tool trace [flags] binary trace.out\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 2 {
+		usage()
+	}
+	programBinary = flag.Arg(0)
+	traceFile = flag.Arg(1)
+
+	ln, err := net.Listen("tcp", *httpFlag)
+	if err != nil {
+		dief("failed to create server socket: %v\n", err)
+	}
+	url := "http://" + ln.Addr().String()
+	fmt.Fprintf(os.Stderr, "Trace viewer is listening on %s\n", url)
+	startBrowser(url)
+
+	// Parse and symbolize trace asynchronously while browser opens.
+	go parseEvents()
+
+	http.HandleFunc("/", httpMain)
+	err = http.Serve(ln, nil)
+	dief("failed to start http server: %v\n", err)
+}
+
+var loader struct {
+	once   sync.Once
+	events []*trace.Event
+	err    error
+}
+
+// parseEvents parses and symbolizes the trace file once
+// and returns the resulting events.
+func parseEvents() ([]*trace.Event, error) {
+	loader.once.Do(func() {
+		tracef, err := os.Open(traceFile)
+		if err != nil {
+			loader.err = fmt.Errorf("failed to open trace file: %v", err)
+			return
+		}
+		defer tracef.Close()
+
+		events, err := trace.Parse(bufio.NewReader(tracef))
+		if err != nil {
+			loader.err = fmt.Errorf("failed to parse trace: %v", err)
+			return
+		}
+		err = trace.Symbolize(events, programBinary)
+		if err != nil {
+			loader.err = fmt.Errorf("failed to symbolize trace: %v", err)
+			return
+		}
+		loader.events = events
+	})
+	return loader.events, loader.err
+}
+
+// httpMain serves the starting page.
+func httpMain(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if err := templMain.Execute(w, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var templMain = template.Must(template.New("").Parse(`
+<html>
+<body>
+<a href="/trace">View trace</a><br>
+<a href="/jsontrace">Trace in chrome://tracing format</a><br>
+<a href="/goroutines">Goroutine analysis</a><br>
+<a href="/io">Network blocking profile</a><br>
+<a href="/block">Synchronization blocking profile</a><br>
+<a href="/syscall">Syscall blocking profile</a><br>
+<a href="/sched">Scheduler latency profile</a><br>
+</body>
+</html>
+`))
+
+// startBrowser tries to open the URL in a browser
+// and reports whether it succeeds.
+func startBrowser(url string) bool {
+	var args []string
+	switch runtime.GOOS {
+	case "darwin":
+		args = []string{"open"}
+	case "windows":
+		args = []string{"cmd", "/c", "start"}
+	default:
+		args = []string{"xdg-open"}
+	}
+	cmd := exec.Command(args[0], append(args[1:], url)...)
+	return cmd.Start() == nil
+}
+
+func dief(msg string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,559 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"internal/trace"
+	"net/http"
+	"strconv"
+)
+
+func init() {
+	http.HandleFunc("/trace", httpTrace)
+	http.HandleFunc("/jsontrace", httpJsonTrace)
+}
+
+// timelineRowHeight is the height in pixels of a single P row in /trace.
+const timelineRowHeight = 20
+
+// httpTrace serves the execution timeline as an SVG image embedded into HTML.
+// An optional goid parameter restricts the view to goroutines related to goid.
+func httpTrace(w http.ResponseWriter, r *http.Request) {
+	events, err := parseEvents()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	params, err := newViewerParams(r, events)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := generateTimeline(params)
+	if err := templTrace.Execute(w, data); err != nil {
+		http.Error(w, fmt.Sprintf("failed to execute template: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+// httpJsonTrace serves json trace, requested from within the trace viewer.
+func httpJsonTrace(w http.ResponseWriter, r *http.Request) {
+	events, err := parseEvents()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	params, err := newViewerParams(r, events)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := generateTrace(params)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		http.Error(w, fmt.Sprintf("failed to serialize trace: %v", err), http.StatusInternalServerError)
+		return
+	}
+}
+
+type traceParams struct {
+	events    []*trace.Event
+	gtrace    bool
+	startTime int64
+	endTime   int64
+	gs        map[uint64]bool
+}
+
+// newViewerParams builds traceParams from the request parameters.
+func newViewerParams(r *http.Request, events []*trace.Event) (*traceParams, error) {
+	params := &traceParams{
+		events:  events,
+		endTime: int64(1<<63 - 1),
+	}
+	if goids := r.FormValue("goid"); goids != "" {
+		goid, err := strconv.ParseUint(goids, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse goid parameter '%v': %v", goids, err)
+		}
+		analyzeGoroutines(events)
+		g := gs[goid]
+		if g == nil {
+			return nil, fmt.Errorf("goroutine %v not found", goid)
+		}
+		params.gtrace = true
+		params.startTime = g.StartTime
+		params.endTime = g.EndTime
+		params.gs = trace.RelatedGoroutines(events, goid)
+	}
+	return params, nil
+}
+
+// ViewerData is the Trace Event Format understood by chrome://tracing.
+// See https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU.
+type ViewerData struct {
+	Events   []*ViewerEvent         `json:"traceEvents"`
+	Frames   map[string]ViewerFrame `json:"stackFrames"`
+	TimeUnit string                 `json:"displayTimeUnit"`
+}
+
+type ViewerEvent struct {
+	Name     string      `json:"name,omitempty"`
+	Phase    string      `json:"ph"`
+	Scope    string      `json:"s,omitempty"`
+	Time     float64     `json:"ts"`
+	Dur      float64     `json:"dur,omitempty"`
+	Pid      uint64      `json:"pid"`
+	Tid      uint64      `json:"tid"`
+	ID       uint64      `json:"id,omitempty"`
+	Stack    int         `json:"sf,omitempty"`
+	EndStack int         `json:"esf,omitempty"`
+	Arg      interface{} `json:"args,omitempty"`
+}
+
+type ViewerFrame struct {
+	Name   string `json:"name"`
+	Parent int    `json:"parent,omitempty"`
+}
+
+type NameArg struct {
+	Name string `json:"name"`
+}
+
+type SortIndexArg struct {
+	Index int `json:"sort_index"`
+}
+
+type heapCountersArg struct {
+	Allocated uint64
+	NextGC    uint64
+}
+
+type goroutineCountersArg struct {
+	Running  uint64
+	Runnable uint64
+}
+
+type threadCountersArg struct {
+	Running   uint64
+	InSyscall uint64
+}
+
+type frameNode struct {
+	id       int
+	children map[uint64]frameNode
+}
+
+// traceContext accumulates state while converting events into ViewerData.
+type traceContext struct {
+	*traceParams
+	data      ViewerData
+	frameTree frameNode
+	frameSeq  int
+	arrowSeq  uint64
+	heapAlloc uint64
+	nextGC    uint64
+	grunnable uint64
+	grunning  uint64
+	insyscall uint64
+	prunning  uint64
+	maxProc   int
+}
+
+// generateTrace generates json trace for trace-viewer:
+// https://github.com/google/trace-viewer
+// Trace format is described at:
+// https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU/view
+// If gtrace=true, generate trace for goroutine goid, otherwise whole trace.
+// startTime, endTime determine part of the trace that we are interested in.
+// gset restricts goroutines that are included in the resulting trace.
+func generateTrace(params *traceParams) ViewerData {
+	ctx := &traceContext{traceParams: params}
+	ctx.frameTree.children = make(map[uint64]frameNode)
+	ctx.data.Frames = make(map[string]ViewerFrame)
+	ctx.data.TimeUnit = "ns"
+	gnames := make(map[uint64]string)
+	gstates := make(map[uint64]int)
+	const (
+		gDead = iota
+		gRunnable
+		gRunning
+		gWaiting
+	)
+	setGState := func(g uint64, st int) {
+		switch gstates[g] {
+		case gRunnable:
+			ctx.grunnable--
+		case gRunning:
+			ctx.grunning--
+		}
+		switch st {
+		case gRunnable:
+			ctx.grunnable++
+		case gRunning:
+			ctx.grunning++
+		}
+		gstates[g] = st
+	}
+	for _, ev := range ctx.events {
+		// Handle trace.EvGoStart separately, because we need the goroutine name
+		// even if ignore the event otherwise.
+		if ev.Type == trace.EvGoStart {
+			if _, ok := gnames[ev.G]; !ok {
+				if len(ev.Stk) > 0 {
+					gnames[ev.G] = fmt.Sprintf("G%v %s", ev.G, ev.Stk[0].Fn)
+				} else {
+					gnames[ev.G] = fmt.Sprintf("G%v", ev.G)
+				}
+			}
+		}
+
+		// Ignore events that are from uninteresting goroutines
+		// or outside of the interesting timeframe.
+		if ctx.gs != nil && ev.P < trace.FakeP && !ctx.gs[ev.G] {
+			continue
+		}
+		if ev.Ts < ctx.startTime || ev.Ts > ctx.endTime {
+			continue
+		}
+
+		if ev.P < trace.FakeP && ev.P > ctx.maxProc {
+			ctx.maxProc = ev.P
+		}
+
+		switch ev.Type {
+		case trace.EvProcStart:
+			if ctx.gtrace {
+				continue
+			}
+			ctx.prunning++
+			ctx.emitThreadCounters(ev)
+			ctx.emitInstant(ev, "proc start")
+		case trace.EvProcStop:
+			if ctx.gtrace {
+				continue
+			}
+			ctx.prunning--
+			ctx.emitThreadCounters(ev)
+			ctx.emitInstant(ev, "proc stop")
+		case trace.EvGCStart:
+			ctx.emitSlice(ev, "GC")
+		case trace.EvGCDone:
+		case trace.EvGCScanStart:
+			if ctx.gtrace {
+				continue
+			}
+			ctx.emitSlice(ev, "MARK")
+		case trace.EvGCScanDone:
+		case trace.EvGCSweepStart:
+			ctx.emitSlice(ev, "SWEEP")
+		case trace.EvGCSweepDone:
+		case trace.EvGoStart:
+			setGState(ev.G, gRunning)
+			ctx.emitSlice(ev, gnames[ev.G])
+		case trace.EvGoCreate:
+			setGState(ev.Args[0], gRunnable)
+			ctx.emitArrow(ev, "go")
+		case trace.EvGoEnd:
+			setGState(ev.G, gDead)
+		case trace.EvGoUnblock:
+			setGState(ev.Args[0], gRunnable)
+			ctx.emitArrow(ev, "unblock")
+		case trace.EvGoSysCall:
+			ctx.emitInstant(ev, "syscall")
+		case trace.EvGoSysExit:
+			setGState(ev.G, gRunnable)
+			ctx.insyscall--
+			ctx.emitThreadCounters(ev)
+			ctx.emitArrow(ev, "sysexit")
+		case trace.EvGoSysBlock:
+			setGState(ev.G, gWaiting)
+			ctx.insyscall++
+			ctx.emitThreadCounters(ev)
+		case trace.EvGoSched, trace.EvGoPreempt:
+			setGState(ev.G, gRunnable)
+		case trace.EvGoStop,
+			trace.EvGoSleep, trace.EvGoBlock, trace.EvGoBlockSend, trace.EvGoBlockRecv,
+			trace.EvGoBlockSelect, trace.EvGoBlockSync, trace.EvGoBlockCond, trace.EvGoBlockNet:
+			setGState(ev.G, gWaiting)
+		case trace.EvGoWaiting:
+			setGState(ev.Args[0], gRunnable)
+		case trace.EvGoInSyscall:
+			setGState(ev.Args[0], gWaiting)
+			ctx.insyscall++
+			ctx.emitThreadCounters(ev)
+		case trace.EvHeapAlloc:
+			ctx.heapAlloc = ev.Args[0]
+			ctx.emitHeapCounters(ev)
+		case trace.EvNextGC:
+			ctx.nextGC = ev.Args[0]
+			ctx.emitHeapCounters(ev)
+		}
+		if ev.Type >= trace.EvGoCreate && ev.Type <= trace.EvGoInSyscall {
+			ctx.emitGoroutineCounters(ev)
+		}
+	}
+
+	ctx.emit(&ViewerEvent{Name: "process_name", Phase: "M", Pid: 0, Arg: &NameArg{"PROCS"}})
+	ctx.emit(&ViewerEvent{Name: "process_sort_index", Phase: "M", Pid: 0, Arg: &SortIndexArg{1}})
+
+	ctx.emit(&ViewerEvent{Name: "process_name", Phase: "M", Pid: 1, Arg: &NameArg{"STATS"}})
+	ctx.emit(&ViewerEvent{Name: "process_sort_index", Phase: "M", Pid: 1, Arg: &SortIndexArg{0}})
+
+	ctx.emit(&ViewerEvent{Name: "thread_name", Phase: "M", Pid: 0, Tid: trace.NetpollP, Arg: &NameArg{"Network"}})
+	ctx.emit(&ViewerEvent{Name: "thread_sort_index", Phase: "M", Pid: 0, Tid: trace.NetpollP, Arg: &SortIndexArg{-5}})
+
+	ctx.emit(&ViewerEvent{Name: "thread_name", Phase: "M", Pid: 0, Tid: trace.TimerP, Arg: &NameArg{"Timers"}})
+	ctx.emit(&ViewerEvent{Name: "thread_sort_index", Phase: "M", Pid: 0, Tid: trace.TimerP, Arg: &SortIndexArg{-4}})
+
+	ctx.emit(&ViewerEvent{Name: "thread_name", Phase: "M", Pid: 0, Tid: trace.SyscallP, Arg: &NameArg{"Syscalls"}})
+	ctx.emit(&ViewerEvent{Name: "thread_sort_index", Phase: "M", Pid: 0, Tid: trace.SyscallP, Arg: &SortIndexArg{-3}})
+
+	if !ctx.gtrace {
+		for i := 0; i <= ctx.maxProc; i++ {
+			ctx.emit(&ViewerEvent{Name: "thread_name", Phase: "M", Pid: 0, Tid: uint64(i), Arg: &NameArg{fmt.Sprintf("Proc %v", i)}})
+		}
+	}
+
+	if ctx.gtrace && ctx.gs != nil {
+		for k, v := range gnames {
+			if !ctx.gs[k] {
+				continue
+			}
+			ctx.emit(&ViewerEvent{Name: "thread_name", Phase: "M", Pid: 0, Tid: k, Arg: &NameArg{v}})
+		}
+	}
+
+	return ctx.data
+}
+
+func (ctx *traceContext) emit(e *ViewerEvent) {
+	ctx.data.Events = append(ctx.data.Events, e)
+}
+
+func (ctx *traceContext) time(ev *trace.Event) float64 {
+	// Trace viewer wants timestamps in microseconds.
+	return float64(ev.Ts-ctx.startTime) / 1000
+}
+
+func (ctx *traceContext) proc(ev *trace.Event) uint64 {
+	if ctx.gtrace && ev.P < trace.FakeP {
+		return ev.G
+	}
+	return uint64(ev.P)
+}
+
+func (ctx *traceContext) emitSlice(ev *trace.Event, name string) {
+	var dur float64
+	if ev.Link != nil {
+		dur = ctx.time(ev.Link) - ctx.time(ev)
+	}
+	var endStack int
+	if ev.Link != nil {
+		endStack = ctx.stack(ev.Link.Stk)
+	}
+	ctx.emit(&ViewerEvent{
+		Name:     name,
+		Phase:    "X",
+		Time:     ctx.time(ev),
+		Dur:      dur,
+		Tid:      ctx.proc(ev),
+		Stack:    ctx.stack(ev.Stk),
+		EndStack: endStack,
+	})
+}
+
+func (ctx *traceContext) emitHeapCounters(ev *trace.Event) {
+	if ctx.gtrace {
+		return
+	}
+	diff := uint64(0)
+	if ctx.nextGC > ctx.heapAlloc {
+		diff = ctx.nextGC - ctx.heapAlloc
+	}
+	ctx.emit(&ViewerEvent{Name: "Heap", Phase: "C", Time: ctx.time(ev), Pid: 1, Arg: &heapCountersArg{ctx.heapAlloc, diff}})
+}
+
+func (ctx *traceContext) emitGoroutineCounters(ev *trace.Event) {
+	if ctx.gtrace {
+		return
+	}
+	ctx.emit(&ViewerEvent{Name: "Goroutines", Phase: "C", Time: ctx.time(ev), Pid: 1, Arg: &goroutineCountersArg{ctx.grunning, ctx.grunnable}})
+}
+
+func (ctx *traceContext) emitThreadCounters(ev *trace.Event) {
+	if ctx.gtrace {
+		return
+	}
+	ctx.emit(&ViewerEvent{Name: "Threads", Phase: "C", Time: ctx.time(ev), Pid: 1, Arg: &threadCountersArg{ctx.prunning, ctx.insyscall}})
+}
+
+func (ctx *traceContext) emitInstant(ev *trace.Event, name string) {
+	ctx.emit(&ViewerEvent{Name: name, Phase: "I", Scope: "t", Time: ctx.time(ev), Tid: ctx.proc(ev), Stack: ctx.stack(ev.Stk)})
+}
+
+func (ctx *traceContext) emitArrow(ev *trace.Event, name string) {
+	if ev.Link == nil {
+		// The other end of the arrow is not captured in the trace.
+		// For example, a goroutine was unblocked but was not scheduled before trace stop.
+		return
+	}
+	if ctx.gtrace && (!ctx.gs[ev.Link.G] || ev.Link.Ts < ctx.startTime || ev.Link.Ts > ctx.endTime) {
+		return
+	}
+
+	ctx.arrowSeq++
+	ctx.emit(&ViewerEvent{Name: name, Phase: "s", Tid: ctx.proc(ev), ID: ctx.arrowSeq, Time: ctx.time(ev), Stack: ctx.stack(ev.Stk)})
+	ctx.emit(&ViewerEvent{Name: name, Phase: "t", Tid: ctx.proc(ev.Link), ID: ctx.arrowSeq, Time: ctx.time(ev.Link)})
+}
+
+func (ctx *traceContext) stack(stk []*trace.Frame) int {
+	return ctx.buildBranch(ctx.frameTree, stk)
+}
+
+// buildBranch builds one branch in the prefix tree rooted at ctx.frameTree.
+func (ctx *traceContext) buildBranch(parent frameNode, stk []*trace.Frame) int {
+	if len(stk) == 0 {
+		return parent.id
+	}
+	last := len(stk) - 1
+	frame := stk[last]
+	stk = stk[:last]
+
+	node, ok := parent.children[frame.PC]
+	if !ok {
+		ctx.frameSeq++
+		node.id = ctx.frameSeq
+		node.children = make(map[uint64]frameNode)
+		parent.children[frame.PC] = node
+		ctx.data.Frames[strconv.Itoa(node.id)] = ViewerFrame{fmt.Sprintf("%v:%v", frame.Fn, frame.Line), parent.id}
+	}
+	return ctx.buildBranch(node, stk)
+}
+
+// timeline is the data rendered by templTrace.
+type timeline struct {
+	Width  int
+	Height int
+	Rows   []timelineRow
+	Slices []timelineSlice
+}
+
+type timelineRow struct {
+	Name string
+	Y    int
+}
+
+type timelineSlice struct {
+	X, Y, W int
+	Class   string
+	Title   string
+}
+
+// generateTimeline lays out goroutine executions, GC and sweeping
+// as rectangles, one row per P.
+func generateTimeline(params *traceParams) *timeline {
+	const width = 2000
+	tl := &timeline{Width: width}
+	start, end := params.startTime, params.endTime
+	if len(params.events) > 0 && end > params.events[len(params.events)-1].Ts {
+		end = params.events[len(params.events)-1].Ts
+	}
+	if end <= start {
+		end = start + 1
+	}
+	scale := func(ts int64) int {
+		return int((ts - start) * width / (end - start))
+	}
+	// Row 0 is for GC, rows 1..N are for Ps.
+	maxProc := -1
+	for _, ev := range params.events {
+		if ev.P < trace.FakeP && ev.P > maxProc {
+			maxProc = ev.P
+		}
+	}
+	tl.Rows = append(tl.Rows, timelineRow{"GC", 0})
+	for p := 0; p <= maxProc; p++ {
+		tl.Rows = append(tl.Rows, timelineRow{fmt.Sprintf("Proc %v", p), (p + 1) * timelineRowHeight})
+	}
+	tl.Height = len(tl.Rows) * timelineRowHeight
+
+	for _, ev := range params.events {
+		if ev.Link == nil || ev.Link.Ts < start || ev.Ts > end {
+			continue
+		}
+		var row int
+		var class, title string
+		switch ev.Type {
+		case trace.EvGoStart:
+			if ev.P >= trace.FakeP || (params.gs != nil && !params.gs[ev.G]) {
+				continue
+			}
+			row = ev.P + 1
+			class = "g"
+			title = fmt.Sprintf("G%v", ev.G)
+			if len(ev.Stk) > 0 {
+				title += " " + ev.Stk[0].Fn
+			}
+			title += fmt.Sprintf(" (%v ns, %v)", ev.Link.Ts-ev.Ts, trace.EventDescriptions[ev.Link.Type].Name)
+		case trace.EvGCStart:
+			class = "gc"
+			title = fmt.Sprintf("GC (%v ns)", ev.Link.Ts-ev.Ts)
+		case trace.EvGCSweepStart:
+			if ev.P >= trace.FakeP {
+				continue
+			}
+			row = ev.P + 1
+			class = "sweep"
+			title = fmt.Sprintf("sweep (%v ns)", ev.Link.Ts-ev.Ts)
+		default:
+			continue
+		}
+		x0, x1 := scale(ev.Ts), scale(ev.Link.Ts)
+		if x0 < 0 {
+			x0 = 0
+		}
+		if x1 > width {
+			x1 = width
+		}
+		w := x1 - x0
+		if w < 1 {
+			w = 1
+		}
+		tl.Slices = append(tl.Slices, timelineSlice{x0, row * timelineRowHeight, w, class, title})
+	}
+	return tl
+}
+
+var templTrace = template.Must(template.New("").Funcs(template.FuncMap{
+	"add": func(a, b int) int { return a + b },
+}).Parse(`
+<html>
+<head>
+<style>
+rect.g { fill: #6a8fd8; }
+rect.gc { fill: #d86a6a; }
+rect.sweep { fill: #d8b86a; }
+text { font: 12px sans-serif; }
+</style>
+</head>
+<body>
+<p>Hover over a rectangle to see details.
+Use <a href="/jsontrace">/jsontrace</a> with chrome://tracing for an interactive view.</p>
+<svg width="{{add .Width 100}}" height="{{.Height}}">
+{{range .Rows}}
+  <text x="0" y="{{add .Y 14}}">{{.Name}}</text>
+{{end}}
+<g transform="translate(100,0)">
+{{range .Slices}}
+  <rect class="{{.Class}}" x="{{.X}}" y="{{add .Y 2}}" width="{{.W}}" height="16"><title>{{.Title}}</title></rect>
+{{end}}
+</g>
+</svg>
+</body>
+</html>
+`))
@@ -16,13 +16,23 @@ const (
 	fastCompression    = 3
 	BestCompression    = 9
 	DefaultCompression = -1
-	logWindowSize      = 15
-	windowSize         = 1 << logWindowSize
-	windowMask         = windowSize - 1
-	logMaxOffsetSize   = 15  // Standard DEFLATE
-	minMatchLength     = 3   // The smallest match that the compressor looks for
-	maxMatchLength     = 258 // The longest match for the compressor
-	minOffsetSize      = 1   // The shortest offset that makes any sense
+
+	// HuffmanOnly disables Lempel-Ziv match searching and only performs
+	// Huffman entropy encoding. This is useful for data that has already
+	// been compressed with an LZ style algorithm that lacks an entropy
+	// encoder, such as Snappy or LZ4, or that is otherwise dominated by
+	// a few byte values. The output is valid DEFLATE.
+	HuffmanOnly = -2
+)
+
+const (
+	logWindowSize    = 15
+	windowSize       = 1 << logWindowSize
+	windowMask       = windowSize - 1
+	logMaxOffsetSize = 15  // Standard DEFLATE
+	minMatchLength   = 3   // The smallest match that the compressor looks for
+	maxMatchLength   = 258 // The longest match for the compressor
+	minOffsetSize    = 1   // The shortest offset that makes any sense
 
 	// The maximum number of tokens we put into a single flat block, just too
 	// stop things from getting too large.
@@ -43,6 +53,8 @@ type compressionLevel struct {
 
 var levels = []compressionLevel{
 	{}, // 0
+	// BestSpeed normally uses a single hash table (see deflatefast.go);
+	// level 1 is only used with a preset dictionary.
 	// For levels 1-3 we don't bother trying with lazy matches
 	{3, 0, 8, 4, 4},
 	{3, 0, 16, 8, 5},
@@ -372,6 +384,34 @@ func (d *compressor) store() {
 	d.windowEnd = 0
 }
 
+// storeHuff Huffman-encodes the window once it is full, or when flushing.
+func (d *compressor) storeHuff() {
+	if d.windowEnd < len(d.window) && !d.sync || d.windowEnd == 0 {
+		return
+	}
+	d.w.writeBlockHuff(false, d.window[:d.windowEnd])
+	d.err = d.w.err
+	d.windowEnd = 0
+}
+
+// encSpeed compresses the window with encodeBestSpeed once it is full,
+// or when flushing.
+func (d *compressor) encSpeed() {
+	if d.windowEnd < len(d.window) && !d.sync || d.windowEnd == 0 {
+		return
+	}
+	d.tokens = encodeBestSpeed(d.tokens[:0], d.window[:d.windowEnd])
+	if len(d.tokens) > d.windowEnd-d.windowEnd>>4 {
+		// Matching removed less than 1/16th of the input;
+		// only Huffman-encode it.
+		d.w.writeBlockHuff(false, d.window[:d.windowEnd])
+	} else {
+		d.w.writeBlock(d.tokens, false, d.window[:d.windowEnd])
+	}
+	d.err = d.w.err
+	d.windowEnd = 0
+}
+
 func (d *compressor) write(b []byte) (n int, err error) {
 	n = len(b)
 	b = b[d.fill(d, b):]
@@ -402,16 +442,25 @@ func (d *compressor) init(w io.Writer, level int) (err error) {
 		d.window = make([]byte, maxStoreBlockSize)
 		d.fill = (*compressor).fillStore
 		d.step = (*compressor).store
+	case level == HuffmanOnly:
+		d.window = make([]byte, maxStoreBlockSize)
+		d.fill = (*compressor).fillStore
+		d.step = (*compressor).storeHuff
+	case level == BestSpeed:
+		d.window = make([]byte, maxStoreBlockSize)
+		d.tokens = make([]token, 0, maxStoreBlockSize+1)
+		d.fill = (*compressor).fillStore
+		d.step = (*compressor).encSpeed
 	case level == DefaultCompression:
 		level = 6
 		fallthrough
-	case 1 <= level && level <= 9:
+	case 2 <= level && level <= 9:
 		d.compressionLevel = levels[level]
 		d.initDeflate()
 		d.fill = (*compressor).fillDeflate
 		d.step = (*compressor).deflate
 	default:
-		return fmt.Errorf("flate: invalid compression level %d: want value in range [-1, 9]", level)
+		return fmt.Errorf("flate: invalid compression level %d: want value in range [-2, 9]", level)
 	}
 	return nil
 }
@@ -425,11 +474,12 @@ func (d *compressor) reset(w io.Writer) {
 	d.err = nil
 	switch d.compressionLevel.chain {
 	case 0:
-		// level was NoCompression.
+		// level was NoCompression, HuffmanOnly or BestSpeed.
 		for i := range d.window {
 			d.window[i] = 0
 		}
 		d.windowEnd = 0
+		d.tokens = d.tokens[:0]
 	default:
 		d.chainHead = -1
 		for s := d.hashHead; len(s) > 0; {
@@ -478,9 +528,10 @@ func (d *compressor) close() error {
 // higher levels typically run slower but compress more. Level 0
 // (NoCompression) does not attempt any compression; it only adds the
 // necessary DEFLATE framing. Level -1 (DefaultCompression) uses the default
-// compression level.
+// compression level. Level -2 (HuffmanOnly) only uses Huffman encoding;
+// see HuffmanOnly.
 //
-// If level is in the range [-1, 9] then the error returned will be nil.
+// If level is in the range [-2, 9] then the error returned will be nil.
 // Otherwise the error returned will be non-nil.
 func NewWriter(w io.Writer, level int) (*Writer, error) {
 	var dw Writer
@@ -502,6 +553,15 @@ func NewWriterDict(w io.Writer, level int, dict []byte) (*Writer, error) {
 	if err != nil {
 		return nil, err
 	}
+	if level == BestSpeed && len(dict) > 0 {
+		// The BestSpeed encoder only finds matches within the block
+		// being encoded, so it can never refer back to dict.
+		// Use the hash chains instead.
+		zw.d.compressionLevel = levels[BestSpeed]
+		zw.d.initDeflate()
+		zw.d.fill = (*compressor).fillDeflate
+		zw.d.step = (*compressor).deflate
+	}
 	zw.Write(dict)
 	zw.Flush()
 	dw.enabled = true
@@ -44,11 +44,18 @@ var deflateTests = []*deflateTest{
 	{[]byte{}, 1, []byte{1, 0, 0, 255, 255}},
 	{[]byte{0x11}, 1, []byte{18, 4, 4, 0, 0, 255, 255}},
 	{[]byte{0x11, 0x12}, 1, []byte{18, 20, 2, 4, 0, 0, 255, 255}},
-	{[]byte{0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11}, 1, []byte{18, 132, 2, 64, 0, 0, 0, 255, 255}},
+	// BestSpeed does not look for matches in inputs this short.
+	{[]byte{0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11}, 1, []byte{18, 20, 20, 20, 20, 20, 20, 20, 4, 4, 0, 0, 255, 255}},
 	{[]byte{}, 9, []byte{1, 0, 0, 255, 255}},
 	{[]byte{0x11}, 9, []byte{18, 4, 4, 0, 0, 255, 255}},
 	{[]byte{0x11, 0x12}, 9, []byte{18, 20, 2, 4, 0, 0, 255, 255}},
 	{[]byte{0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11}, 9, []byte{18, 132, 2, 64, 0, 0, 0, 255, 255}},
+	{[]byte{}, HuffmanOnly, []byte{1, 0, 0, 255, 255}},
+	{[]byte{0x11}, HuffmanOnly, []byte{0, 1, 0, 254, 255, 17, 1, 0, 0, 255, 255}},
+	{[]byte{0x11, 0x12}, HuffmanOnly, []byte{0, 2, 0, 253, 255, 17, 18, 1, 0, 0, 255, 255}},
+	{[]byte{0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x11}, HuffmanOnly,
+		[]byte{0, 8, 0, 247, 255, 17, 17, 17, 17, 17, 17, 17, 17, 1, 0, 0, 255, 255},
+	},
 }
 
 var deflateInflateTests = []*deflateInflateTest{
@@ -311,6 +318,7 @@ func testToFromWithLimit(t *testing.T, input []byte, name string, limit [10]int)
 func TestDeflateInflate(t *testing.T) {
 	for i, h := range deflateInflateTests {
 		testToFromWithLimit(t, h.in, fmt.Sprintf("#%d", i), [10]int{})
+		testToFromWithLevelAndLimit(t, HuffmanOnly, h.in, fmt.Sprintf("#%d", i), 0)
 	}
 }
 
@@ -338,7 +346,7 @@ var deflateInflateStringTests = []deflateInflateStringTest{
 	{
 		"../testdata/Mark.Twain-Tom.Sawyer.txt",
 		"Mark.Twain-Tom.Sawyer",
-		[...]int{407330, 187598, 180361, 172974, 169160, 163476, 160936, 160506, 160295, 160295},
+		[...]int{407330, 191175, 180361, 172974, 169160, 163476, 160936, 160506, 160295, 160295},
 	},
 }
 
@@ -407,6 +415,35 @@ func TestWriterDict(t *testing.T) {
 	}
 }
 
+func TestWriterDictBestSpeed(t *testing.T) {
+	dict := []byte("The quick brown fox jumps over the lazy dog, then naps in the sun.")
+	text := append([]byte("Why? "), dict...)
+
+	compress := func(dict []byte) []byte {
+		var b bytes.Buffer
+		w, err := NewWriterDict(&b, BestSpeed, dict)
+		if err != nil {
+			t.Fatalf("NewWriterDict: %v", err)
+		}
+		w.Write(text)
+		w.Close()
+		return b.Bytes()
+	}
+	withDict := compress(dict)
+	noDict := compress(nil)
+	if len(withDict) >= len(noDict) {
+		t.Errorf("BestSpeed with dictionary wrote %d bytes, want fewer than %d without", len(withDict), len(noDict))
+	}
+
+	out, err := ioutil.ReadAll(NewReaderDict(bytes.NewReader(withDict), dict))
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(out, text) {
+		t.Fatalf("read %q, want %q", out, text)
+	}
+}
+
 // See http://code.google.com/p/go/issues/detail?id=2508
 func TestRegression2508(t *testing.T) {
 	if testing.Short() {
@@ -427,7 +464,7 @@ func TestRegression2508(t *testing.T) {
 }
 
 func TestWriterReset(t *testing.T) {
-	for level := 0; level <= 9; level++ {
+	for level := HuffmanOnly; level <= 9; level++ {
 		if testing.Short() && level > 1 {
 			break
 		}
@@ -454,10 +491,13 @@ func TestWriterReset(t *testing.T) {
 		}
 	}
 	testResetOutput(t, func(w io.Writer) (*Writer, error) { return NewWriter(w, NoCompression) })
+	testResetOutput(t, func(w io.Writer) (*Writer, error) { return NewWriter(w, HuffmanOnly) })
+	testResetOutput(t, func(w io.Writer) (*Writer, error) { return NewWriter(w, BestSpeed) })
 	testResetOutput(t, func(w io.Writer) (*Writer, error) { return NewWriter(w, DefaultCompression) })
 	testResetOutput(t, func(w io.Writer) (*Writer, error) { return NewWriter(w, BestCompression) })
 	dict := []byte("we are the world")
 	testResetOutput(t, func(w io.Writer) (*Writer, error) { return NewWriterDict(w, NoCompression, dict) })
+	testResetOutput(t, func(w io.Writer) (*Writer, error) { return NewWriterDict(w, BestSpeed, dict) })
 	testResetOutput(t, func(w io.Writer) (*Writer, error) { return NewWriterDict(w, DefaultCompression, dict) })
 	testResetOutput(t, func(w io.Writer) (*Writer, error) { return NewWriterDict(w, BestCompression, dict) })
 }
@@ -488,3 +528,29 @@ func testResetOutput(t *testing.T, newWriter func(w io.Writer) (*Writer, error))
 	}
 	t.Logf("got %d bytes", len(out1))
 }
+
+func TestBestSpeedMatch(t *testing.T) {
+	// Matches found by the BestSpeed encoder must reproduce the input.
+	for _, in := range [][]byte{
+		bytes.Repeat([]byte("abcd"), 100),
+		bytes.Repeat([]byte{0}, maxStoreBlockSize),
+		append(bytes.Repeat([]byte("0123456789"), 10), largeDataChunk()[:50000]...),
+	} {
+		var out []byte
+		for _, tok := range encodeBestSpeed(nil, in) {
+			switch tok.typ() {
+			case literalType:
+				out = append(out, byte(tok.literal()))
+			case matchType:
+				n := int(tok.length()) + minMatchLength
+				off := int(tok.offset()) + minOffsetSize
+				for i := 0; i < n; i++ {
+					out = append(out, out[len(out)-off])
+				}
+			}
+		}
+		if !bytes.Equal(out, in) {
+			t.Errorf("encodeBestSpeed of %d bytes did not round trip", len(in))
+		}
+	}
+}
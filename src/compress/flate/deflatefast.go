@@ -0,0 +1,124 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flate
+
+// This encoding algorithm, which prioritizes speed over output size, is
+// based on Snappy's LZ77-style encoder: a single hash table of the most
+// recent position of each 4-byte sequence, with no chains and no lazy
+// matching. It is used for BestSpeed.
+
+const (
+	tableBits  = 14             // Bits used in the table.
+	tableSize  = 1 << tableBits // Size of the table.
+	tableMask  = tableSize - 1  // Mask for table indices.
+	tableShift = 32 - tableBits // Right-shift to get the tableBits most significant bits of a uint32.
+
+	// inputMargin is the number of bytes at the end of the block that
+	// are not searched for matches, so that load32 never reads past it.
+	inputMargin            = 16 - 1
+	minNonLiteralBlockSize = 1 + 1 + inputMargin
+)
+
+func load32(b []byte, i int) uint32 {
+	b = b[i : i+4]
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+func fastHash(u uint32) uint32 {
+	return (u * 0x1e35a7bd) >> tableShift
+}
+
+// encodeBestSpeed appends the tokens for src, which must be at most
+// maxStoreBlockSize bytes, to dst. Matches are only searched for within
+// src.
+func encodeBestSpeed(dst []token, src []byte) []token {
+	if len(src) < minNonLiteralBlockSize {
+		return emitLiteral(dst, src)
+	}
+
+	// The table holds positions in src, which fit in a uint16 as
+	// len(src) <= maxStoreBlockSize.
+	var table [tableSize]uint16
+
+	// sLimit is where to stop looking for matches.
+	sLimit := len(src) - inputMargin
+
+	// nextEmit is where in src the next literal starts.
+	nextEmit := 0
+
+	// The first byte has no history to match, so start at 1.
+	s := 1
+	nextHash := fastHash(load32(src, s))
+
+	for {
+		// Heuristic match skipping: if 32 bytes are scanned with no
+		// matches, look at every other byte; after 32 more, at every
+		// third byte, and so on. Incompressible data is thus skipped
+		// quickly, at a small cost in density for compressible data.
+		skip := 32
+
+		nextS := s
+		candidate := 0
+		for {
+			s = nextS
+			step := skip >> 5
+			nextS = s + step
+			skip += step
+			if nextS > sLimit {
+				return emitLiteral(dst, src[nextEmit:])
+			}
+			candidate = int(table[nextHash&tableMask])
+			table[nextHash&tableMask] = uint16(s)
+			nextHash = fastHash(load32(src, nextS))
+			if s-candidate <= windowSize && load32(src, s) == load32(src, candidate) {
+				break
+			}
+		}
+
+		// A 4-byte match has been found at s; src[nextEmit:s] has no
+		// match and is emitted as literals.
+		dst = emitLiteral(dst, src[nextEmit:s])
+
+		// Emit matches for as long as the input right after the last
+		// one matches again.
+		for {
+			base := s
+
+			// Extend the 4-byte match as far as possible.
+			s += 4
+			end := base + maxMatchLength
+			if end > len(src) {
+				end = len(src)
+			}
+			for t := candidate + 4; s < end && src[s] == src[t]; s, t = s+1, t+1 {
+			}
+
+			dst = append(dst, matchToken(uint32(s-base-minMatchLength), uint32(base-candidate-minOffsetSize)))
+			nextEmit = s
+			if s >= sLimit {
+				return emitLiteral(dst, src[nextEmit:])
+			}
+
+			// Update the table at s-1 and s, and check for another
+			// match at s.
+			table[fastHash(load32(src, s-1))&tableMask] = uint16(s - 1)
+			currHash := fastHash(load32(src, s))
+			candidate = int(table[currHash&tableMask])
+			table[currHash&tableMask] = uint16(s)
+			if s-candidate > windowSize || load32(src, s) != load32(src, candidate) {
+				s++
+				nextHash = fastHash(load32(src, s))
+				break
+			}
+		}
+	}
+}
+
+func emitLiteral(dst []token, lit []byte) []token {
+	for _, v := range lit {
+		dst = append(dst, literalToken(uint32(v)))
+	}
+	return dst
+}
@@ -446,23 +446,8 @@ func (w *huffmanBitWriter) writeBlock(tokens []token, eof bool, input []byte) {
 	var offsetEncoding = fixedOffsetEncoding
 
 	// Dynamic Huffman?
-	var numCodegens int
-
-	// Generate codegen and codegenFrequencies, which indicates how to encode
-	// the literalEncoding and the offsetEncoding.
-	w.generateCodegen(numLiterals, numOffsets)
-	w.codegenEncoding.generate(w.codegenFreq, 7)
-	numCodegens = len(w.codegenFreq)
-	for numCodegens > 4 && w.codegenFreq[codegenOrder[numCodegens-1]] == 0 {
-		numCodegens--
-	}
-	dynamicHeader := int64(3+5+5+4+(3*numCodegens)) +
-		w.codegenEncoding.bitLength(w.codegenFreq) +
-		int64(extraBits) +
-		int64(w.codegenFreq[16]*2) +
-		int64(w.codegenFreq[17]*3) +
-		int64(w.codegenFreq[18]*7)
-	dynamicSize := dynamicHeader +
+	dynamicHeader, numCodegens := w.dynamicHeaderSize(numLiterals, numOffsets)
+	dynamicSize := dynamicHeader + extraBits +
 		w.literalEncoding.bitLength(w.literalFreq) +
 		w.offsetEncoding.bitLength(w.offsetFreq)
 
@@ -515,3 +500,66 @@ func (w *huffmanBitWriter) writeBlock(tokens []token, eof bool, input []byte) {
 		}
 	}
 }
+
+// dynamicHeaderSize generates the codegen for the literal and offset
+// encodings and returns the size in bits of the dynamic block header
+// describing them, and the number of codegen codes it uses.
+func (w *huffmanBitWriter) dynamicHeaderSize(numLiterals, numOffsets int) (size int64, numCodegens int) {
+	// Generate codegen and codegenFrequencies, which indicates how to encode
+	// the literalEncoding and the offsetEncoding.
+	w.generateCodegen(numLiterals, numOffsets)
+	w.codegenEncoding.generate(w.codegenFreq, 7)
+	numCodegens = len(w.codegenFreq)
+	for numCodegens > 4 && w.codegenFreq[codegenOrder[numCodegens-1]] == 0 {
+		numCodegens--
+	}
+	size = int64(3+5+5+4+(3*numCodegens)) +
+		w.codegenEncoding.bitLength(w.codegenFreq) +
+		int64(w.codegenFreq[16]*2) +
+		int64(w.codegenFreq[17]*3) +
+		int64(w.codegenFreq[18]*7)
+	return size, numCodegens
+}
+
+// writeBlockHuff writes input as a block of Huffman-encoded literals,
+// or as a stored block if that gains too little over storing it.
+func (w *huffmanBitWriter) writeBlockHuff(eof bool, input []byte) {
+	if w.err != nil {
+		return
+	}
+	for i := range w.literalFreq {
+		w.literalFreq[i] = 0
+	}
+	for i := range w.offsetFreq {
+		w.offsetFreq[i] = 0
+	}
+	for _, b := range input {
+		w.literalFreq[b]++
+	}
+	w.literalFreq[endBlockMarker] = 1
+	// The header needs an offset code even though none is used.
+	w.offsetFreq[0] = 1
+
+	const numLiterals = endBlockMarker + 1
+	const numOffsets = 1
+	w.literalEncoding.generate(w.literalFreq, 15)
+	w.offsetEncoding.generate(w.offsetFreq, 15)
+
+	size, numCodegens := w.dynamicHeaderSize(numLiterals, numOffsets)
+	size += w.literalEncoding.bitLength(w.literalFreq)
+
+	// Store the bytes if Huffman encoding saves less than 1/16th.
+	if len(input) <= maxStoreBlockSize {
+		if storedSize := int64(len(input)+5) * 8; storedSize < size+size>>4 {
+			w.writeStoredHeader(len(input), eof)
+			w.writeBytes(input)
+			return
+		}
+	}
+
+	w.writeDynamicHeader(numLiterals, numOffsets, numCodegens, eof)
+	for _, b := range input {
+		w.writeCode(w.literalEncoding, uint32(b))
+	}
+	w.writeCode(w.literalEncoding, endBlockMarker)
+}
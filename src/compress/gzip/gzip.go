@@ -20,6 +20,7 @@ const (
 	BestSpeed          = flate.BestSpeed
 	BestCompression    = flate.BestCompression
 	DefaultCompression = flate.DefaultCompression
+	HuffmanOnly        = flate.HuffmanOnly
 )
 
 // A Writer is an io.WriteCloser.
@@ -35,6 +36,14 @@ type Writer struct {
 	closed      bool
 	buf         [10]byte
 	err         error
+
+	// parallel compression, see SetConcurrency
+	blockSize int
+	blocks    int
+	block     []byte           // input not yet being compressed
+	dict      []byte           // end of the input before block
+	queue     []*parallelBlock // blocks being compressed, oldest first
+	free      chan *flate.Writer
 }
 
 // NewWriter returns a new Writer.
@@ -56,11 +65,11 @@ func NewWriter(w io.Writer) *Writer {
 // NewWriterLevel is like NewWriter but specifies the compression level instead
 // of assuming DefaultCompression.
 //
-// The compression level can be DefaultCompression, NoCompression, or any
-// integer value between BestSpeed and BestCompression inclusive. The error
-// returned will be nil if the level is valid.
+// The compression level can be DefaultCompression, NoCompression,
+// HuffmanOnly or any integer value between BestSpeed and BestCompression
+// inclusive. The error returned will be nil if the level is valid.
 func NewWriterLevel(w io.Writer, level int) (*Writer, error) {
-	if level < DefaultCompression || level > BestCompression {
+	if level < HuffmanOnly || level > BestCompression {
 		return nil, fmt.Errorf("gzip: invalid compression level: %d", level)
 	}
 	z := new(Writer)
@@ -87,13 +96,16 @@ func (z *Writer) init(w io.Writer, level int) {
 		level:      level,
 		digest:     digest,
 		compressor: compressor,
+		blockSize:  z.blockSize,
+		blocks:     z.blocks,
+		free:       z.free,
 	}
 }
 
 // Reset discards the Writer z's state and makes it equivalent to the
 // result of its original state from NewWriter or NewWriterLevel, but
 // writing to w instead. This permits reusing a Writer rather than
-// allocating a new one.
+// allocating a new one. The SetConcurrency setting is kept.
 func (z *Writer) Reset(w io.Writer) {
 	z.init(w, z.level)
 }
@@ -210,12 +222,16 @@ func (z *Writer) Write(p []byte) (int, error) {
 				return n, z.err
 			}
 		}
-		if z.compressor == nil {
+		if z.compressor == nil && z.blockSize == 0 {
 			z.compressor, _ = flate.NewWriter(z.w, z.level)
 		}
 	}
 	z.size += uint32(len(p))
 	z.digest.Write(p)
+	if z.blockSize > 0 {
+		n, z.err = z.writeParallel(p)
+		return n, z.err
+	}
 	n, z.err = z.compressor.Write(p)
 	return n, z.err
 }
@@ -241,6 +257,10 @@ func (z *Writer) Flush() error {
 			return z.err
 		}
 	}
+	if z.blockSize > 0 {
+		z.err = z.flushParallel()
+		return z.err
+	}
 	z.err = z.compressor.Flush()
 	return z.err
 }
@@ -261,7 +281,11 @@ func (z *Writer) Close() error {
 			return z.err
 		}
 	}
-	z.err = z.compressor.Close()
+	if z.blockSize > 0 {
+		z.err = z.closeParallel()
+	} else {
+		z.err = z.compressor.Close()
+	}
 	if z.err != nil {
 		return z.err
 	}
@@ -8,6 +8,7 @@ import (
 	"bufio"
 	"bytes"
 	"io/ioutil"
+	"math/rand"
 	"testing"
 	"time"
 )
@@ -229,3 +230,127 @@ func TestWriterReset(t *testing.T) {
 		t.Errorf("buf2 %q != original buf of %q", buf2.String(), buf.String())
 	}
 }
+
+func TestWriterConcurrency(t *testing.T) {
+	data, err := ioutil.ReadFile("../testdata/e.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, level := range []int{HuffmanOnly, NoCompression, BestSpeed, DefaultCompression} {
+		for _, blockSize := range []int{1000, 32 << 10, 1 << 20} {
+			var buf bytes.Buffer
+			w, err := NewWriterLevel(&buf, level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := w.SetConcurrency(blockSize, 4); err != nil {
+				t.Fatal(err)
+			}
+			w.Name = "e.txt"
+			// Write in pieces that do not line up with blocks,
+			// flushing once in the middle.
+			for i := 0; i < len(data); i += 7777 {
+				end := i + 7777
+				if end > len(data) {
+					end = len(data)
+				}
+				if _, err := w.Write(data[i:end]); err != nil {
+					t.Fatal(err)
+				}
+				if i == 7777*5 {
+					if err := w.Flush(); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := NewReader(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("level %d, block size %d: %v", level, blockSize, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("level %d, block size %d: round trip mismatch", level, blockSize)
+			}
+			if r.Name != "e.txt" {
+				t.Errorf("level %d, block size %d: Name = %q, want %q", level, blockSize, r.Name, "e.txt")
+			}
+		}
+	}
+}
+
+func TestWriterConcurrencyBestSpeedDict(t *testing.T) {
+	// The second block repeats the first, so it compresses to
+	// almost nothing if it uses the first block as its dictionary.
+	block := make([]byte, 16<<10)
+	rnd := rand.New(rand.NewSource(1))
+	for i := range block {
+		block[i] = byte(rnd.Intn(256))
+	}
+	data := append(append([]byte{}, block...), block...)
+
+	var buf bytes.Buffer
+	w, err := NewWriterLevel(&buf, BestSpeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetConcurrency(len(block), 2); err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if max := len(block) + len(block)/8; buf.Len() > max {
+		t.Errorf("compressed to %d bytes, want at most %d", buf.Len(), max)
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("round trip mismatch")
+	}
+}
+
+func TestWriterConcurrencyReset(t *testing.T) {
+	var buf, buf2 bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.SetConcurrency(0, 1); err == nil {
+		t.Error("SetConcurrency accepted a zero block size")
+	}
+	if err := w.SetConcurrency(100, 2); err != nil {
+		t.Fatal(err)
+	}
+	msg := bytes.Repeat([]byte("hello world "), 100)
+	w.Write(msg)
+	w.Close()
+	if err := w.SetConcurrency(100, 2); err == nil {
+		t.Error("SetConcurrency succeeded after Write")
+	}
+	w.Reset(&buf2)
+	w.Write(msg)
+	w.Close()
+	if buf.String() != buf2.String() {
+		t.Errorf("output after Reset differs: got %d bytes, want %d", buf2.Len(), buf.Len())
+	}
+
+	w.Reset(&buf2)
+	if err := w.SetConcurrency(100, 4); err != nil {
+		t.Fatal(err)
+	}
+	if cap(w.free) != 4 {
+		t.Errorf("Writer pool holds %d Writers after SetConcurrency with 4 blocks", cap(w.free))
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gzip
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// dictSize is the size of the DEFLATE window, and so the most of the
+// previous block a block can refer to.
+const dictSize = 32 << 10
+
+// finalBlock is an empty final stored DEFLATE block, which ends the
+// stream after the sync-flushed blocks.
+var finalBlock = []byte{1, 0, 0, 0xff, 0xff}
+
+// SetConcurrency makes z split its input into blocks of blockSize bytes
+// and compress up to blocks of them at a time, each on its own goroutine.
+//
+// Each block is compressed with the last 32KiB of the input before it as
+// a preset dictionary and ends with a sync flush, so the blocks are
+// joined into a single gzip member that any gzip reader can decompress.
+// The output is slightly larger than without SetConcurrency, and up to
+// blocks+1 blocks of input are buffered; Flush compresses and writes all
+// of them.
+//
+// SetConcurrency must be called before the first Write, Flush or Close.
+// The setting is kept across calls to Reset.
+func (z *Writer) SetConcurrency(blockSize, blocks int) error {
+	if z.wroteHeader {
+		return errors.New("gzip: SetConcurrency called after Write")
+	}
+	if blockSize <= 0 || blocks <= 0 {
+		return fmt.Errorf("gzip: invalid concurrency: block size %d, %d blocks", blockSize, blocks)
+	}
+	z.blockSize, z.blocks = blockSize, blocks
+	if cap(z.free) != blocks {
+		z.free = make(chan *flate.Writer, blocks)
+	}
+	return nil
+}
+
+// A parallelBlock is the compressed form of a block of input.
+type parallelBlock struct {
+	out  bytes.Buffer
+	err  error
+	done chan struct{} // closed when out and err are set
+}
+
+// switchWriter writes to w unless discard is set.
+type switchWriter struct {
+	w       io.Writer
+	discard bool
+}
+
+func (w *switchWriter) Write(p []byte) (int, error) {
+	if w.discard {
+		return len(p), nil
+	}
+	return w.w.Write(p)
+}
+
+// compressBlock compresses in, which follows dict in the input, into b.
+// It takes a flate.Writer from free, if there is one, and returns it
+// there when done.
+func compressBlock(b *parallelBlock, level int, free chan *flate.Writer, in, dict []byte) {
+	defer close(b.done)
+	if level == flate.BestSpeed && len(dict) > 0 {
+		// BestSpeed only looks for matches in a dictionary given to
+		// flate.NewWriterDict, and Reset would prime the Writer with
+		// this dict again, so it is not reused.
+		var fw *flate.Writer
+		if fw, b.err = flate.NewWriterDict(&b.out, level, dict); b.err != nil {
+			return
+		}
+		if _, b.err = fw.Write(in); b.err == nil {
+			b.err = fw.Flush()
+		}
+		return
+	}
+	var fw *flate.Writer
+	select {
+	case fw = <-free:
+	default:
+		if fw, b.err = flate.NewWriter(nil, level); b.err != nil {
+			return
+		}
+	}
+	// Prime fw with dict as flate.NewWriterDict does, but with a
+	// Writer that can be reused for the next block. Stored and
+	// Huffman-only blocks never refer back to dict.
+	sw := &switchWriter{w: &b.out}
+	fw.Reset(sw)
+	if len(dict) > 0 && level != flate.NoCompression && level != flate.HuffmanOnly {
+		sw.discard = true
+		fw.Write(dict)
+		fw.Flush()
+		sw.discard = false
+	}
+	if _, b.err = fw.Write(in); b.err == nil {
+		b.err = fw.Flush()
+	}
+	select {
+	case free <- fw:
+	default:
+	}
+}
+
+func (z *Writer) writeParallel(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if z.block == nil {
+			z.block = make([]byte, 0, z.blockSize)
+		}
+		m := z.blockSize - len(z.block)
+		if m > len(p) {
+			m = len(p)
+		}
+		z.block = append(z.block, p[:m]...)
+		p = p[m:]
+		if len(z.block) == z.blockSize {
+			if err := z.startBlock(); err != nil {
+				return n - len(p), err
+			}
+		}
+	}
+	return n, nil
+}
+
+// startBlock starts compressing z.block, first writing out the oldest
+// block if blocks are already being compressed.
+func (z *Writer) startBlock() error {
+	if len(z.queue) == z.blocks {
+		if err := z.writeOldest(); err != nil {
+			return err
+		}
+	}
+	in, dict := z.block, z.dict
+	b := &parallelBlock{done: make(chan struct{})}
+	z.queue = append(z.queue, b)
+	go compressBlock(b, z.level, z.free, in, dict)
+
+	// in now belongs to the goroutine and is only read from here on,
+	// so the next dictionary may point into it.
+	if len(in) >= dictSize {
+		z.dict = in[len(in)-dictSize:]
+	} else {
+		d := make([]byte, 0, len(dict)+len(in))
+		d = append(append(d, dict...), in...)
+		if len(d) > dictSize {
+			d = d[len(d)-dictSize:]
+		}
+		z.dict = d
+	}
+	z.block = nil
+	return nil
+}
+
+// writeOldest waits for the oldest block to be compressed and writes it.
+func (z *Writer) writeOldest() error {
+	b := z.queue[0]
+	<-b.done
+	z.queue = z.queue[:copy(z.queue, z.queue[1:])]
+	if b.err != nil {
+		return b.err
+	}
+	_, err := z.w.Write(b.out.Bytes())
+	return err
+}
+
+// flushParallel compresses any buffered input and writes all blocks.
+func (z *Writer) flushParallel() error {
+	if len(z.block) > 0 {
+		if err := z.startBlock(); err != nil {
+			return err
+		}
+	}
+	for len(z.queue) > 0 {
+		if err := z.writeOldest(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (z *Writer) closeParallel() error {
+	if err := z.flushParallel(); err != nil {
+		return err
+	}
+	_, err := z.w.Write(finalBlock)
+	return err
+}
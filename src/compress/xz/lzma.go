@@ -0,0 +1,438 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import "io"
+
+// The LZMA decoder follows the description and reference decoder in
+// the LZMA SDK's lzma-specification.txt.
+
+// A window holds the decoded data, preceded by as much of the data
+// before it as matches may refer to.
+type window struct {
+	buf   []byte
+	off   int   // buf[off:] has not been returned by Read yet
+	size  int64 // dictionary size
+	total int64 // bytes decoded since the last dictionary reset
+}
+
+// reset empties the dictionary. All data must have been read.
+func (w *window) reset() {
+	w.buf = w.buf[:0]
+	w.off = 0
+	w.total = 0
+}
+
+// slide discards data that matches can no longer refer to, once it has
+// all been read.
+func (w *window) slide() {
+	if w.off == len(w.buf) && int64(len(w.buf)) > 2*w.size {
+		n := copy(w.buf, w.buf[int64(len(w.buf))-w.size:])
+		w.buf = w.buf[:n]
+		w.off = n
+	}
+}
+
+// avail returns how far back matches may refer.
+func (w *window) avail() int64 {
+	if w.total < w.size {
+		return w.total
+	}
+	return w.size
+}
+
+func (w *window) put(c byte) {
+	w.buf = append(w.buf, c)
+	w.total++
+}
+
+// byteAt returns the byte dist bytes back; byteAt(1) is the last one.
+func (w *window) byteAt(dist uint32) byte {
+	return w.buf[len(w.buf)-int(dist)]
+}
+
+// copyMatch appends n bytes from dist bytes back.
+func (w *window) copyMatch(dist, n int) {
+	src := len(w.buf) - dist
+	for n > 0 {
+		m := n
+		if m > dist {
+			m = dist
+		}
+		w.buf = append(w.buf, w.buf[src:src+m]...)
+		w.total += int64(m)
+		src += m
+		n -= m
+	}
+}
+
+// A prob is the probability, in units of 1/2048, that the next bit
+// is 0.
+type prob uint16
+
+const (
+	probBits = 11
+	probInit = 1 << probBits / 2
+	moveBits = 5
+)
+
+type rangeDecoder struct {
+	r    io.ByteReader
+	rng  uint32
+	code uint32
+	err  error // the first error from r
+}
+
+func (rd *rangeDecoder) init(r io.ByteReader) error {
+	rd.r = r
+	rd.rng = 0xFFFFFFFF
+	rd.code = 0
+	rd.err = nil
+	if rd.readByte() != 0 {
+		return StructuralError("invalid range coder header")
+	}
+	for i := 0; i < 4; i++ {
+		rd.code = rd.code<<8 | uint32(rd.readByte())
+	}
+	if rd.code == rd.rng {
+		return StructuralError("invalid range coder header")
+	}
+	return rd.err
+}
+
+func (rd *rangeDecoder) readByte() byte {
+	c, err := rd.r.ReadByte()
+	if err != nil && rd.err == nil {
+		rd.err = err
+	}
+	return c
+}
+
+func (rd *rangeDecoder) normalize() {
+	if rd.rng < 1<<24 {
+		rd.rng <<= 8
+		rd.code = rd.code<<8 | uint32(rd.readByte())
+	}
+}
+
+// finishedOK reports whether the range coder ended cleanly.
+func (rd *rangeDecoder) finishedOK() bool {
+	return rd.code == 0
+}
+
+func (rd *rangeDecoder) bit(p *prob) uint32 {
+	bound := (rd.rng >> probBits) * uint32(*p)
+	var b uint32
+	if rd.code < bound {
+		rd.rng = bound
+		*p += (1<<probBits - *p) >> moveBits
+	} else {
+		rd.rng -= bound
+		rd.code -= bound
+		*p -= *p >> moveBits
+		b = 1
+	}
+	rd.normalize()
+	return b
+}
+
+// direct decodes n bits with fixed probabilities of 1/2.
+func (rd *rangeDecoder) direct(n uint) uint32 {
+	var v uint32
+	for ; n > 0; n-- {
+		rd.rng >>= 1
+		v <<= 1
+		if rd.code >= rd.rng {
+			rd.code -= rd.rng
+			v |= 1
+		}
+		rd.normalize()
+	}
+	return v
+}
+
+// bitTree decodes n bits, most significant first, with the binary
+// tree of probabilities p[1:1<<n].
+func (rd *rangeDecoder) bitTree(p []prob, n uint) uint32 {
+	m := uint32(1)
+	for i := uint(0); i < n; i++ {
+		m = m<<1 | rd.bit(&p[m])
+	}
+	return m - 1<<n
+}
+
+// reverseBitTree is like bitTree but decodes the least significant
+// bit first.
+func (rd *rangeDecoder) reverseBitTree(p []prob, n uint) uint32 {
+	m := uint32(1)
+	var v uint32
+	for i := uint(0); i < n; i++ {
+		b := rd.bit(&p[m])
+		m = m<<1 | b
+		v |= b << i
+	}
+	return v
+}
+
+func initProbs(p []prob) {
+	for i := range p {
+		p[i] = probInit
+	}
+}
+
+const (
+	numStates     = 12
+	maxPosBits    = 4
+	minMatchLen   = 2
+	endPosModel   = 14
+	fullDistances = 1 << (endPosModel >> 1)
+	alignBits     = 4
+)
+
+type lenDecoder struct {
+	choice  prob
+	choice2 prob
+	low     [1 << maxPosBits][1 << 3]prob
+	mid     [1 << maxPosBits][1 << 3]prob
+	high    [1 << 8]prob
+}
+
+func (ld *lenDecoder) init() {
+	ld.choice = probInit
+	ld.choice2 = probInit
+	for i := range ld.low {
+		initProbs(ld.low[i][:])
+		initProbs(ld.mid[i][:])
+	}
+	initProbs(ld.high[:])
+}
+
+func (ld *lenDecoder) decode(rd *rangeDecoder, posState uint32) uint32 {
+	if rd.bit(&ld.choice) == 0 {
+		return rd.bitTree(ld.low[posState][:], 3)
+	}
+	if rd.bit(&ld.choice2) == 0 {
+		return 8 + rd.bitTree(ld.mid[posState][:], 3)
+	}
+	return 16 + rd.bitTree(ld.high[:], 8)
+}
+
+// An lzmaDecoder holds the state of an LZMA decoder, decoding into a
+// window.
+type lzmaDecoder struct {
+	lc, lp, pb uint
+
+	literal    []prob
+	isMatch    [numStates << maxPosBits]prob
+	isRep      [numStates]prob
+	isRepG0    [numStates]prob
+	isRepG1    [numStates]prob
+	isRepG2    [numStates]prob
+	isRep0Long [numStates << maxPosBits]prob
+	posSlot    [4][1 << 6]prob
+	posSpecial [1 + fullDistances - endPosModel]prob
+	align      [1 << alignBits]prob
+	lenDec     lenDecoder
+	repLenDec  lenDecoder
+
+	state   uint32
+	reps    [4]uint32 // distances minus 1
+	pending int       // bytes of the last match not yet copied
+}
+
+// setProps sets the literal context bits, literal position bits and
+// position bits from an LZMA properties byte.
+func (d *lzmaDecoder) setProps(props byte) error {
+	if props >= 9*5*5 {
+		return StructuralError("invalid LZMA properties")
+	}
+	d.lc = uint(props % 9)
+	props /= 9
+	d.lp = uint(props % 5)
+	d.pb = uint(props / 5)
+	if d.pb > maxPosBits {
+		return StructuralError("invalid LZMA properties")
+	}
+	return nil
+}
+
+// resetState resets the probabilities and the state, for the current
+// properties.
+func (d *lzmaDecoder) resetState() {
+	n := 0x300 << (d.lc + d.lp)
+	if cap(d.literal) < n {
+		d.literal = make([]prob, n)
+	}
+	d.literal = d.literal[:n]
+	initProbs(d.literal)
+	initProbs(d.isMatch[:])
+	initProbs(d.isRep[:])
+	initProbs(d.isRepG0[:])
+	initProbs(d.isRepG1[:])
+	initProbs(d.isRepG2[:])
+	initProbs(d.isRep0Long[:])
+	for i := range d.posSlot {
+		initProbs(d.posSlot[i][:])
+	}
+	initProbs(d.posSpecial[:])
+	initProbs(d.align[:])
+	d.lenDec.init()
+	d.repLenDec.init()
+	d.state = 0
+	d.reps = [4]uint32{}
+	d.pending = 0
+}
+
+func (d *lzmaDecoder) decodeLiteral(rd *rangeDecoder, w *window) {
+	var prev uint32
+	if w.total > 0 {
+		prev = uint32(w.byteAt(1))
+	}
+	lit := (uint32(w.total)&(1<<d.lp-1))<<d.lc + prev>>(8-d.lc)
+	p := d.literal[0x300*lit:]
+	sym := uint32(1)
+	if d.state >= 7 {
+		// After a match, the literal is coded relative to the
+		// byte after the match, until a bit differs.
+		match := uint32(w.byteAt(d.reps[0] + 1))
+		for sym < 0x100 {
+			matchBit := match >> 7 & 1
+			match <<= 1
+			b := rd.bit(&p[(1+matchBit)<<8+sym])
+			sym = sym<<1 | b
+			if matchBit != b {
+				break
+			}
+		}
+	}
+	for sym < 0x100 {
+		sym = sym<<1 | rd.bit(&p[sym])
+	}
+	w.put(byte(sym))
+	switch {
+	case d.state < 4:
+		d.state = 0
+	case d.state < 10:
+		d.state -= 3
+	default:
+		d.state -= 6
+	}
+}
+
+func (d *lzmaDecoder) decodeDistance(rd *rangeDecoder, length uint32) uint32 {
+	lenState := length
+	if lenState > 3 {
+		lenState = 3
+	}
+	slot := rd.bitTree(d.posSlot[lenState][:], 6)
+	if slot < 4 {
+		return slot
+	}
+	n := uint(slot>>1 - 1)
+	dist := (2 | slot&1) << n
+	if slot < endPosModel {
+		return dist + rd.reverseBitTree(d.posSpecial[dist-slot:], n)
+	}
+	dist += rd.direct(n-alignBits) << alignBits
+	return dist + rd.reverseBitTree(d.align[:], alignBits)
+}
+
+// decode decodes into w until n more bytes have been decoded or the end
+// marker is found, which it reports. A match may be left unfinished, in
+// d.pending, when n bytes have been decoded.
+func (d *lzmaDecoder) decode(rd *rangeDecoder, w *window, n int) (eos bool, err error) {
+	end := len(w.buf) + n
+	if d.pending > 0 {
+		m := d.pending
+		if m > n {
+			m = n
+		}
+		w.copyMatch(int(d.reps[0])+1, m)
+		d.pending -= m
+	}
+	pbMask := uint32(1)<<d.pb - 1
+	for len(w.buf) < end {
+		if rd.err != nil {
+			return false, noEOF(rd.err)
+		}
+		posState := uint32(w.total) & pbMask
+		if rd.bit(&d.isMatch[d.state<<maxPosBits+posState]) == 0 {
+			if d.state >= 7 && int64(d.reps[0]) >= w.avail() {
+				return false, StructuralError("match distance too large")
+			}
+			d.decodeLiteral(rd, w)
+			continue
+		}
+
+		var length uint32
+		if rd.bit(&d.isRep[d.state]) == 0 {
+			d.reps[3], d.reps[2], d.reps[1] = d.reps[2], d.reps[1], d.reps[0]
+			length = d.lenDec.decode(rd, posState)
+			if d.state < 7 {
+				d.state = 7
+			} else {
+				d.state = 10
+			}
+			d.reps[0] = d.decodeDistance(rd, length)
+			if d.reps[0] == 0xFFFFFFFF {
+				if !rd.finishedOK() {
+					return false, StructuralError("data after end marker")
+				}
+				return true, noEOF(rd.err)
+			}
+		} else {
+			if w.total == 0 {
+				return false, StructuralError("repeated match at start of data")
+			}
+			if rd.bit(&d.isRepG0[d.state]) == 0 {
+				if rd.bit(&d.isRep0Long[d.state<<maxPosBits+posState]) == 0 {
+					// A single byte at the last distance.
+					if d.state < 7 {
+						d.state = 9
+					} else {
+						d.state = 11
+					}
+					if int64(d.reps[0]) >= w.avail() {
+						return false, StructuralError("match distance too large")
+					}
+					w.put(w.byteAt(d.reps[0] + 1))
+					continue
+				}
+			} else {
+				var dist uint32
+				if rd.bit(&d.isRepG1[d.state]) == 0 {
+					dist = d.reps[1]
+				} else {
+					if rd.bit(&d.isRepG2[d.state]) == 0 {
+						dist = d.reps[2]
+					} else {
+						dist = d.reps[3]
+						d.reps[3] = d.reps[2]
+					}
+					d.reps[2] = d.reps[1]
+				}
+				d.reps[1] = d.reps[0]
+				d.reps[0] = dist
+			}
+			length = d.repLenDec.decode(rd, posState)
+			if d.state < 7 {
+				d.state = 8
+			} else {
+				d.state = 11
+			}
+		}
+
+		if int64(d.reps[0]) >= w.avail() {
+			return false, StructuralError("match distance too large")
+		}
+		m := int(length + minMatchLen)
+		if r := end - len(w.buf); m > r {
+			d.pending = m - r
+			m = r
+		}
+		w.copyMatch(int(d.reps[0])+1, m)
+	}
+	return false, noEOF(rd.err)
+}
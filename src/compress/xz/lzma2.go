@@ -0,0 +1,117 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"bytes"
+	"io"
+)
+
+// LZMA2 data is a sequence of chunks, each either uncompressed or LZMA
+// compressed, that may reset the dictionary, the LZMA state or the LZMA
+// properties. A control byte of 0 ends the data.
+
+const maxChunkPacked = 1 << 16
+
+// readChunk reads and decodes the next LZMA2 chunk of the current block.
+func (z *reader) readChunk() error {
+	control, err := z.r.ReadByte()
+	if err != nil {
+		return noEOF(err)
+	}
+	if control == 0 {
+		return z.endBlock()
+	}
+	z.w.slide()
+	start := len(z.w.buf)
+
+	switch {
+	case control == 1 || control == 2:
+		// An uncompressed chunk; 1 resets the dictionary.
+		var buf [2]byte
+		if _, err := io.ReadFull(&z.r, buf[:]); err != nil {
+			return noEOF(err)
+		}
+		if control == 1 {
+			z.w.reset()
+			start = 0
+		} else if z.needDictReset {
+			return StructuralError("missing LZMA2 dictionary reset")
+		}
+		z.needDictReset = false
+		n := int(buf[0])<<8 | int(buf[1]) + 1
+		z.w.buf = append(z.w.buf, make([]byte, n)...)
+		if _, err := io.ReadFull(&z.r, z.w.buf[start:]); err != nil {
+			return noEOF(err)
+		}
+		z.w.total += int64(n)
+
+	case control >= 0x80:
+		var buf [5]byte
+		reset := control >> 5 & 3
+		hdr := buf[:4]
+		if reset >= 2 {
+			hdr = buf[:5]
+		}
+		if _, err := io.ReadFull(&z.r, hdr); err != nil {
+			return noEOF(err)
+		}
+		unpacked := int(control&0x1f)<<16 | int(buf[0])<<8 | int(buf[1]) + 1
+		packed := int(buf[2])<<8 | int(buf[3]) + 1
+		if reset == 3 {
+			z.w.reset()
+			start = 0
+		} else if z.needDictReset {
+			return StructuralError("missing LZMA2 dictionary reset")
+		}
+		z.needDictReset = false
+		if reset >= 2 {
+			if err := z.lzma.setProps(buf[4]); err != nil {
+				return err
+			}
+			if z.lzma.lc+z.lzma.lp > 4 {
+				return StructuralError("invalid LZMA2 properties")
+			}
+			z.needProps = false
+		} else if z.needProps {
+			return StructuralError("missing LZMA2 properties")
+		}
+		if reset >= 1 {
+			z.lzma.resetState()
+		}
+
+		if cap(z.chunk) < maxChunkPacked {
+			z.chunk = make([]byte, maxChunkPacked)
+		}
+		data := z.chunk[:packed]
+		if _, err := io.ReadFull(&z.r, data); err != nil {
+			return noEOF(err)
+		}
+		br := bytes.NewReader(data)
+		if err := z.rd.init(br); err != nil {
+			return noEOF(err)
+		}
+		eos, err := z.lzma.decode(&z.rd, &z.w, unpacked)
+		if err != nil {
+			return err
+		}
+		if eos || z.lzma.pending > 0 || br.Len() != 0 || !z.rd.finishedOK() {
+			return StructuralError("LZMA2 chunk size mismatch")
+		}
+
+	default:
+		return StructuralError("invalid LZMA2 control byte")
+	}
+
+	out := z.w.buf[start:]
+	z.uncompressed += int64(len(out))
+	if z.uncompressedSize >= 0 && z.uncompressed > z.uncompressedSize {
+		return StructuralError("block larger than its uncompressed size")
+	}
+	if z.check != nil {
+		z.check.Write(out)
+	}
+	return nil
+}
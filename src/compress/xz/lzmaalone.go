@@ -0,0 +1,114 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"errors"
+	"io"
+)
+
+// The .lzma format, also called LZMA_Alone, is a 13-byte header of the
+// LZMA properties, the dictionary size and the uncompressed size,
+// followed by a single LZMA stream.
+
+const lzmaStep = 1 << 16 // bytes decoded per call to decode
+
+type lzmaReader struct {
+	r         byteReader
+	err       error
+	rd        rangeDecoder
+	lzma      lzmaDecoder
+	w         window
+	started   bool
+	remaining int64 // or -1 if the size is not known
+}
+
+// NewLZMAReader returns an io.ReadCloser that decompresses data in the
+// legacy .lzma format from r. If r does not also implement
+// io.ByteReader, the decompressor may read more data than necessary
+// from r. It is the caller's responsibility to call Close on the
+// ReadCloser when done.
+func NewLZMAReader(r io.Reader) io.ReadCloser {
+	z := new(lzmaReader)
+	z.r = makeReader(r)
+	return z
+}
+
+func (z *lzmaReader) readHeader() error {
+	var buf [13]byte
+	if _, err := io.ReadFull(z.r, buf[:]); err != nil {
+		return noEOF(err)
+	}
+	if err := z.lzma.setProps(buf[0]); err != nil {
+		return err
+	}
+	z.lzma.resetState()
+	z.w.size = int64(le32(buf[1:]))
+	if z.w.size < 1<<12 {
+		z.w.size = 1 << 12
+	}
+	z.remaining = -1
+	if size := uint64(le32(buf[5:])) | uint64(le32(buf[9:]))<<32; size != 1<<64-1 {
+		if size >= 1<<63 {
+			return StructuralError("uncompressed size too large")
+		}
+		z.remaining = int64(size)
+	}
+	z.started = true
+	return noEOF(z.rd.init(z.r))
+}
+
+func (z *lzmaReader) Read(p []byte) (int, error) {
+	for z.w.off == len(z.w.buf) {
+		if z.err != nil {
+			return 0, z.err
+		}
+		if !z.started {
+			z.err = z.readHeader()
+			continue
+		}
+		z.err = z.decode()
+	}
+	n := copy(p, z.w.buf[z.w.off:])
+	z.w.off += n
+	return n, nil
+}
+
+func (z *lzmaReader) decode() error {
+	n := int64(lzmaStep)
+	if z.remaining >= 0 && n > z.remaining {
+		n = z.remaining
+	}
+	if n == 0 {
+		return io.EOF
+	}
+	z.w.slide()
+	start := len(z.w.buf)
+	eos, err := z.lzma.decode(&z.rd, &z.w, int(n))
+	if err != nil {
+		return err
+	}
+	if z.remaining >= 0 {
+		if eos && int64(len(z.w.buf)-start) != n {
+			return StructuralError("end marker before uncompressed size")
+		}
+		z.remaining -= int64(len(z.w.buf) - start)
+	} else if eos {
+		return io.EOF
+	}
+	return nil
+}
+
+// Close closes the reader. It does not close the underlying io.Reader.
+func (z *lzmaReader) Close() error {
+	if z.err == io.EOF {
+		return nil
+	}
+	if z.err == nil {
+		z.err = errors.New("xz: reader closed")
+		return nil
+	}
+	return z.err
+}
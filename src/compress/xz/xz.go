@@ -0,0 +1,466 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package xz implements decompression of the xz file format, and of
+// the legacy .lzma format that preceded it.
+//
+// An xz file is one or more streams, each a sequence of blocks of data
+// compressed with LZMA2, followed by an index of the blocks. The
+// integrity check of each block, if any, is verified. Only the LZMA2
+// filter is supported; blocks that use other filters, such as the
+// branch converters selected by xz's --x86 option, are rejected.
+//
+// The format is described at http://tukaani.org/xz/xz-file-format.txt.
+package xz
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+)
+
+// A StructuralError is returned when the xz data is found to be
+// syntactically invalid.
+type StructuralError string
+
+func (s StructuralError) Error() string {
+	return "xz data invalid: " + string(s)
+}
+
+// ErrChecksum is returned when reading a block whose integrity check
+// does not match its data.
+var ErrChecksum = errors.New("xz: invalid checksum")
+
+var errFilter = errors.New("xz: unsupported filter")
+
+const (
+	headerMagic = "\xfd7zXZ\x00"
+	footerMagic = "YZ"
+
+	streamHeaderLen = 12
+	streamFooterLen = 12
+
+	lzma2FilterID = 0x21
+)
+
+// Check types.
+const (
+	checkNone   = 0x00
+	checkCRC32  = 0x01
+	checkCRC64  = 0x04
+	checkSHA256 = 0x0A
+)
+
+// checkSizes are the sizes of the checks of each type, including those
+// that are not supported and are skipped.
+var checkSizes = [16]int{0, 4, 4, 4, 8, 8, 8, 16, 16, 16, 32, 32, 32, 64, 64, 64}
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+// byteReader is the input of the decompressor.
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// A countingReader counts the bytes read from it.
+type countingReader struct {
+	r byteReader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (r *countingReader) ReadByte() (byte, error) {
+	c, err := r.r.ReadByte()
+	if err == nil {
+		r.n++
+	}
+	return c, err
+}
+
+// A record is an index record, describing a block.
+type record struct {
+	unpaddedSize     int64
+	uncompressedSize int64
+}
+
+type reader struct {
+	r       countingReader
+	err     error
+	streams int // number of streams started
+
+	w    window
+	lzma lzmaDecoder
+	rd   rangeDecoder
+
+	// The current stream.
+	inStream bool
+	flags    [2]byte
+	records  []record
+
+	// The current block.
+	inBlock          bool
+	headerSize       int64
+	start            int64 // input offset of the compressed data
+	compressedSize   int64 // or -1 if not known
+	uncompressedSize int64 // or -1 if not known
+	uncompressed     int64
+	check            hash.Hash
+	needDictReset    bool
+	needProps        bool
+
+	chunk []byte
+}
+
+// NewReader returns an io.ReadCloser that decompresses xz data from r.
+// If r does not also implement io.ByteReader, the decompressor may read
+// more data than necessary from r. It is the caller's responsibility to
+// call Close on the ReadCloser when done.
+func NewReader(r io.Reader) io.ReadCloser {
+	z := new(reader)
+	z.r.r = makeReader(r)
+	return z
+}
+
+func makeReader(r io.Reader) byteReader {
+	if rr, ok := r.(byteReader); ok {
+		return rr
+	}
+	return bufio.NewReader(r)
+}
+
+func (z *reader) Read(p []byte) (int, error) {
+	for z.w.off == len(z.w.buf) {
+		if z.err != nil {
+			return 0, z.err
+		}
+		switch {
+		case !z.inStream:
+			z.err = z.readStreamHeader()
+		case !z.inBlock:
+			z.err = z.readBlockHeader()
+		default:
+			z.err = z.readChunk()
+		}
+	}
+	n := copy(p, z.w.buf[z.w.off:])
+	z.w.off += n
+	return n, nil
+}
+
+// Close closes the reader. It does not close the underlying io.Reader.
+func (z *reader) Close() error {
+	if z.err == io.EOF {
+		return nil
+	}
+	if z.err == nil {
+		z.err = errors.New("xz: reader closed")
+		return nil
+	}
+	return z.err
+}
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readStreamHeader reads the next stream header, skipping the stream
+// padding before it. It returns io.EOF at the end of the input.
+func (z *reader) readStreamHeader() error {
+	var buf [streamHeaderLen]byte
+	pad := 0
+	for {
+		c, err := z.r.ReadByte()
+		if err == io.EOF && z.streams > 0 {
+			if pad%4 != 0 {
+				return StructuralError("invalid stream padding")
+			}
+			return io.EOF
+		}
+		if err != nil {
+			return noEOF(err)
+		}
+		if c != 0 || z.streams == 0 {
+			buf[0] = c
+			break
+		}
+		pad++
+	}
+	if pad%4 != 0 {
+		return StructuralError("invalid stream padding")
+	}
+	if _, err := io.ReadFull(&z.r, buf[1:]); err != nil {
+		return noEOF(err)
+	}
+	if string(buf[:6]) != headerMagic {
+		return StructuralError("bad magic number")
+	}
+	if err := z.setFlags(buf[6:8]); err != nil {
+		return err
+	}
+	if crc32.ChecksumIEEE(buf[6:8]) != le32(buf[8:]) {
+		return StructuralError("stream header checksum mismatch")
+	}
+	z.streams++
+	z.inStream = true
+	z.records = z.records[:0]
+	return nil
+}
+
+func (z *reader) setFlags(b []byte) error {
+	if b[0] != 0 || b[1]&0xf0 != 0 {
+		return StructuralError("reserved stream flags set")
+	}
+	z.flags = [2]byte{b[0], b[1]}
+	return nil
+}
+
+func le32(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+// readVLI reads a variable-length integer with next.
+func readVLI(next func() (byte, error)) (int64, error) {
+	var v int64
+	for i := uint(0); i < 9; i++ {
+		c, err := next()
+		if err != nil {
+			return 0, err
+		}
+		v |= int64(c&0x7f) << (7 * i)
+		if c&0x80 == 0 {
+			if c == 0 && i > 0 {
+				return 0, StructuralError("non-minimal integer")
+			}
+			return v, nil
+		}
+	}
+	return 0, StructuralError("integer too large")
+}
+
+// readBlockHeader reads the next block header, or the index and stream
+// footer at the end of the stream.
+func (z *reader) readBlockHeader() error {
+	c, err := z.r.ReadByte()
+	if err != nil {
+		return noEOF(err)
+	}
+	if c == 0 {
+		return z.readIndex()
+	}
+	size := (int(c) + 1) * 4
+	hdr := make([]byte, size)
+	hdr[0] = c
+	if _, err := io.ReadFull(&z.r, hdr[1:]); err != nil {
+		return noEOF(err)
+	}
+	if crc32.ChecksumIEEE(hdr[:size-4]) != le32(hdr[size-4:]) {
+		return StructuralError("block header checksum mismatch")
+	}
+	flags := hdr[1]
+	if flags&0x3c != 0 {
+		return StructuralError("reserved block flags set")
+	}
+	p := hdr[2 : size-4]
+	next := func() (byte, error) {
+		if len(p) == 0 {
+			return 0, StructuralError("truncated block header")
+		}
+		c := p[0]
+		p = p[1:]
+		return c, nil
+	}
+	z.compressedSize, z.uncompressedSize = -1, -1
+	if flags&0x40 != 0 {
+		if z.compressedSize, err = readVLI(next); err != nil {
+			return err
+		}
+		if z.compressedSize == 0 {
+			return StructuralError("invalid compressed size")
+		}
+	}
+	if flags&0x80 != 0 {
+		if z.uncompressedSize, err = readVLI(next); err != nil {
+			return err
+		}
+	}
+
+	// The last filter must be LZMA2, and it is the only one supported.
+	if flags&3 != 0 {
+		return errFilter
+	}
+	id, err := readVLI(next)
+	if err != nil {
+		return err
+	}
+	if id != lzma2FilterID {
+		return errFilter
+	}
+	if n, err := readVLI(next); err != nil {
+		return err
+	} else if n != 1 {
+		return StructuralError("invalid LZMA2 properties")
+	}
+	d, err := next()
+	if err != nil {
+		return err
+	}
+	if d > 40 {
+		return StructuralError("invalid LZMA2 dictionary size")
+	}
+	z.w.size = 0xFFFFFFFF
+	if d < 40 {
+		z.w.size = int64(2|d&1) << (d/2 + 11)
+	}
+	for _, c := range p {
+		if c != 0 {
+			return StructuralError("invalid block header padding")
+		}
+	}
+
+	switch z.flags[1] {
+	case checkNone:
+		z.check = nil
+	case checkCRC32:
+		z.check = crc32.NewIEEE()
+	case checkCRC64:
+		z.check = crc64.New(crc64Table)
+	case checkSHA256:
+		z.check = sha256.New()
+	default:
+		// Unsupported checks are skipped.
+		z.check = nil
+	}
+	z.inBlock = true
+	z.headerSize = int64(size)
+	z.start = z.r.n
+	z.uncompressed = 0
+	z.needDictReset = true
+	z.needProps = true
+	return nil
+}
+
+// endBlock reads the block padding and check, after the last chunk of
+// the block.
+func (z *reader) endBlock() error {
+	compressed := z.r.n - z.start
+	if z.compressedSize >= 0 && compressed != z.compressedSize ||
+		z.uncompressedSize >= 0 && z.uncompressed != z.uncompressedSize {
+		return StructuralError("block size mismatch")
+	}
+	for n := compressed; n%4 != 0; n++ {
+		c, err := z.r.ReadByte()
+		if err != nil {
+			return noEOF(err)
+		}
+		if c != 0 {
+			return StructuralError("invalid block padding")
+		}
+	}
+	size := checkSizes[z.flags[1]]
+	var buf [64]byte
+	if _, err := io.ReadFull(&z.r, buf[:size]); err != nil {
+		return noEOF(err)
+	}
+	if z.check != nil {
+		sum := z.check.Sum(nil)
+		if z.flags[1] != checkSHA256 {
+			// CRC32 and CRC64 are stored little-endian.
+			for i, j := 0, len(sum)-1; i < j; i, j = i+1, j-1 {
+				sum[i], sum[j] = sum[j], sum[i]
+			}
+		}
+		if !bytes.Equal(sum, buf[:size]) {
+			return ErrChecksum
+		}
+	}
+	z.records = append(z.records, record{
+		unpaddedSize:     z.headerSize + compressed + int64(size),
+		uncompressedSize: z.uncompressed,
+	})
+	z.inBlock = false
+	return nil
+}
+
+// readIndex reads the index, whose indicator byte has been read, and
+// the stream footer, and checks them against the blocks read.
+func (z *reader) readIndex() error {
+	crc := crc32.Update(0, crc32.IEEETable, []byte{0})
+	size := int64(1)
+	next := func() (byte, error) {
+		c, err := z.r.ReadByte()
+		if err != nil {
+			return 0, noEOF(err)
+		}
+		crc = crc32.Update(crc, crc32.IEEETable, []byte{c})
+		size++
+		return c, nil
+	}
+	n, err := readVLI(next)
+	if err != nil {
+		return err
+	}
+	if n != int64(len(z.records)) {
+		return StructuralError("index does not match blocks")
+	}
+	for _, rec := range z.records {
+		unpadded, err := readVLI(next)
+		if err != nil {
+			return err
+		}
+		uncompressed, err := readVLI(next)
+		if err != nil {
+			return err
+		}
+		if unpadded != rec.unpaddedSize || uncompressed != rec.uncompressedSize {
+			return StructuralError("index does not match blocks")
+		}
+	}
+	for size%4 != 0 {
+		c, err := next()
+		if err != nil {
+			return err
+		}
+		if c != 0 {
+			return StructuralError("invalid index padding")
+		}
+	}
+	var buf [4 + streamFooterLen]byte
+	if _, err := io.ReadFull(&z.r, buf[:]); err != nil {
+		return noEOF(err)
+	}
+	if le32(buf[:]) != crc {
+		return StructuralError("index checksum mismatch")
+	}
+	size += 4
+
+	footer := buf[4:]
+	if string(footer[10:]) != footerMagic {
+		return StructuralError("bad footer magic number")
+	}
+	if crc32.ChecksumIEEE(footer[4:10]) != le32(footer) {
+		return StructuralError("stream footer checksum mismatch")
+	}
+	if (int64(le32(footer[4:]))+1)*4 != size {
+		return StructuralError("stream footer backward size mismatch")
+	}
+	if footer[8] != z.flags[0] || footer[9] != z.flags[1] {
+		return StructuralError("stream footer flags mismatch")
+	}
+	z.inStream = false
+	return nil
+}
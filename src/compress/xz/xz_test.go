@@ -0,0 +1,142 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xz
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func mustReadFile(t testing.TB, name string) []byte {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecompress(t *testing.T) {
+	twain := mustReadFile(t, "../testdata/Mark.Twain-Tom.Sawyer.txt")
+	// The second stream of multi.xz is incompressible, so it is stored
+	// in an uncompressed LZMA2 chunk.
+	multi := append(twain[:20000:20000], mustReadFile(t, "../zstd/testdata/e.txt.zst")[:3000]...)
+	tests := []struct {
+		name string
+		want []byte
+	}{
+		{"crc32.xz", twain[:10000]},
+		{"sha256.xz", twain[:10000]},
+		{"none.xz", twain[:10000]},
+		{"blocks.xz", twain[:60000]}, // CRC64, in blocks of 20000 bytes
+		{"multi.xz", multi},
+	}
+	for _, tt := range tests {
+		in := mustReadFile(t, "testdata/"+tt.name)
+		r := NewReader(bytes.NewReader(in))
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: got %d bytes, want %d matching bytes", tt.name, len(got), len(tt.want))
+		}
+		if err := r.Close(); err != nil {
+			t.Errorf("%s: Close: %v", tt.name, err)
+		}
+	}
+}
+
+func TestLZMA(t *testing.T) {
+	want := mustReadFile(t, "../testdata/Mark.Twain-Tom.Sawyer.txt")[:10000]
+	// twain.lzma has an end marker and no size; twain-size.lzma is
+	// the same stream with the size in its header.
+	for _, name := range []string{"twain.lzma", "twain-size.lzma"} {
+		in := mustReadFile(t, "testdata/"+name)
+		got, err := ioutil.ReadAll(NewLZMAReader(bytes.NewReader(in)))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: wrong output", name)
+		}
+	}
+}
+
+func TestTar(t *testing.T) {
+	f := bytes.NewReader(mustReadFile(t, "testdata/twain.tar.xz"))
+	tr := tar.NewReader(NewReader(f))
+	want := []struct {
+		name string
+		size int64
+	}{
+		{"a.txt", 6},
+		{"d/twain.txt", 10000},
+	}
+	for _, w := range want {
+		hdr, err := tr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name != w.name || hdr.Size != w.size {
+			t.Errorf("got %s of %d bytes, want %s of %d bytes", hdr.Name, hdr.Size, w.name, w.size)
+		}
+		if n, err := io.Copy(ioutil.Discard, tr); err != nil || n != w.size {
+			t.Errorf("%s: read %d bytes, %v", w.name, n, err)
+		}
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Errorf("got %v after the last file, want EOF", err)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	for _, name := range []string{"crc32.xz", "sha256.xz", "blocks.xz"} {
+		in := append([]byte(nil), mustReadFile(t, "testdata/"+name)...)
+		// Damage the check of the last block, just before the
+		// index, whose size is in the stream footer.
+		footer := in[len(in)-streamFooterLen:]
+		i := len(in) - streamFooterLen - int(le32(footer[4:])+1)*4
+		in[i-1] ^= 1
+		if _, err := ioutil.ReadAll(NewReader(bytes.NewReader(in))); err != ErrChecksum {
+			t.Errorf("%s: got %v, want %v", name, err, ErrChecksum)
+		}
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	in := mustReadFile(t, "testdata/blocks.xz")
+	for _, n := range []int{0, 5, 20, len(in) / 2, len(in) - 1} {
+		_, err := ioutil.ReadAll(NewReader(bytes.NewReader(in[:n])))
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("truncated to %d bytes: got %v, want %v", n, err, io.ErrUnexpectedEOF)
+		}
+	}
+	for i := 0; i < len(in); i += 97 {
+		b := append([]byte(nil), in...)
+		b[i] ^= 0x55
+		if _, err := ioutil.ReadAll(NewReader(bytes.NewReader(b))); err == nil {
+			t.Errorf("damaged byte %d: no error", i)
+		}
+	}
+	// Stream padding must be a multiple of 4 bytes.
+	b := append(mustReadFile(t, "testdata/none.xz"), 0, 0)
+	if _, err := ioutil.ReadAll(NewReader(bytes.NewReader(b))); err == nil {
+		t.Error("bad stream padding: no error")
+	}
+}
+
+func BenchmarkDecodeTwain(b *testing.B) {
+	in := mustReadFile(b, "testdata/blocks.xz")
+	b.SetBytes(60000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		io.Copy(ioutil.Discard, NewReader(bytes.NewReader(in)))
+	}
+}
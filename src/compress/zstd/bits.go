@@ -0,0 +1,129 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+// highBit returns the index of the most significant set bit of v,
+// which must not be zero.
+func highBit(v uint32) uint {
+	n := uint(0)
+	for v > 1 {
+		v >>= 1
+		n++
+	}
+	return n
+}
+
+// A forwardBitReader reads bits from the start of b, least significant
+// bit first, as FSE table descriptions are written.
+type forwardBitReader struct {
+	b   []byte
+	off uint // offset in bits
+}
+
+// peek returns the next n bits, n <= 16, without consuming them.
+// Bits past the end of b are zero.
+func (r *forwardBitReader) peek(n uint) uint32 {
+	var v uint32
+	i := r.off >> 3
+	for k := uint(0); k < 4 && i+k < uint(len(r.b)); k++ {
+		v |= uint32(r.b[i+k]) << (8 * k)
+	}
+	return v >> (r.off & 7) & (1<<n - 1)
+}
+
+// skip consumes n bits.
+func (r *forwardBitReader) skip(n uint) {
+	r.off += n
+}
+
+// overflow reports whether more bits have been consumed than b holds.
+func (r *forwardBitReader) overflow() bool {
+	return r.off > 8*uint(len(r.b))
+}
+
+// bytes returns the number of bytes that hold the consumed bits.
+func (r *forwardBitReader) bytes() int {
+	return int(r.off+7) >> 3
+}
+
+// A backwardBitReader reads a bitstream that was written forwards but
+// is read from the end: the first bits read are the most significant
+// bits of the last byte, below the 1 bit that marks where the stream
+// starts. Huffman streams and FSE streams are read this way.
+type backwardBitReader struct {
+	data     []byte
+	off      int    // data[:off] has not been loaded yet
+	bits     uint64 // the low nbits bits hold the loaded bits
+	nbits    uint
+	overread uint // zero bits supplied past the start of data
+}
+
+func (r *backwardBitReader) init(data []byte) error {
+	if len(data) == 0 {
+		return StructuralError("empty bitstream")
+	}
+	last := data[len(data)-1]
+	if last == 0 {
+		return StructuralError("missing bitstream start marker")
+	}
+	r.data = data
+	r.off = len(data) - 1
+	r.bits = uint64(last)
+	r.nbits = highBit(uint32(last))
+	r.overread = 0
+	return nil
+}
+
+func (r *backwardBitReader) fill() {
+	for r.nbits <= 56 && r.off > 0 {
+		r.off--
+		r.bits = r.bits<<8 | uint64(r.data[r.off])
+		r.nbits += 8
+	}
+}
+
+// peek returns the next n bits, n <= 32, without consuming them.
+// Bits past the start of the data are zero.
+func (r *backwardBitReader) peek(n uint) uint32 {
+	if r.nbits < n {
+		r.fill()
+	}
+	if r.nbits >= n {
+		return uint32(r.bits>>(r.nbits-n)) & (1<<n - 1)
+	}
+	return uint32(r.bits<<(n-r.nbits)) & (1<<n - 1)
+}
+
+// consume consumes n bits.
+func (r *backwardBitReader) consume(n uint) {
+	if r.nbits >= n {
+		r.nbits -= n
+		return
+	}
+	r.overread += n - r.nbits
+	r.nbits = 0
+}
+
+// read reads n bits, n <= 32.
+func (r *backwardBitReader) read(n uint) uint32 {
+	if n == 0 {
+		return 0
+	}
+	v := r.peek(n)
+	r.consume(n)
+	return v
+}
+
+// overflow reports whether more bits have been read than the stream
+// holds.
+func (r *backwardBitReader) overflow() bool {
+	return r.overread > 0
+}
+
+// finished reports whether exactly all bits of the stream have been
+// read.
+func (r *backwardBitReader) finished() bool {
+	return r.off == 0 && r.nbits == 0 && r.overread == 0
+}
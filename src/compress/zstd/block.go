@@ -0,0 +1,398 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+// Compressed blocks, section 3.1.1.3 of RFC 8478.
+
+const (
+	maxLitLenCode   = 35
+	maxMatchLenCode = 52
+	maxOffsetCode   = 31
+
+	maxLitLenLog   = 9
+	maxMatchLenLog = 9
+	maxOffsetLog   = 8
+)
+
+// Baselines and extra bits of the literal length and match length
+// codes.
+var (
+	litLenBase = [maxLitLenCode + 1]uint32{
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512,
+		1024, 2048, 4096, 8192, 16384, 32768, 65536,
+	}
+	litLenBits = [maxLitLenCode + 1]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9,
+		10, 11, 12, 13, 14, 15, 16,
+	}
+	matchLenBase = [maxMatchLenCode + 1]uint32{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
+		19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+		35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259,
+		515, 1027, 2051, 4099, 8195, 16387, 32771, 65539,
+	}
+	matchLenBits = [maxMatchLenCode + 1]uint8{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8,
+		9, 10, 11, 12, 13, 14, 15, 16,
+	}
+)
+
+// The predefined distributions, used by sequences in Predefined_Mode.
+var (
+	predefLitLen, predefMatchLen, predefOffset fseTable
+)
+
+func init() {
+	predefLitLen.build([]int16{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1,
+	}, 6)
+	predefMatchLen.build([]int16{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1,
+	}, 6)
+	predefOffset.build([]int16{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+	}, 5)
+}
+
+const (
+	litsRaw = iota
+	litsRLE
+	litsCompressed
+	litsTreeless
+)
+
+// decodeBlock decodes the compressed block b, appending its output to
+// z.hist.
+func (z *reader) decodeBlock(b []byte) error {
+	lits, n, err := z.decodeLiterals(b)
+	if err != nil {
+		return err
+	}
+	return z.decodeSequences(b[n:], lits)
+}
+
+// decodeLiterals decodes the literals section at the start of b. It
+// returns the literals and the size of the section.
+func (z *reader) decodeLiterals(b []byte) ([]byte, int, error) {
+	if len(b) == 0 {
+		return nil, 0, StructuralError("missing literals section")
+	}
+	typ := b[0] & 3
+	sizeFormat := b[0] >> 2 & 3
+
+	if typ == litsRaw || typ == litsRLE {
+		var size, hdr int
+		switch sizeFormat {
+		case 0, 2:
+			size, hdr = int(b[0]>>3), 1
+		case 1:
+			if len(b) < 2 {
+				return nil, 0, StructuralError("truncated literals header")
+			}
+			size, hdr = int(b[0]>>4)|int(b[1])<<4, 2
+		case 3:
+			if len(b) < 3 {
+				return nil, 0, StructuralError("truncated literals header")
+			}
+			size, hdr = int(b[0]>>4)|int(b[1])<<4|int(b[2])<<12, 3
+		}
+		if size > maxBlockSize {
+			return nil, 0, StructuralError("too many literals")
+		}
+		if typ == litsRaw {
+			if len(b) < hdr+size {
+				return nil, 0, StructuralError("truncated literals")
+			}
+			return b[hdr : hdr+size], hdr + size, nil
+		}
+		if len(b) < hdr+1 {
+			return nil, 0, StructuralError("truncated literals")
+		}
+		lits := z.litBuf(size)
+		for i := range lits {
+			lits[i] = b[hdr]
+		}
+		return lits, hdr + 1, nil
+	}
+
+	// Huffman-coded literals, in one stream or four.
+	var regen, comp, hdr int
+	switch sizeFormat {
+	case 0, 1:
+		if len(b) < 3 {
+			return nil, 0, StructuralError("truncated literals header")
+		}
+		h := int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+		regen, comp, hdr = h>>4&0x3ff, h>>14&0x3ff, 3
+	case 2:
+		if len(b) < 4 {
+			return nil, 0, StructuralError("truncated literals header")
+		}
+		h := int(le32(b))
+		regen, comp, hdr = h>>4&0x3fff, h>>18&0x3fff, 4
+	case 3:
+		if len(b) < 5 {
+			return nil, 0, StructuralError("truncated literals header")
+		}
+		h := int64(le32(b)) | int64(b[4])<<32
+		regen, comp, hdr = int(h>>4&0x3ffff), int(h>>22&0x3ffff), 5
+	}
+	if regen > maxBlockSize {
+		return nil, 0, StructuralError("too many literals")
+	}
+	if len(b) < hdr+comp {
+		return nil, 0, StructuralError("truncated literals")
+	}
+	data := b[hdr : hdr+comp]
+	if typ == litsCompressed {
+		t, n, err := readHuffTable(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		z.huff = t
+		data = data[n:]
+	} else if z.huff == nil {
+		return nil, 0, StructuralError("treeless literals without a previous Huffman table")
+	}
+
+	lits := z.litBuf(regen)
+	if sizeFormat == 0 {
+		if err := z.huff.decode(lits, data); err != nil {
+			return nil, 0, err
+		}
+		return lits, hdr + comp, nil
+	}
+
+	// Four streams, with a jump table of the sizes of the first three.
+	if len(data) < 6 {
+		return nil, 0, StructuralError("truncated literals jump table")
+	}
+	var sizes [4]int
+	sizes[0] = int(data[0]) | int(data[1])<<8
+	sizes[1] = int(data[2]) | int(data[3])<<8
+	sizes[2] = int(data[4]) | int(data[5])<<8
+	data = data[6:]
+	sizes[3] = len(data) - sizes[0] - sizes[1] - sizes[2]
+	if sizes[3] < 0 {
+		return nil, 0, StructuralError("invalid literals jump table")
+	}
+	seg := (regen + 3) / 4
+	if 3*seg > regen {
+		return nil, 0, StructuralError("too few literals for four streams")
+	}
+	out := lits
+	for i, size := range sizes {
+		n := seg
+		if i == 3 {
+			n = len(out)
+		}
+		if err := z.huff.decode(out[:n], data[:size]); err != nil {
+			return nil, 0, err
+		}
+		out = out[n:]
+		data = data[size:]
+	}
+	return lits, hdr + comp, nil
+}
+
+func (z *reader) litBuf(n int) []byte {
+	if cap(z.lits) < n {
+		z.lits = make([]byte, n, maxBlockSize)
+	}
+	return z.lits[:n]
+}
+
+// Symbol compression modes of the sequences section.
+const (
+	modePredefined = iota
+	modeRLE
+	modeFSE
+	modeRepeat
+)
+
+// decodeSequences decodes the sequences section b and executes the
+// sequences with the literals lits, appending to z.hist.
+func (z *reader) decodeSequences(b []byte, lits []byte) error {
+	if len(b) == 0 {
+		return StructuralError("missing sequences section")
+	}
+	var nseq int
+	switch {
+	case b[0] < 128:
+		nseq, b = int(b[0]), b[1:]
+	case b[0] < 255:
+		if len(b) < 2 {
+			return StructuralError("truncated sequences header")
+		}
+		nseq, b = int(b[0]-128)<<8|int(b[1]), b[2:]
+	default:
+		if len(b) < 3 {
+			return StructuralError("truncated sequences header")
+		}
+		nseq, b = int(b[1])|int(b[2])<<8+0x7f00, b[3:]
+	}
+	if nseq == 0 {
+		if len(b) != 0 {
+			return StructuralError("extra data after sequences")
+		}
+		z.hist = append(z.hist, lits...)
+		return nil
+	}
+
+	if len(b) == 0 {
+		return StructuralError("truncated sequences header")
+	}
+	modes := b[0]
+	if modes&3 != 0 {
+		return StructuralError("reserved sequence mode bits set")
+	}
+	b = b[1:]
+	var err error
+	if z.ll, b, err = seqTable(b, modes>>6, z.ll, &predefLitLen, maxLitLenCode, maxLitLenLog); err != nil {
+		return err
+	}
+	if z.of, b, err = seqTable(b, modes>>4&3, z.of, &predefOffset, maxOffsetCode, maxOffsetLog); err != nil {
+		return err
+	}
+	if z.ml, b, err = seqTable(b, modes>>2&3, z.ml, &predefMatchLen, maxMatchLenCode, maxMatchLenLog); err != nil {
+		return err
+	}
+
+	var br backwardBitReader
+	if err := br.init(b); err != nil {
+		return err
+	}
+	var ll, of, ml fseState
+	ll.init(z.ll, &br)
+	of.init(z.of, &br)
+	ml.init(z.ml, &br)
+
+	start := len(z.hist)
+	for i := 0; i < nseq; i++ {
+		ofCode, mlCode, llCode := of.symbol(), ml.symbol(), ll.symbol()
+		if ofCode > maxOffsetCode || mlCode > maxMatchLenCode || llCode > maxLitLenCode {
+			return StructuralError("invalid sequence code")
+		}
+		ofValue := uint32(1)<<ofCode + br.read(uint(ofCode))
+		matchLen := matchLenBase[mlCode] + br.read(uint(matchLenBits[mlCode]))
+		litLen := litLenBase[llCode] + br.read(uint(litLenBits[llCode]))
+		if i != nseq-1 {
+			ll.update(&br)
+			ml.update(&br)
+			of.update(&br)
+		}
+		if br.overflow() {
+			return StructuralError("truncated sequences")
+		}
+
+		offset, err := z.offset(ofValue, litLen)
+		if err != nil {
+			return err
+		}
+		if litLen > uint32(len(lits)) {
+			return StructuralError("sequence literal length too large")
+		}
+		z.hist = append(z.hist, lits[:litLen]...)
+		lits = lits[litLen:]
+
+		if offset > uint32(len(z.hist)) || offset > z.maxOffset {
+			return StructuralError("sequence offset too large")
+		}
+		if len(z.hist)-start+int(matchLen) > maxBlockSize {
+			return StructuralError("block too large")
+		}
+		z.copyMatch(int(offset), int(matchLen))
+	}
+	if !br.finished() {
+		return StructuralError("invalid sequences bitstream")
+	}
+	z.hist = append(z.hist, lits...)
+	return nil
+}
+
+// seqTable returns the decoding table selected by mode, and the rest of
+// b after any table description.
+func seqTable(b []byte, mode uint8, prev, predef *fseTable, maxSymbol int, maxLog uint) (*fseTable, []byte, error) {
+	switch mode {
+	case modePredefined:
+		return predef, b, nil
+	case modeRLE:
+		if len(b) == 0 {
+			return nil, nil, StructuralError("truncated sequences header")
+		}
+		if int(b[0]) > maxSymbol {
+			return nil, nil, StructuralError("invalid sequence code")
+		}
+		return rleTable(b[0]), b[1:], nil
+	case modeFSE:
+		t, n, err := readFSETable(b, maxSymbol, maxLog)
+		if err != nil {
+			return nil, nil, err
+		}
+		return t, b[n:], nil
+	}
+	if prev == nil {
+		return nil, nil, StructuralError("repeated sequence table without a previous table")
+	}
+	return prev, b, nil
+}
+
+// offset returns the match offset for an offset value, updating the
+// repeat offsets as section 3.1.2.5 of RFC 8478 describes.
+func (z *reader) offset(ofValue, litLen uint32) (uint32, error) {
+	if ofValue > 3 {
+		z.reps = [3]uint32{ofValue - 3, z.reps[0], z.reps[1]}
+		return z.reps[0], nil
+	}
+	i := ofValue - 1
+	if litLen == 0 {
+		i++
+	}
+	var offset uint32
+	switch i {
+	case 0:
+		return z.reps[0], nil
+	case 1:
+		offset = z.reps[1]
+		z.reps[1] = z.reps[0]
+		z.reps[0] = offset
+		return offset, nil
+	case 2:
+		offset = z.reps[2]
+	case 3:
+		offset = z.reps[0] - 1
+		if offset == 0 {
+			return 0, StructuralError("invalid repeat offset")
+		}
+	}
+	z.reps = [3]uint32{offset, z.reps[0], z.reps[1]}
+	return offset, nil
+}
+
+// copyMatch appends n bytes from offset bytes back to z.hist.
+func (z *reader) copyMatch(offset, n int) {
+	src := len(z.hist) - offset
+	for n > 0 {
+		// The source may overlap what is being appended, so copy
+		// at most offset bytes at a time.
+		m := n
+		if m > offset {
+			m = offset
+		}
+		z.hist = append(z.hist, z.hist[src:src+m]...)
+		src += m
+		n -= m
+	}
+}
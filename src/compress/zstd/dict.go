@@ -0,0 +1,62 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+const dictMagic = 0xEC30A437
+
+// A dictionary primes the decoder at the start of each frame, as
+// described in section 5 of RFC 8478.
+type dictionary struct {
+	id      uint32
+	content []byte
+
+	// Entropy tables and repeat offsets, if the dictionary is not
+	// raw content.
+	huff       *huffTable
+	ll, of, ml *fseTable
+	reps       [3]uint32
+}
+
+// parseDict parses a dictionary. Data that does not start with the
+// dictionary magic number is used as raw content, with an ID of 0.
+func parseDict(b []byte) (*dictionary, error) {
+	d := &dictionary{reps: [3]uint32{1, 4, 8}}
+	if len(b) < 8 || le32(b) != dictMagic {
+		d.content = b
+		return d, nil
+	}
+	d.id = le32(b[4:])
+	b = b[8:]
+
+	var n int
+	var err error
+	if d.huff, n, err = readHuffTable(b); err != nil {
+		return nil, err
+	}
+	b = b[n:]
+	if d.of, n, err = readFSETable(b, maxOffsetCode, maxOffsetLog); err != nil {
+		return nil, err
+	}
+	b = b[n:]
+	if d.ml, n, err = readFSETable(b, maxMatchLenCode, maxMatchLenLog); err != nil {
+		return nil, err
+	}
+	b = b[n:]
+	if d.ll, n, err = readFSETable(b, maxLitLenCode, maxLitLenLog); err != nil {
+		return nil, err
+	}
+	b = b[n:]
+	if len(b) < 12 {
+		return nil, StructuralError("truncated dictionary")
+	}
+	d.content = b[12:]
+	for i := range d.reps {
+		d.reps[i] = le32(b[4*i:])
+		if d.reps[i] == 0 || d.reps[i] > uint32(len(d.content)) {
+			return nil, StructuralError("invalid dictionary repeat offset")
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+// Finite State Entropy (FSE) decoding, section 4.1 of RFC 8478.
+
+// An fseEntry is a decoding table state: the symbol it decodes, and
+// how to compute the next state from nbBits more bits of input.
+type fseEntry struct {
+	symbol   uint8
+	nbBits   uint8
+	newState uint16
+}
+
+// An fseTable is an FSE decoding table.
+type fseTable struct {
+	accuracyLog uint
+	entries     []fseEntry
+}
+
+// readFSETable reads an FSE table description for symbols up to
+// maxSymbol with an accuracy log of at most maxLog from the start of b.
+// It returns the table and the number of bytes of b that it used.
+func readFSETable(b []byte, maxSymbol int, maxLog uint) (*fseTable, int, error) {
+	if len(b) == 0 {
+		return nil, 0, StructuralError("missing FSE table")
+	}
+	br := forwardBitReader{b: b}
+	accuracyLog := uint(br.peek(4)) + 5
+	br.skip(4)
+	if accuracyLog > maxLog {
+		return nil, 0, StructuralError("FSE accuracy log too large")
+	}
+
+	var counts [256]int16
+	remaining := 1<<accuracyLog + 1
+	threshold := 1 << accuracyLog
+	nbBits := accuracyLog + 1
+	sym := 0
+	prev0 := false
+	for remaining > 1 && sym <= maxSymbol {
+		if prev0 {
+			// A zero probability is followed by a repeat count
+			// of further zeros, in 2-bit fields; 3 means that
+			// another field follows.
+			n0 := sym
+			for {
+				rep := int(br.peek(2))
+				br.skip(2)
+				n0 += rep
+				if rep != 3 {
+					break
+				}
+				if br.overflow() {
+					return nil, 0, StructuralError("truncated FSE table")
+				}
+			}
+			if n0 > maxSymbol {
+				return nil, 0, StructuralError("too many FSE symbols")
+			}
+			sym = n0
+		}
+
+		max := 2*threshold - 1 - remaining
+		var count int
+		if v := int(br.peek(nbBits - 1)); v < max {
+			count = v
+			br.skip(nbBits - 1)
+		} else {
+			count = int(br.peek(nbBits))
+			if count >= threshold {
+				count -= max
+			}
+			br.skip(nbBits)
+		}
+		count-- // -1 means a probability of "less than 1"
+		if count < 0 {
+			remaining += count
+		} else {
+			remaining -= count
+		}
+		if remaining < 1 {
+			return nil, 0, StructuralError("invalid FSE probabilities")
+		}
+		counts[sym] = int16(count)
+		sym++
+		prev0 = count == 0
+		for remaining < threshold {
+			nbBits--
+			threshold >>= 1
+		}
+	}
+	if remaining != 1 || br.overflow() {
+		return nil, 0, StructuralError("invalid FSE table")
+	}
+	t := new(fseTable)
+	if err := t.build(counts[:sym], accuracyLog); err != nil {
+		return nil, 0, err
+	}
+	return t, br.bytes(), nil
+}
+
+// build builds the decoding table for the normalized symbol counts,
+// which add up to 1<<accuracyLog.
+func (t *fseTable) build(counts []int16, accuracyLog uint) error {
+	size := 1 << accuracyLog
+	t.accuracyLog = accuracyLog
+	t.entries = make([]fseEntry, size)
+
+	// Symbols with a probability of "less than 1" take one state
+	// each at the end of the table; the others are spread over the
+	// rest of it.
+	var next [256]uint16
+	high := size - 1
+	for s, c := range counts {
+		if c == -1 {
+			t.entries[high].symbol = uint8(s)
+			high--
+			next[s] = 1
+		} else if c > 0 {
+			next[s] = uint16(c)
+		}
+	}
+	step := size>>1 + size>>3 + 3
+	mask := size - 1
+	pos := 0
+	for s, c := range counts {
+		for i := 0; i < int(c); i++ {
+			t.entries[pos].symbol = uint8(s)
+			for {
+				pos = (pos + step) & mask
+				if pos <= high {
+					break
+				}
+			}
+		}
+	}
+	if pos != 0 {
+		return StructuralError("invalid FSE probabilities")
+	}
+
+	for i := range t.entries {
+		e := &t.entries[i]
+		n := next[e.symbol]
+		next[e.symbol]++
+		nb := accuracyLog - highBit(uint32(n))
+		e.nbBits = uint8(nb)
+		e.newState = uint16(int(n)<<nb - size)
+	}
+	return nil
+}
+
+// rleTable returns a table that always decodes sym.
+func rleTable(sym uint8) *fseTable {
+	return &fseTable{entries: []fseEntry{{symbol: sym}}}
+}
+
+// An fseState is the state of an FSE decoder.
+type fseState struct {
+	t     *fseTable
+	state uint32
+}
+
+func (s *fseState) init(t *fseTable, br *backwardBitReader) {
+	s.t = t
+	s.state = br.read(t.accuracyLog)
+}
+
+func (s *fseState) symbol() uint8 {
+	return s.t.entries[s.state].symbol
+}
+
+func (s *fseState) update(br *backwardBitReader) {
+	e := &s.t.entries[s.state]
+	s.state = uint32(e.newState) + br.read(uint(e.nbBits))
+}
@@ -0,0 +1,151 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+// Huffman decoding of literals, section 4.2 of RFC 8478.
+
+const (
+	maxHuffBits      = 11 // longest Huffman code
+	maxHuffWeightLog = 6  // FSE accuracy log for compressed weights
+)
+
+type huffEntry struct {
+	symbol uint8
+	nbBits uint8
+}
+
+// A huffTable is indexed by the next maxBits bits of a stream.
+type huffTable struct {
+	maxBits uint
+	entries []huffEntry
+}
+
+// readHuffTable reads a Huffman tree description from the start of b.
+// It returns the table and the number of bytes of b that it used.
+func readHuffTable(b []byte) (*huffTable, int, error) {
+	if len(b) == 0 {
+		return nil, 0, StructuralError("missing Huffman tree")
+	}
+	var weights [256]uint8
+	nw := 0 // number of weights; the last symbol's weight is implied
+	hdr := int(b[0])
+	var used int
+	if hdr < 128 {
+		// The weights are FSE compressed in hdr bytes, decoded
+		// with two interleaved states.
+		used = 1 + hdr
+		if len(b) < used {
+			return nil, 0, StructuralError("truncated Huffman tree")
+		}
+		data := b[1:used]
+		t, n, err := readFSETable(data, maxHuffBits+1, maxHuffWeightLog)
+		if err != nil {
+			return nil, 0, err
+		}
+		var br backwardBitReader
+		if err := br.init(data[n:]); err != nil {
+			return nil, 0, err
+		}
+		var s1, s2 fseState
+		s1.init(t, &br)
+		s2.init(t, &br)
+		for {
+			if nw >= len(weights)-2 {
+				return nil, 0, StructuralError("too many Huffman weights")
+			}
+			weights[nw] = s1.symbol()
+			nw++
+			s1.update(&br)
+			if br.overflow() {
+				weights[nw] = s2.symbol()
+				nw++
+				break
+			}
+			weights[nw] = s2.symbol()
+			nw++
+			s2.update(&br)
+			if br.overflow() {
+				weights[nw] = s1.symbol()
+				nw++
+				break
+			}
+		}
+	} else {
+		// The weights are stored directly, 4 bits each.
+		nw = hdr - 127
+		used = 1 + (nw+1)/2
+		if len(b) < used {
+			return nil, 0, StructuralError("truncated Huffman tree")
+		}
+		for i := 0; i < nw; i++ {
+			w := b[1+i/2]
+			if i%2 == 0 {
+				w >>= 4
+			}
+			weights[i] = w & 0xf
+		}
+	}
+
+	// The weights of all but the last symbol add up to less than the
+	// next power of two; the last symbol makes up the difference.
+	total := uint32(0)
+	for _, w := range weights[:nw] {
+		if w > maxHuffBits {
+			return nil, 0, StructuralError("invalid Huffman weight")
+		}
+		if w > 0 {
+			total += 1 << (w - 1)
+		}
+	}
+	if total == 0 {
+		return nil, 0, StructuralError("invalid Huffman weights")
+	}
+	maxBits := highBit(total) + 1
+	if maxBits > maxHuffBits {
+		return nil, 0, StructuralError("Huffman code too long")
+	}
+	rest := uint32(1)<<maxBits - total
+	if rest&(rest-1) != 0 {
+		return nil, 0, StructuralError("invalid Huffman weights")
+	}
+	weights[nw] = uint8(highBit(rest) + 1)
+	nw++
+
+	// Codes are assigned in order of increasing weight, then symbol,
+	// so a table entry is found by the code's bits followed by any
+	// bits at all.
+	t := &huffTable{maxBits: maxBits, entries: make([]huffEntry, 1<<maxBits)}
+	pos := 0
+	for w := uint8(1); w <= uint8(maxBits); w++ {
+		for s, sw := range weights[:nw] {
+			if sw != w {
+				continue
+			}
+			e := huffEntry{symbol: uint8(s), nbBits: uint8(maxBits) + 1 - w}
+			for i := 0; i < 1<<(w-1); i++ {
+				t.entries[pos] = e
+				pos++
+			}
+		}
+	}
+	return t, used, nil
+}
+
+// decode decodes the Huffman stream src to fill dst.
+func (t *huffTable) decode(dst, src []byte) error {
+	var br backwardBitReader
+	if err := br.init(src); err != nil {
+		return err
+	}
+	for i := range dst {
+		e := t.entries[br.peek(t.maxBits)]
+		dst[i] = e.symbol
+		br.consume(uint(e.nbBits))
+	}
+	if !br.finished() {
+		return StructuralError("invalid Huffman stream")
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+// XXH64 with a seed of 0, whose low 32 bits are the content checksum of
+// a frame. See https://github.com/Cyan4973/xxHash.
+
+const (
+	prime64_1 = 11400714785074694791
+	prime64_2 = 14029467366897019727
+	prime64_3 = 1609587929392839161
+	prime64_4 = 9650029242287828579
+	prime64_5 = 2870177450012600261
+)
+
+type xxhash64 struct {
+	v     [4]uint64
+	total uint64
+	mem   [32]byte
+	n     int // bytes in mem
+}
+
+func (h *xxhash64) reset() {
+	p1, p2 := uint64(prime64_1), uint64(prime64_2)
+	h.v = [4]uint64{p1 + p2, p2, 0, -p1}
+	h.total = 0
+	h.n = 0
+}
+
+func rol64(x uint64, r uint) uint64 {
+	return x<<r | x>>(64-r)
+}
+
+func le64(b []byte) uint64 {
+	_ = b[7]
+	return uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16 | uint64(b[3])<<24 |
+		uint64(b[4])<<32 | uint64(b[5])<<40 | uint64(b[6])<<48 | uint64(b[7])<<56
+}
+
+func le32(b []byte) uint32 {
+	_ = b[3]
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * prime64_2
+	return rol64(acc, 31) * prime64_1
+}
+
+func xxMergeRound(acc, val uint64) uint64 {
+	acc ^= xxRound(0, val)
+	return acc*prime64_1 + prime64_4
+}
+
+func (h *xxhash64) write(b []byte) {
+	h.total += uint64(len(b))
+	if h.n > 0 {
+		n := copy(h.mem[h.n:], b)
+		h.n += n
+		b = b[n:]
+		if h.n < len(h.mem) {
+			return
+		}
+		h.stripes(h.mem[:])
+		h.n = 0
+	}
+	n := len(b) &^ 31
+	h.stripes(b[:n])
+	h.n = copy(h.mem[:], b[n:])
+}
+
+// stripes hashes b, whose length is a multiple of 32.
+func (h *xxhash64) stripes(b []byte) {
+	v0, v1, v2, v3 := h.v[0], h.v[1], h.v[2], h.v[3]
+	for ; len(b) >= 32; b = b[32:] {
+		v0 = xxRound(v0, le64(b[0:]))
+		v1 = xxRound(v1, le64(b[8:]))
+		v2 = xxRound(v2, le64(b[16:]))
+		v3 = xxRound(v3, le64(b[24:]))
+	}
+	h.v = [4]uint64{v0, v1, v2, v3}
+}
+
+func (h *xxhash64) sum64() uint64 {
+	var x uint64
+	if h.total >= 32 {
+		v := &h.v
+		x = rol64(v[0], 1) + rol64(v[1], 7) + rol64(v[2], 12) + rol64(v[3], 18)
+		for _, vi := range v {
+			x = xxMergeRound(x, vi)
+		}
+	} else {
+		x = prime64_5
+	}
+	x += h.total
+
+	b := h.mem[:h.n]
+	for ; len(b) >= 8; b = b[8:] {
+		x ^= xxRound(0, le64(b))
+		x = rol64(x, 27)*prime64_1 + prime64_4
+	}
+	if len(b) >= 4 {
+		x ^= uint64(le32(b)) * prime64_1
+		x = rol64(x, 23)*prime64_2 + prime64_3
+		b = b[4:]
+	}
+	for _, c := range b {
+		x ^= uint64(c) * prime64_5
+		x = rol64(x, 11) * prime64_1
+	}
+
+	x ^= x >> 33
+	x *= prime64_2
+	x ^= x >> 29
+	x *= prime64_3
+	x ^= x >> 32
+	return x
+}
@@ -0,0 +1,374 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package zstd implements decompression of the Zstandard format, as
+// specified in RFC 8478.
+//
+// A Zstandard stream is a sequence of frames, each of which may be
+// preceded or followed by skippable frames. The decompressed data is
+// the concatenation of the frames' contents.
+package zstd
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// A StructuralError is returned when the Zstandard data is found to be
+// syntactically invalid.
+type StructuralError string
+
+func (s StructuralError) Error() string {
+	return "zstd data invalid: " + string(s)
+}
+
+var (
+	// ErrChecksum is returned when reading a frame whose content
+	// checksum does not match its data.
+	ErrChecksum = errors.New("zstd: invalid checksum")
+	// ErrDictionary is returned when reading a frame that needs a
+	// dictionary other than the one given to NewReaderDict.
+	ErrDictionary = errors.New("zstd: wrong dictionary")
+)
+
+var errWindowSize = errors.New("zstd: window size too large")
+
+const (
+	frameMagic     = 0xFD2FB528
+	skippableMagic = 0x184D2A50 // the low 4 bits may have any value
+
+	maxBlockSize  = 128 << 10
+	maxWindowSize = 1 << 27 // the largest window the reference decoder accepts by default
+)
+
+// Block types.
+const (
+	blockRaw = iota
+	blockRLE
+	blockCompressed
+)
+
+// byteReader is the input of the decompressor.
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+type reader struct {
+	r      byteReader
+	dict   *dictionary
+	err    error
+	frames int // number of frames started
+
+	// The current frame.
+	inFrame        bool
+	windowSize     int
+	blockMax       int
+	maxOffset      uint32
+	hasChecksum    bool
+	hasContentSize bool
+	contentSize    uint64
+	produced       uint64
+	hash           xxhash64
+
+	// hist holds the decoded data, preceded by as much of the data
+	// before it as matches may refer to. hist[off:] has not been
+	// returned by Read yet.
+	hist []byte
+	off  int
+
+	block []byte // the compressed block being decoded
+	lits  []byte // decoded literals
+
+	// The Huffman table, FSE tables and repeat offsets carried from
+	// one block of a frame to the next.
+	huff       *huffTable
+	ll, of, ml *fseTable
+	reps       [3]uint32
+}
+
+// NewReader returns an io.ReadCloser that decompresses Zstandard data
+// from r. If r does not also implement io.ByteReader, the decompressor
+// may read more data than necessary from r. It is the caller's
+// responsibility to call Close on the ReadCloser when done.
+func NewReader(r io.Reader) io.ReadCloser {
+	z := new(reader)
+	z.r = makeReader(r)
+	return z
+}
+
+// NewReaderDict is like NewReader but decompresses frames with the
+// dictionary dict, which is either in the format produced by
+// "zstd --train" or raw content. Frames that name a different
+// dictionary ID fail with ErrDictionary. Frames compressed with a
+// dictionary cannot be decompressed without it.
+func NewReaderDict(r io.Reader, dict []byte) io.ReadCloser {
+	z := new(reader)
+	z.r = makeReader(r)
+	z.dict, z.err = parseDict(dict)
+	return z
+}
+
+func makeReader(r io.Reader) byteReader {
+	if rr, ok := r.(byteReader); ok {
+		return rr
+	}
+	return bufio.NewReader(r)
+}
+
+func (z *reader) Read(p []byte) (int, error) {
+	for z.off == len(z.hist) {
+		if z.err != nil {
+			return 0, z.err
+		}
+		if z.inFrame {
+			z.err = z.readBlock()
+		} else {
+			z.err = z.readFrameHeader()
+		}
+	}
+	n := copy(p, z.hist[z.off:])
+	z.off += n
+	return n, nil
+}
+
+// Close closes the reader. It does not close the underlying io.Reader.
+func (z *reader) Close() error {
+	if z.err == io.EOF {
+		return nil
+	}
+	if z.err == nil {
+		z.err = errors.New("zstd: reader closed")
+		return nil
+	}
+	return z.err
+}
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readFrameHeader reads the next frame header, skipping any skippable
+// frames. It returns io.EOF at the end of the input.
+func (z *reader) readFrameHeader() error {
+	var buf [14]byte
+	if _, err := io.ReadFull(z.r, buf[:4]); err != nil {
+		if err == io.EOF && z.frames > 0 {
+			return io.EOF
+		}
+		return noEOF(err)
+	}
+	magic := le32(buf[:])
+	if magic&^0xf == skippableMagic {
+		if _, err := io.ReadFull(z.r, buf[:4]); err != nil {
+			return noEOF(err)
+		}
+		return z.skip(int64(le32(buf[:])))
+	}
+	if magic != frameMagic {
+		return StructuralError("bad magic number")
+	}
+	z.frames++
+
+	desc, err := z.r.ReadByte()
+	if err != nil {
+		return noEOF(err)
+	}
+	if desc&0x08 != 0 {
+		return StructuralError("reserved frame header bit set")
+	}
+	singleSegment := desc&0x20 != 0
+	fcsSize := [4]int{0, 2, 4, 8}[desc>>6]
+	if fcsSize == 0 && singleSegment {
+		fcsSize = 1
+	}
+	dictIDSize := [4]int{0, 1, 2, 4}[desc&3]
+	n := dictIDSize + fcsSize
+	if !singleSegment {
+		n++
+	}
+	if _, err := io.ReadFull(z.r, buf[:n]); err != nil {
+		return noEOF(err)
+	}
+	b := buf[:n]
+
+	var windowSize uint64
+	if !singleSegment {
+		exp, mantissa := b[0]>>3, b[0]&7
+		windowLog := 10 + uint(exp)
+		if windowLog > 27 {
+			return errWindowSize
+		}
+		base := uint64(1) << windowLog
+		windowSize = base + base/8*uint64(mantissa)
+		b = b[1:]
+	}
+	var dictID uint32
+	for i := dictIDSize - 1; i >= 0; i-- {
+		dictID = dictID<<8 | uint32(b[i])
+	}
+	b = b[dictIDSize:]
+	z.hasContentSize = fcsSize > 0
+	z.contentSize = 0
+	for i := fcsSize - 1; i >= 0; i-- {
+		z.contentSize = z.contentSize<<8 | uint64(b[i])
+	}
+	if fcsSize == 2 {
+		z.contentSize += 256
+	}
+	if singleSegment {
+		windowSize = z.contentSize
+	}
+	if windowSize > maxWindowSize {
+		return errWindowSize
+	}
+
+	if dictID != 0 && (z.dict == nil || dictID != z.dict.id) {
+		return ErrDictionary
+	}
+
+	z.inFrame = true
+	z.windowSize = int(windowSize)
+	z.blockMax = maxBlockSize
+	if z.windowSize < z.blockMax {
+		z.blockMax = z.windowSize
+	}
+	z.hasChecksum = desc&0x04 != 0
+	z.produced = 0
+	z.hash.reset()
+
+	// Matches may not refer to earlier frames, only to the
+	// dictionary.
+	z.hist = z.hist[:0]
+	z.huff, z.ll, z.of, z.ml = nil, nil, nil, nil
+	z.reps = [3]uint32{1, 4, 8}
+	z.maxOffset = uint32(windowSize)
+	if d := z.dict; d != nil {
+		z.hist = append(z.hist, d.content...)
+		z.huff, z.ll, z.of, z.ml = d.huff, d.ll, d.of, d.ml
+		z.reps = d.reps
+		z.maxOffset += uint32(len(d.content))
+	}
+	z.off = len(z.hist)
+	return nil
+}
+
+// skip discards n bytes of input.
+func (z *reader) skip(n int64) error {
+	for n > 0 {
+		m := int64(cap(z.block))
+		if m == 0 {
+			z.block = make([]byte, maxBlockSize)
+			m = maxBlockSize
+		}
+		if m > n {
+			m = n
+		}
+		if _, err := io.ReadFull(z.r, z.block[:m]); err != nil {
+			return noEOF(err)
+		}
+		n -= m
+	}
+	return nil
+}
+
+// readBlock reads and decodes the next block of the current frame.
+func (z *reader) readBlock() error {
+	var hdr [3]byte
+	if _, err := io.ReadFull(z.r, hdr[:]); err != nil {
+		return noEOF(err)
+	}
+	h := int(hdr[0]) | int(hdr[1])<<8 | int(hdr[2])<<16
+	last := h&1 != 0
+	typ := h >> 1 & 3
+	size := h >> 3
+
+	z.slide()
+	start := len(z.hist)
+	switch typ {
+	case blockRaw:
+		if size > z.blockMax {
+			return StructuralError("block too large")
+		}
+		z.hist = append(z.hist, make([]byte, size)...)
+		if _, err := io.ReadFull(z.r, z.hist[start:]); err != nil {
+			return noEOF(err)
+		}
+	case blockRLE:
+		if size > z.blockMax {
+			return StructuralError("block too large")
+		}
+		c, err := z.r.ReadByte()
+		if err != nil {
+			return noEOF(err)
+		}
+		for i := 0; i < size; i++ {
+			z.hist = append(z.hist, c)
+		}
+	case blockCompressed:
+		if size > z.blockMax {
+			return StructuralError("block too large")
+		}
+		if cap(z.block) < maxBlockSize {
+			z.block = make([]byte, maxBlockSize)
+		}
+		b := z.block[:size]
+		if _, err := io.ReadFull(z.r, b); err != nil {
+			return noEOF(err)
+		}
+		if err := z.decodeBlock(b); err != nil {
+			return err
+		}
+		if len(z.hist)-start > z.blockMax {
+			return StructuralError("block too large")
+		}
+	default:
+		return StructuralError("reserved block type")
+	}
+
+	out := z.hist[start:]
+	z.produced += uint64(len(out))
+	if z.hasContentSize && z.produced > z.contentSize {
+		return StructuralError("frame larger than its content size")
+	}
+	if z.hasChecksum {
+		z.hash.write(out)
+	}
+	if last {
+		return z.endFrame()
+	}
+	return nil
+}
+
+// slide discards history that matches can no longer refer to, once it
+// has all been read.
+func (z *reader) slide() {
+	keep := int(z.maxOffset)
+	if z.off == len(z.hist) && len(z.hist) > 2*keep+maxBlockSize {
+		n := copy(z.hist, z.hist[len(z.hist)-keep:])
+		z.hist = z.hist[:n]
+		z.off = n
+	}
+}
+
+func (z *reader) endFrame() error {
+	z.inFrame = false
+	if z.hasContentSize && z.produced != z.contentSize {
+		return StructuralError("frame smaller than its content size")
+	}
+	if z.hasChecksum {
+		var buf [4]byte
+		if _, err := io.ReadFull(z.r, buf[:]); err != nil {
+			return noEOF(err)
+		}
+		if le32(buf[:]) != uint32(z.hash.sum64()) {
+			return ErrChecksum
+		}
+	}
+	return nil
+}
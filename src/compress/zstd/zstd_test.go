@@ -0,0 +1,219 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"archive/zip"
+	"bytes"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func mustReadFile(t testing.TB, name string) []byte {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// mixed returns the input of testdata/mixed.zst, which has a raw
+// block, an RLE block and compressed blocks.
+func mixed(t testing.TB) []byte {
+	var b []byte
+	b = append(b, mustReadFile(t, "testdata/e.txt.zst")[:3000]...)
+	b = append(b, make([]byte, 70000)...)
+	b = append(b, mustReadFile(t, "../testdata/Mark.Twain-Tom.Sawyer.txt")[:10000]...)
+	return b
+}
+
+func TestDecompress(t *testing.T) {
+	twain := mustReadFile(t, "../testdata/Mark.Twain-Tom.Sawyer.txt")
+	tests := []struct {
+		name string
+		want []byte
+	}{
+		{"e.txt.zst", mustReadFile(t, "../testdata/e.txt")},
+		{"twain.zst", twain[:140000]},
+		{"mixed.zst", mixed(t)},
+		{"frames.zst", []byte("Hello, World!\n")},
+	}
+	for _, tt := range tests {
+		in := mustReadFile(t, "testdata/"+tt.name)
+		r := NewReader(bytes.NewReader(in))
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: got %d bytes, want %d matching bytes", tt.name, len(got), len(tt.want))
+		}
+		if err := r.Close(); err != nil {
+			t.Errorf("%s: Close: %v", tt.name, err)
+		}
+	}
+}
+
+func TestDictionary(t *testing.T) {
+	twain := mustReadFile(t, "../testdata/Mark.Twain-Tom.Sawyer.txt")
+	tests := []struct {
+		name, dict string
+		want       []byte
+	}{
+		// A dictionary made by zstd --train.
+		{"dict.zst", "testdata/dict", twain[400000:401000]},
+		// A dictionary of raw content.
+		{"rawdict.zst", "", twain[1000:3000]},
+	}
+	for _, tt := range tests {
+		dict := twain[:4000]
+		if tt.dict != "" {
+			dict = mustReadFile(t, tt.dict)
+		}
+		in := mustReadFile(t, "testdata/"+tt.name)
+		got, err := ioutil.ReadAll(NewReaderDict(bytes.NewReader(in), dict))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: wrong output", tt.name)
+		}
+	}
+
+	// Without the dictionary, or with another one, dict.zst fails.
+	in := mustReadFile(t, "testdata/dict.zst")
+	if _, err := ioutil.ReadAll(NewReader(bytes.NewReader(in))); err != ErrDictionary {
+		t.Errorf("no dictionary: got %v, want %v", err, ErrDictionary)
+	}
+	other := append([]byte(nil), mustReadFile(t, "testdata/dict")...)
+	other[4]++
+	if _, err := ioutil.ReadAll(NewReaderDict(bytes.NewReader(in), other)); err != ErrDictionary {
+		t.Errorf("other dictionary: got %v, want %v", err, ErrDictionary)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	in := append([]byte(nil), mustReadFile(t, "testdata/e.txt.zst")...)
+	in[len(in)-1] ^= 1
+	_, err := ioutil.ReadAll(NewReader(bytes.NewReader(in)))
+	if err != ErrChecksum {
+		t.Errorf("got %v, want %v", err, ErrChecksum)
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	in := mustReadFile(t, "testdata/twain.zst")
+	// Truncated input.
+	for _, n := range []int{0, 3, 10, len(in) / 2, len(in) - 1} {
+		_, err := ioutil.ReadAll(NewReader(bytes.NewReader(in[:n])))
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("truncated to %d bytes: got %v, want %v", n, err, io.ErrUnexpectedEOF)
+		}
+	}
+	// Damaged input must fail without panicking; e.txt.zst has a
+	// checksum, so damage to the literals is found too.
+	in = mustReadFile(t, "testdata/e.txt.zst")
+	for i := 20; i < len(in); i += 97 {
+		b := append([]byte(nil), in...)
+		b[i] ^= 0x55
+		if _, err := ioutil.ReadAll(NewReader(bytes.NewReader(b))); err == nil {
+			t.Errorf("damaged byte %d: no error", i)
+		}
+	}
+	// Trailing garbage after a frame.
+	b := append(mustReadFile(t, "testdata/frames.zst"), "garbage"...)
+	if _, err := ioutil.ReadAll(NewReader(bytes.NewReader(b))); err == nil {
+		t.Error("trailing garbage: no error")
+	}
+}
+
+func TestZip(t *testing.T) {
+	want := mustReadFile(t, "../testdata/e.txt")
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "e.txt",
+		Method:             zip.Zstd,
+		CRC32:              crc32.ChecksumIEEE(want),
+		CompressedSize64:   uint64(len(mustReadFile(t, "testdata/e.txt.zst"))),
+		UncompressedSize64: uint64(len(want)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(mustReadFile(t, "testdata/e.txt.zst"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zip.RegisterDecompressor(zip.Zstd, NewReader)
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("wrong output")
+	}
+}
+
+func TestXXHash64(t *testing.T) {
+	tests := []struct {
+		in   string
+		want uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+	}
+	for _, tt := range tests {
+		var h xxhash64
+		h.reset()
+		h.write([]byte(tt.in))
+		if got := h.sum64(); got != tt.want {
+			t.Errorf("xxhash64(%q) = %#x, want %#x", tt.in, got, tt.want)
+		}
+	}
+
+	// Writing in pieces gives the same result.
+	b := mustReadFile(t, "../testdata/e.txt")[:1000]
+	var h1, h2 xxhash64
+	h1.reset()
+	h1.write(b)
+	h2.reset()
+	for i := 0; i < len(b); i += 7 {
+		h2.write(b[i:min(i+7, len(b))])
+	}
+	if h1.sum64() != h2.sum64() {
+		t.Error("xxhash64 of pieces differs")
+	}
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func BenchmarkDecodeTwain(b *testing.B) {
+	in := mustReadFile(b, "testdata/twain.zst")
+	b.SetBytes(140000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		io.Copy(ioutil.Discard, NewReader(bytes.NewReader(in)))
+	}
+}
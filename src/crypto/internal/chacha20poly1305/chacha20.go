@@ -0,0 +1,83 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chacha20poly1305
+
+const blockSize = 64
+
+// state is the input to the ChaCha20 block function: four constant words,
+// the key, a 32-bit block counter and the nonce. See RFC 7539, section 2.3.
+type state [16]uint32
+
+func (s *state) init(key *[8]uint32, nonce []byte) {
+	s[0], s[1], s[2], s[3] = 0x61707865, 0x3320646e, 0x79622d32, 0x6b206574
+	copy(s[4:12], key[:])
+	s[12] = 0
+	s[13] = getUint32(nonce[0:])
+	s[14] = getUint32(nonce[4:])
+	s[15] = getUint32(nonce[8:])
+}
+
+// block writes the key stream block for the current counter to out and
+// increments the counter.
+func (s *state) block(out *[blockSize]byte) {
+	x := *s
+	for i := 0; i < 10; i++ {
+		// Column round.
+		quarterRound(&x[0], &x[4], &x[8], &x[12])
+		quarterRound(&x[1], &x[5], &x[9], &x[13])
+		quarterRound(&x[2], &x[6], &x[10], &x[14])
+		quarterRound(&x[3], &x[7], &x[11], &x[15])
+		// Diagonal round.
+		quarterRound(&x[0], &x[5], &x[10], &x[15])
+		quarterRound(&x[1], &x[6], &x[11], &x[12])
+		quarterRound(&x[2], &x[7], &x[8], &x[13])
+		quarterRound(&x[3], &x[4], &x[9], &x[14])
+	}
+	for i := range x {
+		putUint32(out[4*i:], x[i]+s[i])
+	}
+	s[12]++
+}
+
+func quarterRound(a, b, c, d *uint32) {
+	*a += *b
+	*d ^= *a
+	*d = *d<<16 | *d>>16
+	*c += *d
+	*b ^= *c
+	*b = *b<<12 | *b>>20
+	*a += *b
+	*d ^= *a
+	*d = *d<<8 | *d>>24
+	*c += *d
+	*b ^= *c
+	*b = *b<<7 | *b>>25
+}
+
+// polyKey writes the one-time Poly1305 key, the first half of block zero, to
+// out. The rest of that block is discarded and encryption starts with block
+// one. See RFC 7539, section 2.6.
+func (s *state) polyKey(out *[32]byte) {
+	var b [blockSize]byte
+	s.block(&b)
+	copy(out[:], b[:])
+}
+
+// xorKeyStream XORs src with the key stream starting at the current block
+// and writes the result to dst, which may alias src exactly.
+func (s *state) xorKeyStream(dst, src []byte) {
+	var b [blockSize]byte
+	for len(src) > 0 {
+		s.block(&b)
+		n := len(src)
+		if n > blockSize {
+			n = blockSize
+		}
+		for i := 0; i < n; i++ {
+			dst[i] = src[i] ^ b[i]
+		}
+		dst, src = dst[n:], src[n:]
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package chacha20poly1305 implements the ChaCha20-Poly1305 AEAD as specified
+// in RFC 7539.
+package chacha20poly1305
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+)
+
+const (
+	// KeySize is the size of the key used by this AEAD, in bytes.
+	KeySize = 32
+	// NonceSize is the size of the nonce used with this AEAD, in bytes.
+	NonceSize = 12
+
+	tagSize = 16
+)
+
+type chacha20poly1305 struct {
+	key [8]uint32
+}
+
+// New returns a ChaCha20-Poly1305 AEAD that uses the given 256-bit key.
+func New(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, errors.New("chacha20poly1305: bad key length")
+	}
+	c := new(chacha20poly1305)
+	for i := range c.key {
+		c.key[i] = getUint32(key[4*i:])
+	}
+	return c, nil
+}
+
+func (c *chacha20poly1305) NonceSize() int {
+	return NonceSize
+}
+
+func (c *chacha20poly1305) Overhead() int {
+	return tagSize
+}
+
+// maxPlaintext is the largest message that the 32-bit block counter allows,
+// excluding the block that is used for the Poly1305 key.
+const maxPlaintext = (1<<32 - 1) * blockSize
+
+func (c *chacha20poly1305) Seal(dst, nonce, plaintext, data []byte) []byte {
+	if len(nonce) != NonceSize {
+		panic("chacha20poly1305: incorrect nonce length given to ChaCha20-Poly1305")
+	}
+	if uint64(len(plaintext)) > maxPlaintext {
+		panic("chacha20poly1305: plaintext too large")
+	}
+
+	ret, out := sliceForAppend(dst, len(plaintext)+tagSize)
+
+	var s state
+	s.init(&c.key, nonce)
+	var polyKey [32]byte
+	s.polyKey(&polyKey)
+	s.xorKeyStream(out, plaintext)
+
+	var tag [tagSize]byte
+	auth(&tag, out[:len(plaintext)], data, &polyKey)
+	copy(out[len(plaintext):], tag[:])
+
+	return ret
+}
+
+var errOpen = errors.New("chacha20poly1305: message authentication failed")
+
+func (c *chacha20poly1305) Open(dst, nonce, ciphertext, data []byte) ([]byte, error) {
+	if len(nonce) != NonceSize {
+		panic("chacha20poly1305: incorrect nonce length given to ChaCha20-Poly1305")
+	}
+	if len(ciphertext) < tagSize {
+		return nil, errOpen
+	}
+	tag := ciphertext[len(ciphertext)-tagSize:]
+	ciphertext = ciphertext[:len(ciphertext)-tagSize]
+	if uint64(len(ciphertext)) > maxPlaintext {
+		return nil, errOpen
+	}
+
+	var s state
+	s.init(&c.key, nonce)
+	var polyKey [32]byte
+	s.polyKey(&polyKey)
+
+	var expectedTag [tagSize]byte
+	auth(&expectedTag, ciphertext, data, &polyKey)
+	if subtle.ConstantTimeCompare(expectedTag[:], tag) != 1 {
+		return nil, errOpen
+	}
+
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	s.xorKeyStream(out, ciphertext)
+
+	return ret, nil
+}
+
+// auth computes the Poly1305 tag over the additional data and ciphertext,
+// each zero padded to a multiple of 16 bytes, followed by their lengths.
+// See RFC 7539, section 2.8.
+func auth(out *[tagSize]byte, ciphertext, data []byte, key *[32]byte) {
+	var m mac
+	m.init(key)
+	m.write(data)
+	m.padBlock()
+	m.write(ciphertext)
+	m.padBlock()
+
+	var lengths [16]byte
+	putUint64(lengths[:8], uint64(len(data)))
+	putUint64(lengths[8:], uint64(len(ciphertext)))
+	m.write(lengths[:])
+	m.sum(out)
+}
+
+func getUint32(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+func putUint32(b []byte, v uint32) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+	b[3] = byte(v >> 24)
+}
+
+func putUint64(b []byte, v uint64) {
+	putUint32(b, uint32(v))
+	putUint32(b[4:], uint32(v>>32))
+}
+
+// sliceForAppend takes a slice and a requested number of bytes. It returns a
+// slice with the contents of the given slice followed by that many bytes and a
+// second slice that aliases into it and contains only the extra bytes. If the
+// original slice has sufficient capacity then no allocation is performed.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
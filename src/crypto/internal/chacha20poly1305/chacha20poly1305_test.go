@@ -0,0 +1,131 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chacha20poly1305
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func decodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// From RFC 7539, section 2.8.2.
+var aeadTests = []struct {
+	key, nonce, aad, plaintext, ciphertext string
+}{
+	{
+		"808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f",
+		"070000004041424344454647",
+		"50515253c0c1c2c3c4c5c6c7",
+		hex.EncodeToString([]byte("Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")),
+		"d31a8d34648e60db7b86afbc53ef7ec2a4aded51296e08fea9e2b5a736ee62d63dbea45e8ca9671282fafb69da92728b1a71de0a9e060b2905d6a5b67ecd3b3692ddbd7f2d778b8c9803aee328091b58fab324e4fad675945585808b4831d7bc3ff4def08e4b7a9de576d26586cec64b6116" +
+			"1ae10b594f09e26a7e902ecbd0600691",
+	},
+}
+
+func TestVectors(t *testing.T) {
+	for i, test := range aeadTests {
+		key, nonce, aad := decodeHex(test.key), decodeHex(test.nonce), decodeHex(test.aad)
+		plaintext, ciphertext := decodeHex(test.plaintext), decodeHex(test.ciphertext)
+
+		aead, err := New(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := aead.Seal(nil, nonce, plaintext, aad); !bytes.Equal(ct, ciphertext) {
+			t.Errorf("#%d: got %x, want %x", i, ct, ciphertext)
+			continue
+		}
+		pt, err := aead.Open(nil, nonce, ciphertext, aad)
+		if err != nil {
+			t.Errorf("#%d: Open failed: %s", i, err)
+			continue
+		}
+		if !bytes.Equal(pt, plaintext) {
+			t.Errorf("#%d: plaintext's don't match: got %x vs %x", i, pt, plaintext)
+		}
+
+		if len(aad) > 0 {
+			aad[0] ^= 0x80
+			if _, err := aead.Open(nil, nonce, ciphertext, aad); err == nil {
+				t.Errorf("#%d: Open was successful after altering additional data", i)
+			}
+			aad[0] ^= 0x80
+		}
+		nonce[0] ^= 0x80
+		if _, err := aead.Open(nil, nonce, ciphertext, aad); err == nil {
+			t.Errorf("#%d: Open was successful after altering nonce", i)
+		}
+		nonce[0] ^= 0x80
+		ciphertext[len(ciphertext)-1] ^= 0x80
+		if _, err := aead.Open(nil, nonce, ciphertext, aad); err == nil {
+			t.Errorf("#%d: Open was successful after altering ciphertext", i)
+		}
+	}
+}
+
+func TestPoly1305(t *testing.T) {
+	// From RFC 7539, section 2.5.2.
+	var key [32]byte
+	copy(key[:], decodeHex("85d6be7857556d337f4452fe42d506a80103808afb0db2fd4abff6af4149f51b"))
+	want := "a8061dc1305136c6c22b8baf0c0127a9"
+
+	// Feed the message in pieces that straddle block boundaries.
+	msg := []byte("Cryptographic Forum Research Group")
+	for _, split := range []int{0, 1, 15, 16, 17, len(msg)} {
+		var m mac
+		m.init(&key)
+		m.write(msg[:split])
+		m.write(msg[split:])
+		var tag [16]byte
+		m.sum(&tag)
+		if got := hex.EncodeToString(tag[:]); got != want {
+			t.Errorf("split at %d: got %s, want %s", split, got, want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	key := make([]byte, KeySize)
+	nonce := make([]byte, NonceSize)
+	aead, _ := New(key)
+	for n := 0; n < 300; n += 7 {
+		plaintext := bytes.Repeat([]byte{'x'}, n)
+		aad := plaintext[:n/3]
+
+		// Seal in place, as crypto/tls does.
+		buf := make([]byte, n, n+aead.Overhead())
+		copy(buf, plaintext)
+		ct := aead.Seal(buf[:0], nonce, buf, aad)
+		if len(ct) != n+aead.Overhead() {
+			t.Fatalf("n=%d: ciphertext has length %d", n, len(ct))
+		}
+		pt, err := aead.Open(ct[:0], nonce, ct, aad)
+		if err != nil {
+			t.Fatalf("n=%d: %s", n, err)
+		}
+		if !bytes.Equal(pt, plaintext) {
+			t.Fatalf("n=%d: round trip failed", n)
+		}
+	}
+}
+
+func BenchmarkSeal1K(b *testing.B) {
+	aead, _ := New(make([]byte, KeySize))
+	nonce := make([]byte, NonceSize)
+	buf := make([]byte, 1024)
+	out := make([]byte, 0, len(buf)+aead.Overhead())
+	b.SetBytes(int64(len(buf)))
+	for i := 0; i < b.N; i++ {
+		aead.Seal(out, nonce, buf, nil)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chacha20poly1305
+
+// mac computes the Poly1305 one-time authenticator of RFC 7539, section 2.5.
+// The accumulator h and the key r are kept in five 26-bit limbs so that
+// products fit in 64 bits.
+type mac struct {
+	r   [5]uint32
+	h   [5]uint32
+	pad [4]uint32
+
+	buf [16]byte
+	n   int // number of bytes buffered in buf
+}
+
+func (m *mac) init(key *[32]byte) {
+	// r is clamped as required by the specification.
+	m.r[0] = getUint32(key[0:]) & 0x3ffffff
+	m.r[1] = (getUint32(key[3:]) >> 2) & 0x3ffff03
+	m.r[2] = (getUint32(key[6:]) >> 4) & 0x3ffc0ff
+	m.r[3] = (getUint32(key[9:]) >> 6) & 0x3f03fff
+	m.r[4] = (getUint32(key[12:]) >> 8) & 0x00fffff
+
+	for i := range m.pad {
+		m.pad[i] = getUint32(key[16+4*i:])
+	}
+}
+
+func (m *mac) write(p []byte) {
+	if m.n > 0 {
+		n := copy(m.buf[m.n:], p)
+		m.n += n
+		p = p[n:]
+		if m.n < len(m.buf) {
+			return
+		}
+		m.blocks(m.buf[:], 1<<24)
+		m.n = 0
+	}
+	if n := len(p) &^ (len(m.buf) - 1); n > 0 {
+		m.blocks(p[:n], 1<<24)
+		p = p[n:]
+	}
+	m.n = copy(m.buf[:], p)
+}
+
+// padBlock completes a partially written block with zeros.
+func (m *mac) padBlock() {
+	if m.n > 0 {
+		for i := m.n; i < len(m.buf); i++ {
+			m.buf[i] = 0
+		}
+		m.blocks(m.buf[:], 1<<24)
+		m.n = 0
+	}
+}
+
+// blocks processes full 16-byte blocks, adding hibit as the 129th bit of
+// each.
+func (m *mac) blocks(p []byte, hibit uint32) {
+	r0, r1, r2, r3, r4 := uint64(m.r[0]), uint64(m.r[1]), uint64(m.r[2]), uint64(m.r[3]), uint64(m.r[4])
+	s1, s2, s3, s4 := r1*5, r2*5, r3*5, r4*5
+	h0, h1, h2, h3, h4 := m.h[0], m.h[1], m.h[2], m.h[3], m.h[4]
+
+	for len(p) >= 16 {
+		// h += p
+		h0 += getUint32(p[0:]) & 0x3ffffff
+		h1 += (getUint32(p[3:]) >> 2) & 0x3ffffff
+		h2 += (getUint32(p[6:]) >> 4) & 0x3ffffff
+		h3 += (getUint32(p[9:]) >> 6) & 0x3ffffff
+		h4 += (getUint32(p[12:]) >> 8) | hibit
+
+		// h *= r, reducing modulo 2^130 - 5 by folding the limbs
+		// above 2^130 back in multiplied by five.
+		d0 := uint64(h0)*r0 + uint64(h1)*s4 + uint64(h2)*s3 + uint64(h3)*s2 + uint64(h4)*s1
+		d1 := uint64(h0)*r1 + uint64(h1)*r0 + uint64(h2)*s4 + uint64(h3)*s3 + uint64(h4)*s2
+		d2 := uint64(h0)*r2 + uint64(h1)*r1 + uint64(h2)*r0 + uint64(h3)*s4 + uint64(h4)*s3
+		d3 := uint64(h0)*r3 + uint64(h1)*r2 + uint64(h2)*r1 + uint64(h3)*r0 + uint64(h4)*s4
+		d4 := uint64(h0)*r4 + uint64(h1)*r3 + uint64(h2)*r2 + uint64(h3)*r1 + uint64(h4)*r0
+
+		// Partial carry propagation.
+		c := d0 >> 26
+		h0 = uint32(d0) & 0x3ffffff
+		d1 += c
+		c = d1 >> 26
+		h1 = uint32(d1) & 0x3ffffff
+		d2 += c
+		c = d2 >> 26
+		h2 = uint32(d2) & 0x3ffffff
+		d3 += c
+		c = d3 >> 26
+		h3 = uint32(d3) & 0x3ffffff
+		d4 += c
+		c = d4 >> 26
+		h4 = uint32(d4) & 0x3ffffff
+		h0 += uint32(c) * 5
+		h1 += h0 >> 26
+		h0 &= 0x3ffffff
+
+		p = p[16:]
+	}
+
+	m.h[0], m.h[1], m.h[2], m.h[3], m.h[4] = h0, h1, h2, h3, h4
+}
+
+// sum writes the authenticator to out. The mac must not be used afterwards.
+func (m *mac) sum(out *[16]byte) {
+	if m.n > 0 {
+		// The final partial block is padded with a one and zeros,
+		// which take the place of the 129th bit.
+		m.buf[m.n] = 1
+		for i := m.n + 1; i < len(m.buf); i++ {
+			m.buf[i] = 0
+		}
+		m.blocks(m.buf[:], 0)
+		m.n = 0
+	}
+
+	h0, h1, h2, h3, h4 := m.h[0], m.h[1], m.h[2], m.h[3], m.h[4]
+
+	// Fully carry h.
+	c := h1 >> 26
+	h1 &= 0x3ffffff
+	h2 += c
+	c = h2 >> 26
+	h2 &= 0x3ffffff
+	h3 += c
+	c = h3 >> 26
+	h3 &= 0x3ffffff
+	h4 += c
+	c = h4 >> 26
+	h4 &= 0x3ffffff
+	h0 += c * 5
+	c = h0 >> 26
+	h0 &= 0x3ffffff
+	h1 += c
+
+	// Compute g = h + -p = h - (2^130 - 5).
+	g0 := h0 + 5
+	c = g0 >> 26
+	g0 &= 0x3ffffff
+	g1 := h1 + c
+	c = g1 >> 26
+	g1 &= 0x3ffffff
+	g2 := h2 + c
+	c = g2 >> 26
+	g2 &= 0x3ffffff
+	g3 := h3 + c
+	c = g3 >> 26
+	g3 &= 0x3ffffff
+	g4 := h4 + c - 1<<26
+
+	// Select h if h < p, or g otherwise, in constant time.
+	mask := (g4 >> 31) - 1
+	g0 &= mask
+	g1 &= mask
+	g2 &= mask
+	g3 &= mask
+	g4 &= mask
+	mask = ^mask
+	h0 = h0&mask | g0
+	h1 = h1&mask | g1
+	h2 = h2&mask | g2
+	h3 = h3&mask | g3
+	h4 = h4&mask | g4
+
+	// h = h % 2^128
+	h0 = h0 | h1<<26
+	h1 = h1>>6 | h2<<20
+	h2 = h2>>12 | h3<<14
+	h3 = h3>>18 | h4<<8
+
+	// out = (h + pad) % 2^128
+	f := uint64(h0) + uint64(m.pad[0])
+	putUint32(out[0:], uint32(f))
+	f = uint64(h1) + uint64(m.pad[1]) + f>>32
+	putUint32(out[4:], uint32(f))
+	f = uint64(h2) + uint64(m.pad[2]) + f>>32
+	putUint32(out[8:], uint32(f))
+	f = uint64(h3) + uint64(m.pad[3]) + f>>32
+	putUint32(out[12:], uint32(f))
+}
@@ -0,0 +1,7 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cipherhw reports whether the CPU has instructions that accelerate
+// particular ciphers, for choosing between otherwise equivalent algorithms.
+package cipherhw
@@ -0,0 +1,13 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !amd64
+
+package cipherhw
+
+// AESGCMSupport reports whether crypto/aes runs in hardware, which makes
+// AES-GCM faster than ChaCha20-Poly1305.
+func AESGCMSupport() bool {
+	return false
+}
@@ -0,0 +1,243 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package curve25519 implements the X25519 Diffie-Hellman function of
+// RFC 7748.
+package curve25519
+
+// A fieldElement is an element of GF(2^255 - 19), stored in ten signed limbs
+// of alternately 26 and 25 bits, so that limb i has weight 2^ceil(25.5*i).
+// A limb can temporarily exceed its width; feCarry brings it back.
+type fieldElement [10]int64
+
+// limbBits is the width of each limb.
+var limbBits = [10]uint{26, 25, 26, 25, 26, 25, 26, 25, 26, 25}
+
+func feZero(h *fieldElement) {
+	*h = fieldElement{}
+}
+
+func feOne(h *fieldElement) {
+	*h = fieldElement{1}
+}
+
+func feAdd(h, f, g *fieldElement) {
+	for i := range h {
+		h[i] = f[i] + g[i]
+	}
+}
+
+func feSub(h, f, g *fieldElement) {
+	for i := range h {
+		h[i] = f[i] - g[i]
+	}
+}
+
+// feCSwap swaps f and g if b is one, and leaves them alone if b is zero,
+// in constant time.
+func feCSwap(f, g *fieldElement, b int64) {
+	mask := -b
+	for i := range f {
+		x := mask & (f[i] ^ g[i])
+		f[i] ^= x
+		g[i] ^= x
+	}
+}
+
+// feCarry reduces every limb of h to within its width, give or take a
+// small excess in limb one.
+func feCarry(h *fieldElement) {
+	for i := range h {
+		w := limbBits[i]
+		c := (h[i] + 1<<(w-1)) >> w
+		h[i] -= c << w
+		if i < len(h)-1 {
+			h[i+1] += c
+		} else {
+			// 2^255 = 19 mod p.
+			h[0] += 19 * c
+		}
+	}
+	c := (h[0] + 1<<25) >> 26
+	h[0] -= c << 26
+	h[1] += c
+}
+
+// feMul sets h = f * g. The limbs of f and g must not exceed 2^27 in
+// absolute value, which holds for sums and differences of carried elements.
+func feMul(h, f, g *fieldElement) {
+	f0, f1, f2, f3, f4, f5, f6, f7, f8, f9 := f[0], f[1], f[2], f[3], f[4], f[5], f[6], f[7], f[8], f[9]
+	g0, g1, g2, g3, g4, g5, g6, g7, g8, g9 := g[0], g[1], g[2], g[3], g[4], g[5], g[6], g[7], g[8], g[9]
+
+	// The weights of two odd limbs add up to one more than the weight of
+	// the limb they land in, and products that overflow limb nine wrap
+	// around multiplied by 19, since 2^255 = 19 mod p.
+	f1_2, f3_2, f5_2, f7_2, f9_2 := 2*f1, 2*f3, 2*f5, 2*f7, 2*f9
+	g1_19, g2_19, g3_19, g4_19, g5_19, g6_19, g7_19, g8_19, g9_19 := 19*g1, 19*g2, 19*g3, 19*g4, 19*g5, 19*g6, 19*g7, 19*g8, 19*g9
+
+	h0 := f0*g0 + f1_2*g9_19 + f2*g8_19 + f3_2*g7_19 + f4*g6_19 + f5_2*g5_19 + f6*g4_19 + f7_2*g3_19 + f8*g2_19 + f9_2*g1_19
+	h1 := f0*g1 + f1*g0 + f2*g9_19 + f3*g8_19 + f4*g7_19 + f5*g6_19 + f6*g5_19 + f7*g4_19 + f8*g3_19 + f9*g2_19
+	h2 := f0*g2 + f1_2*g1 + f2*g0 + f3_2*g9_19 + f4*g8_19 + f5_2*g7_19 + f6*g6_19 + f7_2*g5_19 + f8*g4_19 + f9_2*g3_19
+	h3 := f0*g3 + f1*g2 + f2*g1 + f3*g0 + f4*g9_19 + f5*g8_19 + f6*g7_19 + f7*g6_19 + f8*g5_19 + f9*g4_19
+	h4 := f0*g4 + f1_2*g3 + f2*g2 + f3_2*g1 + f4*g0 + f5_2*g9_19 + f6*g8_19 + f7_2*g7_19 + f8*g6_19 + f9_2*g5_19
+	h5 := f0*g5 + f1*g4 + f2*g3 + f3*g2 + f4*g1 + f5*g0 + f6*g9_19 + f7*g8_19 + f8*g7_19 + f9*g6_19
+	h6 := f0*g6 + f1_2*g5 + f2*g4 + f3_2*g3 + f4*g2 + f5_2*g1 + f6*g0 + f7_2*g9_19 + f8*g8_19 + f9_2*g7_19
+	h7 := f0*g7 + f1*g6 + f2*g5 + f3*g4 + f4*g3 + f5*g2 + f6*g1 + f7*g0 + f8*g9_19 + f9*g8_19
+	h8 := f0*g8 + f1_2*g7 + f2*g6 + f3_2*g5 + f4*g4 + f5_2*g3 + f6*g2 + f7_2*g1 + f8*g0 + f9_2*g9_19
+	h9 := f0*g9 + f1*g8 + f2*g7 + f3*g6 + f4*g5 + f5*g4 + f6*g3 + f7*g2 + f8*g1 + f9*g0
+
+	t := fieldElement{h0, h1, h2, h3, h4, h5, h6, h7, h8, h9}
+	feCarry(&t)
+	*h = t
+}
+
+func feSquare(h, f *fieldElement) {
+	feMul(h, f, f)
+}
+
+// feMul121665 sets h = f * 121665, the constant (A - 2) / 4 of the curve.
+func feMul121665(h, f *fieldElement) {
+	for i := range h {
+		h[i] = f[i] * 121665
+	}
+	feCarry(h)
+}
+
+// feInvert sets out = z^(p - 2) = 1/z.
+func feInvert(out, z *fieldElement) {
+	// p - 2 = 2^255 - 21 has all bits from 254 down to 5 set, followed
+	// by 01011.
+	var r fieldElement
+	feOne(&r)
+	for i := 254; i >= 0; i-- {
+		feSquare(&r, &r)
+		if i >= 5 || (0x0b>>uint(i))&1 == 1 {
+			feMul(&r, &r, z)
+		}
+	}
+	*out = r
+}
+
+// feFromBytes decodes the little-endian s into h, ignoring the top bit.
+func feFromBytes(h *fieldElement, s *[32]byte) {
+	var w [4]uint64
+	for i := range w {
+		for j := 7; j >= 0; j-- {
+			w[i] = w[i]<<8 | uint64(s[8*i+j])
+		}
+	}
+	w[3] &= 1<<63 - 1
+
+	var off uint
+	for i := range h {
+		k, shift := off/64, off%64
+		v := w[k] >> shift
+		if shift+limbBits[i] > 64 {
+			v |= w[k+1] << (64 - shift)
+		}
+		h[i] = int64(v & (1<<limbBits[i] - 1))
+		off += limbBits[i]
+	}
+}
+
+// feToBytes encodes h, which must have been carried, in its unique,
+// fully reduced little-endian form.
+func feToBytes(s *[32]byte, h *fieldElement) {
+	t := *h
+
+	// q is one if h >= p, and zero otherwise. Computing it requires
+	// the carries that adding 19 would cause.
+	q := (19*t[9] + 1<<24) >> 25
+	for i := range t {
+		q = (t[i] + q) >> limbBits[i]
+	}
+
+	// Subtract q * p by adding 19 * q and dropping 2^255.
+	t[0] += 19 * q
+	for i := 0; i < len(t)-1; i++ {
+		c := t[i] >> limbBits[i]
+		t[i+1] += c
+		t[i] -= c << limbBits[i]
+	}
+	t[9] &= 1<<25 - 1
+
+	var acc uint64
+	var accBits uint
+	n := 0
+	for i := range t {
+		acc |= uint64(t[i]) << accBits
+		accBits += limbBits[i]
+		for accBits >= 8 {
+			s[n] = byte(acc)
+			n++
+			acc >>= 8
+			accBits -= 8
+		}
+	}
+	if n < len(s) {
+		s[n] = byte(acc)
+	}
+}
+
+// ScalarMult sets dst to the product scalar * point, where point is the
+// u-coordinate of a point on the curve. The scalar is clamped as specified
+// by RFC 7748.
+func ScalarMult(dst, scalar, point *[32]byte) {
+	e := *scalar
+	e[0] &= 248
+	e[31] &= 127
+	e[31] |= 64
+
+	var x1, x2, z2, x3, z3 fieldElement
+	var a, aa, b, bb, c, d, da, cb, t fieldElement
+	feFromBytes(&x1, point)
+	feOne(&x2)
+	feZero(&z2)
+	x3 = x1
+	feOne(&z3)
+
+	// The Montgomery ladder of RFC 7748, section 5.
+	var swap int64
+	for pos := 254; pos >= 0; pos-- {
+		bit := int64(e[pos/8]>>uint(pos&7)) & 1
+		swap ^= bit
+		feCSwap(&x2, &x3, swap)
+		feCSwap(&z2, &z3, swap)
+		swap = bit
+
+		feAdd(&a, &x2, &z2)
+		feSquare(&aa, &a)
+		feSub(&b, &x2, &z2)
+		feSquare(&bb, &b)
+		feSub(&t, &aa, &bb) // E
+		feAdd(&c, &x3, &z3)
+		feSub(&d, &x3, &z3)
+		feMul(&da, &d, &a)
+		feMul(&cb, &c, &b)
+
+		feAdd(&x3, &da, &cb)
+		feSquare(&x3, &x3)
+		feSub(&z3, &da, &cb)
+		feSquare(&z3, &z3)
+		feMul(&z3, &z3, &x1)
+		feMul(&x2, &aa, &bb)
+		feMul121665(&z2, &t)
+		feAdd(&z2, &z2, &aa)
+		feMul(&z2, &z2, &t)
+	}
+	feCSwap(&x2, &x3, swap)
+	feCSwap(&z2, &z3, swap)
+
+	feInvert(&z2, &z2)
+	feMul(&x2, &x2, &z2)
+	feToBytes(dst, &x2)
+}
+
+var basePoint = [32]byte{9}
+
+// ScalarBaseMult sets dst to the product scalar * base, where base is the
+// standard generator.
+func ScalarBaseMult(dst, scalar *[32]byte) {
+	ScalarMult(dst, scalar, &basePoint)
+}
@@ -0,0 +1,189 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tls
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"errors"
+	"hash"
+	"io"
+)
+
+// TLS 1.3 signs the transcript hash prefixed with 64 spaces and a context
+// string that depends on the signer. See RFC 8446, section 4.4.3.
+const (
+	serverSignatureContext = "TLS 1.3, server CertificateVerify\x00"
+	clientSignatureContext = "TLS 1.3, client CertificateVerify\x00"
+)
+
+var signaturePadding = []byte{
+	0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20,
+	0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20,
+	0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20,
+	0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20,
+	0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20,
+	0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20,
+	0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20,
+	0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20,
+}
+
+// signedMessage returns the digest, with sigHash, of the content covered by
+// a TLS 1.3 CertificateVerify signature.
+func signedMessage(sigHash crypto.Hash, context string, transcript hash.Hash) []byte {
+	h := sigHash.New()
+	h.Write(signaturePadding)
+	io.WriteString(h, context)
+	h.Write(transcript.Sum(nil))
+	return h.Sum(nil)
+}
+
+// pssHash returns the TLS 1.2 hash identifier matching the second octet of a
+// RSASSA-PSS signature scheme, or zero if it isn't one.
+func pssHash(signature uint8) uint8 {
+	switch signature {
+	case signatureRSAPSSSHA256:
+		return hashSHA256
+	case signatureRSAPSSSHA384:
+		return hashSHA384
+	case signatureRSAPSSSHA512:
+		return hashSHA512
+	}
+	return 0
+}
+
+// isSupportedSignatureAlgorithm reports whether sigAndHash is in
+// supportedSignatureAlgorithms.
+func isSupportedSignatureAlgorithm(sigAndHash signatureAndHash, supportedSignatureAlgorithms []signatureAndHash) bool {
+	for _, s := range supportedSignatureAlgorithms {
+		if s == sigAndHash {
+			return true
+		}
+	}
+	return false
+}
+
+// hashForSignatureTLS13 returns the hash function of one of the
+// supportedSignatureAlgorithmsTLS13.
+func hashForSignatureTLS13(sigAndHash signatureAndHash) (crypto.Hash, error) {
+	h := sigAndHash.hash
+	if h == hashIntrinsic {
+		h = pssHash(sigAndHash.signature)
+	} else if sigAndHash.signature != signatureECDSA {
+		h = 0
+	}
+	switch h {
+	case hashSHA256:
+		return crypto.SHA256, nil
+	case hashSHA384:
+		return crypto.SHA384, nil
+	case hashSHA512:
+		return crypto.SHA512, nil
+	}
+	return 0, errors.New("tls: unsupported signature algorithm")
+}
+
+// signatureSchemeTLS13 returns the signature scheme to use in TLS 1.3 with
+// the given public key, out of those that the peer supports.
+func signatureSchemeTLS13(pub crypto.PublicKey, peerSigAndHashes []signatureAndHash) (signatureAndHash, error) {
+	var candidates []signatureAndHash
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		// RSASSA-PSS with a salt as long as the hash needs a modulus of at
+		// least twice the hash size plus two bytes.
+		size := (pub.N.BitLen() - 1 + 7) / 8
+		for _, sigAndHash := range []signatureAndHash{
+			{hashIntrinsic, signatureRSAPSSSHA256},
+			{hashIntrinsic, signatureRSAPSSSHA384},
+			{hashIntrinsic, signatureRSAPSSSHA512},
+		} {
+			sigHash, _ := hashForSignatureTLS13(sigAndHash)
+			if size >= 2*sigHash.Size()+2 {
+				candidates = append(candidates, sigAndHash)
+			}
+		}
+		if len(candidates) == 0 {
+			return signatureAndHash{}, errors.New("tls: RSA key is too small for TLS 1.3 signature algorithms")
+		}
+	case *ecdsa.PublicKey:
+		// In TLS 1.3 the ECDSA schemes are bound to a curve.
+		switch pub.Curve {
+		case elliptic.P256():
+			candidates = []signatureAndHash{{hashSHA256, signatureECDSA}}
+		case elliptic.P384():
+			candidates = []signatureAndHash{{hashSHA384, signatureECDSA}}
+		case elliptic.P521():
+			candidates = []signatureAndHash{{hashSHA512, signatureECDSA}}
+		}
+	}
+
+	for _, candidate := range candidates {
+		for _, sigAndHash := range peerSigAndHashes {
+			if candidate == sigAndHash {
+				return candidate, nil
+			}
+		}
+	}
+	return signatureAndHash{}, errors.New("tls: peer doesn't support any of the certificate's signature algorithms")
+}
+
+// signHandshakeTLS13 signs the transcript for a TLS 1.3 CertificateVerify
+// message.
+func signHandshakeTLS13(rand io.Reader, key crypto.PrivateKey, sigAndHash signatureAndHash, context string, transcript hash.Hash) ([]byte, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("tls: certificate private key does not implement crypto.Signer")
+	}
+	sigHash, err := hashForSignatureTLS13(sigAndHash)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts crypto.SignerOpts = sigHash
+	if sigAndHash.hash == hashIntrinsic {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: sigHash}
+	}
+	return signer.Sign(rand, signedMessage(sigHash, context, transcript), opts)
+}
+
+// verifyHandshakeTLS13 checks the signature of a TLS 1.3 CertificateVerify
+// message.
+func verifyHandshakeTLS13(pub crypto.PublicKey, sigAndHash signatureAndHash, context string, transcript hash.Hash, sig []byte) error {
+	sigHash, err := hashForSignatureTLS13(sigAndHash)
+	if err != nil {
+		return err
+	}
+	digest := signedMessage(sigHash, context, transcript)
+
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		if sigAndHash.signature != signatureECDSA {
+			return errors.New("tls: ECDSA public key used with a non-ECDSA signature algorithm")
+		}
+		ecdsaSig := new(ecdsaSignature)
+		if _, err := asn1.Unmarshal(sig, ecdsaSig); err != nil {
+			return err
+		}
+		if ecdsaSig.R.Sign() <= 0 || ecdsaSig.S.Sign() <= 0 {
+			return errors.New("tls: ECDSA signature contained zero or negative values")
+		}
+		if !ecdsa.Verify(pub, digest, ecdsaSig.R, ecdsaSig.S) {
+			return errors.New("tls: ECDSA verification failure")
+		}
+	case *rsa.PublicKey:
+		if sigAndHash.hash != hashIntrinsic {
+			return errors.New("tls: RSA public key used with a non-RSASSA-PSS signature algorithm")
+		}
+		if err := rsa.VerifyPSS(pub, sigHash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}); err != nil {
+			return err
+		}
+	default:
+		return errors.New("tls: unknown public key type")
+	}
+	return nil
+}
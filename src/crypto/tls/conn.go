@@ -49,6 +49,14 @@ type Conn struct {
 	clientProtocol         string
 	clientProtocolFallback bool
 
+	// resumptionSecret is the TLS 1.3 resumption master secret, from
+	// which a client derives the pre-shared keys of the session tickets
+	// it receives.
+	resumptionSecret []byte
+	// pendingTicket is a TLS 1.3 NewSessionTicket message that a server
+	// sends ahead of its first application data; protected by out.Mutex.
+	pendingTicket []byte
+
 	// input/output
 	in, out  halfConn     // in.Mutex < out.Mutex
 	rawInput *block       // raw input, right off the wire
@@ -107,6 +115,8 @@ type halfConn struct {
 	nextCipher interface{} // next encryption state
 	nextMac    macFunction // next MAC algorithm
 
+	trafficSecret []byte // current TLS 1.3 traffic secret
+
 	// used to save allocating a new buffer for each MAC.
 	inDigestBuf, outDigestBuf []byte
 }
@@ -147,6 +157,36 @@ func (hc *halfConn) changeCipherSpec() error {
 	return nil
 }
 
+// setTrafficSecret installs the TLS 1.3 keys derived from secret and resets
+// the sequence number. There is no ChangeCipherSpec in TLS 1.3: the new keys
+// are used from the next record on.
+func (hc *halfConn) setTrafficSecret(suite *cipherSuiteTLS13, secret []byte) {
+	hc.trafficSecret = secret
+	key, iv := suite.trafficKey(secret)
+	hc.version = VersionTLS13
+	hc.cipher = suite.aead(key, iv)
+	hc.mac = nil
+	hc.resetSeq()
+}
+
+// isAlertRecord reports whether data, the buffered raw input, begins with an
+// alert record. TLS 1.3 disguises alerts as application data, so there it
+// looks for a complete record of the size of an encrypted, unpadded alert.
+func (hc *halfConn) isAlertRecord(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	if hc.version != VersionTLS13 {
+		return recordType(data[0]) == recordTypeAlert
+	}
+	a, ok := hc.cipher.(aead)
+	if !ok || recordType(data[0]) != recordTypeApplicationData || len(data) < recordHeaderLen {
+		return false
+	}
+	n := int(data[3])<<8 | int(data[4])
+	return n == 2+1+a.Overhead() && len(data) >= recordHeaderLen+n
+}
+
 // incSeq increments the sequence number.
 func (hc *halfConn) incSeq() {
 	for i := 7; i >= 0; i-- {
@@ -253,13 +293,38 @@ func (hc *halfConn) decrypt(b *block) (ok bool, prefixLen int, alertValue alert)
 		switch c := hc.cipher.(type) {
 		case cipher.Stream:
 			c.XORKeyStream(payload, payload)
-		case cipher.AEAD:
-			explicitIVLen = 8
+		case aead:
+			if hc.version == VersionTLS13 {
+				// The nonce is derived from the sequence number and
+				// the record header is the additional data.
+				var err error
+				payload, err = c.Open(payload[:0], hc.seq[:], payload, b.data[:recordHeaderLen])
+				if err != nil {
+					return false, 0, alertBadRecordMAC
+				}
+				// The real content type follows the data and is
+				// itself followed by optional zero padding. Move it
+				// into the record header for readRecord.
+				i := len(payload) - 1
+				for i >= 0 && payload[i] == 0 {
+					i--
+				}
+				if i < 0 {
+					return false, 0, alertUnexpectedMessage
+				}
+				b.data[0] = payload[i]
+				b.resize(recordHeaderLen + i)
+				break
+			}
+			explicitIVLen = c.explicitNonceLen()
 			if len(payload) < explicitIVLen {
 				return false, 0, alertBadRecordMAC
 			}
-			nonce := payload[:8]
-			payload = payload[8:]
+			nonce := payload[:explicitIVLen]
+			if len(nonce) == 0 {
+				nonce = hc.seq[:]
+			}
+			payload = payload[explicitIVLen:]
 
 			var additionalData [13]byte
 			copy(additionalData[:], hc.seq[:])
@@ -370,13 +435,24 @@ func (hc *halfConn) encrypt(b *block, explicitIVLen int) (bool, alert) {
 		switch c := hc.cipher.(type) {
 		case cipher.Stream:
 			c.XORKeyStream(payload, payload)
-		case cipher.AEAD:
+		case aead:
 			payloadLen := len(b.data) - recordHeaderLen - explicitIVLen
 			b.resize(len(b.data) + c.Overhead())
 			nonce := b.data[recordHeaderLen : recordHeaderLen+explicitIVLen]
+			if len(nonce) == 0 {
+				nonce = hc.seq[:]
+			}
 			payload := b.data[recordHeaderLen+explicitIVLen:]
 			payload = payload[:payloadLen]
 
+			if hc.version == VersionTLS13 {
+				n := len(b.data) - recordHeaderLen
+				b.data[3] = byte(n >> 8)
+				b.data[4] = byte(n)
+				c.Seal(payload[:0], hc.seq[:], payload, b.data[:recordHeaderLen])
+				break
+			}
+
 			var additionalData [13]byte
 			copy(additionalData[:], hc.seq[:])
 			copy(additionalData[8:], b.data[:3])
@@ -518,7 +594,9 @@ func (c *Conn) readRecord(want recordType) error {
 		c.sendAlert(alertInternalError)
 		return c.in.setErrorLocked(errors.New("tls: unknown record type requested"))
 	case recordTypeHandshake, recordTypeChangeCipherSpec:
-		if c.handshakeComplete {
+		// TLS 1.3 sends further handshake messages after the handshake,
+		// see handlePostHandshakeMessage.
+		if c.handshakeComplete && !(want == recordTypeHandshake && c.vers == VersionTLS13) {
 			c.sendAlert(alertInternalError)
 			return c.in.setErrorLocked(errors.New("tls: handshake or ChangeCipherSpec requested after handshake complete"))
 		}
@@ -561,9 +639,14 @@ Again:
 
 	vers := uint16(b.data[1])<<8 | uint16(b.data[2])
 	n := int(b.data[3])<<8 | int(b.data[4])
-	if c.haveVers && vers != c.vers {
+	expectedVers := c.vers
+	if expectedVers == VersionTLS13 {
+		// TLS 1.3 freezes the record layer version at TLS 1.2.
+		expectedVers = VersionTLS12
+	}
+	if c.haveVers && vers != expectedVers {
 		c.sendAlert(alertProtocolVersion)
-		return c.in.setErrorLocked(fmt.Errorf("tls: received record with version %x when expecting version %x", vers, c.vers))
+		return c.in.setErrorLocked(fmt.Errorf("tls: received record with version %x when expecting version %x", vers, expectedVers))
 	}
 	if n > maxCiphertext {
 		c.sendAlert(alertRecordOverflow)
@@ -595,9 +678,25 @@ Again:
 
 	// Process message.
 	b, c.rawInput = c.in.splitBlock(b, recordHeaderLen+n)
+
+	// TLS 1.3 peers in middlebox compatibility mode send an unencrypted
+	// ChangeCipherSpec during the handshake, which is ignored. See RFC
+	// 8446, Appendix D.4.
+	if c.vers == VersionTLS13 && typ == recordTypeChangeCipherSpec && !c.handshakeComplete {
+		if n != 1 || b.data[recordHeaderLen] != 1 {
+			c.in.freeBlock(b)
+			return c.in.setErrorLocked(c.sendAlert(alertUnexpectedMessage))
+		}
+		c.in.freeBlock(b)
+		goto Again
+	}
+
 	ok, off, err := c.in.decrypt(b)
 	if !ok {
 		c.in.setErrorLocked(c.sendAlert(err))
+	} else if c.in.version == VersionTLS13 {
+		// The real content type was encrypted.
+		typ = recordType(b.data[0])
 	}
 	b.off = off
 	data := b.data[b.off:]
@@ -651,7 +750,7 @@ Again:
 
 	case recordTypeHandshake:
 		// TODO(rsc): Should at least pick off connection close.
-		if typ != want {
+		if typ != want && !(c.vers == VersionTLS13 && c.handshakeComplete) {
 			return c.in.setErrorLocked(c.sendAlert(alertNoRenegotiation))
 		}
 		c.hand.Write(data)
@@ -701,6 +800,9 @@ func (c *Conn) writeRecord(typ recordType, data []byte) (n int, err error) {
 		}
 		explicitIVLen := 0
 		explicitIVIsSeq := false
+		// TLS 1.3 records carry the real content type after the data,
+		// inside the encryption.
+		tls13 := c.out.version == VersionTLS13
 
 		var cbc cbcMode
 		if c.out.version >= VersionTLS11 {
@@ -710,8 +812,8 @@ func (c *Conn) writeRecord(typ recordType, data []byte) (n int, err error) {
 			}
 		}
 		if explicitIVLen == 0 {
-			if _, ok := c.out.cipher.(cipher.AEAD); ok {
-				explicitIVLen = 8
+			if a, ok := c.out.cipher.(aead); ok && !tls13 {
+				explicitIVLen = a.explicitNonceLen()
 				// The AES-GCM construction in TLS has an
 				// explicit nonce so that the nonce can be
 				// random. However, the nonce is only 8 bytes
@@ -721,18 +823,28 @@ func (c *Conn) writeRecord(typ recordType, data []byte) (n int, err error) {
 				explicitIVIsSeq = true
 			}
 		}
-		b.resize(recordHeaderLen + explicitIVLen + m)
+		payloadLen := m
+		if tls13 {
+			payloadLen++
+		}
+		b.resize(recordHeaderLen + explicitIVLen + payloadLen)
 		b.data[0] = byte(typ)
+		if tls13 {
+			b.data[0] = byte(recordTypeApplicationData)
+			b.data[len(b.data)-1] = byte(typ)
+		}
 		vers := c.vers
 		if vers == 0 {
 			// Some TLS servers fail if the record version is
 			// greater than TLS 1.0 for the initial ClientHello.
 			vers = VersionTLS10
+		} else if vers == VersionTLS13 {
+			vers = VersionTLS12
 		}
 		b.data[1] = byte(vers >> 8)
 		b.data[2] = byte(vers)
-		b.data[3] = byte(m >> 8)
-		b.data[4] = byte(m)
+		b.data[3] = byte(payloadLen >> 8)
+		b.data[4] = byte(payloadLen)
 		if explicitIVLen > 0 {
 			explicitIV := b.data[recordHeaderLen : recordHeaderLen+explicitIVLen]
 			if explicitIVIsSeq {
@@ -743,7 +855,7 @@ func (c *Conn) writeRecord(typ recordType, data []byte) (n int, err error) {
 				}
 			}
 		}
-		copy(b.data[recordHeaderLen+explicitIVLen:], data)
+		copy(b.data[recordHeaderLen+explicitIVLen:], data[:m])
 		c.out.encrypt(b, explicitIVLen)
 		_, err = c.conn.Write(b.data)
 		if err != nil {
@@ -802,12 +914,26 @@ func (c *Conn) readHandshake() (interface{}, error) {
 	case typeServerHello:
 		m = new(serverHelloMsg)
 	case typeNewSessionTicket:
-		m = new(newSessionTicketMsg)
+		if c.vers == VersionTLS13 {
+			m = new(newSessionTicketMsgTLS13)
+		} else {
+			m = new(newSessionTicketMsg)
+		}
+	case typeEncryptedExtensions:
+		m = new(encryptedExtensionsMsg)
 	case typeCertificate:
-		m = new(certificateMsg)
+		if c.vers == VersionTLS13 {
+			m = new(certificateMsgTLS13)
+		} else {
+			m = new(certificateMsg)
+		}
 	case typeCertificateRequest:
-		m = &certificateRequestMsg{
-			hasSignatureAndHash: c.vers >= VersionTLS12,
+		if c.vers == VersionTLS13 {
+			m = new(certificateRequestMsgTLS13)
+		} else {
+			m = &certificateRequestMsg{
+				hasSignatureAndHash: c.vers >= VersionTLS12,
+			}
 		}
 	case typeCertificateStatus:
 		m = new(certificateStatusMsg)
@@ -825,6 +951,8 @@ func (c *Conn) readHandshake() (interface{}, error) {
 		m = new(nextProtoMsg)
 	case typeFinished:
 		m = new(finishedMsg)
+	case typeKeyUpdate:
+		m = new(keyUpdateMsg)
 	default:
 		return nil, c.in.setErrorLocked(c.sendAlert(alertUnexpectedMessage))
 	}
@@ -840,6 +968,68 @@ func (c *Conn) readHandshake() (interface{}, error) {
 	return m, nil
 }
 
+// handlePostHandshakeMessage processes a handshake message that arrived after
+// the handshake completed, which only TLS 1.3 allows.
+// c.in.Mutex <= L.
+func (c *Conn) handlePostHandshakeMessage() error {
+	msg, err := c.readHandshake()
+	if err != nil {
+		return err
+	}
+
+	switch msg := msg.(type) {
+	case *newSessionTicketMsgTLS13:
+		return c.handleNewSessionTicket(msg)
+	case *keyUpdateMsg:
+		return c.handleKeyUpdate(msg)
+	default:
+		c.sendAlert(alertUnexpectedMessage)
+		return c.in.setErrorLocked(fmt.Errorf("tls: received unexpected handshake message of type %T after the handshake", msg))
+	}
+}
+
+// handleKeyUpdate switches to the peer's next traffic secret and, if asked
+// to, updates our own. See RFC 8446, section 4.6.3.
+// c.in.Mutex <= L.
+func (c *Conn) handleKeyUpdate(keyUpdate *keyUpdateMsg) error {
+	suite := cipherSuiteTLS13ByID(c.cipherSuite)
+	if suite == nil {
+		return c.in.setErrorLocked(c.sendAlert(alertInternalError))
+	}
+
+	// The KeyUpdate must end a record, as what follows it is protected
+	// with the new key.
+	if c.hand.Len() > 0 {
+		return c.in.setErrorLocked(c.sendAlert(alertUnexpectedMessage))
+	}
+	c.in.setTrafficSecret(suite, suite.nextTrafficSecret(c.in.trafficSecret))
+
+	if keyUpdate.updateRequested {
+		c.out.Lock()
+		defer c.out.Unlock()
+		return c.sendKeyUpdateLocked(false)
+	}
+	return nil
+}
+
+// sendKeyUpdateLocked sends a KeyUpdate message and switches to our next
+// traffic secret. If requestUpdate is true, the peer is asked to update its
+// traffic secret as well.
+// c.out.Mutex <= L.
+func (c *Conn) sendKeyUpdateLocked(requestUpdate bool) error {
+	suite := cipherSuiteTLS13ByID(c.cipherSuite)
+	if suite == nil {
+		return c.sendAlertLocked(alertInternalError)
+	}
+
+	msg := &keyUpdateMsg{updateRequested: requestUpdate}
+	if _, err := c.writeRecord(recordTypeHandshake, msg.marshal()); err != nil {
+		return c.out.setErrorLocked(err)
+	}
+	c.out.setTrafficSecret(suite, suite.nextTrafficSecret(c.out.trafficSecret))
+	return nil
+}
+
 // Write writes data to the connection.
 func (c *Conn) Write(b []byte) (int, error) {
 	if err := c.Handshake(); err != nil {
@@ -857,6 +1047,14 @@ func (c *Conn) Write(b []byte) (int, error) {
 		return 0, alertInternalError
 	}
 
+	if c.pendingTicket != nil {
+		_, err := c.writeRecord(recordTypeHandshake, c.pendingTicket)
+		c.pendingTicket = nil
+		if err != nil {
+			return 0, c.out.setErrorLocked(err)
+		}
+	}
+
 	// SSL 3.0 and TLS 1.0 are susceptible to a chosen-plaintext
 	// attack when using block mode ciphers due to predictable IVs.
 	// This can be prevented by splitting each Application Data
@@ -905,6 +1103,11 @@ func (c *Conn) Read(b []byte) (n int, err error) {
 				// Soft error, like EAGAIN
 				return 0, err
 			}
+			for c.hand.Len() > 0 {
+				if err := c.handlePostHandshakeMessage(); err != nil {
+					return 0, err
+				}
+			}
 		}
 		if err := c.in.err; err != nil {
 			return 0, err
@@ -929,7 +1132,7 @@ func (c *Conn) Read(b []byte) (n int, err error) {
 		// and http://golang.org/issue/3514
 		if ri := c.rawInput; ri != nil &&
 			n != 0 && err == nil &&
-			c.input == nil && len(ri.data) > 0 && recordType(ri.data[0]) == recordTypeAlert {
+			c.input == nil && c.in.isAlertRecord(ri.data) {
 			if recErr := c.readRecord(recordTypeApplicationData); recErr != nil {
 				err = recErr // will be io.EOF on closeNotify
 			}
@@ -997,7 +1200,7 @@ func (c *Conn) ConnectionState() ConnectionState {
 		state.PeerCertificates = c.peerCertificates
 		state.VerifiedChains = c.verifiedChains
 		state.ServerName = c.serverName
-		if !c.didResume {
+		if !c.didResume && c.vers != VersionTLS13 {
 			state.TLSUnique = c.firstFinished[:]
 		}
 	}
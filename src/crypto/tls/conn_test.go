@@ -5,6 +5,8 @@
 package tls
 
 import (
+	"bytes"
+	"io"
 	"testing"
 )
 
@@ -116,3 +118,69 @@ func TestCertificateSelection(t *testing.T) {
 		t.Errorf("foo.bar.baz.example.com returned certificate %d, not 0", n)
 	}
 }
+
+func TestTLS13KeyUpdate(t *testing.T) {
+	ln := newLocalListener(t)
+	defer ln.Close()
+
+	serverConfig := &Config{
+		Certificates: testConfig.Certificates,
+	}
+	clientConfig := &Config{
+		InsecureSkipVerify: true,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		server := Server(c, serverConfig)
+		defer server.Close()
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(server, buf); err != nil {
+			serverErr <- err
+			return
+		}
+		_, err = server.Write(buf)
+		serverErr <- err
+	}()
+
+	cli, err := Dial("tcp", ln.Addr().String(), clientConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	inSecret, outSecret := cli.in.trafficSecret, cli.out.trafficSecret
+	cli.out.Lock()
+	err = cli.sendKeyUpdateLocked(true)
+	cli.out.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := cli.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	} else if n != 4 {
+		t.Fatalf("Write returned %d, expected 4", n)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(cli, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "ping" {
+		t.Errorf("read %q, expected ping", buf)
+	}
+	if err := <-serverErr; err != nil {
+		t.Fatalf("server: %s", err)
+	}
+
+	if bytes.Equal(cli.out.trafficSecret, outSecret) {
+		t.Errorf("client didn't update its traffic secret")
+	}
+	if bytes.Equal(cli.in.trafficSecret, inSecret) {
+		t.Errorf("server didn't update its traffic secret as requested")
+	}
+}
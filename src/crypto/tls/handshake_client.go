@@ -16,6 +16,7 @@ import (
 	"io"
 	"net"
 	"strconv"
+	"time"
 )
 
 type clientHandshakeState struct {
@@ -63,7 +64,10 @@ func (c *Conn) clientHandshake() error {
 	}
 
 	possibleCipherSuites := c.config.cipherSuites()
-	hello.cipherSuites = make([]uint16, 0, len(possibleCipherSuites))
+	hello.cipherSuites = make([]uint16, 0, len(cipherSuitesTLS13)+len(possibleCipherSuites))
+	if hello.vers >= VersionTLS13 {
+		hello.cipherSuites = append(hello.cipherSuites, defaultCipherSuitesTLS13()...)
+	}
 
 NextCipherSuite:
 	for _, suiteId := range possibleCipherSuites {
@@ -91,6 +95,35 @@ NextCipherSuite:
 		hello.signatureAndHashes = supportedSKXSignatureAlgorithms
 	}
 
+	var ecdheParams ecdheParameters
+	if hello.vers >= VersionTLS13 {
+		// TLS 1.3 negotiates the version with the supported_versions
+		// extension and freezes the legacy version field at TLS 1.2.
+		hello.vers = VersionTLS12
+		hello.supportedVersions = c.config.supportedVersions()
+
+		hello.signatureAndHashes = append([]signatureAndHash(nil), supportedSignatureAlgorithmsTLS13...)
+		for _, sigAndHash := range supportedSKXSignatureAlgorithms {
+			if !isSupportedSignatureAlgorithm(sigAndHash, hello.signatureAndHashes) {
+				hello.signatureAndHashes = append(hello.signatureAndHashes, sigAndHash)
+			}
+		}
+
+		// Send a key share for the preferred curve only; the server
+		// asks for another one with a HelloRetryRequest if needed.
+		curveID := c.config.curvePreferences()[0]
+		if !isSupportedCurve(curveID) {
+			c.sendAlert(alertInternalError)
+			return errors.New("tls: CurvePreferences includes unsupported curve")
+		}
+		ecdheParams, err = generateECDHEParameters(c.config.rand(), curveID)
+		if err != nil {
+			c.sendAlert(alertInternalError)
+			return err
+		}
+		hello.keyShares = []keyShare{{group: curveID, data: ecdheParams.PublicKey()}}
+	}
+
 	var session *ClientSessionState
 	var cacheKey string
 	sessionCache := c.config.ClientSessionCache
@@ -100,6 +133,9 @@ NextCipherSuite:
 
 	if sessionCache != nil {
 		hello.ticketSupported = true
+		if ecdheParams != nil {
+			hello.pskModes = []uint8{pskModeDHE}
+		}
 
 		// Try to resume a previously negotiated TLS session, if
 		// available.
@@ -118,13 +154,36 @@ NextCipherSuite:
 
 			versOk := candidateSession.vers >= c.config.minVersion() &&
 				candidateSession.vers <= c.config.maxVersion()
+			if candidateSession.vers == VersionTLS13 {
+				// TLS 1.3 sessions can only be offered with the
+				// supported_versions extension, and expire.
+				versOk = versOk && ecdheParams != nil &&
+					c.config.time().Before(candidateSession.useBy)
+			}
 			if versOk && cipherSuiteOk {
 				session = candidateSession
 			}
 		}
 	}
 
-	if session != nil {
+	var earlySecret, binderKey []byte
+	if session != nil && session.vers == VersionTLS13 {
+		// Offer the session ticket as a PSK identity, and authenticate
+		// the ClientHello with the PSK. See RFC 8446, section 4.2.11.
+		pskSuite := cipherSuiteTLS13ByID(session.cipherSuite)
+		ticketAge := uint32(c.config.time().Sub(session.receivedAt) / time.Millisecond)
+		hello.pskIdentities = []pskIdentity{{
+			label:               session.sessionTicket,
+			obfuscatedTicketAge: ticketAge + session.ageAdd,
+		}}
+		hello.pskBinders = [][]byte{make([]byte, pskSuite.hash.Size())}
+
+		earlySecret = pskSuite.extract(session.masterSecret, nil)
+		binderKey = pskSuite.deriveSecret(earlySecret, resumptionBinderLabel, nil)
+		transcript := pskSuite.hash.New()
+		transcript.Write(hello.marshalWithoutBinders())
+		hello.updateBinders([][]byte{pskSuite.finishedHash(binderKey, transcript)})
+	} else if session != nil {
 		hello.sessionTicket = session.sessionTicket
 		// A random session ID is used to detect when the
 		// server accepted the ticket and is resuming a session
@@ -148,6 +207,33 @@ NextCipherSuite:
 		return unexpectedMessageError(serverHello, msg)
 	}
 
+	if serverHello.supportedVersion != 0 {
+		offeredTLS13 := false
+		for _, v := range hello.supportedVersions {
+			if v == VersionTLS13 {
+				offeredTLS13 = true
+				break
+			}
+		}
+		if serverHello.supportedVersion != VersionTLS13 || !offeredTLS13 {
+			c.sendAlert(alertIllegalParameter)
+			return fmt.Errorf("tls: server selected unsupported protocol version %x", serverHello.supportedVersion)
+		}
+		c.vers = VersionTLS13
+		c.haveVers = true
+
+		hs := &clientHandshakeStateTLS13{
+			c:           c,
+			serverHello: serverHello,
+			hello:       hello,
+			ecdheParams: ecdheParams,
+			session:     session,
+			earlySecret: earlySecret,
+			binderKey:   binderKey,
+		}
+		return hs.handshake()
+	}
+
 	vers, ok := c.config.mutualVersion(serverHello.vers)
 	if !ok || vers < VersionTLS10 {
 		// TLS 1.0 is the minimum version supported as a client.
@@ -157,6 +243,22 @@ NextCipherSuite:
 	c.vers = vers
 	c.haveVers = true
 
+	// A TLS 1.3 server negotiating a lower version tells so in its
+	// random, which an attacker can't change. See RFC 8446, section 4.1.3.
+	if ecdheParams != nil {
+		downgrade := serverHello.random[24:]
+		if vers == VersionTLS12 && bytes.Equal(downgrade, []byte(downgradeCanaryTLS12)) ||
+			vers <= VersionTLS11 && bytes.Equal(downgrade, []byte(downgradeCanaryTLS11)) {
+			c.sendAlert(alertIllegalParameter)
+			return errors.New("tls: downgrade attempt detected, possibly due to a MitM attack or a broken middlebox")
+		}
+	}
+
+	if session != nil && session.vers == VersionTLS13 {
+		// The TLS 1.3 session can't be resumed in this handshake.
+		session = nil
+	}
+
 	suite := mutualCipherSuite(c.config.cipherSuites(), serverHello.cipherSuite)
 	if suite == nil {
 		c.sendAlert(alertHandshakeFailure)
@@ -168,7 +270,7 @@ NextCipherSuite:
 		serverHello:  serverHello,
 		hello:        hello,
 		suite:        suite,
-		finishedHash: newFinishedHash(c.vers),
+		finishedHash: newFinishedHash(c.vers, suite),
 		session:      session,
 	}
 
@@ -181,6 +283,7 @@ NextCipherSuite:
 	}
 
 	if isResume {
+		hs.finishedHash.discardHandshakeBuffer()
 		if err := hs.establishKeys(); err != nil {
 			return err
 		}
@@ -235,46 +338,10 @@ func (hs *clientHandshakeState) doFullHandshake() error {
 	}
 	hs.finishedHash.Write(certMsg.marshal())
 
-	certs := make([]*x509.Certificate, len(certMsg.certificates))
-	for i, asn1Data := range certMsg.certificates {
-		cert, err := x509.ParseCertificate(asn1Data)
-		if err != nil {
-			c.sendAlert(alertBadCertificate)
-			return errors.New("tls: failed to parse certificate from server: " + err.Error())
-		}
-		certs[i] = cert
-	}
-
-	if !c.config.InsecureSkipVerify {
-		opts := x509.VerifyOptions{
-			Roots:         c.config.RootCAs,
-			CurrentTime:   c.config.time(),
-			DNSName:       c.config.ServerName,
-			Intermediates: x509.NewCertPool(),
-		}
-
-		for i, cert := range certs {
-			if i == 0 {
-				continue
-			}
-			opts.Intermediates.AddCert(cert)
-		}
-		c.verifiedChains, err = certs[0].Verify(opts)
-		if err != nil {
-			c.sendAlert(alertBadCertificate)
-			return err
-		}
-	}
-
-	switch certs[0].PublicKey.(type) {
-	case *rsa.PublicKey, *ecdsa.PublicKey:
-		break
-	default:
-		c.sendAlert(alertUnsupportedCertificate)
-		return fmt.Errorf("tls: server's certificate contains an unsupported type of public key: %T", certs[0].PublicKey)
+	if err := c.verifyServerCertificate(certMsg.certificates); err != nil {
+		return err
 	}
-
-	c.peerCertificates = certs
+	certs := c.peerCertificates
 
 	if hs.serverHello.ocspStapling {
 		msg, err = c.readHandshake()
@@ -433,19 +500,25 @@ func (hs *clientHandshakeState) doFullHandshake() error {
 			c.sendAlert(alertInternalError)
 			return fmt.Errorf("tls: client certificate private key of type %T does not implement crypto.Signer", chainToSend.PrivateKey)
 		}
+		var sigType uint8
 		switch key.Public().(type) {
 		case *ecdsa.PublicKey:
-			digest, hashFunc, hashId := hs.finishedHash.hashForClientCertificate(signatureECDSA)
-			signed, err = key.Sign(c.config.rand(), digest, hashFunc)
-			certVerify.signatureAndHash.signature = signatureECDSA
-			certVerify.signatureAndHash.hash = hashId
+			sigType = signatureECDSA
 		case *rsa.PublicKey:
-			digest, hashFunc, hashId := hs.finishedHash.hashForClientCertificate(signatureRSA)
-			signed, err = key.Sign(c.config.rand(), digest, hashFunc)
-			certVerify.signatureAndHash.signature = signatureRSA
-			certVerify.signatureAndHash.hash = hashId
+			sigType = signatureRSA
 		default:
-			err = fmt.Errorf("tls: unknown client certificate key type: %T", key)
+			c.sendAlert(alertInternalError)
+			return fmt.Errorf("tls: failed to sign handshake with client certificate: unknown client certificate key type: %T", key)
+		}
+
+		certVerify.signatureAndHash, err = hs.finishedHash.selectClientCertSignatureAlgorithm(certReq.signatureAndHashes, sigType)
+		if err != nil {
+			c.sendAlert(alertInternalError)
+			return err
+		}
+		digest, hashFunc, err := hs.finishedHash.hashForClientCertificate(certVerify.signatureAndHash)
+		if err == nil {
+			signed, err = key.Sign(c.config.rand(), digest, hashFunc)
 		}
 		if err != nil {
 			c.sendAlert(alertInternalError)
@@ -456,8 +529,9 @@ func (hs *clientHandshakeState) doFullHandshake() error {
 		hs.finishedHash.Write(certVerify.marshal())
 		c.writeRecord(recordTypeHandshake, certVerify.marshal())
 	}
+	hs.finishedHash.discardHandshakeBuffer()
 
-	hs.masterSecret = masterFromPreMasterSecret(c.vers, preMasterSecret, hs.hello.random, hs.serverHello.random)
+	hs.masterSecret = masterFromPreMasterSecret(c.vers, hs.suite, preMasterSecret, hs.hello.random, hs.serverHello.random)
 	return nil
 }
 
@@ -465,7 +539,7 @@ func (hs *clientHandshakeState) establishKeys() error {
 	c := hs.c
 
 	clientMAC, serverMAC, clientKey, serverKey, clientIV, serverIV :=
-		keysFromMasterSecret(c.vers, hs.masterSecret, hs.hello.random, hs.serverHello.random, hs.suite.macLen, hs.suite.keyLen, hs.suite.ivLen)
+		keysFromMasterSecret(c.vers, hs.suite, hs.masterSecret, hs.hello.random, hs.serverHello.random, hs.suite.macLen, hs.suite.keyLen, hs.suite.ivLen)
 	var clientCipher, serverCipher interface{}
 	var clientHash, serverHash macFunction
 	if hs.suite.cipher != nil {
@@ -612,6 +686,53 @@ func (hs *clientHandshakeState) sendFinished(out []byte) error {
 	return nil
 }
 
+// verifyServerCertificate parses and verifies the certificate chain of the
+// server and sets c.peerCertificates.
+func (c *Conn) verifyServerCertificate(certificates [][]byte) error {
+	certs := make([]*x509.Certificate, len(certificates))
+	for i, asn1Data := range certificates {
+		cert, err := x509.ParseCertificate(asn1Data)
+		if err != nil {
+			c.sendAlert(alertBadCertificate)
+			return errors.New("tls: failed to parse certificate from server: " + err.Error())
+		}
+		certs[i] = cert
+	}
+
+	if !c.config.InsecureSkipVerify {
+		opts := x509.VerifyOptions{
+			Roots:         c.config.RootCAs,
+			CurrentTime:   c.config.time(),
+			DNSName:       c.config.ServerName,
+			Intermediates: x509.NewCertPool(),
+		}
+
+		for i, cert := range certs {
+			if i == 0 {
+				continue
+			}
+			opts.Intermediates.AddCert(cert)
+		}
+		var err error
+		c.verifiedChains, err = certs[0].Verify(opts)
+		if err != nil {
+			c.sendAlert(alertBadCertificate)
+			return err
+		}
+	}
+
+	switch certs[0].PublicKey.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		break
+	default:
+		c.sendAlert(alertUnsupportedCertificate)
+		return fmt.Errorf("tls: server's certificate contains an unsupported type of public key: %T", certs[0].PublicKey)
+	}
+
+	c.peerCertificates = certs
+	return nil
+}
+
 // clientSessionCacheKey returns a key used to cache sessionTickets that could
 // be used to resume previously negotiated TLS sessions with a server.
 func clientSessionCacheKey(serverAddr net.Addr, config *Config) string {
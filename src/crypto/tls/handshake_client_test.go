@@ -17,6 +17,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -165,6 +166,8 @@ func (test *clientTest) loadData() (flows [][]byte, err error) {
 }
 
 func (test *clientTest) run(t *testing.T, write bool) {
+	defer useRecordedSignatureAlgorithms()()
+
 	var clientConn, serverConn net.Conn
 	var recordingConn *recordingConn
 	var childProcess *exec.Cmd
@@ -369,6 +372,7 @@ func TestClientResumption(t *testing.T) {
 		Certificates: testConfig.Certificates,
 	}
 	clientConfig := &Config{
+		MaxVersion:         VersionTLS12,
 		CipherSuites:       []uint16{TLS_RSA_WITH_RC4_128_SHA},
 		InsecureSkipVerify: true,
 		ClientSessionCache: NewLRUClientSessionCache(32),
@@ -401,6 +405,111 @@ func TestClientResumption(t *testing.T) {
 	testResumeState("WithoutSessionCache", false)
 }
 
+func TestTLS13ClientResumption(t *testing.T) {
+	serverConfig := &Config{
+		Certificates: testConfig.Certificates,
+	}
+	clientConfig := &Config{
+		InsecureSkipVerify: true,
+		ClientSessionCache: NewLRUClientSessionCache(32),
+	}
+
+	testResumeState := func(test string, didResume bool) {
+		clientState, serverState, err := testHandshakeWithData(t, clientConfig, serverConfig)
+		if err != nil {
+			t.Fatalf("%s: handshake failed: %s", test, err)
+		}
+		if clientState.Version != VersionTLS13 {
+			t.Fatalf("%s: negotiated version %x, expected TLS 1.3", test, clientState.Version)
+		}
+		if clientState.DidResume != didResume || serverState.DidResume != didResume {
+			t.Fatalf("%s resumed: %v and %v, expected: %v", test, clientState.DidResume, serverState.DidResume, didResume)
+		}
+		if len(clientState.PeerCertificates) == 0 {
+			t.Fatalf("%s: no peer certificates", test)
+		}
+	}
+
+	testResumeState("Handshake", false)
+	testResumeState("Resume", true)
+
+	if _, err := io.ReadFull(serverConfig.rand(), serverConfig.SessionTicketKey[:]); err != nil {
+		t.Fatalf("Failed to invalidate SessionTicketKey")
+	}
+	testResumeState("InvalidSessionTicketKey", false)
+	testResumeState("ResumeAfterInvalidSessionTicketKey", true)
+
+	// The server asks for a key share for another curve, so the
+	// binder must be recomputed.
+	serverConfig.CurvePreferences = []CurveID{CurveP384}
+	testResumeState("HelloRetryRequest", true)
+	serverConfig.CurvePreferences = nil
+
+	// A session of a TLS 1.3 connection is not offered for TLS 1.2.
+	serverConfig.MaxVersion = VersionTLS12
+	clientState, _, err := testHandshakeWithData(t, clientConfig, serverConfig)
+	if err != nil || clientState.Version != VersionTLS12 || clientState.DidResume {
+		t.Fatalf("TLS 1.2 handshake: version %x, resumed %v, err %v", clientState.Version, clientState.DidResume, err)
+	}
+	serverConfig.MaxVersion = 0
+	testResumeState("BackToTLS13", false)
+
+	serverConfig.SessionTicketsDisabled = true
+	testResumeState("SessionTicketsDisabled", false)
+	serverConfig.SessionTicketsDisabled = false
+
+	clientConfig.ClientSessionCache = nil
+	testResumeState("WithoutSessionCache", false)
+}
+
+func TestTLS13DowngradeCanary(t *testing.T) {
+	// An attacker strips the supported_versions extension, which makes
+	// the server negotiate TLS 1.2 and set the downgrade canary.
+	clientConn, proxyClient := net.Pipe()
+	proxyServer, serverConn := net.Pipe()
+	go func() {
+		defer proxyClient.Close()
+		defer proxyServer.Close()
+		header := make([]byte, recordHeaderLen)
+		if _, err := io.ReadFull(proxyClient, header); err != nil {
+			return
+		}
+		record := make([]byte, int(header[3])<<8|int(header[4]))
+		if _, err := io.ReadFull(proxyClient, record); err != nil {
+			return
+		}
+		hello := new(clientHelloMsg)
+		if !hello.unmarshal(record) {
+			return
+		}
+		hello.raw = nil
+		hello.supportedVersions = nil
+		hello.keyShares = nil
+		record = hello.marshal()
+		header[3], header[4] = byte(len(record)>>8), byte(len(record))
+		proxyServer.Write(append(header, record...))
+		go io.Copy(proxyClient, proxyServer)
+		io.Copy(proxyServer, proxyClient)
+	}()
+
+	serverConfig := &Config{
+		Certificates: testConfig.Certificates,
+	}
+	go func() {
+		Server(serverConn, serverConfig).Handshake()
+		serverConn.Close()
+	}()
+
+	clientConfig := &Config{
+		InsecureSkipVerify: true,
+	}
+	err := Client(clientConn, clientConfig).Handshake()
+	clientConn.Close()
+	if err == nil || !strings.Contains(err.Error(), "downgrade attempt detected") {
+		t.Errorf("got error %v, expected a downgrade error", err)
+	}
+}
+
 func TestLRUClientSessionCache(t *testing.T) {
 	// Initialize cache of capacity 4.
 	cache := NewLRUClientSessionCache(4)
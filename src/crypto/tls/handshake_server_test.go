@@ -8,6 +8,8 @@ import (
 	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
+	"crypto/internal/cipherhw"
+	"crypto/rand"
 	"crypto/rsa"
 	"encoding/hex"
 	"encoding/pem"
@@ -45,6 +47,25 @@ func init() {
 		InsecureSkipVerify: true,
 		MinVersion:         VersionSSL30,
 		MaxVersion:         VersionTLS12,
+		// The handshakes in testdata were recorded before the
+		// AES-256-GCM and ChaCha20-Poly1305 suites and X25519 were
+		// supported.
+		CipherSuites: []uint16{
+			TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			TLS_ECDHE_RSA_WITH_RC4_128_SHA,
+			TLS_ECDHE_ECDSA_WITH_RC4_128_SHA,
+			TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+			TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+			TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+			TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+			TLS_RSA_WITH_RC4_128_SHA,
+			TLS_RSA_WITH_AES_128_CBC_SHA,
+			TLS_RSA_WITH_AES_256_CBC_SHA,
+			TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA,
+			TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+		},
+		CurvePreferences: []CurveID{CurveP256, CurveP384, CurveP521},
 	}
 	testConfig.Certificates[0].Certificate = [][]byte{testRSACertificate}
 	testConfig.Certificates[0].PrivateKey = testRSAPrivateKey
@@ -392,6 +413,8 @@ func (test *serverTest) loadData() (flows [][]byte, err error) {
 }
 
 func (test *serverTest) run(t *testing.T, write bool) {
+	defer useRecordedSignatureAlgorithms()()
+
 	var clientConn, serverConn net.Conn
 	var recordingConn *recordingConn
 	var childProcess *exec.Cmd
@@ -881,6 +904,194 @@ func TestClientAuth(t *testing.T) {
 	runServerTestTLS12(t, test)
 }
 
+// testHandshakeWithData performs a handshake over a TCP connection, so that
+// post-handshake messages don't block, and has the server send one byte to the
+// client so that the client processes any session ticket.
+func testHandshakeWithData(t *testing.T, clientConfig, serverConfig *Config) (clientState, serverState ConnectionState, err error) {
+	ln := newLocalListener(t)
+	defer ln.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		server := Server(c, serverConfig)
+		defer server.Close()
+		if err := server.Handshake(); err != nil {
+			serverErr <- err
+			return
+		}
+		serverState = server.ConnectionState()
+		_, err = server.Write([]byte{42})
+		serverErr <- err
+	}()
+
+	cli, err := Dial("tcp", ln.Addr().String(), clientConfig)
+	if err != nil {
+		<-serverErr
+		return
+	}
+	defer cli.Close()
+	var b [1]byte
+	if _, err = io.ReadFull(cli, b[:]); err != nil {
+		<-serverErr
+		return
+	}
+	clientState = cli.ConnectionState()
+	err = <-serverErr
+	return
+}
+
+func TestTLS13Handshake(t *testing.T) {
+	tests := []struct {
+		name        string
+		certificate Certificate
+		sigAndHash  signatureAndHash
+	}{
+		{"RSA", Certificate{Certificate: [][]byte{testRSACertificate}, PrivateKey: testRSAPrivateKey}, signatureAndHash{hashIntrinsic, signatureRSAPSSSHA256}},
+		{"ECDSA", Certificate{Certificate: [][]byte{testECDSACertificate}, PrivateKey: testECDSAPrivateKey}, signatureAndHash{hashSHA512, signatureECDSA}},
+	}
+	for _, test := range tests {
+		serverConfig := &Config{
+			Certificates: []Certificate{test.certificate},
+			NextProtos:   []string{"proto1"},
+		}
+		clientConfig := &Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"proto2", "proto1"},
+		}
+		clientState, serverState, err := testHandshakeWithData(t, clientConfig, serverConfig)
+		if err != nil {
+			t.Errorf("%s: handshake failed: %s", test.name, err)
+			continue
+		}
+		if clientState.Version != VersionTLS13 || serverState.Version != VersionTLS13 {
+			t.Errorf("%s: got versions %x and %x, expected TLS 1.3", test.name, clientState.Version, serverState.Version)
+		}
+		if clientState.CipherSuite != TLS_AES_128_GCM_SHA256 || serverState.CipherSuite != TLS_AES_128_GCM_SHA256 {
+			t.Errorf("%s: got cipher suites %x and %x, expected %x", test.name, clientState.CipherSuite, serverState.CipherSuite, TLS_AES_128_GCM_SHA256)
+		}
+		if clientState.NegotiatedProtocol != "proto1" || serverState.NegotiatedProtocol != "proto1" {
+			t.Errorf("%s: got protocols %q and %q, expected proto1", test.name, clientState.NegotiatedProtocol, serverState.NegotiatedProtocol)
+		}
+		if len(clientState.PeerCertificates) != 1 || !bytes.Equal(clientState.PeerCertificates[0].Raw, test.certificate.Certificate[0]) {
+			t.Errorf("%s: client got the wrong server certificate", test.name)
+		}
+		if clientState.TLSUnique != nil {
+			t.Errorf("%s: TLSUnique is set in TLS 1.3", test.name)
+		}
+	}
+}
+
+func TestTLS13Version(t *testing.T) {
+	tests := []struct {
+		clientMin, clientMax uint16
+		serverMin, serverMax uint16
+		expected             uint16 // zero if the handshake should fail
+	}{
+		{0, 0, 0, 0, VersionTLS13},
+		{0, 0, 0, VersionTLS12, VersionTLS12},
+		{0, VersionTLS12, 0, 0, VersionTLS12},
+		{0, 0, 0, VersionTLS11, VersionTLS11},
+		{VersionTLS13, 0, 0, VersionTLS12, 0},
+		{0, VersionTLS12, VersionTLS13, 0, 0},
+	}
+	for i, test := range tests {
+		serverConfig := &Config{
+			Certificates: testConfig.Certificates,
+			MinVersion:   test.serverMin,
+			MaxVersion:   test.serverMax,
+		}
+		clientConfig := &Config{
+			InsecureSkipVerify: true,
+			MinVersion:         test.clientMin,
+			MaxVersion:         test.clientMax,
+		}
+		clientState, _, err := testHandshakeWithData(t, clientConfig, serverConfig)
+		if test.expected == 0 {
+			if err == nil {
+				t.Errorf("#%d: handshake succeeded with version %x, expected failure", i, clientState.Version)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("#%d: handshake failed: %s", i, err)
+			continue
+		}
+		if clientState.Version != test.expected {
+			t.Errorf("#%d: got version %x, expected %x", i, clientState.Version, test.expected)
+		}
+	}
+}
+
+func TestTLS13HelloRetryRequest(t *testing.T) {
+	serverConfig := &Config{
+		Certificates:     testConfig.Certificates,
+		CurvePreferences: []CurveID{CurveP384},
+	}
+	clientConfig := &Config{
+		InsecureSkipVerify: true,
+		CurvePreferences:   []CurveID{CurveP256, CurveP384},
+	}
+	clientState, _, err := testHandshakeWithData(t, clientConfig, serverConfig)
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if clientState.Version != VersionTLS13 {
+		t.Errorf("got version %x, expected TLS 1.3", clientState.Version)
+	}
+
+	// The client doesn't support the only curve of the server.
+	clientConfig.CurvePreferences = []CurveID{CurveP256}
+	if _, _, err := testHandshakeWithData(t, clientConfig, serverConfig); err == nil {
+		t.Errorf("handshake succeeded without a mutual curve")
+	}
+}
+
+func TestTLS13ClientAuth(t *testing.T) {
+	rsaCert, err := X509KeyPair([]byte(clientCertificatePEM), []byte(clientKeyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaCert, err := X509KeyPair([]byte(clientECDSACertificatePEM), []byte(clientECDSAKeyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cert := range []Certificate{rsaCert, ecdsaCert} {
+		serverConfig := &Config{
+			Certificates: testConfig.Certificates,
+			ClientAuth:   RequireAnyClientCert,
+		}
+		clientConfig := &Config{
+			InsecureSkipVerify: true,
+			Certificates:       []Certificate{cert},
+		}
+		_, serverState, err := testHandshakeWithData(t, clientConfig, serverConfig)
+		if err != nil {
+			t.Errorf("handshake failed: %s", err)
+			continue
+		}
+		if len(serverState.PeerCertificates) != 1 || !bytes.Equal(serverState.PeerCertificates[0].Raw, cert.Certificate[0]) {
+			t.Errorf("server got the wrong client certificate")
+		}
+	}
+
+	serverConfig := &Config{
+		Certificates: testConfig.Certificates,
+		ClientAuth:   RequireAnyClientCert,
+	}
+	clientConfig := &Config{
+		InsecureSkipVerify: true,
+	}
+	if _, _, err := testHandshakeWithData(t, clientConfig, serverConfig); err == nil {
+		t.Errorf("handshake succeeded without a required client certificate")
+	}
+}
+
 func bigFromString(s string) *big.Int {
 	ret := new(big.Int)
 	ret.SetString(s, 10)
@@ -918,3 +1129,211 @@ var testECDSAPrivateKey = &ecdsa.PrivateKey{
 	},
 	D: bigFromString("5477294338614160138026852784385529180817726002953041720191098180813046231640184669647735805135001309477695746518160084669446643325196003346204701381388769751"),
 }
+
+func TestChaCha20Poly1305(t *testing.T) {
+	rsaCert := Certificate{Certificate: [][]byte{testRSACertificate}, PrivateKey: testRSAPrivateKey}
+	ecdsaCert := Certificate{Certificate: [][]byte{testECDSACertificate}, PrivateKey: testECDSAPrivateKey}
+	tests := []struct {
+		cert  Certificate
+		suite uint16
+	}{
+		{rsaCert, TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305},
+		{ecdsaCert, TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305},
+	}
+	for _, test := range tests {
+		serverConfig := &Config{
+			Certificates: []Certificate{test.cert},
+			MaxVersion:   VersionTLS12,
+		}
+		clientConfig := &Config{
+			InsecureSkipVerify: true,
+			CipherSuites:       []uint16{test.suite},
+		}
+		clientState, _, err := testHandshakeWithData(t, clientConfig, serverConfig)
+		if err != nil {
+			t.Errorf("%x: handshake failed: %s", test.suite, err)
+			continue
+		}
+		if clientState.CipherSuite != test.suite {
+			t.Errorf("%x: got cipher suite %x", test.suite, clientState.CipherSuite)
+		}
+	}
+
+	// The TLS 1.3 suites aren't configurable, so have both sides rank
+	// ChaCha20-Poly1305 first.
+	defer func(saved []uint16) {
+		varDefaultCipherSuitesTLS13 = saved
+	}(defaultCipherSuitesTLS13())
+	varDefaultCipherSuitesTLS13 = []uint16{TLS_CHACHA20_POLY1305_SHA256, TLS_AES_128_GCM_SHA256}
+
+	serverConfig := &Config{Certificates: []Certificate{rsaCert}}
+	clientConfig := &Config{InsecureSkipVerify: true}
+	clientState, _, err := testHandshakeWithData(t, clientConfig, serverConfig)
+	if err != nil {
+		t.Fatalf("TLS 1.3 handshake failed: %s", err)
+	}
+	if clientState.Version != VersionTLS13 || clientState.CipherSuite != TLS_CHACHA20_POLY1305_SHA256 {
+		t.Errorf("got version %x and cipher suite %x", clientState.Version, clientState.CipherSuite)
+	}
+}
+
+func TestChaCha20Poly1305Preference(t *testing.T) {
+	serverConfig := &Config{
+		Certificates:             testConfig.Certificates,
+		PreferServerCipherSuites: true,
+		MaxVersion:               VersionTLS12,
+	}
+
+	// A client that lists ChaCha20-Poly1305 first likely has no AES
+	// hardware, so the server goes along with it.
+	clientConfig := &Config{
+		InsecureSkipVerify: true,
+		CipherSuites:       []uint16{TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305, TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+	}
+	state, err := testHandshake(clientConfig, serverConfig)
+	if err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if state.CipherSuite != TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305 {
+		t.Errorf("got cipher suite %x, expected ChaCha20-Poly1305", state.CipherSuite)
+	}
+
+	// Otherwise the server's preference depends on its own hardware.
+	clientConfig.CipherSuites = []uint16{TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305}
+	want := TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305
+	if cipherhw.AESGCMSupport() {
+		want = TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	}
+	if state, err = testHandshake(clientConfig, serverConfig); err != nil {
+		t.Fatalf("handshake failed: %s", err)
+	}
+	if state.CipherSuite != want {
+		t.Errorf("got cipher suite %x, expected %x", state.CipherSuite, want)
+	}
+}
+
+func TestX25519(t *testing.T) {
+	for _, version := range []uint16{VersionTLS12, VersionTLS13} {
+		serverConfig := &Config{
+			Certificates:     testConfig.Certificates,
+			CurvePreferences: []CurveID{X25519},
+			MaxVersion:       version,
+		}
+		clientConfig := &Config{
+			InsecureSkipVerify: true,
+			CurvePreferences:   []CurveID{X25519},
+		}
+		clientState, _, err := testHandshakeWithData(t, clientConfig, serverConfig)
+		if err != nil {
+			t.Errorf("%x: handshake failed: %s", version, err)
+			continue
+		}
+		if clientState.Version != version {
+			t.Errorf("%x: negotiated version %x", version, clientState.Version)
+		}
+	}
+
+	params, err := generateECDHEParameters(rand.Reader, X25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.SharedKey(make([]byte, 32)) != nil {
+		t.Errorf("X25519 accepted a point of small order")
+	}
+	if params.SharedKey(make([]byte, 31)) != nil {
+		t.Errorf("X25519 accepted a short public key")
+	}
+}
+
+func TestAES256GCMSHA384(t *testing.T) {
+	rsaCert := Certificate{Certificate: [][]byte{testRSACertificate}, PrivateKey: testRSAPrivateKey}
+	ecdsaCert := Certificate{Certificate: [][]byte{testECDSACertificate}, PrivateKey: testECDSAPrivateKey}
+	tests := []struct {
+		cert  Certificate
+		suite uint16
+	}{
+		{rsaCert, TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384},
+		{ecdsaCert, TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384},
+	}
+	for _, test := range tests {
+		serverConfig := &Config{
+			Certificates: []Certificate{test.cert},
+			MaxVersion:   VersionTLS12,
+		}
+		clientConfig := &Config{
+			InsecureSkipVerify: true,
+			CipherSuites:       []uint16{test.suite},
+		}
+		clientState, _, err := testHandshakeWithData(t, clientConfig, serverConfig)
+		if err != nil {
+			t.Errorf("%x: handshake failed: %s", test.suite, err)
+			continue
+		}
+		if clientState.CipherSuite != test.suite {
+			t.Errorf("%x: got cipher suite %x", test.suite, clientState.CipherSuite)
+		}
+	}
+}
+
+func TestTLS12SignatureHashes(t *testing.T) {
+	rsaCert := Certificate{Certificate: [][]byte{testRSACertificate}, PrivateKey: testRSAPrivateKey}
+	ecdsaCert := Certificate{Certificate: [][]byte{testECDSACertificate}, PrivateKey: testECDSAPrivateKey}
+	clientRSACert, err := X509KeyPair([]byte(clientCertificatePEM), []byte(clientKeyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientECDSACert, err := X509KeyPair([]byte(clientECDSACertificatePEM), []byte(clientECDSAKeyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(skx, clientCert []signatureAndHash) {
+		supportedSKXSignatureAlgorithms, supportedClientCertSignatureAlgorithms = skx, clientCert
+	}(supportedSKXSignatureAlgorithms, supportedClientCertSignatureAlgorithms)
+
+	for _, hash := range []uint8{hashSHA384, hashSHA512} {
+		// Leave each side a single hash to pick for the
+		// ServerKeyExchange and the CertificateVerify.
+		supportedSKXSignatureAlgorithms = []signatureAndHash{{hash, signatureRSA}, {hash, signatureECDSA}}
+		supportedClientCertSignatureAlgorithms = supportedSKXSignatureAlgorithms
+
+		for _, test := range []struct {
+			serverCert, clientCert Certificate
+		}{
+			{rsaCert, clientRSACert},
+			{ecdsaCert, clientECDSACert},
+			{rsaCert, clientECDSACert},
+			{ecdsaCert, clientRSACert},
+		} {
+			serverConfig := &Config{
+				Certificates: []Certificate{test.serverCert},
+				ClientAuth:   RequireAnyClientCert,
+				MaxVersion:   VersionTLS12,
+			}
+			clientConfig := &Config{
+				Certificates:       []Certificate{test.clientCert},
+				InsecureSkipVerify: true,
+				CipherSuites: []uint16{
+					TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+					TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+				},
+			}
+			_, serverState, err := testHandshakeWithData(t, clientConfig, serverConfig)
+			if err != nil {
+				t.Errorf("hash %d: handshake failed: %s", hash, err)
+				continue
+			}
+			if len(serverState.PeerCertificates) != 1 {
+				t.Errorf("hash %d: got %d client certificates", hash, len(serverState.PeerCertificates))
+			}
+		}
+	}
+
+	// A client certificate can't be signed with a hash that the server
+	// didn't ask for.
+	supportedClientCertSignatureAlgorithms = []signatureAndHash{{hashSHA384, signatureRSA}}
+	hs := &finishedHash{version: VersionTLS12, buffer: []byte{}}
+	if _, err := hs.selectClientCertSignatureAlgorithm([]signatureAndHash{{hashSHA512, signatureRSA}}, signatureRSA); err == nil {
+		t.Error("selected a signature algorithm that the server didn't list")
+	}
+}
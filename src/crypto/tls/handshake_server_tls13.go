@@ -0,0 +1,605 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tls
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"errors"
+	"hash"
+	"io"
+	"time"
+)
+
+// maxClientPSKIdentities is the number of client PSK identities the server
+// will attempt to validate. It ignores the rest, so that cheap ClientHello
+// messages can't cause too many session ticket decryption attempts.
+const maxClientPSKIdentities = 5
+
+// maxSessionTicketLifetime is the lifetime of TLS 1.3 session tickets, the
+// maximum allowed by RFC 8446, section 4.6.1.
+const maxSessionTicketLifetime = 7 * 24 * time.Hour
+
+// serverHandshakeStateTLS13 contains details of a TLS 1.3 server handshake in
+// progress. It's discarded once the handshake has completed.
+type serverHandshakeStateTLS13 struct {
+	c               *Conn
+	clientHello     *clientHelloMsg
+	hello           *serverHelloMsg
+	suite           *cipherSuiteTLS13
+	cert            *Certificate
+	sigAndHash      signatureAndHash
+	usingPSK        bool
+	earlySecret     []byte
+	sharedKey       []byte
+	handshakeSecret []byte
+	masterSecret    []byte
+	trafficSecret   []byte // client_application_traffic_secret_0
+	transcript      hash.Hash
+	hrrMessages     []byte // message_hash and HelloRetryRequest, if any
+	certsFromClient [][]byte
+}
+
+// handshake performs a TLS 1.3 handshake as a server, once readClientHello
+// has negotiated the version. See RFC 8446, section 2 for an overview.
+func (hs *serverHandshakeStateTLS13) handshake() error {
+	c := hs.c
+
+	if err := hs.processClientHello(); err != nil {
+		return err
+	}
+	if err := hs.checkForResumption(); err != nil {
+		return err
+	}
+	if err := hs.pickCertificate(); err != nil {
+		return err
+	}
+	if err := hs.sendServerParameters(); err != nil {
+		return err
+	}
+	if err := hs.sendServerCertificate(); err != nil {
+		return err
+	}
+	if err := hs.sendServerFinished(); err != nil {
+		return err
+	}
+	if err := hs.readClientCertificate(); err != nil {
+		return err
+	}
+	if err := hs.readClientFinished(); err != nil {
+		return err
+	}
+	if err := hs.prepareSessionTicket(); err != nil {
+		return err
+	}
+	c.handshakeComplete = true
+
+	return nil
+}
+
+// processClientHello selects the cipher suite and the key exchange group,
+// sending a HelloRetryRequest if the client didn't send a key share for it.
+func (hs *serverHandshakeStateTLS13) processClientHello() error {
+	c := hs.c
+
+	hs.hello = new(serverHelloMsg)
+
+	// The ServerHello version field is frozen at TLS 1.2, the version is
+	// negotiated with the supported_versions extension.
+	hs.hello.vers = VersionTLS12
+	hs.hello.supportedVersion = c.vers
+
+	if len(hs.clientHello.compressionMethods) != 1 ||
+		hs.clientHello.compressionMethods[0] != compressionNone {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: TLS 1.3 client supports illegal compression methods")
+	}
+
+	hs.hello.random = make([]byte, 32)
+	if _, err := io.ReadFull(c.config.rand(), hs.hello.random); err != nil {
+		c.sendAlert(alertInternalError)
+		return err
+	}
+	hs.hello.sessionId = hs.clientHello.sessionId
+	hs.hello.compressionMethod = compressionNone
+
+	var preferenceList, supportedList []uint16
+	if c.config.PreferServerCipherSuites {
+		preferenceList = preferChaCha20Poly1305(defaultCipherSuitesTLS13(), hs.clientHello.cipherSuites)
+		supportedList = hs.clientHello.cipherSuites
+	} else {
+		preferenceList = hs.clientHello.cipherSuites
+		supportedList = defaultCipherSuitesTLS13()
+	}
+	for _, id := range preferenceList {
+		if hs.suite = mutualCipherSuiteTLS13(supportedList, id); hs.suite != nil {
+			break
+		}
+	}
+	if hs.suite == nil {
+		c.sendAlert(alertHandshakeFailure)
+		return errors.New("tls: no cipher suite supported by both client and server")
+	}
+	c.cipherSuite = hs.suite.id
+	hs.hello.cipherSuite = hs.suite.id
+
+	// Pick the group in server preference order, but prefer the ones the
+	// client sent a key share for, to avoid a HelloRetryRequest.
+	var selectedGroup CurveID
+	clientShare := -1
+GroupSelection:
+	for _, preferredGroup := range c.config.curvePreferences() {
+		if !isSupportedCurve(preferredGroup) {
+			continue
+		}
+		for i, ks := range hs.clientHello.keyShares {
+			if ks.group == preferredGroup {
+				selectedGroup = preferredGroup
+				clientShare = i
+				break GroupSelection
+			}
+		}
+		if selectedGroup != 0 {
+			continue
+		}
+		for _, group := range hs.clientHello.supportedCurves {
+			if group == preferredGroup {
+				selectedGroup = group
+				break
+			}
+		}
+	}
+	if selectedGroup == 0 {
+		c.sendAlert(alertHandshakeFailure)
+		return errors.New("tls: no ECDHE curve supported by both client and server")
+	}
+	if clientShare < 0 {
+		if err := hs.doHelloRetryRequest(selectedGroup); err != nil {
+			return err
+		}
+		clientShare = 0
+	}
+
+	params, err := generateECDHEParameters(c.config.rand(), selectedGroup)
+	if err != nil {
+		c.sendAlert(alertInternalError)
+		return err
+	}
+	hs.hello.serverShare = keyShare{group: selectedGroup, data: params.PublicKey()}
+	hs.sharedKey = params.SharedKey(hs.clientHello.keyShares[clientShare].data)
+	if hs.sharedKey == nil {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: invalid client key share")
+	}
+
+	if len(hs.clientHello.serverName) > 0 {
+		c.serverName = hs.clientHello.serverName
+	}
+	if len(hs.clientHello.alpnProtocols) > 0 {
+		if selectedProto, fallback := mutualProtocol(hs.clientHello.alpnProtocols, c.config.NextProtos); !fallback {
+			c.clientProtocol = selectedProto
+		}
+	}
+
+	return nil
+}
+
+// doHelloRetryRequest asks the client for a key share for selectedGroup and
+// reads the second ClientHello.
+func (hs *serverHandshakeStateTLS13) doHelloRetryRequest(selectedGroup CurveID) error {
+	c := hs.c
+
+	// The first ClientHello is replaced in the transcript by a synthetic
+	// message_hash message. See RFC 8446, section 4.4.1.
+	ch1Hash := hs.suite.hash.New()
+	ch1Hash.Write(hs.clientHello.marshal())
+	hs.hrrMessages = []byte{typeMessageHash, 0, 0, uint8(hs.suite.hash.Size())}
+	hs.hrrMessages = ch1Hash.Sum(hs.hrrMessages)
+
+	helloRetryRequest := &serverHelloMsg{
+		vers:              hs.hello.vers,
+		random:            helloRetryRequestRandom,
+		sessionId:         hs.hello.sessionId,
+		cipherSuite:       hs.hello.cipherSuite,
+		compressionMethod: hs.hello.compressionMethod,
+		supportedVersion:  hs.hello.supportedVersion,
+		selectedGroup:     selectedGroup,
+	}
+	hs.hrrMessages = append(hs.hrrMessages, helloRetryRequest.marshal()...)
+	c.writeRecord(recordTypeHandshake, helloRetryRequest.marshal())
+
+	msg, err := c.readHandshake()
+	if err != nil {
+		return err
+	}
+	clientHello, ok := msg.(*clientHelloMsg)
+	if !ok {
+		c.sendAlert(alertUnexpectedMessage)
+		return unexpectedMessageError(clientHello, msg)
+	}
+
+	if len(clientHello.keyShares) != 1 || clientHello.keyShares[0].group != selectedGroup {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: client sent invalid key share in second ClientHello")
+	}
+	if vers, ok := c.config.supportedVersion(clientHello.supportedVersions); !ok || vers != VersionTLS13 {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: client changed the protocol version in the second ClientHello")
+	}
+	if mutualCipherSuiteTLS13(clientHello.cipherSuites, hs.suite.id) == nil {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: client no longer offers the selected cipher suite")
+	}
+
+	hs.clientHello = clientHello
+	return nil
+}
+
+// checkForResumption looks for a valid session ticket among the PSK
+// identities of the client and, if there is one, authenticates the
+// ClientHello with its binder.
+func (hs *serverHandshakeStateTLS13) checkForResumption() error {
+	c := hs.c
+
+	if c.config.SessionTicketsDisabled {
+		return nil
+	}
+
+	// Resumption without a fresh key exchange is not supported.
+	modeOK := false
+	for _, mode := range hs.clientHello.pskModes {
+		if mode == pskModeDHE {
+			modeOK = true
+			break
+		}
+	}
+	if !modeOK {
+		return nil
+	}
+
+	for i, identity := range hs.clientHello.pskIdentities {
+		if i >= maxClientPSKIdentities {
+			break
+		}
+
+		plaintext, ok := c.decryptTicket(identity.label)
+		if !ok {
+			continue
+		}
+		sessionState := new(sessionStateTLS13)
+		if !sessionState.unmarshal(plaintext) {
+			continue
+		}
+
+		createdAt := time.Unix(int64(sessionState.createdAt), 0)
+		if c.config.time().Sub(createdAt) > maxSessionTicketLifetime {
+			continue
+		}
+
+		// The obfuscated ticket age is not checked: it only limits the
+		// window for replaying early data, which is not supported.
+
+		pskSuite := cipherSuiteTLS13ByID(sessionState.cipherSuite)
+		if pskSuite == nil || pskSuite.hash != hs.suite.hash {
+			continue
+		}
+
+		// Client certificates are not sent again on resumption, but are
+		// carried over in the ticket. Check that their presence matches
+		// the configuration.
+		sessionHasClientCerts := len(sessionState.certificates) != 0
+		needClientCerts := c.config.ClientAuth == RequireAnyClientCert || c.config.ClientAuth == RequireAndVerifyClientCert
+		if needClientCerts && !sessionHasClientCerts {
+			continue
+		}
+		if sessionHasClientCerts && c.config.ClientAuth == NoClientCert {
+			continue
+		}
+
+		earlySecret := hs.suite.extract(sessionState.psk, nil)
+		binderKey := hs.suite.deriveSecret(earlySecret, resumptionBinderLabel, nil)
+		transcript := hs.suite.hash.New()
+		transcript.Write(hs.hrrMessages)
+		transcript.Write(hs.clientHello.marshalWithoutBinders())
+		pskBinder := hs.suite.finishedHash(binderKey, transcript)
+		if !hmac.Equal(hs.clientHello.pskBinders[i], pskBinder) {
+			c.sendAlert(alertDecryptError)
+			return errors.New("tls: invalid PSK binder")
+		}
+
+		if sessionHasClientCerts {
+			if _, err := c.processCertsFromClient(sessionState.certificates); err != nil {
+				return err
+			}
+			hs.certsFromClient = sessionState.certificates
+		}
+
+		hs.earlySecret = earlySecret
+		hs.hello.selectedIdentityPresent = true
+		hs.hello.selectedIdentity = uint16(i)
+		hs.usingPSK = true
+		c.didResume = true
+		return nil
+	}
+
+	return nil
+}
+
+// pickCertificate selects the certificate and the signature scheme to
+// authenticate the server with, unless a PSK is used instead.
+func (hs *serverHandshakeStateTLS13) pickCertificate() error {
+	c := hs.c
+
+	if hs.usingPSK {
+		return nil
+	}
+
+	if len(c.config.Certificates) == 0 {
+		c.sendAlert(alertInternalError)
+		return errors.New("tls: no certificates configured")
+	}
+	hs.cert = &c.config.Certificates[0]
+	if len(hs.clientHello.serverName) > 0 {
+		chi := &ClientHelloInfo{
+			CipherSuites:    hs.clientHello.cipherSuites,
+			ServerName:      hs.clientHello.serverName,
+			SupportedCurves: hs.clientHello.supportedCurves,
+			SupportedPoints: hs.clientHello.supportedPoints,
+		}
+		var err error
+		if hs.cert, err = c.config.getCertificate(chi); err != nil {
+			c.sendAlert(alertInternalError)
+			return err
+		}
+	}
+
+	signer, ok := hs.cert.PrivateKey.(crypto.Signer)
+	if !ok {
+		c.sendAlert(alertInternalError)
+		return errors.New("tls: certificate private key does not implement crypto.Signer")
+	}
+	var err error
+	hs.sigAndHash, err = signatureSchemeTLS13(signer.Public(), hs.clientHello.signatureAndHashes)
+	if err != nil {
+		c.sendAlert(alertHandshakeFailure)
+		return err
+	}
+
+	return nil
+}
+
+// sendServerParameters sends the ServerHello, switches to the handshake
+// traffic keys and sends the EncryptedExtensions.
+func (hs *serverHandshakeStateTLS13) sendServerParameters() error {
+	c := hs.c
+
+	hs.transcript = hs.suite.hash.New()
+	hs.transcript.Write(hs.hrrMessages)
+	hs.transcript.Write(hs.clientHello.marshal())
+	hs.transcript.Write(hs.hello.marshal())
+	c.writeRecord(recordTypeHandshake, hs.hello.marshal())
+
+	if hs.earlySecret == nil {
+		hs.earlySecret = hs.suite.extract(nil, nil)
+	}
+	hs.handshakeSecret = hs.suite.extract(hs.sharedKey,
+		hs.suite.deriveSecret(hs.earlySecret, "derived", nil))
+
+	clientSecret := hs.suite.deriveSecret(hs.handshakeSecret, clientHandshakeTrafficLabel, hs.transcript)
+	c.in.setTrafficSecret(hs.suite, clientSecret)
+	serverSecret := hs.suite.deriveSecret(hs.handshakeSecret, serverHandshakeTrafficLabel, hs.transcript)
+	c.out.setTrafficSecret(hs.suite, serverSecret)
+
+	encryptedExtensions := new(encryptedExtensionsMsg)
+	encryptedExtensions.alpnProtocol = c.clientProtocol
+	hs.transcript.Write(encryptedExtensions.marshal())
+	c.writeRecord(recordTypeHandshake, encryptedExtensions.marshal())
+
+	return nil
+}
+
+func (hs *serverHandshakeStateTLS13) requestClientCert() bool {
+	return hs.c.config.ClientAuth >= RequestClientCert && !hs.usingPSK
+}
+
+// sendServerCertificate sends the CertificateRequest, if any, and the
+// server's Certificate and CertificateVerify.
+func (hs *serverHandshakeStateTLS13) sendServerCertificate() error {
+	c := hs.c
+
+	// Only one of PSK and certificates are used at a time.
+	if hs.usingPSK {
+		return nil
+	}
+
+	if hs.requestClientCert() {
+		certReq := new(certificateRequestMsgTLS13)
+		certReq.signatureAndHashes = supportedSignatureAlgorithmsTLS13
+		if c.config.ClientCAs != nil {
+			certReq.certificateAuthorities = c.config.ClientCAs.Subjects()
+		}
+		hs.transcript.Write(certReq.marshal())
+		c.writeRecord(recordTypeHandshake, certReq.marshal())
+	}
+
+	certMsg := new(certificateMsgTLS13)
+	certMsg.certificates = hs.cert.Certificate
+	if hs.clientHello.ocspStapling {
+		certMsg.ocspStaple = hs.cert.OCSPStaple
+	}
+	hs.transcript.Write(certMsg.marshal())
+	c.writeRecord(recordTypeHandshake, certMsg.marshal())
+
+	certVerify := &certificateVerifyMsg{
+		hasSignatureAndHash: true,
+		signatureAndHash:    hs.sigAndHash,
+	}
+	sig, err := signHandshakeTLS13(c.config.rand(), hs.cert.PrivateKey, hs.sigAndHash, serverSignatureContext, hs.transcript)
+	if err != nil {
+		c.sendAlert(alertInternalError)
+		return errors.New("tls: failed to sign handshake: " + err.Error())
+	}
+	certVerify.signature = sig
+	hs.transcript.Write(certVerify.marshal())
+	c.writeRecord(recordTypeHandshake, certVerify.marshal())
+
+	return nil
+}
+
+// sendServerFinished sends the server's Finished and switches to the server
+// application traffic keys.
+func (hs *serverHandshakeStateTLS13) sendServerFinished() error {
+	c := hs.c
+
+	finished := &finishedMsg{
+		verifyData: hs.suite.finishedHash(c.out.trafficSecret, hs.transcript),
+	}
+	hs.transcript.Write(finished.marshal())
+	c.writeRecord(recordTypeHandshake, finished.marshal())
+
+	hs.masterSecret = hs.suite.extract(nil,
+		hs.suite.deriveSecret(hs.handshakeSecret, "derived", nil))
+
+	hs.trafficSecret = hs.suite.deriveSecret(hs.masterSecret, clientApplicationTrafficLabel, hs.transcript)
+	serverSecret := hs.suite.deriveSecret(hs.masterSecret, serverApplicationTrafficLabel, hs.transcript)
+	c.out.setTrafficSecret(hs.suite, serverSecret)
+
+	return nil
+}
+
+// readClientCertificate reads the client's Certificate and CertificateVerify,
+// if they were requested.
+func (hs *serverHandshakeStateTLS13) readClientCertificate() error {
+	c := hs.c
+
+	if !hs.requestClientCert() {
+		return nil
+	}
+
+	msg, err := c.readHandshake()
+	if err != nil {
+		return err
+	}
+	certMsg, ok := msg.(*certificateMsgTLS13)
+	if !ok {
+		c.sendAlert(alertUnexpectedMessage)
+		return unexpectedMessageError(certMsg, msg)
+	}
+	hs.transcript.Write(certMsg.marshal())
+
+	if len(certMsg.certificates) == 0 {
+		switch c.config.ClientAuth {
+		case RequireAnyClientCert, RequireAndVerifyClientCert:
+			c.sendAlert(alertBadCertificate)
+			return errors.New("tls: client didn't provide a certificate")
+		}
+		return nil
+	}
+
+	pub, err := c.processCertsFromClient(certMsg.certificates)
+	if err != nil {
+		return err
+	}
+	hs.certsFromClient = certMsg.certificates
+
+	msg, err = c.readHandshake()
+	if err != nil {
+		return err
+	}
+	certVerify, ok := msg.(*certificateVerifyMsg)
+	if !ok {
+		c.sendAlert(alertUnexpectedMessage)
+		return unexpectedMessageError(certVerify, msg)
+	}
+
+	if !isSupportedSignatureAlgorithm(certVerify.signatureAndHash, supportedSignatureAlgorithmsTLS13) {
+		c.sendAlert(alertIllegalParameter)
+		return errors.New("tls: client certificate used with invalid signature algorithm")
+	}
+	if err := verifyHandshakeTLS13(pub, certVerify.signatureAndHash, clientSignatureContext, hs.transcript, certVerify.signature); err != nil {
+		c.sendAlert(alertDecryptError)
+		return errors.New("tls: invalid signature by the client certificate: " + err.Error())
+	}
+	hs.transcript.Write(certVerify.marshal())
+
+	return nil
+}
+
+// readClientFinished reads the client's Finished and switches to the client
+// application traffic keys.
+func (hs *serverHandshakeStateTLS13) readClientFinished() error {
+	c := hs.c
+
+	msg, err := c.readHandshake()
+	if err != nil {
+		return err
+	}
+	finished, ok := msg.(*finishedMsg)
+	if !ok {
+		c.sendAlert(alertUnexpectedMessage)
+		return unexpectedMessageError(finished, msg)
+	}
+
+	expected := hs.suite.finishedHash(c.in.trafficSecret, hs.transcript)
+	if !hmac.Equal(expected, finished.verifyData) {
+		c.sendAlert(alertDecryptError)
+		return errors.New("tls: client's Finished message is incorrect")
+	}
+	hs.transcript.Write(finished.marshal())
+
+	c.in.setTrafficSecret(hs.suite, hs.trafficSecret)
+
+	return nil
+}
+
+// prepareSessionTicket builds a NewSessionTicket message for the client. It
+// is sent ahead of the first application data, so that a client that only
+// reads doesn't block the end of the handshake.
+func (hs *serverHandshakeStateTLS13) prepareSessionTicket() error {
+	c := hs.c
+
+	if c.config.SessionTicketsDisabled {
+		return nil
+	}
+
+	// Don't send tickets the client can't use. See RFC 8446, section 4.2.9.
+	modeOK := false
+	for _, mode := range hs.clientHello.pskModes {
+		if mode == pskModeDHE {
+			modeOK = true
+			break
+		}
+	}
+	if !modeOK {
+		return nil
+	}
+
+	// Only one ticket is sent per connection, so its nonce is empty.
+	resumptionSecret := hs.suite.deriveSecret(hs.masterSecret, resumptionLabel, hs.transcript)
+	state := sessionStateTLS13{
+		cipherSuite:  hs.suite.id,
+		createdAt:    uint64(c.config.time().Unix()),
+		psk:          hs.suite.resumptionPSK(resumptionSecret, nil),
+		certificates: hs.certsFromClient,
+	}
+	label, err := c.encryptTicket(state.marshal())
+	if err != nil {
+		return err
+	}
+
+	var ageAdd [4]byte
+	if _, err := io.ReadFull(c.config.rand(), ageAdd[:]); err != nil {
+		return err
+	}
+
+	m := &newSessionTicketMsgTLS13{
+		lifetime: uint32(maxSessionTicketLifetime / time.Second),
+		ageAdd:   uint32(ageAdd[0])<<24 | uint32(ageAdd[1])<<16 | uint32(ageAdd[2])<<8 | uint32(ageAdd[3]),
+		label:    label,
+	}
+	c.pendingTicket = m.marshal()
+
+	return nil
+}
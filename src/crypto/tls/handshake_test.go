@@ -165,3 +165,25 @@ func tempFile(contents string) string {
 	file.Close()
 	return path
 }
+
+// useRecordedSignatureAlgorithms sets the TLS 1.2 signature and hash lists to
+// the ones that were advertised when the handshakes in testdata were
+// recorded, and returns a function that restores them. Some of those
+// recordings use RC4, which current OpenSSL releases can no longer
+// regenerate.
+func useRecordedSignatureAlgorithms() (restore func()) {
+	skx, clientCert := supportedSKXSignatureAlgorithms, supportedClientCertSignatureAlgorithms
+	supportedSKXSignatureAlgorithms = []signatureAndHash{
+		{hashSHA256, signatureRSA},
+		{hashSHA256, signatureECDSA},
+		{hashSHA1, signatureRSA},
+		{hashSHA1, signatureECDSA},
+	}
+	supportedClientCertSignatureAlgorithms = []signatureAndHash{
+		{hashSHA256, signatureRSA},
+		{hashSHA256, signatureECDSA},
+	}
+	return func() {
+		supportedSKXSignatureAlgorithms, supportedClientCertSignatureAlgorithms = skx, clientCert
+	}
+}
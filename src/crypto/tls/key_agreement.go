@@ -12,11 +12,11 @@ import (
 	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/sha256"
+	_ "crypto/sha512" // for crypto.SHA384 and crypto.SHA512
 	"crypto/x509"
 	"encoding/asn1"
 	"errors"
 	"io"
-	"math/big"
 )
 
 var errClientKeyExchange = errors.New("tls: invalid ClientKeyExchange message")
@@ -119,6 +119,15 @@ func sha256Hash(slices [][]byte) []byte {
 	return h.Sum(nil)
 }
 
+// hashSlices hashes the given slices with h.
+func hashSlices(h crypto.Hash, slices [][]byte) []byte {
+	hash := h.New()
+	for _, slice := range slices {
+		hash.Write(slice)
+	}
+	return hash.Sum(nil)
+}
+
 // hashForServerKeyExchange hashes the given slices and returns their digest
 // and the identifier of the hash function used. The hashFunc argument is only
 // used for >= TLS 1.2 and precisely identifies the hash function to use.
@@ -129,6 +138,10 @@ func hashForServerKeyExchange(sigType, hashFunc uint8, version uint16, slices ..
 			return sha256Hash(slices), crypto.SHA256, nil
 		case hashSHA1:
 			return sha1Hash(slices), crypto.SHA1, nil
+		case hashSHA384:
+			return hashSlices(crypto.SHA384, slices), crypto.SHA384, nil
+		case hashSHA512:
+			return hashSlices(crypto.SHA512, slices), crypto.SHA512, nil
 		default:
 			return nil, crypto.Hash(0), errors.New("tls: unknown hash function used by peer")
 		}
@@ -141,7 +154,9 @@ func hashForServerKeyExchange(sigType, hashFunc uint8, version uint16, slices ..
 
 // pickTLS12HashForSignature returns a TLS 1.2 hash identifier for signing a
 // ServerKeyExchange given the signature type being used and the client's
-// advertised list of supported signature and hash combinations.
+// advertised list of supported signature and hash combinations. The first of
+// supportedSKXSignatureAlgorithms that the client accepts is used, so SHA-256
+// is preferred over the larger hashes whenever the client allows it.
 func pickTLS12HashForSignature(sigType uint8, clientSignatureAndHashes []signatureAndHash) (uint8, error) {
 	if len(clientSignatureAndHashes) == 0 {
 		// If the client didn't specify any signature_algorithms
@@ -150,12 +165,11 @@ func pickTLS12HashForSignature(sigType uint8, clientSignatureAndHashes []signatu
 		return hashSHA1, nil
 	}
 
-	for _, sigAndHash := range clientSignatureAndHashes {
+	for _, sigAndHash := range supportedSKXSignatureAlgorithms {
 		if sigAndHash.signature != sigType {
 			continue
 		}
-		switch sigAndHash.hash {
-		case hashSHA1, hashSHA256:
+		if isSupportedSignatureAlgorithm(sigAndHash, clientSignatureAndHashes) {
 			return sigAndHash.hash, nil
 		}
 	}
@@ -177,16 +191,29 @@ func curveForCurveID(id CurveID) (elliptic.Curve, bool) {
 
 }
 
+// isSupportedCurve reports whether id is one of the groups that
+// generateECDHEParameters implements.
+func isSupportedCurve(id CurveID) bool {
+	if id == X25519 {
+		return true
+	}
+	_, ok := curveForCurveID(id)
+	return ok
+}
+
 // ecdheRSAKeyAgreement implements a TLS key agreement where the server
 // generates a ephemeral EC public/private key pair and signs it. The
 // pre-master secret is then calculated using ECDH. The signature may
 // either be ECDSA or RSA.
 type ecdheKeyAgreement struct {
-	version    uint16
-	sigType    uint8
-	privateKey []byte
-	curve      elliptic.Curve
-	x, y       *big.Int
+	version uint16
+	sigType uint8
+	params  ecdheParameters
+
+	// ckx and preMasterSecret are generated in processServerKeyExchange
+	// and returned in generateClientKeyExchange.
+	ckx             *clientKeyExchangeMsg
+	preMasterSecret []byte
 }
 
 func (ka *ecdheKeyAgreement) generateServerKeyExchange(config *Config, cert *Certificate, clientHello *clientHelloMsg, hello *serverHelloMsg) (*serverKeyExchangeMsg, error) {
@@ -207,18 +234,16 @@ NextCandidate:
 		return nil, errors.New("tls: no supported elliptic curves offered")
 	}
 
-	var ok bool
-	if ka.curve, ok = curveForCurveID(curveid); !ok {
+	if !isSupportedCurve(curveid) {
 		return nil, errors.New("tls: preferredCurves includes unsupported curve")
 	}
 
-	var x, y *big.Int
-	var err error
-	ka.privateKey, x, y, err = elliptic.GenerateKey(ka.curve, config.rand())
+	params, err := generateECDHEParameters(config.rand(), curveid)
 	if err != nil {
 		return nil, err
 	}
-	ecdhePublic := elliptic.Marshal(ka.curve, x, y)
+	ka.params = params
+	ecdhePublic := params.PublicKey()
 
 	// http://tools.ietf.org/html/rfc4492#section-5.4
 	serverECDHParams := make([]byte, 1+2+1+len(ecdhePublic))
@@ -288,17 +313,10 @@ func (ka *ecdheKeyAgreement) processClientKeyExchange(config *Config, cert *Cert
 	if len(ckx.ciphertext) == 0 || int(ckx.ciphertext[0]) != len(ckx.ciphertext)-1 {
 		return nil, errClientKeyExchange
 	}
-	x, y := elliptic.Unmarshal(ka.curve, ckx.ciphertext[1:])
-	if x == nil {
+	preMasterSecret := ka.params.SharedKey(ckx.ciphertext[1:])
+	if preMasterSecret == nil {
 		return nil, errClientKeyExchange
 	}
-	if !ka.curve.IsOnCurve(x, y) {
-		return nil, errClientKeyExchange
-	}
-	x, _ = ka.curve.ScalarMult(x, y, ka.privateKey)
-	preMasterSecret := make([]byte, (ka.curve.Params().BitSize+7)>>3)
-	xBytes := x.Bytes()
-	copy(preMasterSecret[len(preMasterSecret)-len(xBytes):], xBytes)
 
 	return preMasterSecret, nil
 }
@@ -312,8 +330,7 @@ func (ka *ecdheKeyAgreement) processServerKeyExchange(config *Config, clientHell
 	}
 	curveid := CurveID(skx.key[1])<<8 | CurveID(skx.key[2])
 
-	var ok bool
-	if ka.curve, ok = curveForCurveID(curveid); !ok {
+	if !isSupportedCurve(curveid) {
 		return errors.New("tls: server selected unsupported curve")
 	}
 
@@ -321,14 +338,22 @@ func (ka *ecdheKeyAgreement) processServerKeyExchange(config *Config, clientHell
 	if publicLen+4 > len(skx.key) {
 		return errServerKeyExchange
 	}
-	ka.x, ka.y = elliptic.Unmarshal(ka.curve, skx.key[4:4+publicLen])
-	if ka.x == nil {
-		return errServerKeyExchange
+	serverECDHParams := skx.key[:4+publicLen]
+
+	params, err := generateECDHEParameters(config.rand(), curveid)
+	if err != nil {
+		return err
 	}
-	if !ka.curve.IsOnCurve(ka.x, ka.y) {
+	ka.params = params
+	ka.preMasterSecret = params.SharedKey(serverECDHParams[4:])
+	if ka.preMasterSecret == nil {
 		return errServerKeyExchange
 	}
-	serverECDHParams := skx.key[:4+publicLen]
+	ourPublicKey := params.PublicKey()
+	ka.ckx = new(clientKeyExchangeMsg)
+	ka.ckx.ciphertext = make([]byte, 1+len(ourPublicKey))
+	ka.ckx.ciphertext[0] = byte(len(ourPublicKey))
+	copy(ka.ckx.ciphertext[1:], ourPublicKey)
 
 	sig := skx.key[4+publicLen:]
 	if len(sig) < 2 {
@@ -336,14 +361,25 @@ func (ka *ecdheKeyAgreement) processServerKeyExchange(config *Config, clientHell
 	}
 
 	var tls12HashId uint8
+	usePSS := false
 	if ka.version >= VersionTLS12 {
 		// handle SignatureAndHashAlgorithm
 		var sigAndHash []uint8
 		sigAndHash, sig = sig[:2], sig[2:]
-		if sigAndHash[1] != ka.sigType {
-			return errServerKeyExchange
+		if !isSupportedSignatureAlgorithm(signatureAndHash{sigAndHash[0], sigAndHash[1]}, clientHello.signatureAndHashes) {
+			return errors.New("tls: server used a signature algorithm that wasn't advertised")
 		}
 		tls12HashId = sigAndHash[0]
+		if ka.sigType == signatureRSA && tls12HashId == hashIntrinsic {
+			// A server may pick one of the RSASSA-PSS schemes
+			// that a TLS 1.3 capable client advertises.
+			usePSS = true
+			if tls12HashId = pssHash(sigAndHash[1]); tls12HashId == 0 {
+				return errServerKeyExchange
+			}
+		} else if sigAndHash[1] != ka.sigType {
+			return errServerKeyExchange
+		}
 		if len(sig) < 2 {
 			return errServerKeyExchange
 		}
@@ -379,6 +415,9 @@ func (ka *ecdheKeyAgreement) processServerKeyExchange(config *Config, clientHell
 		if !ok {
 			return errors.New("ECDHE RSA requires a RSA server public key")
 		}
+		if usePSS {
+			return rsa.VerifyPSS(pubKey, hashFunc, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
 		if err := rsa.VerifyPKCS1v15(pubKey, hashFunc, digest, sig); err != nil {
 			return err
 		}
@@ -390,24 +429,9 @@ func (ka *ecdheKeyAgreement) processServerKeyExchange(config *Config, clientHell
 }
 
 func (ka *ecdheKeyAgreement) generateClientKeyExchange(config *Config, clientHello *clientHelloMsg, cert *x509.Certificate) ([]byte, *clientKeyExchangeMsg, error) {
-	if ka.curve == nil {
+	if ka.ckx == nil {
 		return nil, nil, errors.New("missing ServerKeyExchange message")
 	}
-	priv, mx, my, err := elliptic.GenerateKey(ka.curve, config.rand())
-	if err != nil {
-		return nil, nil, err
-	}
-	x, _ := ka.curve.ScalarMult(ka.x, ka.y, priv)
-	preMasterSecret := make([]byte, (ka.curve.Params().BitSize+7)>>3)
-	xBytes := x.Bytes()
-	copy(preMasterSecret[len(preMasterSecret)-len(xBytes):], xBytes)
-
-	serialized := elliptic.Marshal(ka.curve, mx, my)
 
-	ckx := new(clientKeyExchangeMsg)
-	ckx.ciphertext = make([]byte, 1+len(serialized))
-	ckx.ciphertext[0] = byte(len(serialized))
-	copy(ckx.ciphertext[1:], serialized)
-
-	return preMasterSecret, ckx, nil
+	return ka.preMasterSecret, ka.ckx, nil
 }
@@ -12,36 +12,70 @@ import (
 	"fmt"
 	"reflect"
 	"strconv"
+	"unicode"
+	"unicode/utf8"
 )
 
 var errNilPtr = errors.New("destination pointer is nil") // embedded in descriptive error
 
+// validateNamedValueName reports an error if name is not usable as the
+// name of a NamedArg: it must begin with a letter and may only contain
+// letters, digits and underscores.
+func validateNamedValueName(name string) error {
+	if len(name) == 0 {
+		return nil
+	}
+	r, _ := utf8.DecodeRuneInString(name)
+	if !unicode.IsLetter(r) {
+		return fmt.Errorf("name %q does not begin with a letter", name)
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			return fmt.Errorf("name %q contains invalid character %q", name, r)
+		}
+	}
+	return nil
+}
+
 // driverArgs converts arguments from callers of Stmt.Exec and
 // Stmt.Query into driver Values.
 //
 // The statement ds may be nil, if no statement is available.
-func driverArgs(ds *driverStmt, args []interface{}) ([]driver.Value, error) {
-	dargs := make([]driver.Value, len(args))
+func driverArgs(ds *driverStmt, args []interface{}) ([]driver.NamedValue, error) {
+	nvargs := make([]driver.NamedValue, len(args))
 	var si driver.Stmt
 	if ds != nil {
 		si = ds.si
 	}
 	cc, ok := si.(driver.ColumnConverter)
 
-	// Normal path, for a driver.Stmt that is not a ColumnConverter.
-	if !ok {
-		for n, arg := range args {
+	for n, arg := range args {
+		nv := &nvargs[n]
+		nv.Ordinal = n + 1
+		named := false
+		if np, ok := arg.(NamedArg); ok {
+			if err := validateNamedValueName(np.Name); err != nil {
+				return nil, err
+			}
+			arg = np.Value
+			nv.Name = np.Name
+			named = np.Name != ""
+		}
+
+		// Normal path, for a driver.Stmt that is not a ColumnConverter.
+		// Column converters are indexed by placeholder position, so
+		// they are not used for named arguments either.
+		if !ok || named {
 			var err error
-			dargs[n], err = driver.DefaultParameterConverter.ConvertValue(arg)
+			nv.Value, err = driver.DefaultParameterConverter.ConvertValue(arg)
 			if err != nil {
 				return nil, fmt.Errorf("sql: converting Exec argument #%d's type: %v", n, err)
 			}
+			continue
 		}
-		return dargs, nil
-	}
 
-	// Let the Stmt convert its own arguments.
-	for n, arg := range args {
+		// Let the Stmt convert its own arguments.
+		//
 		// First, see if the value itself knows how to convert
 		// itself to a driver type.  For example, a NullString
 		// struct changing into a string or nil.
@@ -65,18 +99,18 @@ func driverArgs(ds *driverStmt, args []interface{}) ([]driver.Value, error) {
 		// same error.
 		var err error
 		ds.Lock()
-		dargs[n], err = cc.ColumnConverter(n).ConvertValue(arg)
+		nv.Value, err = cc.ColumnConverter(n).ConvertValue(arg)
 		ds.Unlock()
 		if err != nil {
 			return nil, fmt.Errorf("sql: converting argument #%d's type: %v", n, err)
 		}
-		if !driver.IsValue(dargs[n]) {
+		if !driver.IsValue(nv.Value) {
 			return nil, fmt.Errorf("sql: driver ColumnConverter error converted %T to unsupported type %T",
-				arg, dargs[n])
+				arg, nv.Value)
 		}
 	}
 
-	return dargs, nil
+	return nvargs, nil
 }
 
 // convertAssign copies to dest the value in src, converting it if possible.
@@ -10,6 +10,8 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -99,7 +101,8 @@ func (c *fakeConn) incrStat(v *int) {
 }
 
 type fakeTx struct {
-	c *fakeConn
+	c    *fakeConn
+	opts driver.TxOptions
 }
 
 type fakeStmt struct {
@@ -112,13 +115,17 @@ type fakeStmt struct {
 	closed bool
 
 	colName      []string      // used by CREATE, INSERT, SELECT (selected columns)
-	colType      []string      // used by CREATE
+	colType      []string      // used by CREATE, SELECT (selected columns)
 	colValue     []interface{} // used by INSERT (mix of strings and "?" for bound params)
 	placeholders int           // used by INSERT/SELECT: number of ? params
 
+	placeholderNames []string // used by INSERT/SELECT: name of each ?name param, or "" for a plain ?
+
 	whereCol []string // used by SELECT (all placeholders)
 
 	placeholderConverter []driver.ValueConverter // used by INSERT
+
+	next *fakeStmt // used for returning multiple result sets
 }
 
 var fdriver driver.Driver = &fakeDriver{}
@@ -253,13 +260,22 @@ func (c *fakeConn) isBad() bool {
 }
 
 func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(opts driver.TxOptions) (driver.Tx, error) {
 	if c.isBad() {
 		return nil, driver.ErrBadConn
 	}
 	if c.currTx != nil {
 		return nil, errors.New("already in a transaction")
 	}
-	c.currTx = &fakeTx{c: c}
+	switch IsolationLevel(opts.Isolation) {
+	case LevelDefault, LevelReadCommitted, LevelSerializable:
+	default:
+		return nil, fmt.Errorf("fakedb: unsupported isolation level %v", IsolationLevel(opts.Isolation))
+	}
+	c.currTx = &fakeTx{c: c, opts: opts}
 	return c.currTx, nil
 }
 
@@ -362,6 +378,13 @@ func (c *fakeConn) prepareSelect(stmt *fakeStmt, parts []string) (driver.Stmt, e
 	}
 	stmt.table = parts[0]
 	stmt.colName = strings.Split(parts[1], ",")
+	for _, name := range stmt.colName {
+		typ, ok := c.db.columnType(stmt.table, name)
+		if !ok {
+			typ = "unknown"
+		}
+		stmt.colType = append(stmt.colType, typ)
+	}
 	for n, colspec := range strings.Split(parts[2], ",") {
 		if colspec == "" {
 			continue
@@ -377,13 +400,14 @@ func (c *fakeConn) prepareSelect(stmt *fakeStmt, parts []string) (driver.Stmt, e
 			stmt.Close()
 			return nil, errf("SELECT on table %q references non-existent column %q", stmt.table, column)
 		}
-		if value != "?" {
+		if !strings.HasPrefix(value, "?") {
 			stmt.Close()
 			return nil, errf("SELECT on table %q has pre-bound value for where column %q; need a question mark",
 				stmt.table, column)
 		}
 		stmt.whereCol = append(stmt.whereCol, column)
 		stmt.placeholders++
+		stmt.placeholderNames = append(stmt.placeholderNames, value[1:])
 	}
 	return stmt, nil
 }
@@ -428,7 +452,7 @@ func (c *fakeConn) prepareInsert(stmt *fakeStmt, parts []string) (driver.Stmt, e
 		}
 		stmt.colName = append(stmt.colName, column)
 
-		if value != "?" {
+		if !strings.HasPrefix(value, "?") {
 			var subsetVal interface{}
 			// Convert to driver subset type
 			switch ctype {
@@ -451,6 +475,7 @@ func (c *fakeConn) prepareInsert(stmt *fakeStmt, parts []string) (driver.Stmt, e
 		} else {
 			stmt.placeholders++
 			stmt.placeholderConverter = append(stmt.placeholderConverter, converterForType(ctype))
+			stmt.placeholderNames = append(stmt.placeholderNames, value[1:])
 			stmt.colValue = append(stmt.colValue, "?")
 		}
 	}
@@ -470,6 +495,33 @@ func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
 		return nil, driver.ErrBadConn
 	}
 
+	// Several SELECTs separated by semicolons are chained together
+	// and return one result set each.
+	var first, prev *fakeStmt
+	for _, query := range strings.Split(query, ";") {
+		stmt, err := c.prepareOne(query)
+		if err != nil {
+			if first != nil {
+				first.Close()
+			}
+			return nil, err
+		}
+		if first == nil {
+			first = stmt
+		} else {
+			if first.cmd != "SELECT" || stmt.cmd != "SELECT" {
+				first.Close()
+				stmt.Close()
+				return nil, errf("only SELECT supports multiple result sets")
+			}
+			prev.next = stmt
+		}
+		prev = stmt
+	}
+	return first, nil
+}
+
+func (c *fakeConn) prepareOne(query string) (*fakeStmt, error) {
 	parts := strings.Split(query, "|")
 	if len(parts) < 1 {
 		return nil, errf("empty query")
@@ -478,22 +530,26 @@ func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
 	parts = parts[1:]
 	stmt := &fakeStmt{q: query, c: c, cmd: cmd}
 	c.incrStat(&c.stmtsMade)
+	var err error
 	switch cmd {
 	case "WIPE":
 		// Nothing
 	case "SELECT":
-		return c.prepareSelect(stmt, parts)
+		_, err = c.prepareSelect(stmt, parts)
 	case "CREATE":
-		return c.prepareCreate(stmt, parts)
+		_, err = c.prepareCreate(stmt, parts)
 	case "INSERT":
-		return c.prepareInsert(stmt, parts)
+		_, err = c.prepareInsert(stmt, parts)
 	case "NOSERT":
 		// Do all the prep-work like for an INSERT but don't actually insert the row.
 		// Used for some of the concurrent tests.
-		return c.prepareInsert(stmt, parts)
+		_, err = c.prepareInsert(stmt, parts)
 	default:
 		stmt.Close()
-		return nil, errf("unsupported command type %q", cmd)
+		err = errf("unsupported command type %q", cmd)
+	}
+	if err != nil {
+		return nil, err
 	}
 	return stmt, nil
 }
@@ -516,11 +572,66 @@ func (s *fakeStmt) Close() error {
 		s.c.incrStat(&s.c.stmtsClosed)
 		s.closed = true
 	}
+	if s.next != nil {
+		s.next.Close()
+	}
 	return nil
 }
 
 var errClosed = errors.New("fakedb: statement has been closed")
 
+func (s *fakeStmt) ExecNamed(args []driver.NamedValue) (driver.Result, error) {
+	dargs, err := s.bindNamed(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.Exec(dargs)
+}
+
+func (s *fakeStmt) QueryNamed(args []driver.NamedValue) (driver.Rows, error) {
+	dargs, err := s.bindNamed(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.Query(dargs)
+}
+
+// bindNamed returns args in the order of the placeholders of s and
+// the statements chained after it. A ?name placeholder takes the
+// argument called name; plain ? placeholders take the unnamed
+// arguments in order.
+func (s *fakeStmt) bindNamed(args []driver.NamedValue) ([]driver.Value, error) {
+	var dargs []driver.Value
+	pos := 0
+	for ; s != nil; s = s.next {
+		for _, name := range s.placeholderNames {
+			if name == "" {
+				for pos < len(args) && args[pos].Name != "" {
+					pos++
+				}
+				if pos == len(args) {
+					return nil, errors.New("fakedb: not enough unnamed arguments")
+				}
+				dargs = append(dargs, args[pos].Value)
+				pos++
+				continue
+			}
+			found := false
+			for _, arg := range args {
+				if arg.Name == name {
+					dargs = append(dargs, arg.Value)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("fakedb: no argument named %q", name)
+			}
+		}
+	}
+	return dargs, nil
+}
+
 // hook to simulate broken connections
 var hookExecBadConn func() bool
 
@@ -540,6 +651,12 @@ func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
 
 	db := s.c.db
 	switch s.cmd {
+	case "WIPE", "CREATE", "INSERT":
+		if tx := s.c.currTx; tx != nil && tx.opts.ReadOnly {
+			return nil, errors.New("fakedb: write in read-only transaction")
+		}
+	}
+	switch s.cmd {
 	case "WIPE":
 		db.wipe()
 		return driver.ResultNoRows, nil
@@ -622,11 +739,31 @@ func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
 		return nil, err
 	}
 
-	db := s.c.db
-	if len(args) != s.placeholders {
+	if len(args) != s.NumInput() {
 		panic("error in pkg db; should only get here if size is correct")
 	}
 
+	cursor := &rowsCursor{
+		pos:    -1,
+		errPos: -1,
+	}
+	for ; s != nil; s = s.next {
+		mrows, err := s.queryResultSet(args[:s.placeholders])
+		if err != nil {
+			return nil, err
+		}
+		args = args[s.placeholders:]
+		cursor.rows = append(cursor.rows, mrows)
+		cursor.cols = append(cursor.cols, s.colName)
+		cursor.colType = append(cursor.colType, s.colType)
+	}
+	return cursor, nil
+}
+
+// queryResultSet returns the rows selected by s, ignoring any
+// statements chained after it.
+func (s *fakeStmt) queryResultSet(args []driver.Value) ([]*row, error) {
+	db := s.c.db
 	db.mu.Lock()
 	t, ok := db.table(s.table)
 	db.mu.Unlock()
@@ -680,18 +817,15 @@ rows:
 		}
 		mrows = append(mrows, mrow)
 	}
-
-	cursor := &rowsCursor{
-		pos:    -1,
-		rows:   mrows,
-		cols:   s.colName,
-		errPos: -1,
-	}
-	return cursor, nil
+	return mrows, nil
 }
 
 func (s *fakeStmt) NumInput() int {
-	return s.placeholders
+	n := 0
+	for ; s != nil; s = s.next {
+		n += s.placeholders
+	}
+	return n
 }
 
 func (tx *fakeTx) Commit() error {
@@ -705,10 +839,12 @@ func (tx *fakeTx) Rollback() error {
 }
 
 type rowsCursor struct {
-	cols   []string
-	pos    int
-	rows   []*row
-	closed bool
+	cols    [][]string // per result set
+	colType [][]string // per result set
+	rows    [][]*row   // per result set
+	posSet  int        // index of the current result set
+	pos     int        // index of the current row in rows[posSet]
+	closed  bool
 
 	// errPos and err are for making Next return early with error.
 	errPos int
@@ -731,7 +867,44 @@ func (rc *rowsCursor) Close() error {
 }
 
 func (rc *rowsCursor) Columns() []string {
-	return rc.cols
+	return rc.cols[rc.posSet]
+}
+
+func (rc *rowsCursor) ColumnTypeScanType(index int) reflect.Type {
+	return colTypeToReflectType(rc.colType[rc.posSet][index])
+}
+
+func (rc *rowsCursor) ColumnTypeDatabaseTypeName(index int) string {
+	return strings.ToUpper(strings.TrimPrefix(rc.colType[rc.posSet][index], "null"))
+}
+
+func (rc *rowsCursor) ColumnTypeNullable(index int) (nullable, ok bool) {
+	typ := rc.colType[rc.posSet][index]
+	if typ == "unknown" {
+		return false, false
+	}
+	return strings.HasPrefix(typ, "null") || typ == "datetime", true
+}
+
+func (rc *rowsCursor) ColumnTypeLength(index int) (length int64, ok bool) {
+	switch rc.colType[rc.posSet][index] {
+	case "string", "nullstring", "blob":
+		return math.MaxInt64, true
+	}
+	return 0, false
+}
+
+func (rc *rowsCursor) HasNextResultSet() bool {
+	return rc.posSet < len(rc.rows)-1
+}
+
+func (rc *rowsCursor) NextResultSet() error {
+	if !rc.HasNextResultSet() {
+		return io.EOF
+	}
+	rc.posSet++
+	rc.pos = -1
+	return nil
 }
 
 var rowsCursorNextHook func(dest []driver.Value) error
@@ -748,10 +921,10 @@ func (rc *rowsCursor) Next(dest []driver.Value) error {
 	if rc.pos == rc.errPos {
 		return rc.err
 	}
-	if rc.pos >= len(rc.rows) {
+	if rc.pos >= len(rc.rows[rc.posSet]) {
 		return io.EOF // per interface spec
 	}
-	for i, v := range rc.rows[rc.pos].cols {
+	for i, v := range rc.rows[rc.posSet][rc.pos].cols {
 		// TODO(bradfitz): convert to subset types? naah, I
 		// think the subset types should only be input to
 		// driver, but the sql package should be able to handle
@@ -827,3 +1000,31 @@ func converterForType(typ string) driver.ValueConverter {
 	}
 	panic("invalid fakedb column type of " + typ)
 }
+
+func colTypeToReflectType(typ string) reflect.Type {
+	switch typ {
+	case "bool":
+		return reflect.TypeOf(false)
+	case "nullbool":
+		return reflect.TypeOf(NullBool{})
+	case "int32":
+		return reflect.TypeOf(int32(0))
+	case "string":
+		return reflect.TypeOf("")
+	case "blob":
+		return reflect.TypeOf([]byte(nil))
+	case "nullstring":
+		return reflect.TypeOf(NullString{})
+	case "int64":
+		return reflect.TypeOf(int64(0))
+	case "nullint64":
+		return reflect.TypeOf(NullInt64{})
+	case "float64":
+		return reflect.TypeOf(float64(0))
+	case "nullfloat64":
+		return reflect.TypeOf(NullFloat64{})
+	case "datetime":
+		return reflect.TypeOf(time.Time{})
+	}
+	return reflect.TypeOf(new(interface{})).Elem()
+}
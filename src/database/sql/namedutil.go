@@ -0,0 +1,115 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Dispatch to the optional driver interfaces that take named
+// arguments and transaction options, falling back to the original
+// interfaces for drivers that do not implement them.
+
+package sql
+
+import (
+	"database/sql/driver"
+	"errors"
+)
+
+func isExecerNamed(ci driver.Conn) bool {
+	_, ok := ci.(driver.ExecerNamed)
+	return ok
+}
+
+func isQueryerNamed(ci driver.Conn) bool {
+	_, ok := ci.(driver.QueryerNamed)
+	return ok
+}
+
+// driverExec executes query on ci, which implements driver.ExecerNamed
+// or driver.Execer; execer is ci as a driver.Execer, or nil.
+// Named arguments passed to a plain driver.Execer yield driver.ErrSkip,
+// so that the caller falls back to a prepared statement, which may
+// support them.
+func driverExec(ci driver.Conn, execer driver.Execer, query string, nvdargs []driver.NamedValue) (driver.Result, error) {
+	if execerNamed, ok := ci.(driver.ExecerNamed); ok {
+		return execerNamed.ExecNamed(query, nvdargs)
+	}
+	dargs, err := namedValueToValue(nvdargs)
+	if err != nil {
+		return nil, driver.ErrSkip
+	}
+	return execer.Exec(query, dargs)
+}
+
+// driverQuery executes query on ci, which implements driver.QueryerNamed
+// or driver.Queryer; queryer is ci as a driver.Queryer, or nil.
+// Named arguments are handled as in driverExec.
+func driverQuery(ci driver.Conn, queryer driver.Queryer, query string, nvdargs []driver.NamedValue) (driver.Rows, error) {
+	if queryerNamed, ok := ci.(driver.QueryerNamed); ok {
+		return queryerNamed.QueryNamed(query, nvdargs)
+	}
+	dargs, err := namedValueToValue(nvdargs)
+	if err != nil {
+		return nil, driver.ErrSkip
+	}
+	return queryer.Query(query, dargs)
+}
+
+func driverStmtExec(si driver.Stmt, nvdargs []driver.NamedValue) (driver.Result, error) {
+	if siNamed, ok := si.(driver.StmtExecNamed); ok {
+		return siNamed.ExecNamed(nvdargs)
+	}
+	dargs, err := namedValueToValue(nvdargs)
+	if err != nil {
+		return nil, err
+	}
+	return si.Exec(dargs)
+}
+
+func driverStmtQuery(si driver.Stmt, nvdargs []driver.NamedValue) (driver.Rows, error) {
+	if siNamed, ok := si.(driver.StmtQueryNamed); ok {
+		return siNamed.QueryNamed(nvdargs)
+	}
+	dargs, err := namedValueToValue(nvdargs)
+	if err != nil {
+		return nil, err
+	}
+	return si.Query(dargs)
+}
+
+var (
+	errNamedNotSupported     = errors.New("sql: driver does not support the use of Named Parameters")
+	errIsolationNotSupported = errors.New("sql: driver does not support non-default isolation level")
+	errReadOnlyNotSupported  = errors.New("sql: driver does not support read-only transactions")
+)
+
+// driverBeginTx starts a transaction on ci. Drivers that do not
+// implement driver.ConnBeginTx only support the default options.
+func driverBeginTx(ci driver.Conn, opts *TxOptions) (driver.Tx, error) {
+	var txOpts driver.TxOptions
+	if opts != nil {
+		txOpts = driver.TxOptions{
+			Isolation: driver.IsolationLevel(opts.Isolation),
+			ReadOnly:  opts.ReadOnly,
+		}
+	}
+	if ciBeginTx, ok := ci.(driver.ConnBeginTx); ok {
+		return ciBeginTx.BeginTx(txOpts)
+	}
+	if txOpts.Isolation != driver.IsolationLevel(LevelDefault) {
+		return nil, errIsolationNotSupported
+	}
+	if txOpts.ReadOnly {
+		return nil, errReadOnlyNotSupported
+	}
+	return ci.Begin()
+}
+
+func namedValueToValue(named []driver.NamedValue) ([]driver.Value, error) {
+	dargs := make([]driver.Value, len(named))
+	for n, param := range named {
+		if len(param.Name) > 0 {
+			return nil, errNamedNotSupported
+		}
+		dargs[n] = param.Value
+	}
+	return dargs, nil
+}
@@ -17,9 +17,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"reflect"
 	"runtime"
 	"sort"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var drivers = make(map[string]driver.Driver)
@@ -52,6 +56,94 @@ func Drivers() []string {
 	return list
 }
 
+// A NamedArg is a named argument. NamedArg values may be used as
+// arguments to Query or Exec and bind to the corresponding named
+// parameter in the SQL statement.
+//
+// For a more concise way to create NamedArg values, see
+// the Named function.
+type NamedArg struct {
+	_Named_Fields_Required struct{}
+
+	// Name is the name of the parameter placeholder.
+	//
+	// If empty, the ordinal position in the argument list will be
+	// used.
+	//
+	// Name must omit any symbol prefix.
+	Name string
+
+	// Value is the value of the parameter.
+	// It may be assigned the same value types as the query
+	// arguments.
+	Value interface{}
+}
+
+// Named provides a more concise way to create NamedArg values.
+//
+// Example usage:
+//
+//     db.Exec(`
+//         delete from Invoice
+//         where
+//             TimeCreated < @end
+//             and TimeCreated >= @start;`,
+//         sql.Named("start", startTime),
+//         sql.Named("end", endTime),
+//     )
+func Named(name string, value interface{}) NamedArg {
+	// This method exists because the go1compat promise
+	// doesn't guarantee that structs don't grow more fields,
+	// so unkeyed struct literals are a vet error. Thus, we don't
+	// want to allow sql.NamedArg{name, value}.
+	return NamedArg{Name: name, Value: value}
+}
+
+// IsolationLevel is the transaction isolation level used in TxOptions.
+type IsolationLevel int
+
+// Various isolation levels that drivers may support in BeginTx.
+// If a driver does not support a given isolation level an error may be returned.
+//
+// See https://en.wikipedia.org/wiki/Isolation_(database_systems)#Isolation_levels.
+const (
+	LevelDefault IsolationLevel = iota
+	LevelReadUncommitted
+	LevelReadCommitted
+	LevelWriteCommitted
+	LevelRepeatableRead
+	LevelSnapshot
+	LevelSerializable
+	LevelLinearizable
+)
+
+var isolationLevelNames = [...]string{
+	LevelDefault:         "Default",
+	LevelReadUncommitted: "Read Uncommitted",
+	LevelReadCommitted:   "Read Committed",
+	LevelWriteCommitted:  "Write Committed",
+	LevelRepeatableRead:  "Repeatable Read",
+	LevelSnapshot:        "Snapshot",
+	LevelSerializable:    "Serializable",
+	LevelLinearizable:    "Linearizable",
+}
+
+// String returns the name of the transaction isolation level.
+func (i IsolationLevel) String() string {
+	if i < 0 || int(i) >= len(isolationLevelNames) {
+		return "IsolationLevel(" + strconv.Itoa(int(i)) + ")"
+	}
+	return isolationLevelNames[i]
+}
+
+// TxOptions holds the transaction options to be used in DB.BeginTx.
+type TxOptions struct {
+	// Isolation is the transaction isolation level.
+	// If zero, the driver or database's default level is used.
+	Isolation IsolationLevel
+	ReadOnly  bool
+}
+
 // RawBytes is a byte slice that holds a reference to memory owned by
 // the database itself. After a Scan into a RawBytes, the slice is only
 // valid until the next call to Next, Scan, or Close.
@@ -209,6 +301,10 @@ var ErrNoRows = errors.New("sql: no rows in result set")
 // connection is returned to DB's idle connection pool. The pool size
 // can be controlled with SetMaxIdleConns.
 type DB struct {
+	// Atomic access only. At top of struct to prevent mis-alignment
+	// on 32-bit platforms. Of type time.Duration.
+	waitDuration int64 // Total time waited for new connections.
+
 	driver driver.Driver
 	dsn    string
 
@@ -222,12 +318,19 @@ type DB struct {
 	// maybeOpenNewConnections sends on the chan (one send per needed connection)
 	// It is closed during db.Close(). The close tells the connectionOpener
 	// goroutine to exit.
-	openerCh chan struct{}
-	closed   bool
-	dep      map[finalCloser]depSet
-	lastPut  map[*driverConn]string // stacktrace of last conn's put; debug only
-	maxIdle  int                    // zero means defaultMaxIdleConns; negative means 0
-	maxOpen  int                    // <= 0 means unlimited
+	openerCh          chan struct{}
+	closed            bool
+	dep               map[finalCloser]depSet
+	lastPut           map[*driverConn]string // stacktrace of last conn's put; debug only
+	maxIdle           int                    // zero means defaultMaxIdleConns; negative means 0
+	maxOpen           int                    // <= 0 means unlimited
+	maxLifetime       time.Duration          // maximum amount of time a connection may be reused
+	maxIdleTime       time.Duration          // maximum amount of time a connection may be idle before being closed
+	cleanerCh         chan struct{}
+	waitCount         int64 // Total number of connections waited for.
+	maxIdleClosed     int64 // Total number of connections closed due to idle count.
+	maxIdleTimeClosed int64 // Total number of connections closed due to idle time.
+	maxLifetimeClosed int64 // Total number of connections closed due to max connection lifetime limit.
 }
 
 // driverConn wraps a driver.Conn with a mutex, to
@@ -235,7 +338,8 @@ type DB struct {
 // interfaces returned via that Conn, such as calls on Tx, Stmt,
 // Result, Rows)
 type driverConn struct {
-	db *DB
+	db        *DB
+	createdAt time.Time
 
 	sync.Mutex  // guards following
 	ci          driver.Conn
@@ -245,8 +349,19 @@ type driverConn struct {
 
 	// guarded by db.mu
 	inUse      bool
-	onPut      []func() // code (with db.mu held) run when conn is next returned
-	dbmuClosed bool     // same as closed, but guarded by db.mu, for connIfFree
+	returnedAt time.Time // Time the connection was created or returned.
+	onPut      []func()  // code (with db.mu held) run when conn is next returned
+	dbmuClosed bool      // same as closed, but guarded by db.mu, for connIfFree
+}
+
+// nowFunc returns the current time; it's overridden in tests.
+var nowFunc = time.Now
+
+func (dc *driverConn) expired(timeout time.Duration) bool {
+	if timeout <= 0 {
+		return false
+	}
+	return dc.createdAt.Add(timeout).Before(nowFunc())
 }
 
 func (dc *driverConn) releaseConn(err error) {
@@ -459,7 +574,14 @@ func (db *DB) Ping() error {
 	// TODO(bradfitz): give drivers an optional hook to implement
 	// this in a more efficient or more reliable way, if they
 	// have one.
-	dc, err := db.conn()
+	var dc *driverConn
+	var err error
+	for i := 0; i < maxBadConnRetries; i++ {
+		dc, err = db.conn()
+		if err != driver.ErrBadConn {
+			break
+		}
+	}
 	if err != nil {
 		return err
 	}
@@ -478,6 +600,13 @@ func (db *DB) Close() error {
 		return nil
 	}
 	close(db.openerCh)
+	if db.cleanerCh != nil {
+		// Wake up the cleaner so that it notices db.closed and exits.
+		select {
+		case db.cleanerCh <- struct{}{}:
+		default:
+		}
+	}
 	var err error
 	fns := make([]func() error, 0, len(db.freeConn))
 	for _, dc := range db.freeConn {
@@ -539,6 +668,7 @@ func (db *DB) SetMaxIdleConns(n int) {
 		closing = db.freeConn[maxIdle:]
 		db.freeConn = db.freeConn[:maxIdle]
 	}
+	db.maxIdleClosed += int64(len(closing))
 	db.mu.Unlock()
 	for _, c := range closing {
 		c.Close()
@@ -566,6 +696,188 @@ func (db *DB) SetMaxOpenConns(n int) {
 	}
 }
 
+// SetConnMaxLifetime sets the maximum amount of time a connection may be reused.
+//
+// Expired connections may be closed lazily before reuse.
+//
+// If d <= 0, connections are not closed due to a connection's age.
+func (db *DB) SetConnMaxLifetime(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	db.mu.Lock()
+	// Wake cleaner up when lifetime is shortened.
+	if d > 0 && d < db.maxLifetime && db.cleanerCh != nil {
+		select {
+		case db.cleanerCh <- struct{}{}:
+		default:
+		}
+	}
+	db.maxLifetime = d
+	db.startCleanerLocked()
+	db.mu.Unlock()
+}
+
+// SetConnMaxIdleTime sets the maximum amount of time a connection may be idle.
+//
+// Expired connections may be closed lazily before reuse.
+//
+// If d <= 0, connections are not closed due to a connection's idle time.
+func (db *DB) SetConnMaxIdleTime(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	db.mu.Lock()
+	// Wake cleaner up when idle time is shortened.
+	if d > 0 && d < db.maxIdleTime && db.cleanerCh != nil {
+		select {
+		case db.cleanerCh <- struct{}{}:
+		default:
+		}
+	}
+	db.maxIdleTime = d
+	db.startCleanerLocked()
+	db.mu.Unlock()
+}
+
+// startCleanerLocked starts connectionCleaner if needed.
+func (db *DB) startCleanerLocked() {
+	if (db.maxLifetime > 0 || db.maxIdleTime > 0) && db.numOpen > 0 && db.cleanerCh == nil {
+		db.cleanerCh = make(chan struct{}, 1)
+		go db.connectionCleaner(db.shortestIdleTimeLocked())
+	}
+}
+
+// connectionCleaner periodically closes idle connections that exceeded
+// the maximum lifetime or idle time. It exits once the DB is closed,
+// there are no open connections, or both limits are disabled.
+func (db *DB) connectionCleaner(d time.Duration) {
+	const minInterval = time.Second
+
+	if d < minInterval {
+		d = minInterval
+	}
+	t := time.NewTimer(d)
+
+	for {
+		select {
+		case <-t.C:
+		case <-db.cleanerCh: // limits were changed or db was closed.
+		}
+
+		db.mu.Lock()
+		d = db.shortestIdleTimeLocked()
+		if db.closed || db.numOpen == 0 || d <= 0 {
+			db.cleanerCh = nil
+			db.mu.Unlock()
+			t.Stop()
+			return
+		}
+
+		closing := db.connectionCleanerRunLocked()
+		db.mu.Unlock()
+		for _, c := range closing {
+			c.Close()
+		}
+
+		if d < minInterval {
+			d = minInterval
+		}
+		t.Reset(d)
+	}
+}
+
+// connectionCleanerRunLocked removes connections that should be closed from
+// freeConn and returns them.
+func (db *DB) connectionCleanerRunLocked() (closing []*driverConn) {
+	if db.maxLifetime > 0 {
+		expiredSince := nowFunc().Add(-db.maxLifetime)
+		var expiredCount int64
+		for i := 0; i < len(db.freeConn); i++ {
+			c := db.freeConn[i]
+			if c.createdAt.Before(expiredSince) {
+				closing = append(closing, c)
+				expiredCount++
+				db.freeConn = append(db.freeConn[:i], db.freeConn[i+1:]...)
+				i--
+			}
+		}
+		db.maxLifetimeClosed += expiredCount
+	}
+
+	if db.maxIdleTime > 0 {
+		expiredSince := nowFunc().Add(-db.maxIdleTime)
+		var expiredCount int64
+		for i := 0; i < len(db.freeConn); i++ {
+			c := db.freeConn[i]
+			if c.returnedAt.Before(expiredSince) {
+				closing = append(closing, c)
+				expiredCount++
+				db.freeConn = append(db.freeConn[:i], db.freeConn[i+1:]...)
+				i--
+			}
+		}
+		db.maxIdleTimeClosed += expiredCount
+	}
+	return
+}
+
+// shortestIdleTimeLocked returns the interval at which the cleaner
+// should run: the smaller of the positive lifetime and idle time limits.
+func (db *DB) shortestIdleTimeLocked() time.Duration {
+	if db.maxIdleTime <= 0 {
+		return db.maxLifetime
+	}
+	if db.maxLifetime <= 0 {
+		return db.maxIdleTime
+	}
+	min := db.maxIdleTime
+	if min > db.maxLifetime {
+		min = db.maxLifetime
+	}
+	return min
+}
+
+// DBStats contains database statistics.
+type DBStats struct {
+	MaxOpenConnections int // Maximum number of open connections to the database; 0 means unlimited.
+
+	// Pool Status
+	OpenConnections int // The number of established connections both in use and idle.
+	InUse           int // The number of connections currently in use.
+	Idle            int // The number of idle connections.
+
+	// Counters
+	WaitCount         int64         // The total number of connections waited for.
+	WaitDuration      time.Duration // The total time blocked waiting for a new connection.
+	MaxIdleClosed     int64         // The total number of connections closed due to SetMaxIdleConns.
+	MaxIdleTimeClosed int64         // The total number of connections closed due to SetConnMaxIdleTime.
+	MaxLifetimeClosed int64         // The total number of connections closed due to SetConnMaxLifetime.
+}
+
+// Stats returns database statistics.
+func (db *DB) Stats() DBStats {
+	wait := atomic.LoadInt64(&db.waitDuration)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stats := DBStats{
+		MaxOpenConnections: db.maxOpen,
+
+		Idle:            len(db.freeConn),
+		OpenConnections: db.numOpen,
+		InUse:           db.numOpen - len(db.freeConn),
+
+		WaitCount:         db.waitCount,
+		WaitDuration:      time.Duration(wait),
+		MaxIdleClosed:     db.maxIdleClosed,
+		MaxIdleTimeClosed: db.maxIdleTimeClosed,
+		MaxLifetimeClosed: db.maxLifetimeClosed,
+	}
+	return stats
+}
+
 // Assumes db.mu is locked.
 // If there are connRequests and the connection limit hasn't been reached,
 // then tell the connectionOpener to open new connections.
@@ -608,8 +920,10 @@ func (db *DB) openNewConnection() {
 		return
 	}
 	dc := &driverConn{
-		db: db,
-		ci: ci,
+		db:         db,
+		createdAt:  nowFunc(),
+		returnedAt: nowFunc(),
+		ci:         ci,
 	}
 	if db.putConnDBLocked(dc, err) {
 		db.addDepLocked(dc, dc)
@@ -644,8 +958,21 @@ func (db *DB) conn() (*driverConn, error) {
 		// connectionOpener doesn't block while waiting for the req to be read.
 		req := make(chan connRequest, 1)
 		db.connRequests = append(db.connRequests, req)
+		db.waitCount++
+		lifetime := db.maxLifetime
 		db.mu.Unlock()
+		waitStart := time.Now()
 		ret := <-req
+		atomic.AddInt64(&db.waitDuration, int64(time.Since(waitStart)))
+		// Only check if the connection is expired if it was
+		// handed over by another goroutine rather than freshly opened.
+		if ret.err == nil && ret.conn != nil && ret.conn.expired(lifetime) {
+			db.mu.Lock()
+			db.maxLifetimeClosed++
+			db.mu.Unlock()
+			ret.conn.Close()
+			return nil, driver.ErrBadConn
+		}
 		return ret.conn, ret.err
 	}
 
@@ -653,6 +980,12 @@ func (db *DB) conn() (*driverConn, error) {
 		conn := db.freeConn[0]
 		copy(db.freeConn, db.freeConn[1:])
 		db.freeConn = db.freeConn[:c-1]
+		if conn.expired(db.maxLifetime) {
+			db.maxLifetimeClosed++
+			db.mu.Unlock()
+			conn.Close()
+			return nil, driver.ErrBadConn
+		}
 		conn.inUse = true
 		db.mu.Unlock()
 		return conn, nil
@@ -669,8 +1002,10 @@ func (db *DB) conn() (*driverConn, error) {
 	}
 	db.mu.Lock()
 	dc := &driverConn{
-		db: db,
-		ci: ci,
+		db:         db,
+		createdAt:  nowFunc(),
+		returnedAt: nowFunc(),
+		ci:         ci,
 	}
 	db.addDepLocked(dc, dc)
 	dc.inUse = true
@@ -765,6 +1100,10 @@ func (db *DB) putConn(dc *driverConn, err error) {
 	}
 	dc.onPut = nil
 
+	if err != driver.ErrBadConn && dc.expired(db.maxLifetime) {
+		db.maxLifetimeClosed++
+		err = driver.ErrBadConn
+	}
 	if err == driver.ErrBadConn {
 		// Don't reuse bad connections.
 		// Since the conn is considered bad and is being discarded, treat it
@@ -811,9 +1150,14 @@ func (db *DB) putConnDBLocked(dc *driverConn, err error) bool {
 			err:  err,
 		}
 		return true
-	} else if err == nil && !db.closed && db.maxIdleConnsLocked() > len(db.freeConn) {
-		db.freeConn = append(db.freeConn, dc)
-		return true
+	} else if err == nil && !db.closed {
+		if db.maxIdleConnsLocked() > len(db.freeConn) {
+			dc.returnedAt = nowFunc()
+			db.freeConn = append(db.freeConn, dc)
+			db.startCleanerLocked()
+			return true
+		}
+		db.maxIdleClosed++
 	}
 	return false
 }
@@ -879,22 +1223,28 @@ func (db *DB) Exec(query string, args ...interface{}) (Result, error) {
 	return res, err
 }
 
-func (db *DB) exec(query string, args []interface{}) (res Result, err error) {
+func (db *DB) exec(query string, args []interface{}) (Result, error) {
 	dc, err := db.conn()
 	if err != nil {
 		return nil, err
 	}
+	return db.execDC(dc, dc.releaseConn, query, args)
+}
+
+// execDC executes a query on the given connection.
+// The connection gets released by the release function.
+func (db *DB) execDC(dc *driverConn, release func(error), query string, args []interface{}) (res Result, err error) {
 	defer func() {
-		db.putConn(dc, err)
+		release(err)
 	}()
 
-	if execer, ok := dc.ci.(driver.Execer); ok {
+	if execer, ok := dc.ci.(driver.Execer); ok || isExecerNamed(dc.ci) {
 		dargs, err := driverArgs(nil, args)
 		if err != nil {
 			return nil, err
 		}
 		dc.Lock()
-		resi, err := execer.Exec(query, dargs)
+		resi, err := driverExec(dc.ci, execer, query, dargs)
 		dc.Unlock()
 		if err != driver.ErrSkip {
 			if err != nil {
@@ -940,14 +1290,14 @@ func (db *DB) query(query string, args []interface{}) (*Rows, error) {
 // queryConn executes a query on the given connection.
 // The connection gets released by the releaseConn function.
 func (db *DB) queryConn(dc *driverConn, releaseConn func(error), query string, args []interface{}) (*Rows, error) {
-	if queryer, ok := dc.ci.(driver.Queryer); ok {
+	if queryer, ok := dc.ci.(driver.Queryer); ok || isQueryerNamed(dc.ci) {
 		dargs, err := driverArgs(nil, args)
 		if err != nil {
 			releaseConn(err)
 			return nil, err
 		}
 		dc.Lock()
-		rowsi, err := queryer.Query(query, dargs)
+		rowsi, err := driverQuery(dc.ci, queryer, query, dargs)
 		dc.Unlock()
 		if err != driver.ErrSkip {
 			if err != nil {
@@ -1005,10 +1355,19 @@ func (db *DB) QueryRow(query string, args ...interface{}) *Row {
 // Begin starts a transaction. The isolation level is dependent on
 // the driver.
 func (db *DB) Begin() (*Tx, error) {
+	return db.BeginTx(nil)
+}
+
+// BeginTx starts a transaction.
+//
+// The provided TxOptions is optional and may be nil if defaults should be used.
+// If a non-default isolation level is used that the driver doesn't support,
+// an error will be returned.
+func (db *DB) BeginTx(opts *TxOptions) (*Tx, error) {
 	var tx *Tx
 	var err error
 	for i := 0; i < maxBadConnRetries; i++ {
-		tx, err = db.begin()
+		tx, err = db.begin(opts)
 		if err != driver.ErrBadConn {
 			break
 		}
@@ -1016,22 +1375,30 @@ func (db *DB) Begin() (*Tx, error) {
 	return tx, err
 }
 
-func (db *DB) begin() (tx *Tx, err error) {
+func (db *DB) begin(opts *TxOptions) (tx *Tx, err error) {
 	dc, err := db.conn()
 	if err != nil {
 		return nil, err
 	}
+	return db.beginDC(dc, dc.releaseConn, opts)
+}
+
+// beginDC starts a transaction. The provided dc must be valid and ready to use.
+// The connection gets released by the release function when the
+// transaction ends, or immediately if it cannot be started.
+func (db *DB) beginDC(dc *driverConn, release func(error), opts *TxOptions) (tx *Tx, err error) {
 	dc.Lock()
-	txi, err := dc.ci.Begin()
+	txi, err := driverBeginTx(dc.ci, opts)
 	dc.Unlock()
 	if err != nil {
-		db.putConn(dc, err)
+		release(err)
 		return nil, err
 	}
 	return &Tx{
-		db:  db,
-		dc:  dc,
-		txi: txi,
+		db:          db,
+		dc:          dc,
+		releaseConn: release,
+		txi:         txi,
 	}, nil
 }
 
@@ -1040,6 +1407,238 @@ func (db *DB) Driver() driver.Driver {
 	return db.driver
 }
 
+// Conn returns a single connection by either opening a new connection
+// or returning an existing connection from the connection pool. Conn will
+// block until either a connection is returned or the database is closed.
+//
+// Every Conn must be returned to the database pool after use by
+// calling Conn.Close.
+func (db *DB) Conn() (*Conn, error) {
+	var dc *driverConn
+	var err error
+	for i := 0; i < maxBadConnRetries; i++ {
+		dc, err = db.conn()
+		if err != driver.ErrBadConn {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &Conn{
+		db: db,
+		dc: dc,
+	}
+	return conn, nil
+}
+
+// Conn represents a single database connection rather than a pool of database
+// connections. Prefer running queries from DB unless there is a specific
+// need for a continuous single database connection, such as session state
+// kept in temporary tables or session variables.
+//
+// A Conn must call Close to return the connection to the database pool
+// and may do so concurrently with a running query.
+//
+// After a call to Close, all operations on the
+// connection fail with ErrConnDone.
+type Conn struct {
+	db *DB
+
+	// closemu prevents the connection from closing while there
+	// is an active query. It is held for read during queries
+	// and exclusively during close.
+	closemu sync.RWMutex
+
+	// dc is owned until close, at which point
+	// it's returned to the connection pool.
+	dc *driverConn
+
+	// done transitions from 0 to 1 exactly once, on close.
+	// Once done, all operations fail with ErrConnDone.
+	// Use atomic operations on value when checking value.
+	done int32
+}
+
+// ErrConnDone is returned by any operation that is performed on a connection
+// that has already been returned to the connection pool.
+var ErrConnDone = errors.New("sql: connection is already closed")
+
+// grabConnHook is a hook for testing.
+var grabConnHook func(*Conn)
+
+// grabConn takes a read lock on closemu, which is released by the
+// returned release function, so that Close waits for operations in
+// progress to finish.
+func (c *Conn) grabConn() (*driverConn, func(error), error) {
+	if atomic.LoadInt32(&c.done) != 0 {
+		return nil, nil, ErrConnDone
+	}
+	if grabConnHook != nil {
+		grabConnHook(c)
+	}
+	c.closemu.RLock()
+	if atomic.LoadInt32(&c.done) != 0 {
+		// Close won the race for closemu; c.dc is gone.
+		c.closemu.RUnlock()
+		return nil, nil, ErrConnDone
+	}
+	return c.dc, c.closemuRUnlockCondReleaseConn, nil
+}
+
+// Exec executes a query without returning any rows.
+// The args are for any placeholder parameters in the query.
+func (c *Conn) Exec(query string, args ...interface{}) (Result, error) {
+	dc, release, err := c.grabConn()
+	if err != nil {
+		return nil, err
+	}
+	return dc.db.execDC(dc, release, query, args)
+}
+
+// Query executes a query that returns rows, typically a SELECT.
+// The args are for any placeholder parameters in the query.
+//
+// The Conn cannot be closed until the returned Rows are closed.
+func (c *Conn) Query(query string, args ...interface{}) (*Rows, error) {
+	dc, release, err := c.grabConn()
+	if err != nil {
+		return nil, err
+	}
+	return dc.db.queryConn(dc, release, query, args)
+}
+
+// QueryRow executes a query that is expected to return at most one row.
+// QueryRow always returns a non-nil value. Errors are deferred until
+// Row's Scan method is called.
+func (c *Conn) QueryRow(query string, args ...interface{}) *Row {
+	rows, err := c.Query(query, args...)
+	return &Row{rows: rows, err: err}
+}
+
+// Prepare creates a prepared statement for later queries or executions.
+// Multiple queries or executions may be run concurrently from the
+// returned statement, all of them on this connection.
+// The caller must call the statement's Close method
+// when the statement is no longer needed.
+//
+// The returned statement can no longer be used once the Conn
+// has been closed.
+func (c *Conn) Prepare(query string) (*Stmt, error) {
+	dc, release, err := c.grabConn()
+	if err != nil {
+		return nil, err
+	}
+	defer release(nil)
+
+	dc.Lock()
+	si, err := dc.ci.Prepare(query)
+	dc.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	stmt := &Stmt{
+		db: dc.db,
+		cg: c,
+		cgds: &driverStmt{
+			Locker: dc,
+			si:     si,
+		},
+		query: query,
+	}
+	return stmt, nil
+}
+
+// Raw executes f exposing the underlying driver connection for the
+// duration of f. The driverConn must not be used outside of f.
+//
+// Once f returns and err is nil, the Conn will continue to be usable
+// until Conn.Close is called.
+func (c *Conn) Raw(f func(driverConn interface{}) error) (err error) {
+	var dc *driverConn
+	var release func(error)
+
+	// grabConn takes a read lock on closemu.
+	dc, release, err = c.grabConn()
+	if err != nil {
+		return
+	}
+	fPanic := true
+	dc.Lock()
+	defer func() {
+		dc.Unlock()
+
+		// If f panics fPanic will remain true.
+		// Ensure an error is passed to release so the connection
+		// may be discarded.
+		if fPanic {
+			err = driver.ErrBadConn
+		}
+		release(err)
+	}()
+	err = f(dc.ci)
+	fPanic = false
+
+	return
+}
+
+// Begin starts a transaction. The isolation level is dependent on
+// the driver.
+func (c *Conn) Begin() (*Tx, error) {
+	return c.BeginTx(nil)
+}
+
+// BeginTx starts a transaction on the connection.
+//
+// The provided TxOptions is optional and may be nil if defaults should be used.
+// If a non-default isolation level is used that the driver doesn't support,
+// an error will be returned.
+//
+// The Conn cannot be closed until the transaction is committed or
+// rolled back.
+func (c *Conn) BeginTx(opts *TxOptions) (*Tx, error) {
+	dc, release, err := c.grabConn()
+	if err != nil {
+		return nil, err
+	}
+	return dc.db.beginDC(dc, release, opts)
+}
+
+// closemuRUnlockCondReleaseConn read unlocks closemu
+// as the sql operation is done with the dc. A bad connection
+// is closed rather than being kept for later operations.
+func (c *Conn) closemuRUnlockCondReleaseConn(err error) {
+	c.closemu.RUnlock()
+	if err == driver.ErrBadConn {
+		c.close(err)
+	}
+}
+
+func (c *Conn) close(err error) error {
+	if !atomic.CompareAndSwapInt32(&c.done, 0, 1) {
+		return ErrConnDone
+	}
+
+	// Lock around releasing the driver connection
+	// to ensure all queries have been stopped before doing so.
+	c.closemu.Lock()
+	defer c.closemu.Unlock()
+
+	c.db.putConn(c.dc, err)
+	c.dc = nil
+	c.db = nil
+	return err
+}
+
+// Close returns the connection to the connection pool.
+// All operations after a Close will return with ErrConnDone.
+// Close is safe to call concurrently with other operations and will
+// block until all other operations finish.
+func (c *Conn) Close() error {
+	return c.close(nil)
+}
+
 // Tx is an in-progress database transaction.
 //
 // A transaction must end with a call to Commit or Rollback.
@@ -1050,9 +1649,10 @@ type Tx struct {
 	db *DB
 
 	// dc is owned exclusively until Commit or Rollback, at which point
-	// it's returned with putConn.
-	dc  *driverConn
-	txi driver.Tx
+	// it's returned with releaseConn.
+	dc          *driverConn
+	releaseConn func(error)
+	txi         driver.Tx
 
 	// done transitions from false to true exactly once, on Commit
 	// or Rollback. once done, all operations fail with
@@ -1074,16 +1674,16 @@ func (tx *Tx) close() {
 		panic("double close") // internal error
 	}
 	tx.done = true
-	tx.db.putConn(tx.dc, nil)
+	tx.releaseConn(nil)
 	tx.dc = nil
 	tx.txi = nil
 }
 
-func (tx *Tx) grabConn() (*driverConn, error) {
+func (tx *Tx) grabConn() (*driverConn, func(error), error) {
 	if tx.done {
-		return nil, ErrTxDone
+		return nil, nil, ErrTxDone
 	}
-	return tx.dc, nil
+	return tx.dc, func(error) {}, nil
 }
 
 // Closes all Stmts prepared for this transaction.
@@ -1145,7 +1745,7 @@ func (tx *Tx) Prepare(query string) (*Stmt, error) {
 	// Perhaps just looking at the reference count (by noting
 	// Stmt.Close) would be enough. We might also want a finalizer
 	// on Stmt to drop the reference count.
-	dc, err := tx.grabConn()
+	dc, _, err := tx.grabConn()
 	if err != nil {
 		return nil, err
 	}
@@ -1159,8 +1759,8 @@ func (tx *Tx) Prepare(query string) (*Stmt, error) {
 
 	stmt := &Stmt{
 		db: tx.db,
-		tx: tx,
-		txsi: &driverStmt{
+		cg: tx,
+		cgds: &driverStmt{
 			Locker: dc,
 			si:     si,
 		},
@@ -1190,7 +1790,7 @@ func (tx *Tx) Stmt(stmt *Stmt) *Stmt {
 	if tx.db != stmt.db {
 		return &Stmt{stickyErr: errors.New("sql: Tx.Stmt: statement from different database used")}
 	}
-	dc, err := tx.grabConn()
+	dc, _, err := tx.grabConn()
 	if err != nil {
 		return &Stmt{stickyErr: err}
 	}
@@ -1199,8 +1799,8 @@ func (tx *Tx) Stmt(stmt *Stmt) *Stmt {
 	dc.Unlock()
 	txs := &Stmt{
 		db: tx.db,
-		tx: tx,
-		txsi: &driverStmt{
+		cg: tx,
+		cgds: &driverStmt{
 			Locker: dc,
 			si:     si,
 		},
@@ -1216,18 +1816,18 @@ func (tx *Tx) Stmt(stmt *Stmt) *Stmt {
 // Exec executes a query that doesn't return rows.
 // For example: an INSERT and UPDATE.
 func (tx *Tx) Exec(query string, args ...interface{}) (Result, error) {
-	dc, err := tx.grabConn()
+	dc, _, err := tx.grabConn()
 	if err != nil {
 		return nil, err
 	}
 
-	if execer, ok := dc.ci.(driver.Execer); ok {
+	if execer, ok := dc.ci.(driver.Execer); ok || isExecerNamed(dc.ci) {
 		dargs, err := driverArgs(nil, args)
 		if err != nil {
 			return nil, err
 		}
 		dc.Lock()
-		resi, err := execer.Exec(query, dargs)
+		resi, err := driverExec(dc.ci, execer, query, dargs)
 		dc.Unlock()
 		if err == nil {
 			return driverResult{dc, resi}, nil
@@ -1250,12 +1850,11 @@ func (tx *Tx) Exec(query string, args ...interface{}) (Result, error) {
 
 // Query executes a query that returns rows, typically a SELECT.
 func (tx *Tx) Query(query string, args ...interface{}) (*Rows, error) {
-	dc, err := tx.grabConn()
+	dc, release, err := tx.grabConn()
 	if err != nil {
 		return nil, err
 	}
-	releaseConn := func(error) {}
-	return tx.db.queryConn(dc, releaseConn, query, args)
+	return tx.db.queryConn(dc, release, query, args)
 }
 
 // QueryRow executes a query that is expected to return at most one row.
@@ -1266,6 +1865,19 @@ func (tx *Tx) QueryRow(query string, args ...interface{}) *Row {
 	return &Row{rows: rows, err: err}
 }
 
+// stmtConnGrabber represents a Tx or Conn that will return the underlying
+// driverConn and release function.
+type stmtConnGrabber interface {
+	// grabConn returns the driverConn and the associated release function
+	// that must be called when the operation completes.
+	grabConn() (*driverConn, func(error), error)
+}
+
+var (
+	_ stmtConnGrabber = &Tx{}
+	_ stmtConnGrabber = &Conn{}
+)
+
 // connStmt is a prepared statement on a particular connection.
 type connStmt struct {
 	dc *driverConn
@@ -1281,17 +1893,17 @@ type Stmt struct {
 
 	closemu sync.RWMutex // held exclusively during close, for read otherwise.
 
-	// If in a transaction, else both nil:
-	tx   *Tx
-	txsi *driverStmt
+	// If in a transaction or bound to a Conn, else both nil:
+	cg   stmtConnGrabber
+	cgds *driverStmt
 
 	mu     sync.Mutex // protects the rest of the fields
 	closed bool
 
 	// css is a list of underlying driver statement interfaces
 	// that are valid on particular connections.  This is only
-	// used if tx == nil and one is found that has idle
-	// connections.  If tx != nil, txsi is always used.
+	// used if cg == nil and one is found that has idle
+	// connections.  If cg != nil, cgds is always used.
 	css []connStmt
 }
 
@@ -1338,7 +1950,7 @@ func resultFromStatement(ds driverStmt, args ...interface{}) (Result, error) {
 	}
 
 	ds.Lock()
-	resi, err := ds.si.Exec(dargs)
+	resi, err := driverStmtExec(ds.si, dargs)
 	ds.Unlock()
 	if err != nil {
 		return nil, err
@@ -1360,16 +1972,15 @@ func (s *Stmt) connStmt() (ci *driverConn, releaseConn func(error), si driver.St
 		return
 	}
 
-	// In a transaction, we always use the connection that the
-	// transaction was created on.
-	if s.tx != nil {
+	// In a transaction or on a Conn, we always use the connection
+	// that the transaction or Conn was created on.
+	if s.cg != nil {
 		s.mu.Unlock()
-		ci, err = s.tx.grabConn() // blocks, waiting for the connection.
+		ci, releaseConn, err = s.cg.grabConn() // blocks, waiting for the connection.
 		if err != nil {
 			return
 		}
-		releaseConn = func(error) {}
-		return ci, releaseConn, s.txsi.si, nil
+		return ci, releaseConn, s.cgds.si, nil
 	}
 
 	for i := 0; i < len(s.css); i++ {
@@ -1485,7 +2096,7 @@ func rowsiFromStatement(ds driverStmt, args ...interface{}) (driver.Rows, error)
 	}
 
 	ds.Lock()
-	rowsi, err := ds.si.Query(dargs)
+	rowsi, err := driverStmtQuery(ds.si, dargs)
 	ds.Unlock()
 	if err != nil {
 		return nil, err
@@ -1527,8 +2138,8 @@ func (s *Stmt) Close() error {
 	}
 	s.closed = true
 
-	if s.tx != nil {
-		s.txsi.Close()
+	if s.cg != nil {
+		s.cgds.Close()
 		s.mu.Unlock()
 		return nil
 	}
@@ -1571,7 +2182,7 @@ type Rows struct {
 
 	closed    bool
 	lastcols  []driver.Value
-	lasterr   error       // non-nil only if closed is true
+	lasterr   error       // non-nil only if closed is true, or io.EOF between result sets
 	closeStmt driver.Stmt // if non-nil, statement to Close on close
 }
 
@@ -1589,6 +2200,40 @@ func (rs *Rows) Next() bool {
 		rs.lastcols = make([]driver.Value, len(rs.rowsi.Columns()))
 	}
 	rs.lasterr = rs.rowsi.Next(rs.lastcols)
+	if rs.lasterr != nil {
+		// Leave the Rows open at the end of a result set if the
+		// driver has another one ready, so NextResultSet can
+		// advance to it.
+		if rs.lasterr == io.EOF {
+			if nrs, ok := rs.rowsi.(driver.RowsNextResultSet); ok && nrs.HasNextResultSet() {
+				return false
+			}
+		}
+		rs.Close()
+		return false
+	}
+	return true
+}
+
+// NextResultSet prepares the next result set for reading. It returns true if
+// there are further result sets, or false if there is no further result set
+// or if there is an error advancing to it. The Err method should be consulted
+// to distinguish between the two cases.
+//
+// After calling NextResultSet, the Next method should always be called before
+// scanning. If there are further result sets they may not have rows in the result
+// set.
+func (rs *Rows) NextResultSet() bool {
+	if rs.closed {
+		return false
+	}
+	rs.lastcols = nil
+	nrs, ok := rs.rowsi.(driver.RowsNextResultSet)
+	if !ok {
+		rs.Close()
+		return false
+	}
+	rs.lasterr = nrs.NextResultSet()
 	if rs.lasterr != nil {
 		rs.Close()
 		return false
@@ -1618,6 +2263,108 @@ func (rs *Rows) Columns() ([]string, error) {
 	return rs.rowsi.Columns(), nil
 }
 
+// ColumnTypes returns column information such as column type, length,
+// and nullable. Some information may not be available from some drivers.
+func (rs *Rows) ColumnTypes() ([]*ColumnType, error) {
+	if rs.closed {
+		return nil, errors.New("sql: Rows are closed")
+	}
+	if rs.rowsi == nil {
+		return nil, errors.New("sql: no Rows available")
+	}
+	return rowsColumnInfoSetup(rs.rowsi), nil
+}
+
+// ColumnType contains the name and type of a column.
+type ColumnType struct {
+	name string
+
+	hasNullable       bool
+	hasLength         bool
+	hasPrecisionScale bool
+
+	nullable     bool
+	length       int64
+	databaseType string
+	precision    int64
+	scale        int64
+	scanType     reflect.Type
+}
+
+// Name returns the name or alias of the column.
+func (ci *ColumnType) Name() string {
+	return ci.name
+}
+
+// Length returns the column type length for variable length column types such
+// as text and binary field types. If the type length is unbounded the value will
+// be math.MaxInt64 (any database limits will still apply).
+// If the column type is not variable length, such as an int, or if not supported
+// by the driver ok is false.
+func (ci *ColumnType) Length() (length int64, ok bool) {
+	return ci.length, ci.hasLength
+}
+
+// DecimalSize returns the scale and precision of a decimal type.
+// If not applicable or if not supported ok is false.
+func (ci *ColumnType) DecimalSize() (precision, scale int64, ok bool) {
+	return ci.precision, ci.scale, ci.hasPrecisionScale
+}
+
+// ScanType returns a Go type suitable for scanning into using Rows.Scan.
+// If a driver does not support this property ScanType will return
+// the type of an empty interface.
+func (ci *ColumnType) ScanType() reflect.Type {
+	return ci.scanType
+}
+
+// Nullable returns whether the column may be null.
+// If a driver does not support this property ok will be false.
+func (ci *ColumnType) Nullable() (nullable, ok bool) {
+	return ci.nullable, ci.hasNullable
+}
+
+// DatabaseTypeName returns the database system name of the column type. If an empty
+// string is returned the driver type name is not supported.
+// Consult your driver documentation for a list of driver data types. Length specifiers
+// are not included.
+// Common type names include "VARCHAR", "TEXT", "NVARCHAR", "DECIMAL", "BOOL", "INT",
+// and "BIGINT".
+func (ci *ColumnType) DatabaseTypeName() string {
+	return ci.databaseType
+}
+
+func rowsColumnInfoSetup(rowsi driver.Rows) []*ColumnType {
+	names := rowsi.Columns()
+
+	list := make([]*ColumnType, len(names))
+	for i := range list {
+		ci := &ColumnType{
+			name: names[i],
+		}
+		list[i] = ci
+
+		if prop, ok := rowsi.(driver.RowsColumnTypeScanType); ok {
+			ci.scanType = prop.ColumnTypeScanType(i)
+		} else {
+			ci.scanType = reflect.TypeOf(new(interface{})).Elem()
+		}
+		if prop, ok := rowsi.(driver.RowsColumnTypeDatabaseTypeName); ok {
+			ci.databaseType = prop.ColumnTypeDatabaseTypeName(i)
+		}
+		if prop, ok := rowsi.(driver.RowsColumnTypeLength); ok {
+			ci.length, ci.hasLength = prop.ColumnTypeLength(i)
+		}
+		if prop, ok := rowsi.(driver.RowsColumnTypeNullable); ok {
+			ci.nullable, ci.hasNullable = prop.ColumnTypeNullable(i)
+		}
+		if prop, ok := rowsi.(driver.RowsColumnTypePrecisionScale); ok {
+			ci.precision, ci.scale, ci.hasPrecisionScale = prop.ColumnTypePrecisionScale(i)
+		}
+	}
+	return list
+}
+
 // Scan copies the columns in the current row into the values pointed
 // at by dest.
 //
@@ -1651,8 +2398,9 @@ func (rs *Rows) Scan(dest ...interface{}) error {
 
 var rowsCloseHook func(*Rows, *error)
 
-// Close closes the Rows, preventing further enumeration. If Next returns
-// false, the Rows are closed automatically and it will suffice to check the
+// Close closes the Rows, preventing further enumeration. If Next is called
+// and returns false and there are no further result sets,
+// the Rows are closed automatically and it will suffice to check the
 // result of Err. Close is idempotent and does not affect the result of Err.
 func (rs *Rows) Close() error {
 	if rs.closed {
@@ -8,6 +8,7 @@ import (
 	"database/sql/driver"
 	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"reflect"
 	"runtime"
@@ -206,6 +207,122 @@ func TestQuery(t *testing.T) {
 	}
 }
 
+func TestMultiResultSetQuery(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+	prepares0 := numPrepares(t, db)
+	rows, err := db.Query("SELECT|people|age,name|;SELECT|people|name|age=?", 2)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	type row1 struct {
+		age  int
+		name string
+	}
+	type row2 struct {
+		name string
+	}
+	got1 := []row1{}
+	for rows.Next() {
+		var r row1
+		err = rows.Scan(&r.age, &r.name)
+		if err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		got1 = append(got1, r)
+	}
+	err = rows.Err()
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	want1 := []row1{
+		{age: 1, name: "Alice"},
+		{age: 2, name: "Bob"},
+		{age: 3, name: "Chris"},
+	}
+	if !reflect.DeepEqual(got1, want1) {
+		t.Errorf("mismatch.\n got1: %#v\nwant: %#v", got1, want1)
+	}
+
+	// The connection stays busy until the last result set is read.
+	if n := db.numFreeConns(); n != 0 {
+		t.Fatalf("free conns between result sets = %d; want 0", n)
+	}
+
+	if !rows.NextResultSet() {
+		t.Fatalf("expected another result set; err = %v", rows.Err())
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("Columns: %v", err)
+	}
+	if want := []string{"name"}; !reflect.DeepEqual(cols, want) {
+		t.Errorf("second result set columns = %v; want %v", cols, want)
+	}
+
+	got2 := []row2{}
+	for rows.Next() {
+		var r row2
+		err = rows.Scan(&r.name)
+		if err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		got2 = append(got2, r)
+	}
+	err = rows.Err()
+	if err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	want2 := []row2{
+		{name: "Bob"},
+	}
+	if !reflect.DeepEqual(got2, want2) {
+		t.Errorf("mismatch.\n got: %#v\nwant: %#v", got2, want2)
+	}
+	if rows.NextResultSet() {
+		t.Errorf("expected no more result sets")
+	}
+
+	// And verify that the final rows.Next() call, which hit EOF,
+	// also closed the rows connection.
+	if n := db.numFreeConns(); n != 1 {
+		t.Fatalf("free conns after query hitting EOF = %d; want 1", n)
+	}
+	if prepares := numPrepares(t, db) - prepares0; prepares != 1 {
+		t.Errorf("executed %d Prepare statements; want 1", prepares)
+	}
+}
+
+func TestNextResultSetSkipsRows(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+	rows, err := db.Query("SELECT|people|age|;SELECT|people|name|age=?", 3)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if !rows.Next() {
+		t.Fatalf("expected a first row; err = %v", rows.Err())
+	}
+	// Abandon the remaining rows of the first result set.
+	if !rows.NextResultSet() {
+		t.Fatalf("expected another result set; err = %v", rows.Err())
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if want := []string{"Chris"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v; want %v", names, want)
+	}
+}
+
 func TestByteOwnership(t *testing.T) {
 	db := newTestDB(t, "people")
 	defer closeDB(t, db)
@@ -263,6 +380,75 @@ func TestRowsColumns(t *testing.T) {
 	}
 }
 
+func TestRowsColumnTypes(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+	rows, err := db.Query("SELECT|people|age,name,photo,bdate|age=?", 3)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	tt, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatalf("ColumnTypes: %v", err)
+	}
+
+	type want struct {
+		name     string
+		dbType   string
+		scanType reflect.Type
+		length   int64
+		hasLen   bool
+		nullable bool
+	}
+	wants := []want{
+		{"age", "INT32", reflect.TypeOf(int32(0)), 0, false, false},
+		{"name", "STRING", reflect.TypeOf(""), math.MaxInt64, true, false},
+		{"photo", "BLOB", reflect.TypeOf([]byte(nil)), math.MaxInt64, true, false},
+		{"bdate", "DATETIME", reflect.TypeOf(time.Time{}), 0, false, true},
+	}
+	if len(tt) != len(wants) {
+		t.Fatalf("got %d column types; want %d", len(tt), len(wants))
+	}
+	for i, ct := range tt {
+		w := wants[i]
+		if ct.Name() != w.name {
+			t.Errorf("column %d: Name = %q; want %q", i, ct.Name(), w.name)
+		}
+		if ct.DatabaseTypeName() != w.dbType {
+			t.Errorf("column %d: DatabaseTypeName = %q; want %q", i, ct.DatabaseTypeName(), w.dbType)
+		}
+		if ct.ScanType() != w.scanType {
+			t.Errorf("column %d: ScanType = %v; want %v", i, ct.ScanType(), w.scanType)
+		}
+		if length, ok := ct.Length(); length != w.length || ok != w.hasLen {
+			t.Errorf("column %d: Length = %d, %v; want %d, %v", i, length, ok, w.length, w.hasLen)
+		}
+		if nullable, ok := ct.Nullable(); nullable != w.nullable || !ok {
+			t.Errorf("column %d: Nullable = %v, %v; want %v, true", i, nullable, ok, w.nullable)
+		}
+		if _, _, ok := ct.DecimalSize(); ok {
+			t.Errorf("column %d: DecimalSize reported ok for a driver without precision support", i)
+		}
+	}
+
+	// Scanning into values of the reported types must work.
+	values := make([]interface{}, len(tt))
+	for i, ct := range tt {
+		values[i] = reflect.New(ct.ScanType()).Interface()
+	}
+	for rows.Next() {
+		if err := rows.Scan(values...); err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if _, err := rows.ColumnTypes(); err == nil {
+		t.Error("expected error from ColumnTypes on closed Rows")
+	}
+}
+
 func TestQueryRow(t *testing.T) {
 	db := newTestDB(t, "people")
 	defer closeDB(t, db)
@@ -581,6 +767,383 @@ func TestTxErrBadConn(t *testing.T) {
 	}
 }
 
+func TestConnQuery(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+
+	conn, err := db.Conn()
+	if err != nil {
+		t.Fatalf("Conn: %v", err)
+	}
+	if n := db.numFreeConns(); n != 0 {
+		t.Errorf("free conns while Conn is held = %d; want 0", n)
+	}
+
+	var name string
+	if err := conn.QueryRow("SELECT|people|name|age=?", 3).Scan(&name); err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	if name != "Chris" {
+		t.Errorf("name = %q; want Chris", name)
+	}
+	if _, err := conn.Exec("INSERT|people|name=Dave,age=?", 4); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+
+	stmt, err := conn.Prepare("SELECT|people|name|age=?")
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	if err := stmt.QueryRow(4).Scan(&name); err != nil {
+		t.Fatalf("Stmt.QueryRow: %v", err)
+	}
+	if name != "Dave" {
+		t.Errorf("name = %q; want Dave", name)
+	}
+
+	// All work happens on the one pinned connection.
+	var ci interface{}
+	for i := 0; i < 2; i++ {
+		err = conn.Raw(func(dc interface{}) error {
+			if ci != nil && dc != ci {
+				t.Errorf("Raw call %d got driver conn %p; want %p", i, dc, ci)
+			}
+			ci = dc
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Raw: %v", err)
+		}
+	}
+	if fc := ci.(*fakeConn); fc.numPrepare < 3 {
+		t.Errorf("pinned conn prepared %d statements; want at least 3", fc.numPrepare)
+	}
+
+	if err := stmt.Close(); err != nil {
+		t.Fatalf("Stmt.Close: %v", err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if n := db.numFreeConns(); n != 1 {
+		t.Errorf("free conns after Conn.Close = %d; want 1", n)
+	}
+
+	if err := conn.Close(); err != ErrConnDone {
+		t.Errorf("second Close = %v; want ErrConnDone", err)
+	}
+	if _, err := conn.Exec("INSERT|people|name=Eve,age=?", 5); err != ErrConnDone {
+		t.Errorf("Exec after Close = %v; want ErrConnDone", err)
+	}
+	if _, err := conn.Query("SELECT|people|name|"); err != ErrConnDone {
+		t.Errorf("Query after Close = %v; want ErrConnDone", err)
+	}
+	if _, err := conn.Begin(); err != ErrConnDone {
+		t.Errorf("Begin after Close = %v; want ErrConnDone", err)
+	}
+	if _, err := stmt.Exec(1); err == nil {
+		t.Error("expected error from Stmt prepared on a closed Conn")
+	}
+}
+
+func TestConnTx(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+
+	conn, err := db.Conn()
+	if err != nil {
+		t.Fatalf("Conn: %v", err)
+	}
+	defer conn.Close()
+
+	tx, err := conn.BeginTx(&TxOptions{Isolation: LevelReadCommitted})
+	if err != nil {
+		t.Fatalf("BeginTx: %v", err)
+	}
+	if _, err := tx.Exec("INSERT|people|name=Dave,age=?", 4); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	// The connection stays with the Conn after the transaction ends.
+	if n := db.numFreeConns(); n != 0 {
+		t.Errorf("free conns after Commit = %d; want 0", n)
+	}
+	var age int
+	if err := conn.QueryRow("SELECT|people|age|name=?", "Dave").Scan(&age); err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	if age != 4 {
+		t.Errorf("age = %d; want 4", age)
+	}
+}
+
+func TestConnCloseWaitsForRows(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+
+	conn, err := db.Conn()
+	if err != nil {
+		t.Fatalf("Conn: %v", err)
+	}
+	rows, err := conn.Query("SELECT|people|name|")
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- conn.Close()
+	}()
+	select {
+	case err := <-closed:
+		t.Fatalf("Close returned %v while Rows were open", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	for rows.Next() {
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+	if err := <-closed; err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if n := db.numFreeConns(); n != 1 {
+		t.Errorf("free conns after Close = %d; want 1", n)
+	}
+}
+
+func TestConnCloseConcurrentExec(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+
+	// Close between Exec's check of done and its read lock.
+	conn, err := db.Conn()
+	if err != nil {
+		t.Fatalf("Conn: %v", err)
+	}
+	grabConnHook = func(c *Conn) {
+		grabConnHook = nil
+		if err := c.Close(); err != nil {
+			t.Errorf("Close: %v", err)
+		}
+	}
+	defer func() { grabConnHook = nil }()
+	if _, err := conn.Exec("INSERT|people|name=Dave,age=?", 4); err != ErrConnDone {
+		t.Errorf("Exec racing with Close = %v; want ErrConnDone", err)
+	}
+
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	for i := 0; i < 200; i++ {
+		conn, err := db.Conn()
+		if err != nil {
+			t.Fatalf("Conn: %v", err)
+		}
+		const n = 4
+		errc := make(chan error, n)
+		for j := 0; j < n; j++ {
+			go func() {
+				_, err := conn.Exec("INSERT|people|name=Dave,age=?", 4)
+				errc <- err
+			}()
+		}
+		if err := conn.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		for j := 0; j < n; j++ {
+			if err := <-errc; err != nil && err != ErrConnDone {
+				t.Fatalf("Exec concurrent with Close = %v; want nil or ErrConnDone", err)
+			}
+		}
+	}
+}
+
+func TestConnRawBadConn(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+
+	conn, err := db.Conn()
+	if err != nil {
+		t.Fatalf("Conn: %v", err)
+	}
+	err = conn.Raw(func(dc interface{}) error {
+		if _, ok := dc.(*fakeConn); !ok {
+			t.Errorf("Raw got %T; want *fakeConn", dc)
+		}
+		return driver.ErrBadConn
+	})
+	if err != driver.ErrBadConn {
+		t.Fatalf("Raw = %v; want ErrBadConn", err)
+	}
+
+	// A bad connection closes the Conn and is not put back into the pool.
+	if _, err := conn.Exec("INSERT|people|name=Dave,age=?", 4); err != ErrConnDone {
+		t.Errorf("Exec after bad conn = %v; want ErrConnDone", err)
+	}
+	if n := db.numFreeConns(); n != 0 {
+		t.Errorf("free conns after bad conn = %d; want 0", n)
+	}
+	if n := db.numOpen; n != 0 {
+		t.Errorf("open conns after bad conn = %d; want 0", n)
+	}
+}
+
+func TestBeginTxOptions(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+
+	tx, err := db.BeginTx(&TxOptions{Isolation: LevelSerializable, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("BeginTx: %v", err)
+	}
+	want := driver.TxOptions{Isolation: driver.IsolationLevel(LevelSerializable), ReadOnly: true}
+	if got := tx.txi.(*fakeTx).opts; got != want {
+		t.Errorf("driver got options %+v; want %+v", got, want)
+	}
+	var name string
+	if err := tx.QueryRow("SELECT|people|name|age=?", 1).Scan(&name); err != nil {
+		t.Fatalf("QueryRow in read-only transaction: %v", err)
+	}
+	if name != "Alice" {
+		t.Errorf("name = %q; want Alice", name)
+	}
+	if _, err := tx.Exec("INSERT|people|name=Dave,age=?", 4); err == nil {
+		t.Error("expected error from INSERT in read-only transaction")
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+
+	tx, err = db.BeginTx(nil)
+	if err != nil {
+		t.Fatalf("BeginTx(nil): %v", err)
+	}
+	if got := tx.txi.(*fakeTx).opts; got != (driver.TxOptions{}) {
+		t.Errorf("driver got options %+v for nil TxOptions; want zero value", got)
+	}
+	if _, err := tx.Exec("INSERT|people|name=Dave,age=?", 4); err != nil {
+		t.Errorf("INSERT in read-write transaction: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	if _, err := db.BeginTx(&TxOptions{Isolation: LevelLinearizable}); err == nil {
+		t.Error("expected error from BeginTx with an isolation level the driver does not support")
+	}
+	if n := db.numFreeConns(); n != 1 {
+		t.Errorf("free conns after failed BeginTx = %d; want 1", n)
+	}
+}
+
+// beginOnlyConn hides the optional interfaces of a driver.Conn.
+type beginOnlyConn struct {
+	driver.Conn
+}
+
+// plainStmt hides the optional interfaces of a driver.Stmt.
+type plainStmt struct {
+	driver.Stmt
+}
+
+func TestOptionsNotSupportedByDriver(t *testing.T) {
+	ci := beginOnlyConn{&fakeConn{db: &fakeDB{}}}
+	if _, err := driverBeginTx(ci, &TxOptions{Isolation: LevelSerializable}); err != errIsolationNotSupported {
+		t.Errorf("BeginTx with isolation level: err = %v; want %v", err, errIsolationNotSupported)
+	}
+	if _, err := driverBeginTx(ci, &TxOptions{ReadOnly: true}); err != errReadOnlyNotSupported {
+		t.Errorf("BeginTx with read-only: err = %v; want %v", err, errReadOnlyNotSupported)
+	}
+	tx, err := driverBeginTx(ci, &TxOptions{})
+	if err != nil {
+		t.Fatalf("BeginTx with default options: %v", err)
+	}
+	tx.Rollback()
+
+	args := []driver.NamedValue{{Name: "age", Ordinal: 1, Value: int64(1)}}
+	if _, err := driverStmtExec(plainStmt{}, args); err != errNamedNotSupported {
+		t.Errorf("Exec with named argument: err = %v; want %v", err, errNamedNotSupported)
+	}
+	if _, err := driverStmtQuery(plainStmt{}, args); err != errNamedNotSupported {
+		t.Errorf("Query with named argument: err = %v; want %v", err, errNamedNotSupported)
+	}
+}
+
+func TestNamedArgs(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+
+	exec(t, db, "INSERT|people|name=?name,age=?age", Named("age", 4), Named("name", "Dave"))
+
+	var name string
+	if err := db.QueryRow("SELECT|people|name|age=?age", Named("age", 4)).Scan(&name); err != nil {
+		t.Fatalf("QueryRow: %v", err)
+	}
+	if name != "Dave" {
+		t.Errorf("name = %q; want Dave", name)
+	}
+
+	// Named and positional arguments may be mixed.
+	stmt, err := db.Prepare("SELECT|people|name|age=?;SELECT|people|age|name=?name")
+	if err != nil {
+		t.Fatalf("Prepare: %v", err)
+	}
+	defer stmt.Close()
+	rows, err := stmt.Query(Named("name", "Bob"), 3)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		t.Fatalf("expected a row; err = %v", rows.Err())
+	}
+	if err := rows.Scan(&name); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if name != "Chris" {
+		t.Errorf("name = %q; want Chris", name)
+	}
+	var age int
+	if !rows.NextResultSet() || !rows.Next() {
+		t.Fatalf("expected a row in the second result set; err = %v", rows.Err())
+	}
+	if err := rows.Scan(&age); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if age != 2 {
+		t.Errorf("age = %d; want 2", age)
+	}
+
+	if _, err := db.Exec("INSERT|people|name=?name,age=?", Named("nom", "Eve"), 5); err == nil {
+		t.Error("expected error for an argument name without a placeholder")
+	}
+	for _, bad := range []string{"1st", "a-b", "a b"} {
+		if _, err := db.Exec("INSERT|people|name=?,age=?", Named(bad, "Eve"), 5); err == nil {
+			t.Errorf("expected error for invalid argument name %q", bad)
+		}
+	}
+}
+
+func TestIsolationLevelString(t *testing.T) {
+	tests := []struct {
+		level IsolationLevel
+		want  string
+	}{
+		{LevelDefault, "Default"},
+		{LevelRepeatableRead, "Repeatable Read"},
+		{LevelLinearizable, "Linearizable"},
+		{LevelLinearizable + 1, "IsolationLevel(8)"},
+		{-1, "IsolationLevel(-1)"},
+	}
+	for _, tt := range tests {
+		if got := tt.level.String(); got != tt.want {
+			t.Errorf("IsolationLevel(%d).String() = %q; want %q", int(tt.level), got, tt.want)
+		}
+	}
+}
+
 // Tests fix for issue 2542, that we release a lock when querying on
 // a closed connection.
 func TestIssue2542Deadlock(t *testing.T) {
@@ -1070,6 +1633,276 @@ func TestMaxOpenConns(t *testing.T) {
 	}
 }
 
+func TestStats(t *testing.T) {
+	db := newTestDB(t, "people")
+	stats := db.Stats()
+	if got := stats.OpenConnections; got != 1 {
+		t.Errorf("stats.OpenConnections = %d; want 1", got)
+	}
+	if got := stats.Idle; got != 1 {
+		t.Errorf("stats.Idle = %d; want 1", got)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats = db.Stats()
+	if got := stats.InUse; got != 1 {
+		t.Errorf("stats.InUse = %d; want 1", got)
+	}
+	if got := stats.Idle; got != 0 {
+		t.Errorf("stats.Idle = %d; want 0", got)
+	}
+	tx.Commit()
+
+	closeDB(t, db)
+	stats = db.Stats()
+	if got := stats.OpenConnections; got != 0 {
+		t.Errorf("stats.OpenConnections = %d; want 0", got)
+	}
+}
+
+func TestStatsWait(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+
+	db.SetMaxOpenConns(1)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := db.Stats().MaxOpenConnections; got != 1 {
+		t.Errorf("stats.MaxOpenConnections = %d; want 1", got)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- db.Ping()
+	}()
+	// Wait for Ping to queue up for the only connection.
+	for i := 0; db.Stats().WaitCount == 0; i++ {
+		if i > 1000 {
+			t.Fatal("timed out waiting for Ping to block")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	stats := db.Stats()
+	if got := stats.WaitCount; got != 1 {
+		t.Errorf("stats.WaitCount = %d; want 1", got)
+	}
+	if stats.WaitDuration < 10*time.Millisecond {
+		t.Errorf("stats.WaitDuration = %v; want >= 10ms", stats.WaitDuration)
+	}
+}
+
+func TestStatsMaxIdleClosed(t *testing.T) {
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+
+	db.SetMaxIdleConns(2)
+	var txs []*Tx
+	for i := 0; i < 4; i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+	for _, tx := range txs {
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := db.Stats().MaxIdleClosed; got != 2 {
+		t.Errorf("stats.MaxIdleClosed = %d; want 2", got)
+	}
+
+	db.SetMaxIdleConns(1)
+	stats := db.Stats()
+	if got := stats.MaxIdleClosed; got != 3 {
+		t.Errorf("stats.MaxIdleClosed = %d; want 3", got)
+	}
+	if got := stats.Idle; got != 1 {
+		t.Errorf("stats.Idle = %d; want 1", got)
+	}
+}
+
+func TestConnMaxLifetime(t *testing.T) {
+	t0 := time.Unix(1000000, 0)
+	offset := time.Duration(0)
+
+	nowFunc = func() time.Time { return t0.Add(offset) }
+	defer func() { nowFunc = time.Now }()
+
+	db := newTestDB(t, "magicquery")
+	defer closeDB(t, db)
+
+	driver := db.driver.(*fakeDriver)
+
+	// Force the number of open connections to 0 so we can get an accurate
+	// count for the test
+	db.SetMaxIdleConns(0)
+
+	if g, w := db.numFreeConns(), 0; g != w {
+		t.Errorf("free conns = %d; want %d", g, w)
+	}
+
+	if n := db.numDepsPollUntil(0, time.Second); n > 0 {
+		t.Errorf("number of dependencies = %d; expected 0", n)
+		db.dumpDeps(t)
+	}
+
+	driver.mu.Lock()
+	opens0 := driver.openCount
+	closes0 := driver.closeCount
+	driver.mu.Unlock()
+
+	db.SetMaxIdleConns(10)
+	db.SetMaxOpenConns(10)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offset = time.Second
+	tx2, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx.Commit()
+	tx2.Commit()
+
+	driver.mu.Lock()
+	opens := driver.openCount - opens0
+	closes := driver.closeCount - closes0
+	driver.mu.Unlock()
+
+	if opens != 2 {
+		t.Errorf("opens = %d; want 2", opens)
+	}
+	if closes != 0 {
+		t.Errorf("closes = %d; want 0", closes)
+	}
+	if g, w := db.numFreeConns(), 2; g != w {
+		t.Errorf("free conns = %d; want %d", g, w)
+	}
+
+	// Expire first conn
+	offset = 11 * time.Second
+	db.SetConnMaxLifetime(10 * time.Second)
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx2, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Commit()
+	tx2.Commit()
+
+	driver.mu.Lock()
+	opens = driver.openCount - opens0
+	closes = driver.closeCount - closes0
+	driver.mu.Unlock()
+
+	if opens != 3 {
+		t.Errorf("opens = %d; want 3", opens)
+	}
+	if closes != 1 {
+		t.Errorf("closes = %d; want 1", closes)
+	}
+	if got := db.Stats().MaxLifetimeClosed; got != 1 {
+		t.Errorf("stats.MaxLifetimeClosed = %d; want 1", got)
+	}
+}
+
+func TestConnMaxIdleTime(t *testing.T) {
+	t0 := time.Unix(1000000, 0)
+	offset := time.Duration(0)
+
+	nowFunc = func() time.Time { return t0.Add(offset) }
+	defer func() { nowFunc = time.Now }()
+
+	db := newTestDB(t, "people")
+	defer closeDB(t, db)
+
+	db.SetMaxIdleConns(10)
+	tx1, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx2, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx1.Commit()
+	offset = 5 * time.Second
+	tx2.Commit()
+	if g, w := db.numFreeConns(), 2; g != w {
+		t.Fatalf("free conns = %d; want %d", g, w)
+	}
+
+	// The connection returned first has been idle for more than
+	// the limit; the other one has not.
+	offset = 12 * time.Second
+	db.SetConnMaxIdleTime(10 * time.Second)
+
+	db.mu.Lock()
+	closing := db.connectionCleanerRunLocked()
+	db.mu.Unlock()
+	for _, c := range closing {
+		c.Close()
+	}
+
+	if g, w := len(closing), 1; g != w {
+		t.Errorf("closing = %d; want %d", g, w)
+	}
+	if g, w := db.numFreeConns(), 1; g != w {
+		t.Errorf("free conns = %d; want %d", g, w)
+	}
+	if got := db.Stats().MaxIdleTimeClosed; got != 1 {
+		t.Errorf("stats.MaxIdleTimeClosed = %d; want 1", got)
+	}
+}
+
+// The cleaner goroutine must exit once the DB is closed.
+func TestConnMaxLifetimeCleanerExits(t *testing.T) {
+	db := newTestDB(t, "people")
+	db.SetConnMaxLifetime(time.Hour)
+	db.mu.Lock()
+	started := db.cleanerCh != nil
+	db.mu.Unlock()
+	if !started {
+		t.Fatal("connection cleaner not started")
+	}
+	closeDB(t, db)
+	for i := 0; ; i++ {
+		db.mu.Lock()
+		running := db.cleanerCh != nil
+		db.mu.Unlock()
+		if !running {
+			break
+		}
+		if i > 1000 {
+			t.Fatal("connection cleaner did not exit after Close")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
 func TestSingleOpenConn(t *testing.T) {
 	db := newTestDB(t, "people")
 	defer closeDB(t, db)
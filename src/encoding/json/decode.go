@@ -16,6 +16,7 @@ import (
 	"reflect"
 	"runtime"
 	"strconv"
+	"strings"
 	"unicode"
 	"unicode/utf16"
 	"unicode/utf8"
@@ -174,6 +175,9 @@ type decodeState struct {
 	nextscan   scanner // for calls to nextValue
 	savedError error
 	useNumber  bool
+
+	disallowUnknownFields bool
+	fieldStack            []string // object keys leading to the current value, if disallowUnknownFields
 }
 
 // errPhase is used for errors that should not happen unless
@@ -185,6 +189,7 @@ func (d *decodeState) init(data []byte) *decodeState {
 	d.data = data
 	d.off = 0
 	d.savedError = nil
+	d.fieldStack = d.fieldStack[:0]
 	return d
 }
 
@@ -568,6 +573,9 @@ func (d *decodeState) object(v reflect.Value) {
 					f = ff
 				}
 			}
+			if f == nil && d.disallowUnknownFields {
+				d.saveError(fmt.Errorf("json: unknown field %q", d.fieldPath(string(key))))
+			}
 			if f != nil {
 				subv = v
 				destring = f.quoted
@@ -591,6 +599,10 @@ func (d *decodeState) object(v reflect.Value) {
 			d.error(errPhase)
 		}
 
+		if d.disallowUnknownFields {
+			d.fieldStack = append(d.fieldStack, string(key))
+		}
+
 		// Read value.
 		if destring {
 			switch qv := d.valueQuoted().(type) {
@@ -605,6 +617,10 @@ func (d *decodeState) object(v reflect.Value) {
 			d.value(subv)
 		}
 
+		if d.disallowUnknownFields {
+			d.fieldStack = d.fieldStack[:len(d.fieldStack)-1]
+		}
+
 		// Write value back to map;
 		// if using struct, subv points into struct already.
 		if v.Kind() == reflect.Map {
@@ -623,6 +639,14 @@ func (d *decodeState) object(v reflect.Value) {
 	}
 }
 
+// fieldPath returns the dotted path of object keys leading to key.
+func (d *decodeState) fieldPath(key string) string {
+	if len(d.fieldStack) == 0 {
+		return key
+	}
+	return strings.Join(d.fieldStack, ".") + "." + key
+}
+
 // literal consumes a literal from d.data[d.off-1:], decoding into the value v.
 // The first byte of the literal has been read already
 // (that's how the caller knows it's a literal).
@@ -1372,3 +1372,63 @@ func TestInvalidUnmarshal(t *testing.T) {
 		}
 	}
 }
+
+type unknownFieldsInner struct {
+	X int `json:"x"`
+}
+
+type unknownFieldsOuter struct {
+	A     int
+	Inner unknownFieldsInner `json:"inner"`
+	Map   map[string]unknownFieldsInner
+	List  []unknownFieldsInner
+	Any   interface{}
+}
+
+var disallowUnknownFieldsTests = []struct {
+	in  string
+	err string
+}{
+	{`{"A": 1, "inner": {"x": 2}, "Any": {"whatever": 3}}`, ""},
+	{`{"a": 1}`, ""}, // case-insensitive match is not unknown
+	{`{"B": 1}`, `json: unknown field "B"`},
+	{`{"inner": {"x": 1, "y": 2}}`, `json: unknown field "inner.y"`},
+	{`{"Map": {"k": {"x": 1, "z": 2}}}`, `json: unknown field "Map.k.z"`},
+	{`{"List": [{"x": 1}, {"w": 2}]}`, `json: unknown field "List.w"`},
+	{`{"A": 1, "C": 2, "D": 3}`, `json: unknown field "C"`},
+}
+
+func TestDecoderDisallowUnknownFields(t *testing.T) {
+	for i, tt := range disallowUnknownFieldsTests {
+		dec := NewDecoder(strings.NewReader(tt.in))
+		dec.DisallowUnknownFields()
+		var v unknownFieldsOuter
+		err := dec.Decode(&v)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("#%d: Decode(%s): %v", i, tt.in, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("#%d: Decode(%s) error = %v; want %s", i, tt.in, err, tt.err)
+		}
+	}
+
+	// Without DisallowUnknownFields the same input decodes silently,
+	// and the known fields are still set.
+	var v unknownFieldsOuter
+	if err := NewDecoder(strings.NewReader(`{"A": 7, "B": 1}`)).Decode(&v); err != nil || v.A != 7 {
+		t.Errorf("Decode without DisallowUnknownFields = %+v, %v; want A=7, nil", v, err)
+	}
+
+	// The path is reset between values of a stream.
+	dec := NewDecoder(strings.NewReader(`{"inner": {"x": 1}} {"bad": 1}`))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&v); err != nil {
+		t.Fatalf("first Decode: %v", err)
+	}
+	if err := dec.Decode(&v); err == nil || err.Error() != `json: unknown field "bad"` {
+		t.Errorf("second Decode error = %v; want unknown field \"bad\"", err)
+	}
+}
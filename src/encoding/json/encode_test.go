@@ -381,13 +381,13 @@ func TestStringBytes(t *testing.T) {
 		r = append(r, i)
 	}
 	s := string(r) + "\xff\xff\xffhello" // some invalid UTF-8 too
-	_, err := es.string(s)
+	_, err := es.string(s, true)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	esBytes := &encodeState{}
-	_, err = esBytes.stringBytes([]byte(s))
+	_, err = esBytes.stringBytes([]byte(s), true)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -129,6 +129,10 @@ var pkgDeps = map[string][]string{
 	"os/exec":       {"L2", "os", "path/filepath", "syscall"},
 	"os/signal":     {"L2", "os", "syscall"},
 
+	// Request-scoped cancelation, deadlines and values.
+	// Kept free of fmt and reflect so that net may use it.
+	"context": {"L0", "time"},
+
 	// OS enables basic operating system functionality,
 	// but not direct use of package syscall, nor os/signal.
 	"OS": {
@@ -148,6 +152,7 @@ var pkgDeps = map[string][]string{
 	"regexp/syntax":  {"L2"},
 	"runtime/debug":  {"L2", "fmt", "io/ioutil", "os", "time"},
 	"runtime/pprof":  {"L2", "fmt", "text/tabwriter"},
+	"runtime/trace":  {"L0"},
 	"text/tabwriter": {"L2"},
 
 	"testing":        {"L2", "flag", "fmt", "os", "runtime/pprof", "time"},
@@ -180,6 +185,13 @@ var pkgDeps = map[string][]string{
 		"go/token",
 	},
 
+	// Go type checking.
+	"go/constant":            {"L4", "go/token", "math/big"},
+	"go/importer":            {"L4", "go/internal/gcimporter", "go/types"},
+	"internal/trace":         {"L4", "OS"},
+	"go/internal/gcimporter": {"L4", "OS", "go/build", "go/constant", "go/token", "go/types", "text/scanner"},
+	"go/types":               {"L4", "GOPARSER", "container/heap", "go/constant"},
+
 	// One of a kind.
 	"archive/tar":         {"L4", "OS", "syscall"},
 	"archive/zip":         {"L4", "OS", "compress/flate"},
@@ -187,7 +199,9 @@ var pkgDeps = map[string][]string{
 	"compress/flate":      {"L4"},
 	"compress/gzip":       {"L4", "compress/flate"},
 	"compress/lzw":        {"L4"},
+	"compress/xz":         {"L4", "crypto/sha256"},
 	"compress/zlib":       {"L4", "compress/flate"},
+	"compress/zstd":       {"L4"},
 	"database/sql":        {"L4", "container/list", "database/sql/driver"},
 	"database/sql/driver": {"L4", "time"},
 	"debug/dwarf":         {"L4"},
@@ -240,7 +254,8 @@ var pkgDeps = map[string][]string{
 	// Basic networking.
 	// Because net must be used by any package that wants to
 	// do networking portably, it must have a small dependency set: just L1+basic os.
-	"net": {"L1", "CGO", "os", "syscall", "time"},
+	"internal/nettrace": {},
+	"net":               {"L1", "CGO", "context", "internal/nettrace", "os", "syscall", "time"},
 
 	// NET enables use of basic network-related packages.
 	"NET": {
@@ -265,6 +280,11 @@ var pkgDeps = map[string][]string{
 	"crypto/sha256": {"L3"},
 	"crypto/sha512": {"L3"},
 
+	// Internal implementations of ciphers that are only used by crypto/tls.
+	"crypto/internal/chacha20poly1305": {"L3"},
+	"crypto/internal/cipherhw":         {},
+	"crypto/internal/curve25519":       {},
+
 	"CRYPTO": {
 		"crypto/aes",
 		"crypto/des",
@@ -303,6 +323,7 @@ var pkgDeps = map[string][]string{
 	"crypto/tls": {
 		"L4", "CRYPTO-MATH", "CGO", "OS",
 		"container/list", "crypto/x509", "encoding/pem", "net", "syscall",
+		"crypto/internal/chacha20poly1305", "crypto/internal/cipherhw", "crypto/internal/curve25519",
 	},
 	"crypto/x509": {
 		"L4", "CRYPTO-MATH", "OS", "CGO",
@@ -315,10 +336,12 @@ var pkgDeps = map[string][]string{
 	"net/smtp":       {"L4", "CRYPTO", "NET", "crypto/tls"},
 
 	// HTTP, kingpin of dependencies.
+	"net/http/internal/hpack": {"L4"},
+	"net/http/httptrace":      {"L4", "NET", "context", "crypto/tls", "internal/nettrace"},
 	"net/http": {
 		"L4", "NET", "OS",
-		"compress/gzip", "crypto/tls", "mime/multipart", "runtime/debug",
-		"net/http/internal",
+		"compress/gzip", "container/list", "context", "crypto/tls", "mime/multipart", "runtime/debug",
+		"net/http/httptrace", "net/http/internal", "net/http/internal/hpack",
 	},
 
 	// HTTP-using packages.
@@ -327,7 +350,7 @@ var pkgDeps = map[string][]string{
 	"net/http/fcgi":     {"L4", "NET", "OS", "net/http", "net/http/cgi"},
 	"net/http/httptest": {"L4", "NET", "OS", "crypto/tls", "flag", "net/http"},
 	"net/http/httputil": {"L4", "NET", "OS", "net/http", "net/http/internal"},
-	"net/http/pprof":    {"L4", "OS", "html/template", "net/http", "runtime/pprof"},
+	"net/http/pprof":    {"L4", "OS", "html/template", "net/http", "runtime/pprof", "runtime/trace"},
 	"net/rpc":           {"L4", "NET", "encoding/gob", "html/template", "net/http"},
 	"net/rpc/jsonrpc":   {"L4", "NET", "encoding/json", "net/rpc"},
 }
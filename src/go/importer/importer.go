@@ -0,0 +1,74 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package importer provides access to export data importers.
+package importer
+
+import (
+	"bufio"
+	"go/internal/gcimporter"
+	"go/types"
+	"io"
+	"runtime"
+)
+
+// A Lookup function returns a reader to access package data for
+// a given import path, or an error if no matching package is found.
+type Lookup func(path string) (io.ReadCloser, error)
+
+// For returns an Importer for the given compiler and lookup interface,
+// or nil. Supported compilers are "gc". If lookup is nil, the default
+// package lookup mechanism for the given compiler is used.
+func For(compiler string, lookup Lookup) types.Importer {
+	switch compiler {
+	case "gc":
+		if lookup == nil {
+			return make(gcimports)
+		}
+		return &gcLookupImports{make(map[string]*types.Package), lookup}
+	}
+	// compiler not supported
+	return nil
+}
+
+// Default returns an Importer for the compiler that built the running binary.
+func Default() types.Importer {
+	return For(runtime.Compiler, nil)
+}
+
+// gc support
+
+type gcimports map[string]*types.Package
+
+func (m gcimports) Import(path string) (*types.Package, error) {
+	return gcimporter.Import(m, path)
+}
+
+type gcLookupImports struct {
+	packages map[string]*types.Package
+	lookup   Lookup
+}
+
+func (m *gcLookupImports) Import(path string) (*types.Package, error) {
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+
+	// no need to re-import if the package was imported completely before
+	if pkg := m.packages[path]; pkg != nil && pkg.Complete() {
+		return pkg, nil
+	}
+
+	rc, err := m.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	buf := bufio.NewReader(rc)
+	if err := gcimporter.FindExportData(buf); err != nil {
+		return nil, err
+	}
+	return gcimporter.ImportData(m.packages, path, path, buf)
+}
@@ -7,16 +7,17 @@
 //
 //	- Int	signed integers
 //	- Rat	rational numbers
+//	- Float	floating-point numbers
 //
 // Methods are typically of the form:
 //
-//	func (z *Int) Op(x, y *Int) *Int	(similar for *Rat)
+//	func (z *Int) Op(x, y *Int) *Int	(similar for *Rat, *Float)
 //
 // and implement operations z = x Op y with the result as receiver; if it
 // is one of the operands it may be overwritten (and its memory reused).
 // To enable chaining of operations, the result is also returned. Methods
-// returning a result other than *Int or *Rat take one of the operands as
-// the receiver.
+// returning a result other than *Int, *Rat, or *Float take one of the
+// operands as the receiver.
 //
 package big
 
@@ -1105,6 +1106,28 @@ func (z nat) bit(i uint) uint {
 	return uint(z[j] >> (i % _W) & 1)
 }
 
+// sticky returns 1 if there's a 1 bit within the
+// i least significant bits, otherwise it returns 0.
+func (x nat) sticky(i uint) uint {
+	j := i / _W
+	if j >= uint(len(x)) {
+		if len(x) == 0 {
+			return 0
+		}
+		return 1
+	}
+	// 0 <= j < len(x)
+	for _, x := range x[:j] {
+		if x != 0 {
+			return 1
+		}
+	}
+	if x[j]<<(_W-i%_W) != 0 {
+		return 1
+	}
+	return 0
+}
+
 func (z nat) and(x, y nat) nat {
 	m := len(x)
 	n := len(y)
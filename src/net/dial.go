@@ -5,7 +5,9 @@
 package net
 
 import (
+	"context"
 	"errors"
+	"internal/nettrace"
 	"time"
 )
 
@@ -50,6 +52,9 @@ type Dialer struct {
 	// If zero, keep-alives are not enabled. Network protocols
 	// that do not support keep-alives ignore this field.
 	KeepAlive time.Duration
+
+	// Resolver optionally specifies an alternate resolver to use.
+	Resolver *Resolver
 }
 
 // Return either now+Timeout or Deadline, whichever comes first.
@@ -66,6 +71,13 @@ func (d *Dialer) deadline() time.Time {
 	}
 }
 
+func (d *Dialer) resolver() *Resolver {
+	if d.Resolver != nil {
+		return d.Resolver
+	}
+	return DefaultResolver
+}
+
 func parseNetwork(net string) (afnet string, proto int, err error) {
 	i := last(net, ':')
 	if i < 0 { // no colon
@@ -95,7 +107,7 @@ func parseNetwork(net string) (afnet string, proto int, err error) {
 	return "", 0, UnknownNetworkError(net)
 }
 
-func resolveAddr(op, net, addr string, deadline time.Time) (netaddr, error) {
+func (r *Resolver) resolveAddr(ctx context.Context, op, net, addr string, deadline time.Time) (netaddr, error) {
 	afnet, _, err := parseNetwork(net)
 	if err != nil {
 		return nil, err
@@ -107,7 +119,7 @@ func resolveAddr(op, net, addr string, deadline time.Time) (netaddr, error) {
 	case "unix", "unixgram", "unixpacket":
 		return ResolveUnixAddr(afnet, addr)
 	}
-	return resolveInternetAddr(afnet, addr, deadline)
+	return r.resolveInternetAddr(ctx, afnet, addr, deadline)
 }
 
 // Dial connects to the address on the named network.
@@ -155,19 +167,55 @@ func DialTimeout(network, address string, timeout time.Duration) (Conn, error) {
 // See func Dial for a description of the network and address
 // parameters.
 func (d *Dialer) Dial(network, address string) (Conn, error) {
-	ra, err := resolveAddr("dial", network, address, d.deadline())
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to the address on the named network using
+// the provided context.
+//
+// The provided Context must be non-nil. If the context expires before
+// the connection is complete, an error is returned. Once successfully
+// connected, any expiration of the context will not affect the
+// connection.
+//
+// When the context has a deadline, the dial fails no later than that
+// deadline, in addition to any limit set by Timeout or Deadline.
+//
+// See func Dial for a description of the network and address
+// parameters.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (Conn, error) {
+	if ctx == nil {
+		panic("net: nil context")
+	}
+	deadline := d.deadline()
+	if ctxDeadline, ok := ctx.Deadline(); ok {
+		if deadline.IsZero() || ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+	}
+	select {
+	case <-ctx.Done():
+		return nil, &OpError{Op: "dial", Net: network, Addr: nil, Err: mapErr(ctx.Err())}
+	default:
+	}
+	ra, err := d.resolver().resolveAddr(ctx, "dial", network, address, deadline)
 	if err != nil {
 		return nil, &OpError{Op: "dial", Net: network, Addr: nil, Err: err}
 	}
 	dialer := func(deadline time.Time) (Conn, error) {
-		return dialSingle(network, address, d.LocalAddr, ra.toAddr(), deadline)
+		return dialSingle(ctx, network, address, d.LocalAddr, ra.toAddr(), deadline)
 	}
 	if ras, ok := ra.(addrList); ok && d.DualStack && network == "tcp" {
 		dialer = func(deadline time.Time) (Conn, error) {
-			return dialMulti(network, address, d.LocalAddr, ras, deadline)
+			return dialMulti(ctx, network, address, d.LocalAddr, ras, deadline)
 		}
 	}
-	c, err := dial(network, ra.toAddr(), dialer, d.deadline())
+	var c Conn
+	if ctx.Done() == nil {
+		c, err = dial(network, ra.toAddr(), dialer, deadline)
+	} else {
+		c, err = dialCancel(ctx, network, ra.toAddr(), dialer, deadline)
+	}
 	if d.KeepAlive > 0 && err == nil {
 		if tc, ok := c.(*TCPConn); ok {
 			tc.SetKeepAlive(true)
@@ -178,13 +226,55 @@ func (d *Dialer) Dial(network, address string) (Conn, error) {
 	return c, err
 }
 
+// dialCancel runs dial in its own goroutine and abandons it when ctx
+// is done before the dial completes. A connection established after
+// the abandonment is closed.
+func dialCancel(ctx context.Context, net string, ra Addr, dialer func(time.Time) (Conn, error), deadline time.Time) (Conn, error) {
+	type racer struct {
+		Conn
+		error
+	}
+	ch := make(chan racer)
+	abandon := make(chan struct{})
+	go func() {
+		c, err := dial(net, ra, dialer, deadline)
+		select {
+		case ch <- racer{c, err}:
+		case <-abandon:
+			if err == nil {
+				c.Close()
+			}
+		}
+	}()
+	select {
+	case racer := <-ch:
+		return racer.Conn, racer.error
+	case <-ctx.Done():
+		close(abandon)
+		return nil, &OpError{Op: "dial", Net: net, Addr: ra, Err: mapErr(ctx.Err())}
+	}
+}
+
+// mapErr maps from the context errors to the historical internal net
+// error values.
+func mapErr(err error) error {
+	switch err {
+	case context.Canceled:
+		return errCanceled
+	case context.DeadlineExceeded:
+		return errTimeout
+	default:
+		return err
+	}
+}
+
 var testHookSetKeepAlive = func() {} // changed by dial_test.go
 
 // dialMulti attempts to establish connections to each destination of
 // the list of addresses. It will return the first established
 // connection and close the other connections. Otherwise it returns
 // error on the last attempt.
-func dialMulti(net, addr string, la Addr, ras addrList, deadline time.Time) (Conn, error) {
+func dialMulti(ctx context.Context, net, addr string, la Addr, ras addrList, deadline time.Time) (Conn, error) {
 	type racer struct {
 		Conn
 		error
@@ -196,7 +286,7 @@ func dialMulti(net, addr string, la Addr, ras addrList, deadline time.Time) (Con
 	lane := make(chan racer, 1)
 	for _, ra := range ras {
 		go func(ra Addr) {
-			c, err := dialSingle(net, addr, la, ra, deadline)
+			c, err := dialSingle(ctx, net, addr, la, ra, deadline)
 			if _, ok := <-sig; ok {
 				lane <- racer{c, err}
 			} else if err == nil {
@@ -225,7 +315,17 @@ func dialMulti(net, addr string, la Addr, ras addrList, deadline time.Time) (Con
 
 // dialSingle attempts to establish and returns a single connection to
 // the destination address.
-func dialSingle(net, addr string, la, ra Addr, deadline time.Time) (c Conn, err error) {
+func dialSingle(ctx context.Context, net, addr string, la, ra Addr, deadline time.Time) (c Conn, err error) {
+	trace, _ := ctx.Value(nettrace.TraceKey{}).(*nettrace.Trace)
+	if trace != nil {
+		raStr := ra.String()
+		if trace.ConnectStart != nil {
+			trace.ConnectStart(net, raStr)
+		}
+		if trace.ConnectDone != nil {
+			defer func() { trace.ConnectDone(net, raStr, err) }()
+		}
+	}
 	if la != nil && la.Network() != ra.Network() {
 		return nil, &OpError{Op: "dial", Net: net, Addr: ra, Err: errors.New("mismatched local address type " + la.Network())}
 	}
@@ -256,7 +356,7 @@ func dialSingle(net, addr string, la, ra Addr, deadline time.Time) (c Conn, err
 // "tcp6", "unix" or "unixpacket".
 // See Dial for the syntax of laddr.
 func Listen(net, laddr string) (Listener, error) {
-	la, err := resolveAddr("listen", net, laddr, noDeadline)
+	la, err := DefaultResolver.resolveAddr(context.Background(), "listen", net, laddr, noDeadline)
 	if err != nil {
 		return nil, &OpError{Op: "listen", Net: net, Addr: nil, Err: err}
 	}
@@ -280,7 +380,7 @@ func Listen(net, laddr string) (Listener, error) {
 // "udp6", "ip", "ip4", "ip6" or "unixgram".
 // See Dial for the syntax of laddr.
 func ListenPacket(net, laddr string) (PacketConn, error) {
-	la, err := resolveAddr("listen", net, laddr, noDeadline)
+	la, err := DefaultResolver.resolveAddr(context.Background(), "listen", net, laddr, noDeadline)
 	if err != nil {
 		return nil, &OpError{Op: "listen", Net: net, Addr: nil, Err: err}
 	}
@@ -6,6 +6,7 @@ package net
 
 import (
 	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"io"
@@ -396,7 +397,7 @@ func TestDialMultiFDLeak(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if c, err := dialMulti("tcp", "fast failover test", nil, ras, time.Now().Add(T1)); err == nil {
+			if c, err := dialMulti(context.Background(), "tcp", "fast failover test", nil, ras, time.Now().Add(T1)); err == nil {
 				c.Close()
 			}
 		}()
@@ -546,3 +547,46 @@ func TestDialerKeepAlive(t *testing.T) {
 		}
 	}
 }
+
+func TestDialContext(t *testing.T) {
+	ln := newLocalListener(t)
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var d Dialer
+	c, err := d.DialContext(ctx, "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("DialContext with live context failed: %v", err)
+	}
+	c.Close()
+
+	cancel()
+	c, err = d.DialContext(ctx, "tcp", ln.Addr().String())
+	if err == nil {
+		c.Close()
+		t.Fatal("DialContext with canceled context succeeded")
+	}
+	if perr, ok := err.(*OpError); !ok || perr.Err != errCanceled {
+		t.Errorf("DialContext with canceled context = %v; want OpError wrapping %v", err, errCanceled)
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	c, err = d.DialContext(ctx, "tcp", ln.Addr().String())
+	if err == nil {
+		c.Close()
+		t.Fatal("DialContext with expired context succeeded")
+	}
+	if nerr, ok := err.(Error); !ok || !nerr.Timeout() {
+		t.Errorf("DialContext with expired context = %v; want timeout error", err)
+	}
+}
@@ -16,6 +16,7 @@
 package net
 
 import (
+	"context"
 	"errors"
 	"io"
 	"math/rand"
@@ -24,9 +25,17 @@ import (
 	"time"
 )
 
+// maxDNSPacketSize is the UDP payload size advertised in the EDNS0
+// OPT record of queries and the size of the buffer that UDP
+// responses are read into. 1232 bytes avoids IP fragmentation on
+// most IPv4 and IPv6 paths.
+const maxDNSPacketSize = 1232
+
 // A dnsConn represents a DNS transport endpoint.
 type dnsConn interface {
-	Conn
+	io.Closer
+
+	SetDeadline(time.Time) error
 
 	// readDNSResponse reads a DNS response message from the DNS
 	// transport endpoint and returns the received DNS response
@@ -38,8 +47,15 @@ type dnsConn interface {
 	writeDNSQuery(*dnsMsg) error
 }
 
-func (c *UDPConn) readDNSResponse() (*dnsMsg, error) {
-	b := make([]byte, 512) // see RFC 1035
+// dnsPacketConn implements the dnsConn interface for RFC 1035's
+// "UDP usage" transport mechanism. Conn is a packet-oriented connection,
+// such as a *UDPConn.
+type dnsPacketConn struct {
+	Conn
+}
+
+func (c *dnsPacketConn) readDNSResponse() (*dnsMsg, error) {
+	b := make([]byte, maxDNSPacketSize)
 	n, err := c.Read(b)
 	if err != nil {
 		return nil, err
@@ -51,7 +67,7 @@ func (c *UDPConn) readDNSResponse() (*dnsMsg, error) {
 	return msg, nil
 }
 
-func (c *UDPConn) writeDNSQuery(msg *dnsMsg) error {
+func (c *dnsPacketConn) writeDNSQuery(msg *dnsMsg) error {
 	b, ok := msg.Pack()
 	if !ok {
 		return errors.New("cannot marshal DNS message")
@@ -62,7 +78,14 @@ func (c *UDPConn) writeDNSQuery(msg *dnsMsg) error {
 	return nil
 }
 
-func (c *TCPConn) readDNSResponse() (*dnsMsg, error) {
+// dnsStreamConn implements the dnsConn interface for RFC 1035's
+// "TCP usage" transport mechanism. Conn is a stream-oriented connection,
+// such as a *TCPConn.
+type dnsStreamConn struct {
+	Conn
+}
+
+func (c *dnsStreamConn) readDNSResponse() (*dnsMsg, error) {
 	b := make([]byte, 1280) // 1280 is a reasonable initial size for IP over Ethernet, see RFC 4035
 	if _, err := io.ReadFull(c, b[:2]); err != nil {
 		return nil, err
@@ -82,7 +105,7 @@ func (c *TCPConn) readDNSResponse() (*dnsMsg, error) {
 	return msg, nil
 }
 
-func (c *TCPConn) writeDNSQuery(msg *dnsMsg) error {
+func (c *dnsStreamConn) writeDNSQuery(msg *dnsMsg) error {
 	b, ok := msg.Pack()
 	if !ok {
 		return errors.New("cannot marshal DNS message")
@@ -95,7 +118,7 @@ func (c *TCPConn) writeDNSQuery(msg *dnsMsg) error {
 	return nil
 }
 
-func (d *Dialer) dialDNS(network, server string) (dnsConn, error) {
+func (r *Resolver) dial(ctx context.Context, network, server string) (dnsConn, error) {
 	switch network {
 	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
 	default:
@@ -106,22 +129,29 @@ func (d *Dialer) dialDNS(network, server string) (dnsConn, error) {
 	// call back here to translate it. The DNS config parser has
 	// already checked that all the cfg.servers[i] are IP
 	// addresses, which Dial will use without a DNS lookup.
-	c, err := d.Dial(network, server)
+	var c Conn
+	var err error
+	if r != nil && r.Dial != nil {
+		c, err = r.Dial(ctx, network, server)
+	} else {
+		var d Dialer
+		c, err = d.DialContext(ctx, network, server)
+	}
 	if err != nil {
-		return nil, err
+		return nil, mapErr(err)
 	}
-	switch network {
-	case "tcp", "tcp4", "tcp6":
-		return c.(*TCPConn), nil
-	case "udp", "udp4", "udp6":
-		return c.(*UDPConn), nil
+	if _, ok := c.(PacketConn); ok {
+		return &dnsPacketConn{c}, nil
 	}
-	panic("unreachable")
+	return &dnsStreamConn{c}, nil
 }
 
 // exchange sends a query on the connection and hopes for a response.
-func exchange(server, name string, qtype uint16, timeout time.Duration) (*dnsMsg, error) {
-	d := Dialer{Timeout: timeout}
+// The query carries an EDNS0 OPT record advertising maxDNSPacketSize,
+// unless the server rejects it with FORMERR or NOTIMP, in which case
+// the query is sent once more without it. A truncated UDP response is
+// retried over TCP.
+func (r *Resolver) exchange(ctx context.Context, server, name string, qtype uint16, timeout time.Duration) (*dnsMsg, error) {
 	out := dnsMsg{
 		dnsMsgHdr: dnsMsgHdr{
 			recursion_desired: true,
@@ -129,26 +159,28 @@ func exchange(server, name string, qtype uint16, timeout time.Duration) (*dnsMsg
 		question: []dnsQuestion{
 			{name, qtype, dnsClassINET},
 		},
+		extra: []dnsRR{
+			&dnsRR_OPT{
+				Hdr: dnsRR_Header{
+					Name:   ".",
+					Rrtype: dnsTypeOPT,
+					Class:  maxDNSPacketSize,
+				},
+			},
+		},
 	}
 	for _, network := range []string{"udp", "tcp"} {
-		c, err := d.dialDNS(network, server)
-		if err != nil {
-			return nil, err
-		}
-		defer c.Close()
-		if timeout > 0 {
-			c.SetDeadline(time.Now().Add(timeout))
-		}
-		out.id = uint16(rand.Int()) ^ uint16(time.Now().UnixNano())
-		if err := c.writeDNSQuery(&out); err != nil {
-			return nil, err
-		}
-		in, err := c.readDNSResponse()
+		in, err := r.exchangeOne(ctx, network, server, &out, timeout)
 		if err != nil {
 			return nil, err
 		}
-		if in.id != out.id {
-			return nil, errors.New("DNS message ID mismatch")
+		if out.extra != nil && (in.rcode == dnsRcodeFormatError || in.rcode == dnsRcodeNotImplemented) {
+			// The server may not support EDNS0; see RFC 6891,
+			// section 7.
+			out.extra = nil
+			if in, err = r.exchangeOne(ctx, network, server, &out, timeout); err != nil {
+				return nil, err
+			}
 		}
 		if in.truncated { // see RFC 5966
 			continue
@@ -158,9 +190,41 @@ func exchange(server, name string, qtype uint16, timeout time.Duration) (*dnsMsg
 	return nil, errors.New("no answer from DNS server")
 }
 
+// exchangeOne performs a single query and response on network. The
+// exchange gives up after timeout, if non-zero, or when ctx is done.
+func (r *Resolver) exchangeOne(ctx context.Context, network, server string, out *dnsMsg, timeout time.Duration) (*dnsMsg, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	c, err := r.dial(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	if d, ok := ctx.Deadline(); ok {
+		c.SetDeadline(d)
+	}
+	out.id = uint16(rand.Int()) ^ uint16(time.Now().UnixNano())
+	if err := c.writeDNSQuery(out); err != nil {
+		return nil, err
+	}
+	in, err := c.readDNSResponse()
+	if err != nil {
+		return nil, err
+	}
+	if in.id != out.id {
+		return nil, errors.New("DNS message ID mismatch")
+	}
+	return in, nil
+}
+
 // Do a lookup for a single name, which must be rooted
 // (otherwise answer will not find the answers).
-func tryOneName(cfg *dnsConfig, name string, qtype uint16) (string, []dnsRR, error) {
+// When cfg.rotate is set, successive calls start with successive
+// servers.
+func (r *Resolver) tryOneName(ctx context.Context, cfg *dnsConfig, name string, qtype uint16) (string, []dnsRR, error) {
 	if len(cfg.servers) == 0 {
 		return "", nil, &DNSError{Err: "no DNS servers", Name: name}
 	}
@@ -168,11 +232,13 @@ func tryOneName(cfg *dnsConfig, name string, qtype uint16) (string, []dnsRR, err
 		return "", nil, &DNSError{Err: "DNS name too long", Name: name}
 	}
 	timeout := time.Duration(cfg.timeout) * time.Second
+	serverOffset := cfg.serverOffset()
+	sLen := uint32(len(cfg.servers))
 	var lastErr error
 	for i := 0; i < cfg.attempts; i++ {
-		for _, server := range cfg.servers {
-			server = JoinHostPort(server, "53")
-			msg, err := exchange(server, name, qtype, timeout)
+		for j := uint32(0); j < sLen; j++ {
+			server := JoinHostPort(cfg.servers[(serverOffset+j)%sLen], "53")
+			msg, err := r.exchange(ctx, server, name, qtype, timeout)
 			if err != nil {
 				lastErr = &DNSError{
 					Err:    err.Error(),
@@ -182,6 +248,11 @@ func tryOneName(cfg *dnsConfig, name string, qtype uint16) (string, []dnsRR, err
 				if nerr, ok := err.(Error); ok && nerr.Timeout() {
 					lastErr.(*DNSError).IsTimeout = true
 				}
+				if ctx.Err() != nil {
+					// The caller has given up; trying the
+					// remaining servers is pointless.
+					return "", nil, lastErr
+				}
 				continue
 			}
 			cname, addrs, err := answer(name, server, msg, qtype)
@@ -269,7 +340,7 @@ func loadConfig(resolvConfPath string, reloadTime time.Duration, quit <-chan cha
 	}()
 }
 
-func lookup(name string, qtype uint16) (cname string, addrs []dnsRR, err error) {
+func (r *Resolver) lookup(ctx context.Context, name string, qtype uint16) (cname string, addrs []dnsRR, err error) {
 	if !isDomainName(name) {
 		return name, nil, &DNSError{Err: "invalid domain name", Name: name}
 	}
@@ -296,7 +367,7 @@ func lookup(name string, qtype uint16) (cname string, addrs []dnsRR, err error)
 			rname += "."
 		}
 		// Can try as ordinary name.
-		cname, addrs, err = tryOneName(cfg.dnsConfig, rname, qtype)
+		cname, addrs, err = r.tryOneName(ctx, cfg.dnsConfig, rname, qtype)
 		if rooted || err == nil {
 			return
 		}
@@ -308,7 +379,7 @@ func lookup(name string, qtype uint16) (cname string, addrs []dnsRR, err error)
 		if rname[len(rname)-1] != '.' {
 			rname += "."
 		}
-		cname, addrs, err = tryOneName(cfg.dnsConfig, rname, qtype)
+		cname, addrs, err = r.tryOneName(ctx, cfg.dnsConfig, rname, qtype)
 		if err == nil {
 			return
 		}
@@ -317,7 +388,7 @@ func lookup(name string, qtype uint16) (cname string, addrs []dnsRR, err error)
 	// Last ditch effort: try unsuffixed only if we haven't already,
 	// that is, name is not rooted and has less than ndots dots.
 	if count(name, '.') < cfg.dnsConfig.ndots {
-		cname, addrs, err = tryOneName(cfg.dnsConfig, name+".", qtype)
+		cname, addrs, err = r.tryOneName(ctx, cfg.dnsConfig, name+".", qtype)
 		if err == nil {
 			return
 		}
@@ -333,18 +404,19 @@ func lookup(name string, qtype uint16) (cname string, addrs []dnsRR, err error)
 }
 
 // goLookupHost is the native Go implementation of LookupHost.
-// Used only if cgoLookupHost refuses to handle the request
-// (that is, only if cgoLookupHost is the stub in cgo_stub.go).
+// Used only if the Resolver prefers Go or cgoLookupHost refuses
+// to handle the request (that is, only if cgoLookupHost is the stub
+// in cgo_stub.go).
 // Normally we let cgo use the C library resolver instead of
 // depending on our lookup code, so that Go and C get the same
 // answers.
-func goLookupHost(name string) (addrs []string, err error) {
+func (r *Resolver) goLookupHost(ctx context.Context, name string) (addrs []string, err error) {
 	// Use entries from /etc/hosts if they match.
 	addrs = lookupStaticHost(name)
 	if len(addrs) > 0 {
 		return
 	}
-	ips, err := goLookupIP(name)
+	ips, err := r.goLookupIP(ctx, name)
 	if err != nil {
 		return
 	}
@@ -356,12 +428,13 @@ func goLookupHost(name string) (addrs []string, err error) {
 }
 
 // goLookupIP is the native Go implementation of LookupIP.
-// Used only if cgoLookupIP refuses to handle the request
-// (that is, only if cgoLookupIP is the stub in cgo_stub.go).
+// Used only if the Resolver prefers Go or cgoLookupIP refuses
+// to handle the request (that is, only if cgoLookupIP is the stub
+// in cgo_stub.go).
 // Normally we let cgo use the C library resolver instead of
 // depending on our lookup code, so that Go and C get the same
 // answers.
-func goLookupIP(name string) (addrs []IP, err error) {
+func (r *Resolver) goLookupIP(ctx context.Context, name string) (addrs []IP, err error) {
 	// Use entries from /etc/hosts if possible.
 	haddrs := lookupStaticHost(name)
 	if len(haddrs) > 0 {
@@ -383,7 +456,7 @@ func goLookupIP(name string) (addrs []IP, err error) {
 	qtypes := [...]uint16{dnsTypeA, dnsTypeAAAA}
 	for _, qtype := range qtypes {
 		go func(qtype uint16) {
-			_, rrs, err := lookup(name, qtype)
+			_, rrs, err := r.lookup(ctx, name, qtype)
 			lane <- racer{qtype, rrs, err}
 		}(qtype)
 	}
@@ -408,13 +481,14 @@ func goLookupIP(name string) (addrs []IP, err error) {
 }
 
 // goLookupCNAME is the native Go implementation of LookupCNAME.
-// Used only if cgoLookupCNAME refuses to handle the request
-// (that is, only if cgoLookupCNAME is the stub in cgo_stub.go).
+// Used only if the Resolver prefers Go or cgoLookupCNAME refuses
+// to handle the request (that is, only if cgoLookupCNAME is the stub
+// in cgo_stub.go).
 // Normally we let cgo use the C library resolver instead of
 // depending on our lookup code, so that Go and C get the same
 // answers.
-func goLookupCNAME(name string) (cname string, err error) {
-	_, rr, err := lookup(name, dnsTypeCNAME)
+func (r *Resolver) goLookupCNAME(ctx context.Context, name string) (cname string, err error) {
+	_, rr, err := r.lookup(ctx, name, dnsTypeCNAME)
 	if err != nil {
 		return
 	}
@@ -7,6 +7,9 @@
 package net
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
@@ -36,7 +39,7 @@ func TestDNSTransportFallback(t *testing.T) {
 
 	for _, tt := range dnsTransportFallbackTests {
 		timeout := time.Duration(tt.timeout) * time.Second
-		msg, err := exchange(tt.server, tt.name, tt.qtype, timeout)
+		msg, err := DefaultResolver.exchange(context.Background(), tt.server, tt.name, tt.qtype, timeout)
 		if err != nil {
 			t.Error(err)
 			continue
@@ -78,7 +81,7 @@ func TestSpecialDomainName(t *testing.T) {
 
 	server := "8.8.8.8:53"
 	for _, tt := range specialDomainNameTests {
-		msg, err := exchange(server, tt.name, tt.qtype, 0)
+		msg, err := DefaultResolver.exchange(context.Background(), server, tt.name, tt.qtype, 0)
 		if err != nil {
 			t.Error(err)
 			continue
@@ -173,19 +176,19 @@ func TestReloadResolvConfFail(t *testing.T) {
 
 	// resolv.conf.tmp does not exist yet
 	r.Start()
-	if _, err := goLookupIP("golang.org"); err == nil {
+	if _, err := DefaultResolver.goLookupIP(context.Background(), "golang.org"); err == nil {
 		t.Fatal("goLookupIP(missing) succeeded")
 	}
 
 	r.SetConf("nameserver 8.8.8.8")
-	if _, err := goLookupIP("golang.org"); err != nil {
+	if _, err := DefaultResolver.goLookupIP(context.Background(), "golang.org"); err != nil {
 		t.Fatalf("goLookupIP(missing; good) failed: %v", err)
 	}
 
 	// Using a bad resolv.conf while we had a good
 	// one before should not update the config
 	r.SetConf("")
-	if _, err := goLookupIP("golang.org"); err != nil {
+	if _, err := DefaultResolver.goLookupIP(context.Background(), "golang.org"); err != nil {
 		t.Fatalf("goLookupIP(missing; good; bad) failed: %v", err)
 	}
 }
@@ -201,7 +204,7 @@ func TestReloadResolvConfChange(t *testing.T) {
 	r.SetConf("nameserver 8.8.8.8")
 	r.Start()
 
-	if _, err := goLookupIP("golang.org"); err != nil {
+	if _, err := DefaultResolver.goLookupIP(context.Background(), "golang.org"); err != nil {
 		t.Fatalf("goLookupIP(good) failed: %v", err)
 	}
 	r.WantServers([]string{"8.8.8.8"})
@@ -209,7 +212,7 @@ func TestReloadResolvConfChange(t *testing.T) {
 	// Using a bad resolv.conf when we had a good one
 	// before should not update the config
 	r.SetConf("")
-	if _, err := goLookupIP("golang.org"); err != nil {
+	if _, err := DefaultResolver.goLookupIP(context.Background(), "golang.org"); err != nil {
 		t.Fatalf("goLookupIP(good; bad) failed: %v", err)
 	}
 
@@ -220,13 +223,13 @@ func TestReloadResolvConfChange(t *testing.T) {
 
 func BenchmarkGoLookupIP(b *testing.B) {
 	for i := 0; i < b.N; i++ {
-		goLookupIP("www.example.com")
+		DefaultResolver.goLookupIP(context.Background(), "www.example.com")
 	}
 }
 
 func BenchmarkGoLookupIPNoSuchHost(b *testing.B) {
 	for i := 0; i < b.N; i++ {
-		goLookupIP("some.nonexistent")
+		DefaultResolver.goLookupIP(context.Background(), "some.nonexistent")
 	}
 }
 
@@ -240,7 +243,313 @@ func BenchmarkGoLookupIPWithBrokenNameServer(b *testing.B) {
 	orig := cfg.dnsConfig
 	cfg.dnsConfig.servers = append([]string{"203.0.113.254"}, cfg.dnsConfig.servers...) // use TEST-NET-3 block, see RFC 5737
 	for i := 0; i < b.N; i++ {
-		goLookupIP("www.example.com")
+		DefaultResolver.goLookupIP(context.Background(), "www.example.com")
 	}
 	cfg.dnsConfig = orig
 }
+
+// fakeDNSServer answers the queries sent over the connections
+// returned by its DialContext method, which is suitable for use as
+// Resolver.Dial.
+type fakeDNSServer struct {
+	rh func(network, server string, q *dnsMsg) (*dnsMsg, error)
+}
+
+func (server *fakeDNSServer) DialContext(_ context.Context, network, address string) (Conn, error) {
+	c := &fakeDNSConn{server: server, network: network, address: address}
+	switch network {
+	case "udp", "udp4", "udp6":
+		return &fakeDNSPacketConn{c}, nil
+	}
+	return c, nil
+}
+
+type fakeDNSConn struct {
+	Conn    // nil; unused methods panic
+	server  *fakeDNSServer
+	network string
+	address string
+	q       *dnsMsg
+	resp    []byte
+}
+
+func (f *fakeDNSConn) stream() bool {
+	return f.network == "tcp" || f.network == "tcp4" || f.network == "tcp6"
+}
+
+func (f *fakeDNSConn) Close() error                       { return nil }
+func (f *fakeDNSConn) SetDeadline(time.Time) error        { return nil }
+func (f *fakeDNSConn) SetReadDeadline(time.Time) error    { return nil }
+func (f *fakeDNSConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func (f *fakeDNSConn) Write(b []byte) (int, error) {
+	n := len(b)
+	if f.stream() {
+		b = b[2:]
+	}
+	f.q = new(dnsMsg)
+	if !f.q.Unpack(b) {
+		return 0, errors.New("cannot unmarshal DNS message")
+	}
+	return n, nil
+}
+
+func (f *fakeDNSConn) Read(b []byte) (int, error) {
+	if f.resp == nil {
+		resp, err := f.server.rh(f.network, f.address, f.q)
+		if err != nil {
+			return 0, err
+		}
+		bb, ok := resp.Pack()
+		if !ok {
+			return 0, errors.New("cannot marshal DNS message")
+		}
+		if f.stream() {
+			l := len(bb)
+			bb = append([]byte{byte(l >> 8), byte(l)}, bb...)
+		}
+		f.resp = bb
+	}
+	if len(f.resp) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, f.resp)
+	f.resp = f.resp[n:]
+	return n, nil
+}
+
+// fakeDNSPacketConn is a fakeDNSConn that the resolver treats as a
+// UDP transport.
+type fakeDNSPacketConn struct {
+	*fakeDNSConn
+}
+
+func (f *fakeDNSPacketConn) ReadFrom(b []byte) (int, Addr, error) {
+	n, err := f.Read(b)
+	return n, nil, err
+}
+
+func (f *fakeDNSPacketConn) WriteTo(b []byte, _ Addr) (int, error) {
+	return f.Write(b)
+}
+
+// fakeDNSAnswer returns a successful response to q holding a single
+// A record for 192.0.2.1.
+func fakeDNSAnswer(q *dnsMsg) *dnsMsg {
+	return &dnsMsg{
+		dnsMsgHdr: dnsMsgHdr{
+			id:                  q.id,
+			response:            true,
+			recursion_available: true,
+		},
+		question: q.question,
+		answer: []dnsRR{
+			&dnsRR_A{
+				Hdr: dnsRR_Header{
+					Name:   q.question[0].Name,
+					Rrtype: dnsTypeA,
+					Class:  dnsClassINET,
+				},
+				A: 0xc0000201,
+			},
+		},
+	}
+}
+
+func TestDNSExchangeEDNS0(t *testing.T) {
+	fake := fakeDNSServer{func(_, _ string, q *dnsMsg) (*dnsMsg, error) {
+		if len(q.extra) != 1 {
+			return nil, fmt.Errorf("got %d additional records; want 1", len(q.extra))
+		}
+		opt, ok := q.extra[0].(*dnsRR_OPT)
+		if !ok {
+			return nil, fmt.Errorf("got additional record %T; want *dnsRR_OPT", q.extra[0])
+		}
+		if opt.Hdr.Class != maxDNSPacketSize {
+			return nil, fmt.Errorf("got UDP payload size %d; want %d", opt.Hdr.Class, maxDNSPacketSize)
+		}
+		return fakeDNSAnswer(q), nil
+	}}
+	r := Resolver{Dial: fake.DialContext}
+	msg, err := r.exchange(context.Background(), "192.0.2.53:53", "www.example.com.", dnsTypeA, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.answer) != 1 {
+		t.Fatalf("got %d answers; want 1", len(msg.answer))
+	}
+}
+
+func TestDNSExchangeNoEDNS0Fallback(t *testing.T) {
+	for _, rcode := range []int{dnsRcodeFormatError, dnsRcodeNotImplemented} {
+		var extras []int
+		fake := fakeDNSServer{func(_, _ string, q *dnsMsg) (*dnsMsg, error) {
+			extras = append(extras, len(q.extra))
+			resp := fakeDNSAnswer(q)
+			if len(q.extra) > 0 {
+				// An old server that does not understand
+				// the OPT record.
+				resp.rcode = rcode
+				resp.answer = nil
+			}
+			return resp, nil
+		}}
+		r := Resolver{Dial: fake.DialContext}
+		msg, err := r.exchange(context.Background(), "192.0.2.53:53", "www.example.com.", dnsTypeA, time.Second)
+		if err != nil {
+			t.Fatalf("rcode %d: %v", rcode, err)
+		}
+		if want := []int{1, 0}; !reflect.DeepEqual(extras, want) {
+			t.Errorf("rcode %d: got queries with %v additional records; want %v", rcode, extras, want)
+		}
+		if msg.rcode != dnsRcodeSuccess || len(msg.answer) != 1 {
+			t.Errorf("rcode %d: got rcode %d with %d answers; want success with 1 answer", rcode, msg.rcode, len(msg.answer))
+		}
+	}
+
+	// A server that fails without EDNS0 too is asked only twice.
+	var n int
+	fake := fakeDNSServer{func(_, _ string, q *dnsMsg) (*dnsMsg, error) {
+		n++
+		resp := fakeDNSAnswer(q)
+		resp.rcode = dnsRcodeFormatError
+		resp.answer = nil
+		return resp, nil
+	}}
+	r := Resolver{Dial: fake.DialContext}
+	msg, err := r.exchange(context.Background(), "192.0.2.53:53", "www.example.com.", dnsTypeA, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || msg.rcode != dnsRcodeFormatError {
+		t.Errorf("got %d queries and rcode %d; want 2 queries and rcode %d", n, msg.rcode, dnsRcodeFormatError)
+	}
+}
+
+func TestDNSExchangeTruncatedFallback(t *testing.T) {
+	var networks []string
+	fake := fakeDNSServer{func(network, _ string, q *dnsMsg) (*dnsMsg, error) {
+		networks = append(networks, network)
+		resp := fakeDNSAnswer(q)
+		if network == "udp" {
+			resp.truncated = true
+			resp.answer = nil
+		}
+		return resp, nil
+	}}
+	r := Resolver{Dial: fake.DialContext}
+	msg, err := r.exchange(context.Background(), "192.0.2.53:53", "www.example.com.", dnsTypeA, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"udp", "tcp"}; !reflect.DeepEqual(networks, want) {
+		t.Errorf("got queries over %v; want %v", networks, want)
+	}
+	if msg.truncated || len(msg.answer) != 1 {
+		t.Errorf("got truncated=%v with %d answers; want full response with 1 answer", msg.truncated, len(msg.answer))
+	}
+}
+
+func TestDNSRotate(t *testing.T) {
+	var servers []string
+	fake := fakeDNSServer{func(_, server string, q *dnsMsg) (*dnsMsg, error) {
+		servers = append(servers, server)
+		return fakeDNSAnswer(q), nil
+	}}
+	r := Resolver{Dial: fake.DialContext}
+	conf := &dnsConfig{
+		servers:  []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"},
+		timeout:  1,
+		attempts: 1,
+	}
+	for _, rotate := range []bool{false, true} {
+		servers = nil
+		conf.rotate = rotate
+		for i := 0; i < 4; i++ {
+			if _, _, err := r.tryOneName(context.Background(), conf, "www.example.com.", dnsTypeA); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want := []string{"192.0.2.1:53", "192.0.2.1:53", "192.0.2.1:53", "192.0.2.1:53"}
+		if rotate {
+			want = []string{"192.0.2.1:53", "192.0.2.2:53", "192.0.2.3:53", "192.0.2.1:53"}
+		}
+		if !reflect.DeepEqual(servers, want) {
+			t.Errorf("rotate=%v: got queries to %v; want %v", rotate, servers, want)
+		}
+	}
+}
+
+func TestDNSResolverCanceled(t *testing.T) {
+	dials := 0
+	r := Resolver{Dial: func(ctx context.Context, network, address string) (Conn, error) {
+		dials++
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	conf := &dnsConfig{
+		servers:  []string{"192.0.2.1", "192.0.2.2"},
+		timeout:  1,
+		attempts: 2,
+	}
+	_, _, err := r.tryOneName(ctx, conf, "www.example.com.", dnsTypeA)
+	if err == nil {
+		t.Fatal("tryOneName succeeded with canceled context")
+	}
+	if dials != 1 {
+		t.Errorf("got %d dials; want 1", dials)
+	}
+}
+
+func TestDialerResolver(t *testing.T) {
+	onceLoadConfig.Do(loadDefaultConfig)
+	cfg.mu.Lock()
+	orig := cfg.dnsConfig
+	cfg.dnsConfig = &dnsConfig{
+		servers:  []string{"192.0.2.1"},
+		ndots:    1,
+		timeout:  1,
+		attempts: 1,
+	}
+	cfg.mu.Unlock()
+	defer func() {
+		cfg.mu.Lock()
+		cfg.dnsConfig = orig
+		cfg.mu.Unlock()
+	}()
+
+	ln := newLocalListener(t)
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			c.Close()
+		}
+	}()
+	_, port, err := SplitHostPort(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := fakeDNSServer{func(_, _ string, q *dnsMsg) (*dnsMsg, error) {
+		resp := fakeDNSAnswer(q)
+		switch q.question[0].Qtype {
+		case dnsTypeA:
+			resp.answer[0].(*dnsRR_A).A = 0x7f000001
+		default:
+			resp.answer = nil
+		}
+		return resp, nil
+	}}
+	d := Dialer{Resolver: &Resolver{Dial: fake.DialContext}}
+	c, err := d.Dial("tcp4", JoinHostPort("fake.test", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if got := c.RemoteAddr().String(); got != ln.Addr().String() {
+		t.Errorf("got remote address %s; want %s", got, ln.Addr())
+	}
+}
@@ -8,6 +8,8 @@
 
 package net
 
+import "sync/atomic"
+
 type dnsConfig struct {
 	servers  []string // servers to use
 	search   []string // suffixes to append to local name
@@ -15,6 +17,7 @@ type dnsConfig struct {
 	timeout  int      // seconds before giving up on packet
 	attempts int      // lost packets before giving up on server
 	rotate   bool     // round robin among servers
+	soffset  uint32   // used by serverOffset
 }
 
 // See resolv.conf(5) on a Linux machine.
@@ -66,20 +69,26 @@ func dnsReadConfig(filename string) (*dnsConfig, error) {
 				switch {
 				case hasPrefix(s, "ndots:"):
 					n, _, _ := dtoi(s, 6)
-					if n < 1 {
-						n = 1
+					if n < 0 {
+						n = 0
+					} else if n > 15 {
+						n = 15
 					}
 					conf.ndots = n
 				case hasPrefix(s, "timeout:"):
 					n, _, _ := dtoi(s, 8)
 					if n < 1 {
 						n = 1
+					} else if n > 30 {
+						n = 30
 					}
 					conf.timeout = n
 				case hasPrefix(s, "attempts:"):
 					n, _, _ := dtoi(s, 9)
 					if n < 1 {
 						n = 1
+					} else if n > 5 {
+						n = 5
 					}
 					conf.attempts = n
 				case s == "rotate":
@@ -91,6 +100,17 @@ func dnsReadConfig(filename string) (*dnsConfig, error) {
 	return conf, nil
 }
 
+// serverOffset returns an offset that can be used to determine
+// indices of servers in c.servers when making queries.
+// When the rotate option is enabled, this offset increases.
+// Otherwise it is always 0.
+func (c *dnsConfig) serverOffset() uint32 {
+	if c.rotate {
+		return atomic.AddUint32(&c.soffset, 1) - 1 // return 0 to start
+	}
+	return 0
+}
+
 func hasPrefix(s, prefix string) bool {
 	return len(s) >= len(prefix) && s[:len(prefix)] == prefix
 }
@@ -46,6 +46,15 @@ var dnsReadConfigTests = []struct {
 			attempts: 2,
 		},
 	},
+	{
+		name: "testdata/options-resolv.conf",
+		conf: dnsConfig{
+			servers:  []string{"192.0.2.1"},
+			ndots:    0,
+			timeout:  30,
+			attempts: 5,
+		},
+	},
 	{
 		name: "testdata/empty-resolv.conf",
 		conf: dnsConfig{
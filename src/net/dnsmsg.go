@@ -45,6 +45,7 @@ const (
 	dnsTypeTXT   = 16
 	dnsTypeAAAA  = 28
 	dnsTypeSRV   = 33
+	dnsTypeOPT   = 41
 
 	// valid dnsQuestion.qtype only
 	dnsTypeAXFR  = 252
@@ -355,6 +356,21 @@ func (rr *dnsRR_AAAA) Walk(f func(v interface{}, name, tag string) bool) bool {
 	return rr.Hdr.Walk(f) && f(rr.AAAA[:], "AAAA", "ipv6")
 }
 
+// dnsRR_OPT is the EDNS0 pseudo-RR of RFC 6891. It has no data of
+// its own; the header's Class holds the requestor's UDP payload size
+// and its Ttl the extended RCODE and flags.
+type dnsRR_OPT struct {
+	Hdr dnsRR_Header
+}
+
+func (rr *dnsRR_OPT) Header() *dnsRR_Header {
+	return &rr.Hdr
+}
+
+func (rr *dnsRR_OPT) Walk(f func(v interface{}, name, tag string) bool) bool {
+	return rr.Hdr.Walk(f)
+}
+
 // Packing and unpacking.
 //
 // All the packers and unpackers take a (msg []byte, off int)
@@ -379,6 +395,7 @@ var rr_mk = map[int]func() dnsRR{
 	dnsTypeSRV:   func() dnsRR { return new(dnsRR_SRV) },
 	dnsTypeA:     func() dnsRR { return new(dnsRR_A) },
 	dnsTypeAAAA:  func() dnsRR { return new(dnsRR_AAAA) },
+	dnsTypeOPT:   func() dnsRR { return new(dnsRR_OPT) },
 }
 
 // Pack a domain name s into msg[off:].
@@ -390,6 +407,15 @@ func packDomainName(s string, msg []byte, off int) (off1 int, ok bool) {
 		s += "."
 	}
 
+	// The root domain is just the terminating zero-length string.
+	if s == "." {
+		if off >= len(msg) {
+			return len(msg), false
+		}
+		msg[off] = 0
+		return off + 1, true
+	}
+
 	// Each dot ends a segment of the name.
 	// We trade each dot byte for a length byte.
 	// There is also a trailing zero.
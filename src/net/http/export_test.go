@@ -8,7 +8,11 @@
 package http
 
 import (
+	"bufio"
+	"bytes"
+	"fmt"
 	"net"
+	"net/http/internal/hpack"
 	"net/url"
 	"time"
 )
@@ -97,6 +101,14 @@ func ExportRefererForURL(lastReq, newReq *url.URL) string {
 	return refererForURL(lastReq, newReq)
 }
 
+// SetRoundTripRetried sets a hook to be run each time the Transport
+// retries a request on a new connection.
+func SetRoundTripRetried(f func()) (restore func()) {
+	old := testHookRoundTripRetried
+	testHookRoundTripRetried = f
+	return func() { testHookRoundTripRetried = old }
+}
+
 // SetPendingDialHooks sets the hooks that run before and after handling
 // pending dials.
 func SetPendingDialHooks(before, after func()) {
@@ -106,3 +118,64 @@ func SetPendingDialHooks(before, after func()) {
 var ExportServerNewConn = (*Server).newConn
 
 var ExportCloseWriteAndWait = (*conn).closeWriteAndWait
+
+// ExportHTTP2ConfigureServer enables HTTP/2 on s the way
+// ListenAndServeTLS does, for servers started by httptest.
+func ExportHTTP2ConfigureServer(s *Server) {
+	http2ConfigureServer(s, nil)
+}
+
+// HTTP2PushPromises speaks HTTP/2 on c, on which ALPN negotiated
+// "h2", with server push enabled. It sends a GET for path and returns
+// the paths of the PUSH_PROMISE frames received before the response
+// ends.
+func HTTP2PushPromises(c net.Conn, authority, path string) ([]string, error) {
+	bw := bufio.NewWriter(c)
+	fr := http2newFramer(bw, c)
+	var hbuf bytes.Buffer
+	enc := hpack.NewEncoder(&hbuf)
+	bw.WriteString(http2ClientPreface)
+	fr.WriteSettings()
+	block := http2encodeHeaders(enc, &hbuf, []hpack.HeaderField{
+		{Name: ":method", Value: "GET"},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":authority", Value: authority},
+		{Name: ":path", Value: path},
+	})
+	fr.WriteHeaders(1, true, block, http2initialMaxFrameSize)
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+	var promised []string
+	for {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			return promised, err
+		}
+		switch f := f.(type) {
+		case *http2SettingsFrame:
+			if !f.IsAck() {
+				fr.WriteSettingsAck()
+				bw.Flush()
+			}
+		case *http2PushPromiseFrame:
+			for _, hf := range f.Fields {
+				if hf.Name == ":path" {
+					promised = append(promised, hf.Value)
+				}
+			}
+		case *http2HeadersFrame:
+			if f.StreamID == 1 && f.StreamEnded() {
+				return promised, nil
+			}
+		case *http2DataFrame:
+			if f.StreamID == 1 && f.StreamEnded() {
+				return promised, nil
+			}
+		case *http2RSTStreamFrame:
+			if f.StreamID == 1 {
+				return promised, fmt.Errorf("stream reset: %v", f.ErrCode)
+			}
+		}
+	}
+}
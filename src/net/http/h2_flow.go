@@ -0,0 +1,175 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP/2 flow control and the body pipe shared by client and server.
+
+package http
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+)
+
+// http2flow is the flow control window's size.
+type http2flow struct {
+	// n is the number of DATA bytes we're allowed to send.
+	// A flow is kept both on a conn and a per-stream.
+	n int32
+
+	// conn points to the shared connection-level flow that is
+	// shared by all streams on that conn. It is nil for the flow
+	// that's on the conn directly.
+	conn *http2flow
+}
+
+func (f *http2flow) setConnFlow(cf *http2flow) { f.conn = cf }
+
+// available returns how many bytes may be sent, taking the
+// connection-level window into account.
+func (f *http2flow) available() int32 {
+	n := f.n
+	if f.conn != nil && f.conn.n < n {
+		n = f.conn.n
+	}
+	return n
+}
+
+// take consumes n bytes from the window, and from the connection's
+// window if there is one.
+func (f *http2flow) take(n int32) {
+	if n > f.available() {
+		panic("internal error: took too much")
+	}
+	f.n -= n
+	if f.conn != nil {
+		f.conn.n -= n
+	}
+}
+
+// add adds n bytes (positive or negative) to the flow control window.
+// It returns false if the sum would exceed 2^31-1.
+func (f *http2flow) add(n int32) bool {
+	remain := (1<<31 - 1) - f.n
+	if n > remain {
+		return false
+	}
+	f.n += n
+	return true
+}
+
+var http2errClosedBody = errors.New("http2: response body closed")
+
+// http2pipe is a goroutine-safe io.Reader/io.Writer pair. It is
+// used for request bodies on the server and response bodies on the
+// client, where the writer is the connection's read loop.
+type http2pipe struct {
+	mu  sync.Mutex
+	c   sync.Cond // c.L must point to mu
+	b   bytes.Buffer
+	err error // read error once b is drained; nil means not done
+
+	// breakErr, if set, is returned immediately by Read,
+	// discarding any unread data.
+	breakErr error
+
+	// onRead, if non-nil, is called after each successful Read
+	// with the number of bytes read, outside of mu.
+	onRead func(n int)
+}
+
+func http2newPipe() *http2pipe {
+	p := &http2pipe{}
+	p.c.L = &p.mu
+	return p
+}
+
+// Len returns the number of bytes of unread data.
+func (p *http2pipe) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.b.Len()
+}
+
+// Read waits until data is available and copies bytes from the
+// buffer into d.
+func (p *http2pipe) Read(d []byte) (n int, err error) {
+	p.mu.Lock()
+	for {
+		if p.breakErr != nil {
+			p.mu.Unlock()
+			return 0, p.breakErr
+		}
+		if p.b.Len() > 0 {
+			n, _ = p.b.Read(d)
+			break
+		}
+		if p.err != nil {
+			p.mu.Unlock()
+			return 0, p.err
+		}
+		p.c.Wait()
+	}
+	onRead := p.onRead
+	p.mu.Unlock()
+	if onRead != nil {
+		onRead(n)
+	}
+	return n, nil
+}
+
+// Write copies bytes from d into the buffer and wakes a reader.
+// It is an error to write more data once the pipe is closed.
+func (p *http2pipe) Write(d []byte) (n int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.c.Signal()
+	if p.err != nil || p.breakErr != nil {
+		return 0, http2errClosedBody
+	}
+	return p.b.Write(d)
+}
+
+// CloseWithError causes the next Read (waking up a current blocked
+// Read if needed) to return the provided err after all data has been
+// read. A nil err means io.EOF.
+func (p *http2pipe) CloseWithError(err error) {
+	if err == nil {
+		err = io.EOF
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.c.Broadcast()
+}
+
+// BreakWithError causes the next Read (waking up a current blocked
+// Read if needed) to return the provided err immediately, without
+// waiting for unread data. It returns the number of bytes that were
+// discarded.
+func (p *http2pipe) BreakWithError(err error) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := p.b.Len()
+	if p.breakErr == nil {
+		p.breakErr = err
+	}
+	p.b.Reset()
+	p.c.Broadcast()
+	return n
+}
+
+// Err returns the error (if any) first set by CloseWithError or
+// BreakWithError.
+func (p *http2pipe) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.breakErr != nil {
+		return p.breakErr
+	}
+	return p.err
+}
@@ -0,0 +1,821 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP/2 framing. See RFC 7540, section 4 and 6.
+
+package http
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/internal/hpack"
+	"strings"
+)
+
+// http2ClientPreface is the string that must be sent by new
+// connections from clients.
+const http2ClientPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+const (
+	http2NextProtoTLS = "h2"
+
+	http2frameHeaderLen = 9
+
+	// http2initialWindowSize is the initial flow-control window
+	// size of new streams and connections, per the spec.
+	http2initialWindowSize = 65535
+
+	// http2initialMaxFrameSize is the smallest, and default,
+	// maximum frame payload size.
+	http2initialMaxFrameSize = 16384
+
+	// http2maxFrameSize is the largest frame payload size
+	// permitted by the spec.
+	http2maxFrameSize = 1<<24 - 1
+
+	// http2initialHeaderTableSize is the default size of the
+	// HPACK dynamic table.
+	http2initialHeaderTableSize = 4096
+
+	// http2maxWindowSize is the largest flow-control window.
+	http2maxWindowSize = 1<<31 - 1
+)
+
+// An http2FrameType is a registered frame type as defined in
+// RFC 7540, section 11.2.
+type http2FrameType uint8
+
+const (
+	http2FrameData         http2FrameType = 0x0
+	http2FrameHeaders      http2FrameType = 0x1
+	http2FramePriority     http2FrameType = 0x2
+	http2FrameRSTStream    http2FrameType = 0x3
+	http2FrameSettings     http2FrameType = 0x4
+	http2FramePushPromise  http2FrameType = 0x5
+	http2FramePing         http2FrameType = 0x6
+	http2FrameGoAway       http2FrameType = 0x7
+	http2FrameWindowUpdate http2FrameType = 0x8
+	http2FrameContinuation http2FrameType = 0x9
+)
+
+var http2frameName = map[http2FrameType]string{
+	http2FrameData:         "DATA",
+	http2FrameHeaders:      "HEADERS",
+	http2FramePriority:     "PRIORITY",
+	http2FrameRSTStream:    "RST_STREAM",
+	http2FrameSettings:     "SETTINGS",
+	http2FramePushPromise:  "PUSH_PROMISE",
+	http2FramePing:         "PING",
+	http2FrameGoAway:       "GOAWAY",
+	http2FrameWindowUpdate: "WINDOW_UPDATE",
+	http2FrameContinuation: "CONTINUATION",
+}
+
+func (t http2FrameType) String() string {
+	if s, ok := http2frameName[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("UNKNOWN_FRAME_TYPE_%d", uint8(t))
+}
+
+// Frame flags. Their meaning depends on the frame type.
+const (
+	http2FlagDataEndStream          = 0x1
+	http2FlagDataPadded             = 0x8
+	http2FlagHeadersEndStream       = 0x1
+	http2FlagHeadersEndHeaders      = 0x4
+	http2FlagHeadersPadded          = 0x8
+	http2FlagHeadersPriority        = 0x20
+	http2FlagSettingsAck            = 0x1
+	http2FlagPingAck                = 0x1
+	http2FlagContinuationEndHeaders = 0x4
+	http2FlagPushPromiseEndHeaders  = 0x4
+	http2FlagPushPromisePadded      = 0x8
+)
+
+// An http2ErrCode is an unsigned 32-bit error code as defined in
+// RFC 7540, section 7.
+type http2ErrCode uint32
+
+const (
+	http2ErrCodeNo                 http2ErrCode = 0x0
+	http2ErrCodeProtocol           http2ErrCode = 0x1
+	http2ErrCodeInternal           http2ErrCode = 0x2
+	http2ErrCodeFlowControl        http2ErrCode = 0x3
+	http2ErrCodeSettingsTimeout    http2ErrCode = 0x4
+	http2ErrCodeStreamClosed       http2ErrCode = 0x5
+	http2ErrCodeFrameSize          http2ErrCode = 0x6
+	http2ErrCodeRefusedStream      http2ErrCode = 0x7
+	http2ErrCodeCancel             http2ErrCode = 0x8
+	http2ErrCodeCompression        http2ErrCode = 0x9
+	http2ErrCodeConnect            http2ErrCode = 0xa
+	http2ErrCodeEnhanceYourCalm    http2ErrCode = 0xb
+	http2ErrCodeInadequateSecurity http2ErrCode = 0xc
+	http2ErrCodeHTTP11Required     http2ErrCode = 0xd
+)
+
+var http2errCodeName = map[http2ErrCode]string{
+	http2ErrCodeNo:                 "NO_ERROR",
+	http2ErrCodeProtocol:           "PROTOCOL_ERROR",
+	http2ErrCodeInternal:           "INTERNAL_ERROR",
+	http2ErrCodeFlowControl:        "FLOW_CONTROL_ERROR",
+	http2ErrCodeSettingsTimeout:    "SETTINGS_TIMEOUT",
+	http2ErrCodeStreamClosed:       "STREAM_CLOSED",
+	http2ErrCodeFrameSize:          "FRAME_SIZE_ERROR",
+	http2ErrCodeRefusedStream:      "REFUSED_STREAM",
+	http2ErrCodeCancel:             "CANCEL",
+	http2ErrCodeCompression:        "COMPRESSION_ERROR",
+	http2ErrCodeConnect:            "CONNECT_ERROR",
+	http2ErrCodeEnhanceYourCalm:    "ENHANCE_YOUR_CALM",
+	http2ErrCodeInadequateSecurity: "INADEQUATE_SECURITY",
+	http2ErrCodeHTTP11Required:     "HTTP_1_1_REQUIRED",
+}
+
+func (e http2ErrCode) String() string {
+	if s, ok := http2errCodeName[e]; ok {
+		return s
+	}
+	return fmt.Sprintf("unknown error code 0x%x", uint32(e))
+}
+
+// An http2ConnectionError is an error that results in the
+// termination of the entire connection.
+type http2ConnectionError http2ErrCode
+
+func (e http2ConnectionError) Error() string {
+	return fmt.Sprintf("http2: connection error: %v", http2ErrCode(e))
+}
+
+// An http2StreamError is an error that only affects one stream
+// within an HTTP/2 connection.
+type http2StreamError struct {
+	StreamID uint32
+	Code     http2ErrCode
+}
+
+func (e http2StreamError) Error() string {
+	return fmt.Sprintf("http2: stream error: stream ID %d; %v", e.StreamID, e.Code)
+}
+
+// An http2GoAwayError is returned for streams that the peer did not
+// process before it sent a GOAWAY frame.
+type http2GoAwayError struct {
+	LastStreamID uint32
+	Code         http2ErrCode
+	DebugData    string
+}
+
+func (e http2GoAwayError) Error() string {
+	return fmt.Sprintf("http2: server sent GOAWAY and closed the connection; LastStreamID=%v, ErrCode=%v, debug=%q",
+		e.LastStreamID, e.Code, e.DebugData)
+}
+
+// An http2SettingID is an HTTP/2 setting as defined in RFC 7540,
+// section 6.5.2.
+type http2SettingID uint16
+
+const (
+	http2SettingHeaderTableSize      http2SettingID = 0x1
+	http2SettingEnablePush           http2SettingID = 0x2
+	http2SettingMaxConcurrentStreams http2SettingID = 0x3
+	http2SettingInitialWindowSize    http2SettingID = 0x4
+	http2SettingMaxFrameSize         http2SettingID = 0x5
+	http2SettingMaxHeaderListSize    http2SettingID = 0x6
+)
+
+// An http2Setting is a setting parameter: which setting it is, and
+// its value.
+type http2Setting struct {
+	ID  http2SettingID
+	Val uint32
+}
+
+// valid reports whether the setting value is within the range
+// permitted by the spec.
+func (s http2Setting) valid() error {
+	switch s.ID {
+	case http2SettingEnablePush:
+		if s.Val != 1 && s.Val != 0 {
+			return http2ConnectionError(http2ErrCodeProtocol)
+		}
+	case http2SettingInitialWindowSize:
+		if s.Val > http2maxWindowSize {
+			return http2ConnectionError(http2ErrCodeFlowControl)
+		}
+	case http2SettingMaxFrameSize:
+		if s.Val < http2initialMaxFrameSize || s.Val > http2maxFrameSize {
+			return http2ConnectionError(http2ErrCodeProtocol)
+		}
+	}
+	return nil
+}
+
+// An http2FrameHeader is the 9 byte header of all HTTP/2 frames.
+type http2FrameHeader struct {
+	Type     http2FrameType
+	Flags    uint8
+	Length   uint32 // length of the payload, not including the header
+	StreamID uint32
+}
+
+func (h http2FrameHeader) has(flag uint8) bool { return h.Flags&flag == flag }
+
+func (h http2FrameHeader) String() string {
+	return fmt.Sprintf("[FrameHeader %v flags=0x%x stream=%d len=%d]", h.Type, h.Flags, h.StreamID, h.Length)
+}
+
+// An http2Frame is a frame read by an http2Framer. The concrete
+// types are the *http2...Frame types below.
+type http2Frame interface {
+	header() http2FrameHeader
+}
+
+func (h http2FrameHeader) header() http2FrameHeader { return h }
+
+// An http2DataFrame conveys arbitrary, variable-length sequences of
+// octets associated with a stream. Its Data is only valid until the
+// next call to ReadFrame.
+type http2DataFrame struct {
+	http2FrameHeader
+	Data []byte
+}
+
+func (f *http2DataFrame) StreamEnded() bool { return f.has(http2FlagDataEndStream) }
+
+// An http2HeadersFrame is a complete header block: a HEADERS frame
+// and any CONTINUATION frames that followed it, already decoded.
+type http2HeadersFrame struct {
+	http2FrameHeader
+	Fields []hpack.HeaderField
+}
+
+func (f *http2HeadersFrame) StreamEnded() bool { return f.has(http2FlagHeadersEndStream) }
+
+// PseudoValue returns the value of the pseudo header field named
+// ":"+name, or the empty string.
+func (f *http2HeadersFrame) PseudoValue(name string) string {
+	for _, hf := range f.Fields {
+		if !hf.IsPseudo() {
+			return ""
+		}
+		if hf.Name[1:] == name {
+			return hf.Value
+		}
+	}
+	return ""
+}
+
+// RegularFields returns the header fields that are not pseudo
+// header fields.
+func (f *http2HeadersFrame) RegularFields() []hpack.HeaderField {
+	for i, hf := range f.Fields {
+		if !hf.IsPseudo() {
+			return f.Fields[i:]
+		}
+	}
+	return nil
+}
+
+// An http2PushPromiseFrame is a complete PUSH_PROMISE header block.
+type http2PushPromiseFrame struct {
+	http2FrameHeader
+	PromiseID uint32
+	Fields    []hpack.HeaderField
+}
+
+// An http2PriorityFrame specifies the sender-advised priority of a
+// stream. Priorities are parsed but otherwise ignored.
+type http2PriorityFrame struct {
+	http2FrameHeader
+}
+
+// An http2RSTStreamFrame allows for abnormal termination of a stream.
+type http2RSTStreamFrame struct {
+	http2FrameHeader
+	ErrCode http2ErrCode
+}
+
+// An http2SettingsFrame conveys configuration parameters that affect
+// how endpoints communicate.
+type http2SettingsFrame struct {
+	http2FrameHeader
+	Settings []http2Setting
+}
+
+func (f *http2SettingsFrame) IsAck() bool { return f.has(http2FlagSettingsAck) }
+
+// An http2PingFrame is a mechanism for measuring a minimal round trip
+// time from the sender, as well as determining whether an idle
+// connection is still functional.
+type http2PingFrame struct {
+	http2FrameHeader
+	Data [8]byte
+}
+
+func (f *http2PingFrame) IsAck() bool { return f.has(http2FlagPingAck) }
+
+// An http2GoAwayFrame informs the remote peer to stop creating
+// streams on this connection.
+type http2GoAwayFrame struct {
+	http2FrameHeader
+	LastStreamID uint32
+	ErrCode      http2ErrCode
+	DebugData    []byte
+}
+
+// An http2WindowUpdateFrame is used to implement flow control.
+type http2WindowUpdateFrame struct {
+	http2FrameHeader
+	Increment uint32
+}
+
+// An http2UnknownFrame is a frame of a type this package does not
+// understand. The spec requires such frames to be ignored.
+type http2UnknownFrame struct {
+	http2FrameHeader
+}
+
+// An http2Framer reads and writes HTTP/2 frames.
+//
+// ReadFrame assembles HEADERS and PUSH_PROMISE frames with their
+// CONTINUATION frames and decodes them using the connection's HPACK
+// decoder. The Write methods are not safe for concurrent use; callers
+// serialize them.
+type http2Framer struct {
+	r       io.Reader
+	w       io.Writer
+	headBuf [http2frameHeaderLen]byte
+	readBuf []byte
+	wbuf    []byte
+
+	// maxReadSize is the largest frame payload ReadFrame accepts.
+	maxReadSize uint32
+
+	// maxHeaderListSize is the largest decoded header list
+	// ReadFrame accepts.
+	maxHeaderListSize uint32
+
+	hdec *hpack.Decoder
+}
+
+func http2newFramer(w io.Writer, r io.Reader) *http2Framer {
+	f := &http2Framer{
+		r:                 r,
+		w:                 w,
+		maxReadSize:       http2initialMaxFrameSize,
+		maxHeaderListSize: 10 << 20,
+	}
+	f.hdec = hpack.NewDecoder(http2initialHeaderTableSize, nil)
+	return f
+}
+
+var http2errFrameTooLarge = errors.New("http2: frame too large")
+
+func (f *http2Framer) readFrameHeader() (http2FrameHeader, error) {
+	if _, err := io.ReadFull(f.r, f.headBuf[:]); err != nil {
+		return http2FrameHeader{}, err
+	}
+	b := f.headBuf[:]
+	return http2FrameHeader{
+		Length:   uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2]),
+		Type:     http2FrameType(b[3]),
+		Flags:    b[4],
+		StreamID: binary.BigEndian.Uint32(b[5:]) & (1<<31 - 1),
+	}, nil
+}
+
+// readRawFrame reads a frame header and its payload. The payload is
+// only valid until the next call.
+func (f *http2Framer) readRawFrame() (http2FrameHeader, []byte, error) {
+	fh, err := f.readFrameHeader()
+	if err != nil {
+		return fh, nil, err
+	}
+	if fh.Length > f.maxReadSize {
+		return fh, nil, http2errFrameTooLarge
+	}
+	if uint32(cap(f.readBuf)) < fh.Length {
+		f.readBuf = make([]byte, fh.Length)
+	}
+	payload := f.readBuf[:fh.Length]
+	if _, err := io.ReadFull(f.r, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fh, nil, err
+	}
+	return fh, payload, nil
+}
+
+// ReadFrame reads a single frame. Errors of type
+// http2ConnectionError and http2StreamError describe protocol
+// violations by the peer; other errors are I/O errors.
+func (f *http2Framer) ReadFrame() (http2Frame, error) {
+	fh, p, err := f.readRawFrame()
+	if err != nil {
+		if err == http2errFrameTooLarge {
+			return nil, http2ConnectionError(http2ErrCodeFrameSize)
+		}
+		return nil, err
+	}
+	switch fh.Type {
+	case http2FrameData:
+		if fh.StreamID == 0 {
+			return nil, http2ConnectionError(http2ErrCodeProtocol)
+		}
+		data, err := http2unpad(fh, http2FlagDataPadded, p)
+		if err != nil {
+			return nil, err
+		}
+		return &http2DataFrame{fh, data}, nil
+	case http2FrameHeaders:
+		if fh.StreamID == 0 {
+			return nil, http2ConnectionError(http2ErrCodeProtocol)
+		}
+		frag, err := http2unpad(fh, http2FlagHeadersPadded, p)
+		if err != nil {
+			return nil, err
+		}
+		if fh.has(http2FlagHeadersPriority) {
+			if len(frag) < 5 {
+				return nil, http2ConnectionError(http2ErrCodeFrameSize)
+			}
+			frag = frag[5:]
+		}
+		fields, err := f.readHeaderBlock(fh, fh.has(http2FlagHeadersEndHeaders), frag)
+		if err != nil {
+			return nil, err
+		}
+		return &http2HeadersFrame{fh, fields}, nil
+	case http2FramePushPromise:
+		if fh.StreamID == 0 {
+			return nil, http2ConnectionError(http2ErrCodeProtocol)
+		}
+		frag, err := http2unpad(fh, http2FlagPushPromisePadded, p)
+		if err != nil {
+			return nil, err
+		}
+		if len(frag) < 4 {
+			return nil, http2ConnectionError(http2ErrCodeFrameSize)
+		}
+		promiseID := binary.BigEndian.Uint32(frag) & (1<<31 - 1)
+		fields, err := f.readHeaderBlock(fh, fh.has(http2FlagPushPromiseEndHeaders), frag[4:])
+		if err != nil {
+			return nil, err
+		}
+		return &http2PushPromiseFrame{fh, promiseID, fields}, nil
+	case http2FramePriority:
+		if fh.StreamID == 0 {
+			return nil, http2ConnectionError(http2ErrCodeProtocol)
+		}
+		if len(p) != 5 {
+			return nil, http2StreamError{fh.StreamID, http2ErrCodeFrameSize}
+		}
+		return &http2PriorityFrame{fh}, nil
+	case http2FrameRSTStream:
+		if len(p) != 4 {
+			return nil, http2ConnectionError(http2ErrCodeFrameSize)
+		}
+		if fh.StreamID == 0 {
+			return nil, http2ConnectionError(http2ErrCodeProtocol)
+		}
+		return &http2RSTStreamFrame{fh, http2ErrCode(binary.BigEndian.Uint32(p))}, nil
+	case http2FrameSettings:
+		if fh.StreamID != 0 {
+			return nil, http2ConnectionError(http2ErrCodeProtocol)
+		}
+		if fh.has(http2FlagSettingsAck) {
+			if len(p) != 0 {
+				return nil, http2ConnectionError(http2ErrCodeFrameSize)
+			}
+			return &http2SettingsFrame{http2FrameHeader: fh}, nil
+		}
+		if len(p)%6 != 0 {
+			return nil, http2ConnectionError(http2ErrCodeFrameSize)
+		}
+		sf := &http2SettingsFrame{http2FrameHeader: fh}
+		for ; len(p) > 0; p = p[6:] {
+			s := http2Setting{
+				ID:  http2SettingID(binary.BigEndian.Uint16(p)),
+				Val: binary.BigEndian.Uint32(p[2:]),
+			}
+			if err := s.valid(); err != nil {
+				return nil, err
+			}
+			sf.Settings = append(sf.Settings, s)
+		}
+		return sf, nil
+	case http2FramePing:
+		if len(p) != 8 {
+			return nil, http2ConnectionError(http2ErrCodeFrameSize)
+		}
+		if fh.StreamID != 0 {
+			return nil, http2ConnectionError(http2ErrCodeProtocol)
+		}
+		pf := &http2PingFrame{http2FrameHeader: fh}
+		copy(pf.Data[:], p)
+		return pf, nil
+	case http2FrameGoAway:
+		if fh.StreamID != 0 {
+			return nil, http2ConnectionError(http2ErrCodeProtocol)
+		}
+		if len(p) < 8 {
+			return nil, http2ConnectionError(http2ErrCodeFrameSize)
+		}
+		return &http2GoAwayFrame{
+			http2FrameHeader: fh,
+			LastStreamID:     binary.BigEndian.Uint32(p) & (1<<31 - 1),
+			ErrCode:          http2ErrCode(binary.BigEndian.Uint32(p[4:])),
+			DebugData:        append([]byte(nil), p[8:]...),
+		}, nil
+	case http2FrameWindowUpdate:
+		if len(p) != 4 {
+			return nil, http2ConnectionError(http2ErrCodeFrameSize)
+		}
+		inc := binary.BigEndian.Uint32(p) & (1<<31 - 1)
+		if inc == 0 {
+			if fh.StreamID == 0 {
+				return nil, http2ConnectionError(http2ErrCodeProtocol)
+			}
+			return nil, http2StreamError{fh.StreamID, http2ErrCodeProtocol}
+		}
+		return &http2WindowUpdateFrame{fh, inc}, nil
+	case http2FrameContinuation:
+		// CONTINUATION frames are consumed by readHeaderBlock;
+		// one arriving on its own is a protocol error.
+		return nil, http2ConnectionError(http2ErrCodeProtocol)
+	}
+	return &http2UnknownFrame{fh}, nil
+}
+
+// http2unpad strips the padding from a frame payload whose frame
+// type uses the given padded flag.
+func http2unpad(fh http2FrameHeader, paddedFlag uint8, p []byte) ([]byte, error) {
+	if !fh.has(paddedFlag) {
+		return p, nil
+	}
+	if len(p) < 1 {
+		return nil, http2ConnectionError(http2ErrCodeFrameSize)
+	}
+	padLen := int(p[0])
+	p = p[1:]
+	if padLen > len(p) {
+		return nil, http2ConnectionError(http2ErrCodeProtocol)
+	}
+	return p[:len(p)-padLen], nil
+}
+
+// readHeaderBlock reads any CONTINUATION frames following a HEADERS
+// or PUSH_PROMISE frame and decodes the whole header block.
+func (f *http2Framer) readHeaderBlock(fh http2FrameHeader, endHeaders bool, frag []byte) ([]hpack.HeaderField, error) {
+	var block []byte
+	if endHeaders {
+		block = frag
+	} else {
+		block = append([]byte(nil), frag...)
+		for !endHeaders {
+			ch, p, err := f.readRawFrame()
+			if err != nil {
+				if err == http2errFrameTooLarge {
+					return nil, http2ConnectionError(http2ErrCodeFrameSize)
+				}
+				return nil, err
+			}
+			if ch.Type != http2FrameContinuation || ch.StreamID != fh.StreamID {
+				return nil, http2ConnectionError(http2ErrCodeProtocol)
+			}
+			if uint32(len(block)+len(p)) > f.maxHeaderListSize {
+				return nil, http2ConnectionError(http2ErrCodeEnhanceYourCalm)
+			}
+			block = append(block, p...)
+			endHeaders = ch.has(http2FlagContinuationEndHeaders)
+		}
+	}
+	var (
+		fields  []hpack.HeaderField
+		size    uint32
+		tooBig  bool
+		pseudo  = true
+		badForm bool
+	)
+	f.hdec.SetEmitFunc(func(hf hpack.HeaderField) {
+		size += hf.Size()
+		if size > f.maxHeaderListSize {
+			tooBig = true
+			return
+		}
+		if hf.IsPseudo() {
+			if !pseudo {
+				badForm = true
+			}
+		} else {
+			pseudo = false
+			if strings.ToLower(hf.Name) != hf.Name {
+				badForm = true
+			}
+		}
+		fields = append(fields, hf)
+	})
+	_, err := f.hdec.Write(block)
+	if err == nil {
+		err = f.hdec.Close()
+	}
+	if err != nil {
+		return nil, http2ConnectionError(http2ErrCodeCompression)
+	}
+	if tooBig {
+		return nil, http2StreamError{fh.StreamID, http2ErrCodeEnhanceYourCalm}
+	}
+	if badForm {
+		return nil, http2StreamError{fh.StreamID, http2ErrCodeProtocol}
+	}
+	return fields, nil
+}
+
+func (f *http2Framer) startWrite(t http2FrameType, flags uint8, streamID uint32) {
+	f.wbuf = append(f.wbuf[:0],
+		0, 0, 0, // length, filled in by endWrite
+		byte(t),
+		flags,
+		byte(streamID>>24),
+		byte(streamID>>16),
+		byte(streamID>>8),
+		byte(streamID))
+}
+
+func (f *http2Framer) endWrite() error {
+	length := len(f.wbuf) - http2frameHeaderLen
+	if length > http2maxFrameSize {
+		return http2errFrameTooLarge
+	}
+	f.wbuf[0] = byte(length >> 16)
+	f.wbuf[1] = byte(length >> 8)
+	f.wbuf[2] = byte(length)
+	_, err := f.w.Write(f.wbuf)
+	return err
+}
+
+func (f *http2Framer) writeUint32(v uint32) {
+	f.wbuf = append(f.wbuf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// WriteData writes a DATA frame.
+func (f *http2Framer) WriteData(streamID uint32, endStream bool, data []byte) error {
+	var flags uint8
+	if endStream {
+		flags |= http2FlagDataEndStream
+	}
+	f.startWrite(http2FrameData, flags, streamID)
+	f.wbuf = append(f.wbuf, data...)
+	return f.endWrite()
+}
+
+// WriteHeaders writes a header block as a HEADERS frame followed by
+// as many CONTINUATION frames as needed to respect maxFrameSize.
+func (f *http2Framer) WriteHeaders(streamID uint32, endStream bool, block []byte, maxFrameSize uint32) error {
+	var flags uint8
+	if endStream {
+		flags |= http2FlagHeadersEndStream
+	}
+	return f.writeHeaderBlock(http2FrameHeaders, flags, http2FlagHeadersEndHeaders, streamID, nil, block, maxFrameSize)
+}
+
+// WritePushPromise writes a PUSH_PROMISE frame, and CONTINUATION
+// frames if needed, promising stream promiseID on streamID.
+func (f *http2Framer) WritePushPromise(streamID, promiseID uint32, block []byte, maxFrameSize uint32) error {
+	var id [4]byte
+	binary.BigEndian.PutUint32(id[:], promiseID)
+	return f.writeHeaderBlock(http2FramePushPromise, 0, http2FlagPushPromiseEndHeaders, streamID, id[:], block, maxFrameSize)
+}
+
+func (f *http2Framer) writeHeaderBlock(t http2FrameType, flags, endHeadersFlag uint8, streamID uint32, prefix, block []byte, maxFrameSize uint32) error {
+	max := int(maxFrameSize) - len(prefix)
+	first := true
+	for first || len(block) > 0 {
+		frag := block
+		if len(frag) > max {
+			frag = frag[:max]
+		}
+		block = block[len(frag):]
+		fl := uint8(0)
+		if len(block) == 0 {
+			fl |= endHeadersFlag
+		}
+		if first {
+			f.startWrite(t, flags|fl, streamID)
+			f.wbuf = append(f.wbuf, prefix...)
+			first = false
+			max = int(maxFrameSize)
+		} else {
+			f.startWrite(http2FrameContinuation, fl, streamID)
+		}
+		f.wbuf = append(f.wbuf, frag...)
+		if err := f.endWrite(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteSettings writes a SETTINGS frame with the given settings.
+func (f *http2Framer) WriteSettings(settings ...http2Setting) error {
+	f.startWrite(http2FrameSettings, 0, 0)
+	for _, s := range settings {
+		f.wbuf = append(f.wbuf, byte(s.ID>>8), byte(s.ID))
+		f.writeUint32(s.Val)
+	}
+	return f.endWrite()
+}
+
+// WriteSettingsAck writes an empty SETTINGS frame with the ACK bit set.
+func (f *http2Framer) WriteSettingsAck() error {
+	f.startWrite(http2FrameSettings, http2FlagSettingsAck, 0)
+	return f.endWrite()
+}
+
+// WritePing writes a PING frame.
+func (f *http2Framer) WritePing(ack bool, data [8]byte) error {
+	var flags uint8
+	if ack {
+		flags = http2FlagPingAck
+	}
+	f.startWrite(http2FramePing, flags, 0)
+	f.wbuf = append(f.wbuf, data[:]...)
+	return f.endWrite()
+}
+
+// WriteGoAway writes a GOAWAY frame.
+func (f *http2Framer) WriteGoAway(maxStreamID uint32, code http2ErrCode, debugData []byte) error {
+	f.startWrite(http2FrameGoAway, 0, 0)
+	f.writeUint32(maxStreamID & (1<<31 - 1))
+	f.writeUint32(uint32(code))
+	f.wbuf = append(f.wbuf, debugData...)
+	return f.endWrite()
+}
+
+// WriteRSTStream writes a RST_STREAM frame.
+func (f *http2Framer) WriteRSTStream(streamID uint32, code http2ErrCode) error {
+	f.startWrite(http2FrameRSTStream, 0, streamID)
+	f.writeUint32(uint32(code))
+	return f.endWrite()
+}
+
+// WriteWindowUpdate writes a WINDOW_UPDATE frame. A streamID of
+// zero updates the connection's window.
+func (f *http2Framer) WriteWindowUpdate(streamID, incr uint32) error {
+	f.startWrite(http2FrameWindowUpdate, 0, streamID)
+	f.writeUint32(incr)
+	return f.endWrite()
+}
+
+// http2encodeHeaders HPACK-encodes fields into a new header block.
+func http2encodeHeaders(enc *hpack.Encoder, buf *bytes.Buffer, fields []hpack.HeaderField) []byte {
+	buf.Reset()
+	for _, f := range fields {
+		enc.WriteField(f)
+	}
+	return append([]byte(nil), buf.Bytes()...)
+}
+
+// http2badHeaders are the connection-specific header fields that
+// must not appear in HTTP/2 messages. See RFC 7540, section 8.1.2.2.
+var http2badHeaders = map[string]bool{
+	"connection":        true,
+	"keep-alive":        true,
+	"proxy-connection":  true,
+	"transfer-encoding": true,
+	"upgrade":           true,
+}
+
+// http2appendHeaderFields appends the fields of h, lower-cased and
+// without connection-specific fields, to fields.
+func http2appendHeaderFields(fields []hpack.HeaderField, h Header, skip map[string]bool) []hpack.HeaderField {
+	for k, vv := range h {
+		lk := strings.ToLower(k)
+		if http2badHeaders[lk] || skip[lk] {
+			continue
+		}
+		for _, v := range vv {
+			fields = append(fields, hpack.HeaderField{Name: lk, Value: v})
+		}
+	}
+	return fields
+}
+
+// http2validHeaderFields reports whether the regular header fields
+// of a received message are allowed in HTTP/2.
+func http2validHeaderFields(fields []hpack.HeaderField) bool {
+	for _, hf := range fields {
+		if http2badHeaders[hf.Name] {
+			return false
+		}
+		if hf.Name == "te" && hf.Value != "trailers" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,1243 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP/2 server. See RFC 7540.
+
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http/internal/hpack"
+	"net/url"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// http2defaultMaxStreams is the default number of concurrent
+	// streams a client may open on one connection.
+	http2defaultMaxStreams = 250
+
+	// http2serverWindowSize is the receive window the server
+	// advertises for each stream and for the connection.
+	http2serverWindowSize = 1 << 20
+
+	// http2prefaceTimeout bounds how long a new connection may
+	// take to send the client preface.
+	http2prefaceTimeout = 10 * time.Second
+
+	// http2goAwayTimeout is how long a gracefully shut down
+	// connection stays open after its last stream finishes, giving
+	// the client time to read the final frames.
+	http2goAwayTimeout = 1 * time.Second
+
+	// http2responseBufferSize is the size of the buffer between a
+	// handler's Writes and the DATA frames sent.
+	http2responseBufferSize = 4 << 10
+)
+
+var (
+	http2errStreamClosed = errors.New("http2: stream closed")
+	http2errClientGone   = errors.New("http2: client connection gone")
+)
+
+// http2Server holds the HTTP/2 settings of a Server.
+type http2Server struct {
+	// MaxConcurrentStreams optionally limits the number of
+	// concurrent streams each client may have open at a time.
+	// If zero, http2defaultMaxStreams is used.
+	MaxConcurrentStreams uint32
+
+	// MaxReadFrameSize optionally specifies the largest frame
+	// payload the server is willing to read.
+	// If zero or out of range, the spec's minimum is used.
+	MaxReadFrameSize uint32
+
+	mu          sync.Mutex
+	activeConns map[*http2serverConn]bool
+}
+
+func (s *http2Server) trackConn(sc *http2serverConn, add bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if add {
+		if s.activeConns == nil {
+			s.activeConns = make(map[*http2serverConn]bool)
+		}
+		s.activeConns[sc] = true
+	} else {
+		delete(s.activeConns, sc)
+	}
+}
+
+// startGracefulShutdown sends GOAWAY on every connection, letting
+// in-flight streams finish. It is registered with
+// Server.RegisterOnShutdown.
+func (s *http2Server) startGracefulShutdown() {
+	s.mu.Lock()
+	conns := make([]*http2serverConn, 0, len(s.activeConns))
+	for sc := range s.activeConns {
+		conns = append(conns, sc)
+	}
+	s.mu.Unlock()
+	for _, sc := range conns {
+		sc.goAway(http2ErrCodeNo)
+		sc.closeIfQuiescent()
+	}
+}
+
+func (s *http2Server) maxConcurrentStreams() uint32 {
+	if v := s.MaxConcurrentStreams; v > 0 {
+		return v
+	}
+	return http2defaultMaxStreams
+}
+
+func (s *http2Server) maxReadFrameSize() uint32 {
+	if v := s.MaxReadFrameSize; v >= http2initialMaxFrameSize && v <= http2maxFrameSize {
+		return v
+	}
+	return http2initialMaxFrameSize
+}
+
+// http2ConfigureServer adds HTTP/2 support to s: it advertises "h2"
+// through ALPN in s.TLSConfig and registers the protocol in
+// s.TLSNextProto.
+func http2ConfigureServer(s *Server, conf *http2Server) {
+	if conf == nil {
+		conf = new(http2Server)
+	}
+	if s.TLSConfig == nil {
+		s.TLSConfig = new(tls.Config)
+	}
+	if !http2strSliceContains(s.TLSConfig.NextProtos, http2NextProtoTLS) {
+		s.TLSConfig.NextProtos = append(s.TLSConfig.NextProtos, http2NextProtoTLS)
+	}
+	if !http2strSliceContains(s.TLSConfig.NextProtos, "http/1.1") {
+		s.TLSConfig.NextProtos = append(s.TLSConfig.NextProtos, "http/1.1")
+	}
+	if s.TLSNextProto == nil {
+		s.TLSNextProto = map[string]func(*Server, *tls.Conn, Handler){}
+	}
+	s.TLSNextProto[http2NextProtoTLS] = func(hs *Server, c *tls.Conn, h Handler) {
+		conf.serveConn(hs, c, h)
+	}
+	s.RegisterOnShutdown(conf.startGracefulShutdown)
+}
+
+func http2strSliceContains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// http2godebugDisabled reports whether the GODEBUG environment
+// variable contains name=0, which turns off an automatic HTTP/2
+// behavior.
+func http2godebugDisabled(name string) bool {
+	for _, kv := range strings.Split(os.Getenv("GODEBUG"), ",") {
+		if kv == name+"=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// http2serverConn is the state of one HTTP/2 server connection.
+type http2serverConn struct {
+	srv        *http2Server
+	hs         *Server
+	conn       net.Conn
+	handler    Handler
+	framer     *http2Framer
+	remoteAddr string
+	tlsState   *tls.ConnectionState
+
+	wmu  sync.Mutex // guards the following, used by all writers
+	bw   *bufio.Writer
+	henc *hpack.Encoder
+	hbuf bytes.Buffer
+	werr error
+
+	mu                sync.Mutex // guards the following
+	cond              sync.Cond  // on mu; signaled on flow and stream changes
+	streams           map[uint32]*http2stream
+	flow              http2flow // connection-level send window
+	inflow            int32     // connection-level receive window remaining
+	initialWindowSize int32     // peer's SETTINGS_INITIAL_WINDOW_SIZE
+	peerMaxFrameSize  uint32
+	peerMaxStreams    uint32 // peer's limit on streams we push
+	pushEnabled       bool
+	maxClientStreamID uint32
+	maxPushStreamID   uint32
+	curClientStreams  uint32
+	curPushStreams    uint32
+	closed            bool
+	goAwaySent        bool
+	closeTimer        *time.Timer // closes conn after a graceful GOAWAY
+}
+
+// http2stream is one stream of an HTTP/2 server connection.
+type http2stream struct {
+	sc *http2serverConn
+	id uint32
+
+	body      *http2pipe // request body; nil when the request had none
+	cancelCtx context.CancelFunc
+	cw        chan bool // CloseNotify channel; buffered
+
+	// The following are guarded by sc.mu.
+	flow          http2flow // send window
+	inflow        int32     // receive window remaining
+	declBodyBytes int64     // Content-Length of the request body, or -1
+	bodyBytes     int64     // request body bytes received
+	remoteClosed  bool      // END_STREAM received
+	localClosed   bool      // END_STREAM sent
+	reset         bool      // RST_STREAM sent or received
+	trailer       Header    // declared request trailers, filled on arrival
+}
+
+func (s *http2Server) serveConn(hs *Server, c net.Conn, h Handler) {
+	sc := &http2serverConn{
+		srv:               s,
+		hs:                hs,
+		conn:              c,
+		handler:           h,
+		remoteAddr:        c.RemoteAddr().String(),
+		bw:                bufio.NewWriterSize(c, 4<<10),
+		streams:           make(map[uint32]*http2stream),
+		inflow:            http2serverWindowSize,
+		initialWindowSize: http2initialWindowSize,
+		peerMaxFrameSize:  http2initialMaxFrameSize,
+		peerMaxStreams:    http2defaultMaxStreams,
+		pushEnabled:       true,
+	}
+	sc.cond.L = &sc.mu
+	sc.flow.add(http2initialWindowSize)
+	sc.henc = hpack.NewEncoder(&sc.hbuf)
+	sc.framer = http2newFramer(sc.bw, c)
+	sc.framer.maxReadSize = s.maxReadFrameSize()
+	sc.framer.maxHeaderListSize = uint32(hs.maxHeaderBytes()) + 32*64
+	if tc, ok := c.(*tls.Conn); ok {
+		sc.tlsState = new(tls.ConnectionState)
+		*sc.tlsState = tc.ConnectionState()
+	}
+	s.trackConn(sc, true)
+	defer s.trackConn(sc, false)
+	sc.serve()
+}
+
+func (sc *http2serverConn) logf(format string, args ...interface{}) {
+	sc.hs.logf(format, args...)
+}
+
+func (sc *http2serverConn) serve() {
+	defer sc.conn.Close()
+	defer sc.closeAllStreams()
+	defer sc.stopCloseTimer()
+
+	// The connection-level deadlines set by Server.ReadTimeout and
+	// WriteTimeout apply to HTTP/1 requests; a multiplexed
+	// connection is long-lived.
+	sc.conn.SetDeadline(time.Time{})
+
+	if sc.tlsState != nil && sc.tlsState.Version < tls.VersionTLS12 {
+		sc.goAway(http2ErrCodeInadequateSecurity)
+		return
+	}
+
+	sc.conn.SetReadDeadline(time.Now().Add(http2prefaceTimeout))
+	var preface [len(http2ClientPreface)]byte
+	if _, err := io.ReadFull(sc.conn, preface[:]); err != nil || string(preface[:]) != http2ClientPreface {
+		return
+	}
+	sc.conn.SetReadDeadline(time.Time{})
+
+	err := sc.writeFrame(func(fr *http2Framer) error {
+		err := fr.WriteSettings(
+			http2Setting{http2SettingMaxFrameSize, sc.srv.maxReadFrameSize()},
+			http2Setting{http2SettingMaxConcurrentStreams, sc.srv.maxConcurrentStreams()},
+			http2Setting{http2SettingInitialWindowSize, http2serverWindowSize},
+			http2Setting{http2SettingMaxHeaderListSize, sc.framer.maxHeaderListSize},
+		)
+		if err == nil {
+			err = fr.WriteWindowUpdate(0, http2serverWindowSize-http2initialWindowSize)
+		}
+		return err
+	})
+	if err != nil {
+		return
+	}
+
+	sawSettings := false
+	for {
+		f, err := sc.framer.ReadFrame()
+		if err == nil && !sawSettings {
+			if sf, ok := f.(*http2SettingsFrame); !ok || sf.IsAck() {
+				err = http2ConnectionError(http2ErrCodeProtocol)
+			}
+			sawSettings = true
+		}
+		if err == nil {
+			err = sc.processFrame(f)
+		}
+		switch ev := err.(type) {
+		case nil:
+		case http2StreamError:
+			sc.resetStream(ev)
+		case http2ConnectionError:
+			sc.logf("http2: server connection error from %v: %v", sc.remoteAddr, ev)
+			sc.goAway(http2ErrCode(ev))
+			return
+		default:
+			if err != io.EOF && !http2isClosedConnError(err) {
+				sc.logf("http2: server error reading from %v: %v", sc.remoteAddr, err)
+			}
+			return
+		}
+		if sc.shuttingDown() {
+			return
+		}
+	}
+}
+
+// shuttingDown reports whether the connection has sent GOAWAY and
+// has no streams left.
+func (sc *http2serverConn) shuttingDown() bool {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.goAwaySent && len(sc.streams) == 0
+}
+
+// closeIfQuiescent arranges for the connection to be closed once
+// GOAWAY has been sent and the last stream is gone.
+func (sc *http2serverConn) closeIfQuiescent() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.goAwaySent && len(sc.streams) == 0 && sc.closeTimer == nil && !sc.closed {
+		sc.closeTimer = time.AfterFunc(http2goAwayTimeout, func() { sc.conn.Close() })
+	}
+}
+
+func (sc *http2serverConn) stopCloseTimer() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.closeTimer != nil {
+		sc.closeTimer.Stop()
+	}
+}
+
+func http2isClosedConnError(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "use of closed network connection")
+}
+
+// writeFrame calls fn with the framer while holding the write lock,
+// then flushes. After a write error the connection is closed and all
+// further writes fail.
+func (sc *http2serverConn) writeFrame(fn func(*http2Framer) error) error {
+	sc.wmu.Lock()
+	defer sc.wmu.Unlock()
+	if sc.werr != nil {
+		return sc.werr
+	}
+	err := fn(sc.framer)
+	if err == nil {
+		err = sc.bw.Flush()
+	}
+	if err != nil {
+		sc.werr = err
+		sc.conn.Close()
+	}
+	return err
+}
+
+// writeHeaders HPACK-encodes fields and writes them as a HEADERS
+// frame. The encoding and the write happen under the same lock so
+// that header blocks reach the peer in encoding order.
+func (sc *http2serverConn) writeHeaders(streamID uint32, endStream bool, fields []hpack.HeaderField) error {
+	sc.mu.Lock()
+	maxFrame := sc.peerMaxFrameSize
+	sc.mu.Unlock()
+	return sc.writeFrame(func(fr *http2Framer) error {
+		block := http2encodeHeaders(sc.henc, &sc.hbuf, fields)
+		return fr.WriteHeaders(streamID, endStream, block, maxFrame)
+	})
+}
+
+func (sc *http2serverConn) goAway(code http2ErrCode) {
+	sc.mu.Lock()
+	if sc.goAwaySent {
+		sc.mu.Unlock()
+		return
+	}
+	sc.goAwaySent = true
+	last := sc.maxClientStreamID
+	sc.mu.Unlock()
+	sc.writeFrame(func(fr *http2Framer) error {
+		return fr.WriteGoAway(last, code, nil)
+	})
+}
+
+func (sc *http2serverConn) processFrame(f http2Frame) error {
+	switch f := f.(type) {
+	case *http2SettingsFrame:
+		return sc.processSettings(f)
+	case *http2HeadersFrame:
+		return sc.processHeaders(f)
+	case *http2DataFrame:
+		return sc.processData(f)
+	case *http2WindowUpdateFrame:
+		return sc.processWindowUpdate(f)
+	case *http2PingFrame:
+		if f.IsAck() {
+			return nil
+		}
+		return sc.writeFrame(func(fr *http2Framer) error {
+			return fr.WritePing(true, f.Data)
+		})
+	case *http2RSTStreamFrame:
+		sc.mu.Lock()
+		st := sc.streams[f.StreamID]
+		idle := st == nil && f.StreamID > sc.maxClientStreamID && f.StreamID%2 == 1
+		sc.mu.Unlock()
+		if idle {
+			return http2ConnectionError(http2ErrCodeProtocol)
+		}
+		if st != nil {
+			sc.closeStream(st, http2errStreamClosed)
+		}
+		return nil
+	case *http2GoAwayFrame:
+		sc.mu.Lock()
+		sc.goAwaySent = true // no new streams either way
+		sc.mu.Unlock()
+		return nil
+	case *http2PushPromiseFrame:
+		// Clients must not push.
+		return http2ConnectionError(http2ErrCodeProtocol)
+	}
+	// PRIORITY and unknown frames are ignored.
+	return nil
+}
+
+func (sc *http2serverConn) processSettings(f *http2SettingsFrame) error {
+	if f.IsAck() {
+		return nil
+	}
+	sc.mu.Lock()
+	for _, s := range f.Settings {
+		switch s.ID {
+		case http2SettingHeaderTableSize:
+			sc.wmu.Lock()
+			sc.henc.SetMaxDynamicTableSize(s.Val)
+			sc.wmu.Unlock()
+		case http2SettingEnablePush:
+			sc.pushEnabled = s.Val != 0
+		case http2SettingMaxConcurrentStreams:
+			sc.peerMaxStreams = s.Val
+		case http2SettingInitialWindowSize:
+			// Adjust the send window of every stream by the
+			// difference; windows may become negative.
+			growth := int32(s.Val) - sc.initialWindowSize
+			sc.initialWindowSize = int32(s.Val)
+			for _, st := range sc.streams {
+				if !st.flow.add(growth) {
+					sc.mu.Unlock()
+					return http2ConnectionError(http2ErrCodeFlowControl)
+				}
+			}
+		case http2SettingMaxFrameSize:
+			sc.peerMaxFrameSize = s.Val
+		}
+	}
+	sc.cond.Broadcast()
+	sc.mu.Unlock()
+	return sc.writeFrame(func(fr *http2Framer) error {
+		return fr.WriteSettingsAck()
+	})
+}
+
+func (sc *http2serverConn) processWindowUpdate(f *http2WindowUpdateFrame) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	defer sc.cond.Broadcast()
+	if f.StreamID == 0 {
+		if !sc.flow.add(int32(f.Increment)) {
+			return http2ConnectionError(http2ErrCodeFlowControl)
+		}
+		return nil
+	}
+	st := sc.streams[f.StreamID]
+	if st == nil {
+		// Updates may arrive for streams we just closed.
+		return nil
+	}
+	if !st.flow.add(int32(f.Increment)) {
+		return http2StreamError{f.StreamID, http2ErrCodeFlowControl}
+	}
+	return nil
+}
+
+func (sc *http2serverConn) processData(f *http2DataFrame) error {
+	id := f.StreamID
+	sc.mu.Lock()
+	// The whole frame, padding included, counts against the
+	// connection's flow control window.
+	n := int32(f.Length)
+	if n > sc.inflow {
+		sc.mu.Unlock()
+		return http2ConnectionError(http2ErrCodeFlowControl)
+	}
+	sc.inflow -= n
+	st := sc.streams[id]
+	if st == nil || st.remoteClosed || st.reset {
+		idle := st == nil && id > sc.maxClientStreamID
+		sc.inflow += n
+		sc.mu.Unlock()
+		if idle {
+			return http2ConnectionError(http2ErrCodeProtocol)
+		}
+		// Return the connection-level flow for data nobody
+		// will read.
+		if n > 0 {
+			sc.writeFrame(func(fr *http2Framer) error {
+				return fr.WriteWindowUpdate(0, uint32(n))
+			})
+		}
+		return http2StreamError{id, http2ErrCodeStreamClosed}
+	}
+	if n > st.inflow {
+		sc.mu.Unlock()
+		return http2StreamError{id, http2ErrCodeFlowControl}
+	}
+	st.inflow -= n
+	st.bodyBytes += int64(len(f.Data))
+	if st.declBodyBytes != -1 && st.bodyBytes > st.declBodyBytes {
+		sc.mu.Unlock()
+		return http2StreamError{id, http2ErrCodeProtocol}
+	}
+	if f.StreamEnded() {
+		if st.declBodyBytes != -1 && st.bodyBytes != st.declBodyBytes {
+			sc.mu.Unlock()
+			return http2StreamError{id, http2ErrCodeProtocol}
+		}
+		st.remoteClosed = true
+	}
+	done := st.remoteClosed && st.localClosed
+	sc.mu.Unlock()
+
+	if len(f.Data) > 0 {
+		if _, err := st.body.Write(f.Data); err != nil {
+			// The handler closed the body; the data
+			// is discarded, so give the flow back.
+			sc.sendWindowUpdate(st, int32(len(f.Data)))
+		}
+	}
+	if pad := n - int32(len(f.Data)); pad > 0 {
+		sc.sendWindowUpdate(st, pad)
+	}
+	if f.StreamEnded() {
+		st.body.CloseWithError(io.EOF)
+		if done {
+			sc.closeStream(st, nil)
+		}
+	}
+	return nil
+}
+
+// sendWindowUpdate returns n bytes of receive window to the peer, for
+// the connection and, while the peer may still send on it, st.
+func (sc *http2serverConn) sendWindowUpdate(st *http2stream, n int32) {
+	if n <= 0 {
+		return
+	}
+	sc.mu.Lock()
+	sc.inflow += n
+	streamOpen := st != nil && !st.remoteClosed && !st.reset
+	if streamOpen {
+		st.inflow += n
+	}
+	sc.mu.Unlock()
+	sc.writeFrame(func(fr *http2Framer) error {
+		if err := fr.WriteWindowUpdate(0, uint32(n)); err != nil {
+			return err
+		}
+		if streamOpen {
+			return fr.WriteWindowUpdate(st.id, uint32(n))
+		}
+		return nil
+	})
+}
+
+func (sc *http2serverConn) processHeaders(f *http2HeadersFrame) error {
+	id := f.StreamID
+	if id%2 != 1 {
+		return http2ConnectionError(http2ErrCodeProtocol)
+	}
+	sc.mu.Lock()
+	if st := sc.streams[id]; st != nil {
+		sc.mu.Unlock()
+		return sc.processTrailers(st, f)
+	}
+	if id <= sc.maxClientStreamID {
+		sc.mu.Unlock()
+		return http2ConnectionError(http2ErrCodeProtocol)
+	}
+	sc.maxClientStreamID = id
+	if sc.goAwaySent {
+		sc.mu.Unlock()
+		return nil
+	}
+	if sc.curClientStreams >= sc.srv.maxConcurrentStreams() {
+		sc.mu.Unlock()
+		return http2StreamError{id, http2ErrCodeRefusedStream}
+	}
+	st := sc.newStream(id)
+	st.inflow = http2serverWindowSize
+	st.remoteClosed = f.StreamEnded()
+	sc.curClientStreams++
+	sc.mu.Unlock()
+
+	rw, req, err := sc.newWriterAndRequest(st, f)
+	if err != nil {
+		return err
+	}
+	go sc.runHandler(rw, req)
+	return nil
+}
+
+// newStream registers a new stream. sc.mu must be held.
+func (sc *http2serverConn) newStream(id uint32) *http2stream {
+	st := &http2stream{
+		sc:            sc,
+		id:            id,
+		cw:            make(chan bool, 1),
+		declBodyBytes: -1,
+	}
+	st.flow.conn = &sc.flow
+	st.flow.add(sc.initialWindowSize)
+	sc.streams[id] = st
+	return st
+}
+
+func (sc *http2serverConn) processTrailers(st *http2stream, f *http2HeadersFrame) error {
+	sc.mu.Lock()
+	if st.remoteClosed || st.reset {
+		sc.mu.Unlock()
+		return http2StreamError{st.id, http2ErrCodeStreamClosed}
+	}
+	if !f.StreamEnded() || len(f.Fields) != len(f.RegularFields()) {
+		sc.mu.Unlock()
+		return http2StreamError{st.id, http2ErrCodeProtocol}
+	}
+	if st.declBodyBytes != -1 && st.bodyBytes != st.declBodyBytes {
+		sc.mu.Unlock()
+		return http2StreamError{st.id, http2ErrCodeProtocol}
+	}
+	for _, hf := range f.Fields {
+		key := CanonicalHeaderKey(hf.Name)
+		if _, ok := st.trailer[key]; ok {
+			st.trailer[key] = append(st.trailer[key], hf.Value)
+		}
+	}
+	st.remoteClosed = true
+	done := st.localClosed
+	sc.mu.Unlock()
+	st.body.CloseWithError(io.EOF)
+	if done {
+		sc.closeStream(st, nil)
+	}
+	return nil
+}
+
+// newWriterAndRequest builds the Request for a new stream from its
+// HEADERS frame, and the ResponseWriter for the handler.
+func (sc *http2serverConn) newWriterAndRequest(st *http2stream, f *http2HeadersFrame) (*http2responseWriter, *Request, error) {
+	method := f.PseudoValue("method")
+	path := f.PseudoValue("path")
+	scheme := f.PseudoValue("scheme")
+	authority := f.PseudoValue("authority")
+	isConnect := method == "CONNECT"
+	if isConnect {
+		if path != "" || scheme != "" || authority == "" {
+			return nil, nil, http2StreamError{f.StreamID, http2ErrCodeProtocol}
+		}
+	} else if method == "" || path == "" || (scheme != "https" && scheme != "http") {
+		return nil, nil, http2StreamError{f.StreamID, http2ErrCodeProtocol}
+	}
+	fields := f.RegularFields()
+	if !http2validHeaderFields(fields) {
+		return nil, nil, http2StreamError{f.StreamID, http2ErrCodeProtocol}
+	}
+
+	header := make(Header)
+	var cookies []string
+	for _, hf := range fields {
+		if hf.Name == "cookie" {
+			// RFC 7540, section 8.1.2.5: cookie crumbs are
+			// concatenated back into one header.
+			cookies = append(cookies, hf.Value)
+			continue
+		}
+		header.Add(CanonicalHeaderKey(hf.Name), hf.Value)
+	}
+	if len(cookies) > 0 {
+		header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+	if authority == "" {
+		authority = header.Get("Host")
+	}
+	header.Del("Host")
+
+	req, err := sc.newRequest(st, method, scheme, authority, path, header)
+	if err != nil {
+		return nil, nil, http2StreamError{f.StreamID, http2ErrCodeProtocol}
+	}
+	if f.StreamEnded() {
+		req.ContentLength = 0
+		req.Body = eofReader
+	} else {
+		req.ContentLength = -1
+		if cl := header.Get("Content-Length"); cl != "" {
+			v, err := strconv.ParseInt(cl, 10, 64)
+			if err != nil || v < 0 {
+				return nil, nil, http2StreamError{f.StreamID, http2ErrCodeProtocol}
+			}
+			req.ContentLength = v
+		}
+		sc.mu.Lock()
+		st.declBodyBytes = req.ContentLength
+		sc.mu.Unlock()
+		if vv, ok := header["Trailer"]; ok {
+			st.trailer = make(Header)
+			for _, v := range vv {
+				foreachHeaderElement(v, func(key string) {
+					key = CanonicalHeaderKey(key)
+					switch key {
+					case "Transfer-Encoding", "Trailer", "Content-Length":
+						// Bogus. (copy of http1 rules)
+					default:
+						st.trailer[key] = nil
+					}
+				})
+			}
+			req.Trailer = st.trailer
+		}
+		st.body = http2newPipe()
+		st.body.onRead = func(n int) { sc.sendWindowUpdate(st, int32(n)) }
+		req.Body = &http2requestBody{st: st}
+	}
+	return sc.newResponseWriter(st, req), req, nil
+}
+
+// newRequest creates the Request for stream st. It is used both for
+// client requests and for requests synthesized by server push.
+func (sc *http2serverConn) newRequest(st *http2stream, method, scheme, authority, path string, header Header) (*Request, error) {
+	var u *url.URL
+	var requestURI string
+	if method == "CONNECT" {
+		u = &url.URL{Host: authority}
+		requestURI = authority
+	} else if path == "*" && method == "OPTIONS" {
+		u = &url.URL{Path: "*"}
+		requestURI = "*"
+	} else {
+		var err error
+		u, err = url.ParseRequestURI(path)
+		if err != nil {
+			return nil, err
+		}
+		requestURI = path
+	}
+	req := &Request{
+		Method:     method,
+		URL:        u,
+		RemoteAddr: sc.remoteAddr,
+		Header:     header,
+		RequestURI: requestURI,
+		Proto:      "HTTP/2.0",
+		ProtoMajor: 2,
+		ProtoMinor: 0,
+		TLS:        sc.tlsState,
+		Host:       authority,
+		Body:       eofReader,
+	}
+	ctx := context.WithValue(context.Background(), ServerContextKey, sc.hs)
+	ctx = context.WithValue(ctx, LocalAddrContextKey, sc.conn.LocalAddr())
+	ctx, cancel := context.WithCancel(ctx)
+	req.ctx = ctx
+	st.cancelCtx = cancel
+	return req, nil
+}
+
+func (sc *http2serverConn) newResponseWriter(st *http2stream, req *Request) *http2responseWriter {
+	rw := &http2responseWriter{
+		st:            st,
+		req:           req,
+		handlerHeader: make(Header),
+		contentLength: -1,
+	}
+	rw.bw = bufio.NewWriterSize(http2chunkWriter{rw}, http2responseBufferSize)
+	return rw
+}
+
+func (sc *http2serverConn) runHandler(rw *http2responseWriter, req *Request) {
+	didPanic := true
+	defer func() {
+		if didPanic {
+			err := recover()
+			const size = 64 << 10
+			buf := make([]byte, size)
+			buf = buf[:runtime.Stack(buf, false)]
+			sc.logf("http2: panic serving %v: %v\n%s", sc.remoteAddr, err, buf)
+			sc.resetStream(http2StreamError{rw.st.id, http2ErrCodeInternal})
+			return
+		}
+		rw.finish()
+	}()
+	sc.handler.ServeHTTP(rw, req)
+	didPanic = false
+}
+
+// resetStream sends RST_STREAM for the stream in se and closes it.
+func (sc *http2serverConn) resetStream(se http2StreamError) {
+	sc.writeFrame(func(fr *http2Framer) error {
+		return fr.WriteRSTStream(se.StreamID, se.Code)
+	})
+	sc.mu.Lock()
+	st := sc.streams[se.StreamID]
+	sc.mu.Unlock()
+	if st != nil {
+		sc.closeStream(st, se)
+	}
+}
+
+// closeStream removes st from the connection. A non-nil err means
+// the stream ended abnormally: the handler's request body and
+// context are aborted and CloseNotify fires.
+func (sc *http2serverConn) closeStream(st *http2stream, err error) {
+	sc.mu.Lock()
+	if sc.streams[st.id] != st {
+		sc.mu.Unlock()
+		return
+	}
+	delete(sc.streams, st.id)
+	if st.id%2 == 1 {
+		sc.curClientStreams--
+	} else {
+		sc.curPushStreams--
+	}
+	if err != nil {
+		st.reset = true
+	}
+	sc.cond.Broadcast()
+	sc.mu.Unlock()
+
+	if err != nil {
+		if st.body != nil {
+			st.body.CloseWithError(err)
+		}
+		select {
+		case st.cw <- true:
+		default:
+		}
+	}
+	if st.cancelCtx != nil {
+		st.cancelCtx()
+	}
+	sc.closeIfQuiescent()
+}
+
+func (sc *http2serverConn) closeAllStreams() {
+	sc.mu.Lock()
+	sc.closed = true
+	streams := make([]*http2stream, 0, len(sc.streams))
+	for _, st := range sc.streams {
+		streams = append(streams, st)
+	}
+	sc.cond.Broadcast()
+	sc.mu.Unlock()
+	for _, st := range streams {
+		sc.closeStream(st, http2errClientGone)
+	}
+}
+
+// writeData sends p as DATA frames on st, blocking as needed for
+// flow control window.
+func (sc *http2serverConn) writeData(st *http2stream, p []byte) error {
+	for len(p) > 0 {
+		sc.mu.Lock()
+		for st.flow.available() <= 0 && !st.reset && !sc.closed {
+			sc.cond.Wait()
+		}
+		if st.reset || sc.closed {
+			sc.mu.Unlock()
+			return http2errStreamClosed
+		}
+		n := st.flow.available()
+		if uint32(n) > sc.peerMaxFrameSize {
+			n = int32(sc.peerMaxFrameSize)
+		}
+		if int(n) > len(p) {
+			n = int32(len(p))
+		}
+		st.flow.take(n)
+		sc.mu.Unlock()
+
+		chunk := p[:n]
+		p = p[n:]
+		if err := sc.writeFrame(func(fr *http2Framer) error {
+			return fr.WriteData(st.id, false, chunk)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// endStream marks the local side of st closed after its final frame
+// was written, closing the stream if the peer is done too. If the
+// handler did not consume the whole request body, the stream is
+// reset with NO_ERROR so that the client stops sending it.
+func (sc *http2serverConn) endStream(st *http2stream) {
+	sc.mu.Lock()
+	st.localClosed = true
+	remoteDone := st.remoteClosed || st.reset
+	sc.mu.Unlock()
+	if !remoteDone {
+		sc.resetStream(http2StreamError{st.id, http2ErrCodeNo})
+		return
+	}
+	sc.closeStream(st, nil)
+}
+
+// http2requestBody is the Body of a request received over HTTP/2.
+type http2requestBody struct {
+	st     *http2stream
+	closed bool
+}
+
+func (b *http2requestBody) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, http2errClosedBody
+	}
+	return b.st.body.Read(p)
+}
+
+func (b *http2requestBody) Close() error {
+	if !b.closed {
+		b.closed = true
+		// Give back the flow control of anything unread.
+		n := b.st.body.BreakWithError(http2errClosedBody)
+		b.st.sc.sendWindowUpdate(b.st, int32(n))
+	}
+	return nil
+}
+
+// http2responseWriter is the ResponseWriter of HTTP/2 handlers.
+type http2responseWriter struct {
+	st  *http2stream
+	req *Request
+	bw  *bufio.Writer // buffers Writes, then to http2chunkWriter
+
+	handlerHeader Header // what the handler sees via Header
+	snapHeader    Header // handlerHeader at WriteHeader time
+	trailers      []string
+	status        int
+	contentLength int64 // explicitly declared Content-Length, or -1
+	written       int64 // bytes the handler wrote
+	wroteHeader   bool  // WriteHeader was called (explicitly or not)
+	sentHeader    bool  // HEADERS frame was sent
+	handlerDone   bool
+}
+
+var (
+	_ CloseNotifier = (*http2responseWriter)(nil)
+	_ Flusher       = (*http2responseWriter)(nil)
+	_ Pusher        = (*http2responseWriter)(nil)
+)
+
+func (rw *http2responseWriter) Header() Header {
+	return rw.handlerHeader
+}
+
+func (rw *http2responseWriter) WriteHeader(code int) {
+	if rw.wroteHeader {
+		rw.st.sc.logf("http2: multiple response.WriteHeader calls")
+		return
+	}
+	rw.wroteHeader = true
+	rw.status = code
+	rw.snapHeader = rw.handlerHeader.clone()
+	if cl := rw.snapHeader.Get("Content-Length"); cl != "" {
+		v, err := strconv.ParseInt(cl, 10, 64)
+		if err == nil && v >= 0 {
+			rw.contentLength = v
+		} else {
+			rw.st.sc.logf("http2: invalid Content-Length of %q", cl)
+			rw.snapHeader.Del("Content-Length")
+		}
+	}
+	for _, v := range rw.snapHeader["Trailer"] {
+		foreachHeaderElement(v, rw.declareTrailer)
+	}
+}
+
+func (rw *http2responseWriter) declareTrailer(k string) {
+	k = CanonicalHeaderKey(k)
+	switch k {
+	case "Transfer-Encoding", "Content-Length", "Trailer":
+		return
+	}
+	rw.trailers = append(rw.trailers, k)
+}
+
+func (rw *http2responseWriter) bodyAllowed() bool {
+	return rw.req.Method != "HEAD" && bodyAllowedForStatus(rw.status)
+}
+
+func (rw *http2responseWriter) Write(p []byte) (int, error) {
+	return rw.write(len(p), p, "")
+}
+
+func (rw *http2responseWriter) WriteString(s string) (int, error) {
+	return rw.write(len(s), nil, s)
+}
+
+func (rw *http2responseWriter) write(lenData int, dataB []byte, dataS string) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(StatusOK)
+	}
+	if lenData == 0 {
+		return 0, nil
+	}
+	if !bodyAllowedForStatus(rw.status) {
+		return 0, ErrBodyNotAllowed
+	}
+	rw.written += int64(lenData)
+	if rw.contentLength != -1 && rw.written > rw.contentLength {
+		return 0, ErrContentLength
+	}
+	if rw.req.Method == "HEAD" {
+		// Pretend the write succeeded, as the HTTP/1 server does.
+		return lenData, nil
+	}
+	if dataB != nil {
+		return rw.bw.Write(dataB)
+	}
+	return rw.bw.WriteString(dataS)
+}
+
+// http2chunkWriter sends the buffered output of a handler: first the
+// response header, then the body as DATA frames.
+type http2chunkWriter struct{ rw *http2responseWriter }
+
+func (cw http2chunkWriter) Write(p []byte) (int, error) {
+	if err := cw.rw.writeChunk(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (rw *http2responseWriter) writeChunk(p []byte) error {
+	st := rw.st
+	sc := st.sc
+	if !rw.sentHeader {
+		rw.sentHeader = true
+		endStream := rw.handlerDone && len(p) == 0 && len(rw.trailers) == 0
+		h := rw.snapHeader
+		if rw.handlerDone && rw.contentLength == -1 && rw.bodyAllowed() {
+			// The whole body is in p.
+			h.Set("Content-Length", strconv.Itoa(len(p)))
+		}
+		if _, hasType := h["Content-Type"]; !hasType && len(p) > 0 && rw.bodyAllowed() {
+			h.Set("Content-Type", DetectContentType(p))
+		}
+		if _, hasDate := h["Date"]; !hasDate {
+			h.Set("Date", time.Now().UTC().Format(TimeFormat))
+		}
+		fields := []hpack.HeaderField{{Name: ":status", Value: strconv.Itoa(rw.status)}}
+		fields = http2appendHeaderFields(fields, h, nil)
+		if err := sc.writeHeaders(st.id, endStream, fields); err != nil {
+			return err
+		}
+		if endStream {
+			sc.endStream(st)
+			return nil
+		}
+	}
+	if len(p) == 0 {
+		return nil
+	}
+	return sc.writeData(st, p)
+}
+
+func (rw *http2responseWriter) Flush() {
+	if !rw.wroteHeader {
+		rw.WriteHeader(StatusOK)
+	}
+	if rw.bw.Buffered() > 0 {
+		rw.bw.Flush()
+	} else if !rw.sentHeader {
+		rw.writeChunk(nil)
+	}
+}
+
+// finish is called after the handler returns. It sends whatever
+// the handler left unsent and ends the stream.
+func (rw *http2responseWriter) finish() {
+	rw.handlerDone = true
+	if !rw.wroteHeader {
+		rw.WriteHeader(StatusOK)
+	}
+	if err := rw.bw.Flush(); err != nil {
+		return
+	}
+	if !rw.sentHeader {
+		if err := rw.writeChunk(nil); err != nil {
+			return
+		}
+	}
+	st := rw.st
+	sc := st.sc
+	sc.mu.Lock()
+	done := st.localClosed || st.reset
+	sc.mu.Unlock()
+	if done {
+		return
+	}
+	var err error
+	if len(rw.trailers) > 0 {
+		var fields []hpack.HeaderField
+		for _, k := range rw.trailers {
+			lk := strings.ToLower(k)
+			for _, v := range rw.handlerHeader[k] {
+				fields = append(fields, hpack.HeaderField{Name: lk, Value: v})
+			}
+		}
+		err = sc.writeHeaders(st.id, true, fields)
+	} else {
+		err = sc.writeFrame(func(fr *http2Framer) error {
+			return fr.WriteData(st.id, true, nil)
+		})
+	}
+	if err == nil {
+		sc.endStream(st)
+	}
+}
+
+func (rw *http2responseWriter) CloseNotify() <-chan bool {
+	return rw.st.cw
+}
+
+// Push implements Pusher.
+func (rw *http2responseWriter) Push(target string, opts *PushOptions) error {
+	st := rw.st
+	sc := st.sc
+	if st.id%2 == 0 {
+		return errors.New("http2: recursive push not allowed")
+	}
+	if opts == nil {
+		opts = new(PushOptions)
+	}
+	method := opts.Method
+	if method == "" {
+		method = "GET"
+	}
+	if method != "GET" && method != "HEAD" {
+		return fmt.Errorf("http2: method %q must be GET or HEAD", method)
+	}
+	wantScheme := "https"
+	if sc.tlsState == nil {
+		wantScheme = "http"
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" {
+		if !strings.HasPrefix(target, "/") {
+			return fmt.Errorf("http2: target must be an absolute URL or an absolute path: %q", target)
+		}
+		u.Scheme = wantScheme
+		u.Host = rw.req.Host
+	} else if u.Scheme != wantScheme {
+		return fmt.Errorf("http2: cannot push URL with scheme %q from request with scheme %q", u.Scheme, wantScheme)
+	}
+	if u.Host == "" {
+		return errors.New("http2: URL must have a host")
+	}
+	for k := range opts.Header {
+		if strings.HasPrefix(k, ":") || http2badHeaders[strings.ToLower(k)] {
+			return fmt.Errorf("http2: promised request headers cannot include %q", k)
+		}
+	}
+	path := u.RequestURI()
+
+	sc.mu.Lock()
+	if !sc.pushEnabled {
+		sc.mu.Unlock()
+		return ErrNotSupported
+	}
+	if st.localClosed || st.reset || sc.closed || sc.goAwaySent {
+		sc.mu.Unlock()
+		return http2errStreamClosed
+	}
+	if sc.curPushStreams+1 > sc.peerMaxStreams {
+		sc.mu.Unlock()
+		return errors.New("http2: push would exceed peer's SETTINGS_MAX_CONCURRENT_STREAMS")
+	}
+	if sc.maxPushStreamID+2 >= 1<<31 {
+		sc.mu.Unlock()
+		return errors.New("http2: push stream IDs exhausted")
+	}
+	sc.maxPushStreamID += 2
+	promised := sc.newStream(sc.maxPushStreamID)
+	promised.remoteClosed = true // half-closed (remote) once promised
+	sc.curPushStreams++
+	maxFrame := sc.peerMaxFrameSize
+	sc.mu.Unlock()
+
+	fields := []hpack.HeaderField{
+		{Name: ":method", Value: method},
+		{Name: ":scheme", Value: u.Scheme},
+		{Name: ":authority", Value: u.Host},
+		{Name: ":path", Value: path},
+	}
+	fields = http2appendHeaderFields(fields, opts.Header, nil)
+	err = sc.writeFrame(func(fr *http2Framer) error {
+		block := http2encodeHeaders(sc.henc, &sc.hbuf, fields)
+		return fr.WritePushPromise(st.id, promised.id, block, maxFrame)
+	})
+	if err != nil {
+		sc.closeStream(promised, err)
+		return err
+	}
+
+	req, err := sc.newRequest(promised, method, u.Scheme, u.Host, path, opts.Header.clone())
+	if err != nil {
+		sc.resetStream(http2StreamError{promised.id, http2ErrCodeInternal})
+		return err
+	}
+	if req.Header == nil {
+		req.Header = make(Header)
+	}
+	req.ContentLength = 0
+	go sc.runHandler(sc.newResponseWriter(promised, req), req)
+	return nil
+}
@@ -0,0 +1,499 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// End-to-end HTTP/2 tests.
+
+package http_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	. "net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newH2Server returns a TLS test server with HTTP/2 enabled.
+func newH2Server(h Handler) *httptest.Server {
+	ts := httptest.NewUnstartedServer(h)
+	ExportHTTP2ConfigureServer(ts.Config)
+	ts.TLS = ts.Config.TLSConfig
+	ts.StartTLS()
+	return ts
+}
+
+func newH2Transport() *Transport {
+	return &Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+}
+
+func TestHTTP2Get(t *testing.T) {
+	defer afterTest(t)
+	ts := newH2Server(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.ProtoMajor != 2 || r.Proto != "HTTP/2.0" {
+			t.Errorf("request proto = %q", r.Proto)
+		}
+		if r.Host == "" {
+			t.Errorf("empty Host")
+		}
+		if r.TLS == nil {
+			t.Errorf("nil TLS")
+		}
+		w.Header().Set("Foo", "Bar")
+		io.WriteString(w, "hello, "+r.URL.Query().Get("name"))
+	}))
+	defer ts.Close()
+	tr := newH2Transport()
+	defer tr.CloseIdleConnections()
+
+	res, err := (&Client{Transport: tr}).Get(ts.URL + "/?name=h2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.ProtoMajor != 2 || res.Proto != "HTTP/2.0" {
+		t.Errorf("response proto = %q", res.Proto)
+	}
+	if res.StatusCode != 200 {
+		t.Errorf("status = %d", res.StatusCode)
+	}
+	if got := res.Header.Get("Foo"); got != "Bar" {
+		t.Errorf("Foo header = %q", got)
+	}
+	if got := res.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+		t.Errorf("Content-Type = %q", got)
+	}
+	slurp, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(slurp) != "hello, h2" {
+		t.Errorf("body = %q", slurp)
+	}
+	if res.ContentLength != int64(len(slurp)) {
+		t.Errorf("ContentLength = %d; want %d", res.ContentLength, len(slurp))
+	}
+}
+
+// Tests that request and response bodies larger than the initial
+// flow control windows get through.
+func TestHTTP2LargeBodies(t *testing.T) {
+	defer afterTest(t)
+	ts := newH2Server(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+	tr := newH2Transport()
+	defer tr.CloseIdleConnections()
+
+	body := bytes.Repeat([]byte("0123456789abcdef"), 1<<16) // 1 MB
+	for _, cl := range []int64{int64(len(body)), 0} {
+		req, _ := NewRequest("POST", ts.URL, bytes.NewReader(body))
+		req.ContentLength = cl
+		res, err := tr.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, body) {
+			t.Errorf("ContentLength %d: echoed %d bytes; want %d", cl, len(got), len(body))
+		}
+	}
+}
+
+// Tests that concurrent requests share one connection.
+func TestHTTP2ConcurrentRequests(t *testing.T) {
+	defer afterTest(t)
+	var mu sync.Mutex
+	addrs := map[string]bool{}
+	ts := newH2Server(HandlerFunc(func(w ResponseWriter, r *Request) {
+		mu.Lock()
+		addrs[r.RemoteAddr] = true
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		io.WriteString(w, r.URL.Path)
+	}))
+	defer ts.Close()
+	tr := newH2Transport()
+	defer tr.CloseIdleConnections()
+
+	// Open the connection first, so all requests find it.
+	res, err := tr.RoundTrip(mustNewRequest(t, "GET", ts.URL+"/first", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path := fmt.Sprintf("/%d", i)
+			res, err := tr.RoundTrip(mustNewRequest(t, "GET", ts.URL+path, nil))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer res.Body.Close()
+			slurp, _ := ioutil.ReadAll(res.Body)
+			if string(slurp) != path {
+				t.Errorf("got body %q; want %q", slurp, path)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(addrs) != 1 {
+		t.Errorf("requests used %d connections; want 1", len(addrs))
+	}
+}
+
+func mustNewRequest(t *testing.T, method, url string, body io.Reader) *Request {
+	req, err := NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestHTTP2Trailers(t *testing.T) {
+	defer afterTest(t)
+	ts := newH2Server(HandlerFunc(func(w ResponseWriter, r *Request) {
+		slurp, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("server reading body: %v", err)
+		}
+		if got := r.Trailer.Get("Client-Trailer"); got != "c" {
+			t.Errorf("request trailer = %q; want c", got)
+		}
+		w.Header().Set("Trailer", "Server-Trailer")
+		w.Write(slurp)
+		w.Header().Set("Server-Trailer", "s")
+	}))
+	defer ts.Close()
+	tr := newH2Transport()
+	defer tr.CloseIdleConnections()
+
+	req := mustNewRequest(t, "POST", ts.URL, strings.NewReader("body"))
+	req.Trailer = Header{"Client-Trailer": {"c"}}
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	slurp, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(slurp) != "body" {
+		t.Errorf("body = %q", slurp)
+	}
+	if got := res.Trailer.Get("Server-Trailer"); got != "s" {
+		t.Errorf("response trailer = %q; want s", got)
+	}
+}
+
+func TestHTTP2ClientTrace(t *testing.T) {
+	defer afterTest(t)
+	ts := newH2Server(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+	tr := newH2Transport()
+	defer tr.CloseIdleConnections()
+
+	for i, body := range []string{"", "body"} {
+		var (
+			mu        sync.Mutex
+			gotConns  []httptrace.GotConnInfo
+			firstByte int
+		)
+		wrote := make(chan error, 2)
+		trace := &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				mu.Lock()
+				gotConns = append(gotConns, info)
+				mu.Unlock()
+			},
+			WroteRequest: func(info httptrace.WroteRequestInfo) {
+				wrote <- info.Err
+			},
+			GotFirstResponseByte: func() {
+				mu.Lock()
+				firstByte++
+				mu.Unlock()
+			},
+		}
+		var req *Request
+		if body == "" {
+			req = mustNewRequest(t, "GET", ts.URL, nil)
+		} else {
+			req = mustNewRequest(t, "POST", ts.URL, strings.NewReader(body))
+		}
+		req = req.WithContext(httptrace.WithClientTrace(context.Background(), trace))
+		res, err := tr.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		slurp, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if res.ProtoMajor != 2 {
+			t.Fatalf("request %d: proto = %q; want HTTP/2.0", i, res.Proto)
+		}
+		if string(slurp) != body {
+			t.Errorf("request %d: body = %q; want %q", i, slurp, body)
+		}
+		select {
+		case err := <-wrote:
+			if err != nil {
+				t.Errorf("request %d: WroteRequest error: %v", i, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("request %d: WroteRequest not called", i)
+		}
+
+		mu.Lock()
+		if len(gotConns) != 1 {
+			t.Errorf("request %d: GotConn called %d times; want 1", i, len(gotConns))
+		} else {
+			if gotConns[0].Conn == nil {
+				t.Errorf("request %d: GotConn got nil Conn", i)
+			}
+			if want := i > 0; gotConns[0].Reused != want {
+				t.Errorf("request %d: GotConn Reused = %v; want %v", i, gotConns[0].Reused, want)
+			}
+		}
+		if firstByte != 1 {
+			t.Errorf("request %d: GotFirstResponseByte called %d times; want 1", i, firstByte)
+		}
+		mu.Unlock()
+		if len(wrote) != 0 {
+			t.Errorf("request %d: WroteRequest called more than once", i)
+		}
+	}
+}
+
+func TestHTTP2TransportGzip(t *testing.T) {
+	defer afterTest(t)
+	const msg = "compressed hello"
+	ts := newH2Server(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if ae := r.Header.Get("Accept-Encoding"); ae != "gzip" {
+			t.Errorf("Accept-Encoding = %q; want gzip", ae)
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		io.WriteString(gz, msg)
+		gz.Close()
+	}))
+	defer ts.Close()
+	tr := newH2Transport()
+	defer tr.CloseIdleConnections()
+
+	res, err := tr.RoundTrip(mustNewRequest(t, "GET", ts.URL, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	slurp, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(slurp) != msg {
+		t.Errorf("body = %q; want %q", slurp, msg)
+	}
+}
+
+// Tests that a non-nil, empty TLSNextProto turns HTTP/2 off on
+// both sides.
+func TestHTTP2OptOut(t *testing.T) {
+	defer afterTest(t)
+	ts := newH2Server(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, r.Proto)
+	}))
+	defer ts.Close()
+	tr := newH2Transport()
+	tr.TLSNextProto = map[string]func(string, *tls.Conn) RoundTripper{}
+	defer tr.CloseIdleConnections()
+
+	res, err := tr.RoundTrip(mustNewRequest(t, "GET", ts.URL, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	slurp, _ := ioutil.ReadAll(res.Body)
+	if res.ProtoMajor != 1 || string(slurp) != "HTTP/1.1" {
+		t.Errorf("got response %q, served as %q; want HTTP/1.1", res.Proto, slurp)
+	}
+}
+
+func TestHTTP2RequestContextCanceled(t *testing.T) {
+	defer afterTest(t)
+	handlerDone := make(chan error, 1)
+	ts := newH2Server(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.(Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+			handlerDone <- nil
+		case <-time.After(5 * time.Second):
+			handlerDone <- fmt.Errorf("handler's context not canceled")
+		}
+	}))
+	defer ts.Close()
+	tr := newH2Transport()
+	defer tr.CloseIdleConnections()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := mustNewRequest(t, "GET", ts.URL, nil).WithContext(ctx)
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := ioutil.ReadAll(res.Body); err == nil {
+		t.Error("reading body after cancel: got nil error")
+	}
+	res.Body.Close()
+	if err := <-handlerDone; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHTTP2ServerPush(t *testing.T) {
+	defer afterTest(t)
+	pushed := make(chan string, 1)
+	ts := newH2Server(HandlerFunc(func(w ResponseWriter, r *Request) {
+		switch r.URL.Path {
+		case "/":
+			p, ok := w.(Pusher)
+			if !ok {
+				t.Errorf("ResponseWriter %T is not a Pusher", w)
+				return
+			}
+			if err := p.Push("/style.css", nil); err != nil {
+				t.Errorf("Push: %v", err)
+			}
+			if err := p.Push("relative.css", nil); err == nil {
+				t.Error("Push of a relative path succeeded")
+			}
+			io.WriteString(w, "index")
+		case "/style.css":
+			pushed <- r.Method
+			io.WriteString(w, "css")
+		}
+	}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	c, err := tls.Dial("tcp", u.Host, &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if p := c.ConnectionState().NegotiatedProtocol; p != "h2" {
+		t.Fatalf("negotiated %q; want h2", p)
+	}
+	promised, err := HTTP2PushPromises(c, u.Host, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(promised) != 1 || promised[0] != "/style.css" {
+		t.Errorf("promised %q; want [/style.css]", promised)
+	}
+	select {
+	case m := <-pushed:
+		if m != "GET" {
+			t.Errorf("pushed request method = %q", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("pushed request not handled")
+	}
+}
+
+// Tests that Push reports ErrNotSupported to clients, like the
+// Transport, that disable push.
+func TestHTTP2PushDisabled(t *testing.T) {
+	defer afterTest(t)
+	ts := newH2Server(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if err := w.(Pusher).Push("/x", nil); err != ErrNotSupported {
+			t.Errorf("Push error = %v; want ErrNotSupported", err)
+		}
+	}))
+	defer ts.Close()
+	tr := newH2Transport()
+	defer tr.CloseIdleConnections()
+
+	res, err := tr.RoundTrip(mustNewRequest(t, "GET", ts.URL, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+}
+
+// Tests that Shutdown sends GOAWAY on HTTP/2 connections and waits
+// for their in-flight streams.
+func TestHTTP2ServerShutdown(t *testing.T) {
+	defer afterTest(t)
+	started := make(chan bool)
+	release := make(chan bool)
+	ts := newH2Server(HandlerFunc(func(w ResponseWriter, r *Request) {
+		started <- true
+		<-release
+		io.WriteString(w, "done")
+	}))
+	defer ts.Close()
+	tr := newH2Transport()
+	defer tr.CloseIdleConnections()
+
+	resc := make(chan string, 1)
+	go func() {
+		res, err := tr.RoundTrip(mustNewRequest(t, "GET", ts.URL, nil))
+		if err != nil {
+			resc <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		slurp, _ := ioutil.ReadAll(res.Body)
+		resc <- res.Proto + " " + string(slurp)
+	}()
+	<-started
+	shutdownDone := make(chan error, 1)
+	go func() { shutdownDone <- ts.Config.Shutdown(context.Background()) }()
+	select {
+	case err := <-shutdownDone:
+		t.Fatalf("Shutdown returned with a stream in flight: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(release)
+	if got := <-resc; got != "HTTP/2.0 done" {
+		t.Errorf("in-flight request got %q", got)
+	}
+	select {
+	case err := <-shutdownDone:
+		if err != nil {
+			t.Errorf("Shutdown = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not return after the stream finished")
+	}
+}
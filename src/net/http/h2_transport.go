@@ -0,0 +1,890 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP/2 client. See RFC 7540.
+
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http/httptrace"
+	"net/http/internal/hpack"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// http2transportStreamWindow is the receive window the client
+	// advertises for each stream.
+	http2transportStreamWindow = 4 << 20
+
+	// http2transportConnWindow is the receive window the client
+	// advertises for the connection as a whole.
+	http2transportConnWindow = 1 << 30
+
+	// http2transportDefaultMaxStreams is the number of concurrent
+	// streams assumed until the server's SETTINGS say otherwise.
+	http2transportDefaultMaxStreams = 100
+)
+
+var (
+	// http2errClientConnUnusable is returned by RoundTrip when the
+	// connection can no longer start new streams. No part of the
+	// request was sent, so the Transport retries on another
+	// connection.
+	http2errClientConnUnusable = errors.New("http2: client conn not usable")
+
+	http2errRequestCanceled = errors.New("net/http: request canceled")
+	http2errStreamReset     = errors.New("http2: stream reset by server")
+)
+
+// http2ClientConn is a client connection to an HTTP/2 server. It is
+// a RoundTripper for requests to the host it is connected to and
+// carries any number of them concurrently, up to the server's limit.
+type http2ClientConn struct {
+	t        *Transport
+	tconn    *tls.Conn
+	tlsState *tls.ConnectionState
+	framer   *http2Framer
+
+	wmu  sync.Mutex // guards the following, used by all writers
+	bw   *bufio.Writer
+	henc *hpack.Encoder
+	hbuf bytes.Buffer
+	werr error
+
+	mu                   sync.Mutex // guards the following
+	cond                 sync.Cond  // on mu; signaled on flow and stream changes
+	streams              map[uint32]*http2clientStream
+	streamsReserved      int // RoundTrips between waiting for a slot and opening a stream
+	nextStreamID         uint32
+	flow                 http2flow // connection-level send window
+	inflow               int32     // connection-level receive window remaining
+	initialWindowSize    int32     // peer's SETTINGS_INITIAL_WINDOW_SIZE
+	maxConcurrentStreams uint32
+	peerMaxFrameSize     uint32
+	goAway               *http2GoAwayFrame // if non-nil, no new streams
+	closed               bool
+}
+
+// http2clientStream is one request/response exchange on an
+// http2ClientConn.
+type http2clientStream struct {
+	cc            *http2ClientConn
+	req           *Request
+	trace         *httptrace.ClientTrace // optional
+	id            uint32
+	requestedGzip bool
+
+	resc chan responseAndError // receives the response headers or an error
+	done chan struct{}         // closed when the stream is removed from cc.streams
+	body *http2pipe            // response body
+
+	// The following are guarded by cc.mu.
+	flow         http2flow // send window
+	inflow       int32     // receive window remaining
+	aborted      bool
+	remoteClosed bool // END_STREAM received
+
+	// The following are only used by the read loop.
+	gotHeaders  bool // any HEADERS received, including 1xx
+	pastHeaders bool
+	resp        *Response
+}
+
+// http2newClientConn starts an HTTP/2 connection over c, on which
+// ALPN has already negotiated "h2".
+func (t *Transport) http2newClientConn(c *tls.Conn) (*http2ClientConn, error) {
+	cc := &http2ClientConn{
+		t:                    t,
+		tconn:                c,
+		bw:                   bufio.NewWriterSize(c, 4<<10),
+		streams:              make(map[uint32]*http2clientStream),
+		nextStreamID:         1,
+		inflow:               http2transportConnWindow,
+		initialWindowSize:    http2initialWindowSize,
+		maxConcurrentStreams: http2transportDefaultMaxStreams,
+		peerMaxFrameSize:     http2initialMaxFrameSize,
+	}
+	cc.cond.L = &cc.mu
+	cc.flow.add(http2initialWindowSize)
+	cc.henc = hpack.NewEncoder(&cc.hbuf)
+	cc.framer = http2newFramer(cc.bw, c)
+	cs := c.ConnectionState()
+	cc.tlsState = &cs
+
+	err := cc.writeFrame(func(fr *http2Framer) error {
+		if _, err := cc.bw.WriteString(http2ClientPreface); err != nil {
+			return err
+		}
+		err := fr.WriteSettings(
+			http2Setting{http2SettingEnablePush, 0},
+			http2Setting{http2SettingInitialWindowSize, http2transportStreamWindow},
+		)
+		if err != nil {
+			return err
+		}
+		return fr.WriteWindowUpdate(0, http2transportConnWindow-http2initialWindowSize)
+	})
+	if err != nil {
+		return nil, err
+	}
+	go cc.readLoop()
+	return cc, nil
+}
+
+// writeFrame calls fn with the framer while holding the write lock,
+// then flushes. After a write error the connection is closed and all
+// further writes fail.
+func (cc *http2ClientConn) writeFrame(fn func(*http2Framer) error) error {
+	cc.wmu.Lock()
+	defer cc.wmu.Unlock()
+	if cc.werr != nil {
+		return cc.werr
+	}
+	err := fn(cc.framer)
+	if err == nil {
+		err = cc.bw.Flush()
+	}
+	if err != nil {
+		cc.werr = err
+		cc.tconn.Close()
+	}
+	return err
+}
+
+// canTakeNewRequest reports whether the connection can start
+// another stream.
+func (cc *http2ClientConn) canTakeNewRequest() bool {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.usableLocked()
+}
+
+func (cc *http2ClientConn) usableLocked() bool {
+	return !cc.closed && cc.goAway == nil && cc.nextStreamID < 1<<31
+}
+
+// closeIfIdle closes the connection if it has no active streams and
+// reports whether it did.
+func (cc *http2ClientConn) closeIfIdle() bool {
+	cc.mu.Lock()
+	if len(cc.streams) > 0 {
+		cc.mu.Unlock()
+		return false
+	}
+	cc.closed = true
+	cc.cond.Broadcast()
+	cc.mu.Unlock()
+	cc.tconn.Close()
+	return true
+}
+
+// RoundTrip sends req on a new stream and waits for the response
+// headers.
+func (cc *http2ClientConn) RoundTrip(req *Request) (*Response, error) {
+	ctx := req.Context()
+
+	// Wait for a free stream slot, then write the HEADERS while
+	// holding wmu, so that stream IDs reach the server in
+	// increasing order.
+	cc.mu.Lock()
+	for cc.usableLocked() && len(cc.streams)+cc.streamsReserved >= int(cc.maxConcurrentStreams) {
+		cc.cond.Wait()
+	}
+	if !cc.usableLocked() {
+		cc.mu.Unlock()
+		return nil, http2errClientConnUnusable
+	}
+	cc.streamsReserved++
+	cc.mu.Unlock()
+
+	cc.wmu.Lock()
+	cc.mu.Lock()
+	cc.streamsReserved--
+	if !cc.usableLocked() {
+		cc.cond.Broadcast()
+		cc.mu.Unlock()
+		cc.wmu.Unlock()
+		return nil, http2errClientConnUnusable
+	}
+	cs := &http2clientStream{
+		cc:     cc,
+		req:    req,
+		trace:  httptrace.ContextClientTrace(ctx),
+		id:     cc.nextStreamID,
+		resc:   make(chan responseAndError, 1),
+		done:   make(chan struct{}),
+		inflow: http2transportStreamWindow,
+	}
+	cs.flow.conn = &cc.flow
+	cs.flow.add(cc.initialWindowSize)
+	cc.nextStreamID += 2
+	cc.streams[cs.id] = cs
+	maxFrame := cc.peerMaxFrameSize
+	cc.mu.Unlock()
+
+	hasBody := req.Body != nil
+	var fields []hpack.HeaderField
+	fields, cs.requestedGzip = cc.requestHeaders(req, hasBody)
+	err := cc.werr
+	if err == nil {
+		block := http2encodeHeaders(cc.henc, &cc.hbuf, fields)
+		err = cc.framer.WriteHeaders(cs.id, !hasBody, block, maxFrame)
+		if err == nil {
+			err = cc.bw.Flush()
+		}
+		if err != nil {
+			cc.werr = err
+			cc.tconn.Close()
+		}
+	}
+	cc.wmu.Unlock()
+	if err != nil || !hasBody {
+		cs.wroteRequest(err)
+	}
+	if err != nil {
+		cc.forgetStream(cs)
+		req.closeBody()
+		return nil, err
+	}
+
+	cc.t.setReqCanceler(req, func() { cs.cancel(http2errRequestCanceled) })
+	if hasBody {
+		go cs.writeRequestBody()
+	}
+
+	var respHeaderTimer <-chan time.Time
+	if d := cc.t.ResponseHeaderTimeout; d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		respHeaderTimer = timer.C
+	}
+	select {
+	case re := <-cs.resc:
+		if re.err != nil {
+			cc.t.setReqCanceler(req, nil)
+			return nil, re.err
+		}
+		if ctx.Done() != nil {
+			// Keep honoring the context while the body is read.
+			go func() {
+				select {
+				case <-ctx.Done():
+					cs.cancel(ctx.Err())
+				case <-cs.done:
+				}
+			}()
+		}
+		return re.res, nil
+	case <-ctx.Done():
+		cs.cancel(ctx.Err())
+		cc.t.setReqCanceler(req, nil)
+		return nil, ctx.Err()
+	case <-respHeaderTimer:
+		cs.cancel(errTimeout)
+		cc.t.setReqCanceler(req, nil)
+		return nil, errTimeout
+	}
+}
+
+// requestHeaders returns the header fields for req and whether the
+// client asked for a gzip response on the caller's behalf.
+func (cc *http2ClientConn) requestHeaders(req *Request, hasBody bool) (fields []hpack.HeaderField, requestedGzip bool) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	path := req.URL.RequestURI()
+	fields = []hpack.HeaderField{
+		{Name: ":authority", Value: host},
+		{Name: ":method", Value: req.Method},
+		{Name: ":path", Value: path},
+		{Name: ":scheme", Value: "https"},
+	}
+	if req.Method == "" {
+		fields[1].Value = "GET"
+	}
+	skip := map[string]bool{
+		"host":           true,
+		"content-length": true,
+		"trailer":        true,
+		"user-agent":     true,
+	}
+	fields = http2appendHeaderFields(fields, req.Header, skip)
+
+	var trailers []string
+	for k := range req.Trailer {
+		k = CanonicalHeaderKey(k)
+		switch k {
+		case "Transfer-Encoding", "Trailer", "Content-Length":
+			// Bogus. (copy of http1 rules)
+		default:
+			trailers = append(trailers, strings.ToLower(k))
+		}
+	}
+	if len(trailers) > 0 {
+		fields = append(fields, hpack.HeaderField{Name: "trailer", Value: strings.Join(trailers, ",")})
+	}
+	if hasBody && req.ContentLength > 0 {
+		fields = append(fields, hpack.HeaderField{Name: "content-length", Value: strconv.FormatInt(req.ContentLength, 10)})
+	}
+	userAgent := defaultUserAgent
+	if _, ok := req.Header["User-Agent"]; ok {
+		userAgent = req.Header.Get("User-Agent")
+	}
+	if userAgent != "" {
+		fields = append(fields, hpack.HeaderField{Name: "user-agent", Value: userAgent})
+	}
+	// Same rules as the HTTP/1 transport; see persistConn.roundTrip.
+	if !cc.t.DisableCompression &&
+		req.Header.Get("Accept-Encoding") == "" &&
+		req.Header.Get("Range") == "" &&
+		req.Method != "HEAD" {
+		requestedGzip = true
+		fields = append(fields, hpack.HeaderField{Name: "accept-encoding", Value: "gzip"})
+	}
+	return fields, requestedGzip
+}
+
+// writeRequestBody sends the request body as DATA frames, followed by
+// the request trailers if any, and then closes the body.
+func (cs *http2clientStream) writeRequestBody() {
+	cc := cs.cc
+	req := cs.req
+	defer req.closeBody()
+
+	buf := make([]byte, http2initialMaxFrameSize)
+	var sawEOF bool
+	for !sawEOF {
+		n, err := req.Body.Read(buf)
+		if err == io.EOF {
+			sawEOF = true
+		} else if err != nil {
+			cs.reset(http2ErrCodeCancel, err)
+			cs.wroteRequest(err)
+			return
+		}
+		if err := cs.writeData(buf[:n]); err != nil {
+			cs.wroteRequest(err)
+			return
+		}
+	}
+
+	var err error
+	if len(req.Trailer) > 0 {
+		var fields []hpack.HeaderField
+		for k, vv := range req.Trailer {
+			lk := strings.ToLower(k)
+			for _, v := range vv {
+				fields = append(fields, hpack.HeaderField{Name: lk, Value: v})
+			}
+		}
+		cc.mu.Lock()
+		maxFrame := cc.peerMaxFrameSize
+		cc.mu.Unlock()
+		err = cc.writeFrame(func(fr *http2Framer) error {
+			block := http2encodeHeaders(cc.henc, &cc.hbuf, fields)
+			return fr.WriteHeaders(cs.id, true, block, maxFrame)
+		})
+	} else {
+		err = cc.writeFrame(func(fr *http2Framer) error {
+			return fr.WriteData(cs.id, true, nil)
+		})
+	}
+	if err != nil {
+		cs.abortStream(err)
+	}
+	cs.wroteRequest(err)
+}
+
+// wroteRequest calls the WroteRequest trace hook, if any, once the
+// request headers and body have been written or writing them failed.
+func (cs *http2clientStream) wroteRequest(err error) {
+	if cs.trace != nil && cs.trace.WroteRequest != nil {
+		cs.trace.WroteRequest(httptrace.WroteRequestInfo{Err: err})
+	}
+}
+
+// writeData sends p on the stream, blocking as needed for flow
+// control window.
+func (cs *http2clientStream) writeData(p []byte) error {
+	cc := cs.cc
+	for len(p) > 0 {
+		cc.mu.Lock()
+		for cs.flow.available() <= 0 && !cs.aborted && !cc.closed {
+			cc.cond.Wait()
+		}
+		if cs.aborted || cc.closed {
+			cc.mu.Unlock()
+			return http2errStreamClosed
+		}
+		n := cs.flow.available()
+		if uint32(n) > cc.peerMaxFrameSize {
+			n = int32(cc.peerMaxFrameSize)
+		}
+		if int(n) > len(p) {
+			n = int32(len(p))
+		}
+		cs.flow.take(n)
+		cc.mu.Unlock()
+
+		chunk := p[:n]
+		p = p[n:]
+		if err := cc.writeFrame(func(fr *http2Framer) error {
+			return fr.WriteData(cs.id, false, chunk)
+		}); err != nil {
+			cs.abortStream(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// cancel resets the stream on behalf of the caller, failing the
+// request or its response body with err.
+func (cs *http2clientStream) cancel(err error) {
+	cs.reset(http2ErrCodeCancel, err)
+}
+
+// reset sends RST_STREAM with code and aborts the stream with err.
+func (cs *http2clientStream) reset(code http2ErrCode, err error) {
+	if !cs.abortStream(err) {
+		return
+	}
+	cs.cc.writeFrame(func(fr *http2Framer) error {
+		return fr.WriteRSTStream(cs.id, code)
+	})
+}
+
+// abortStream ends the stream abnormally: the pending RoundTrip or
+// the response body reader gets err. It reports whether the stream
+// was still active.
+func (cs *http2clientStream) abortStream(err error) bool {
+	cc := cs.cc
+	cc.mu.Lock()
+	if cs.aborted || cc.streams[cs.id] != cs {
+		cc.mu.Unlock()
+		return false
+	}
+	cs.aborted = true
+	delete(cc.streams, cs.id)
+	close(cs.done)
+	cc.cond.Broadcast()
+	cc.mu.Unlock()
+
+	select {
+	case cs.resc <- responseAndError{err: err}:
+	default:
+	}
+	if cs.body != nil {
+		n := cs.body.BreakWithError(err)
+		cc.sendWindowUpdate(nil, int32(n))
+	}
+	return true
+}
+
+// forgetStream removes a stream that ended normally.
+func (cc *http2ClientConn) forgetStream(cs *http2clientStream) {
+	cc.mu.Lock()
+	if cc.streams[cs.id] == cs {
+		delete(cc.streams, cs.id)
+		close(cs.done)
+	}
+	cc.cond.Broadcast()
+	cc.mu.Unlock()
+}
+
+// sendWindowUpdate returns n bytes of receive window to the server,
+// for the connection and, while it may still send on it, cs.
+func (cc *http2ClientConn) sendWindowUpdate(cs *http2clientStream, n int32) {
+	if n <= 0 {
+		return
+	}
+	cc.mu.Lock()
+	cc.inflow += n
+	streamOpen := cs != nil && !cs.remoteClosed && !cs.aborted
+	if streamOpen {
+		cs.inflow += n
+	}
+	cc.mu.Unlock()
+	cc.writeFrame(func(fr *http2Framer) error {
+		if err := fr.WriteWindowUpdate(0, uint32(n)); err != nil {
+			return err
+		}
+		if streamOpen {
+			return fr.WriteWindowUpdate(cs.id, uint32(n))
+		}
+		return nil
+	})
+}
+
+func (cc *http2ClientConn) readLoop() {
+	var err error
+	for {
+		var f http2Frame
+		f, err = cc.framer.ReadFrame()
+		if err == nil {
+			err = cc.processFrame(f)
+		}
+		if se, ok := err.(http2StreamError); ok {
+			cc.mu.Lock()
+			cs := cc.streams[se.StreamID]
+			cc.mu.Unlock()
+			if cs != nil {
+				cs.reset(se.Code, se)
+			}
+			continue
+		}
+		if err != nil {
+			break
+		}
+	}
+	if ce, ok := err.(http2ConnectionError); ok {
+		cc.writeFrame(func(fr *http2Framer) error {
+			return fr.WriteGoAway(0, http2ErrCode(ce), nil)
+		})
+	}
+	cc.closeWithError(err)
+}
+
+// closeWithError closes the connection, failing every active stream
+// with err.
+func (cc *http2ClientConn) closeWithError(err error) {
+	cc.mu.Lock()
+	cc.closed = true
+	if cc.goAway != nil {
+		err = http2GoAwayError{
+			LastStreamID: cc.goAway.LastStreamID,
+			Code:         cc.goAway.ErrCode,
+			DebugData:    string(cc.goAway.DebugData),
+		}
+	}
+	var streams []*http2clientStream
+	for _, cs := range cc.streams {
+		streams = append(streams, cs)
+	}
+	cc.cond.Broadcast()
+	cc.mu.Unlock()
+	cc.tconn.Close()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	for _, cs := range streams {
+		cs.abortStream(err)
+	}
+}
+
+func (cc *http2ClientConn) processFrame(f http2Frame) error {
+	switch f := f.(type) {
+	case *http2SettingsFrame:
+		return cc.processSettings(f)
+	case *http2HeadersFrame:
+		return cc.processHeaders(f)
+	case *http2DataFrame:
+		return cc.processData(f)
+	case *http2WindowUpdateFrame:
+		cc.mu.Lock()
+		defer cc.mu.Unlock()
+		defer cc.cond.Broadcast()
+		if f.StreamID == 0 {
+			if !cc.flow.add(int32(f.Increment)) {
+				return http2ConnectionError(http2ErrCodeFlowControl)
+			}
+			return nil
+		}
+		if cs := cc.streams[f.StreamID]; cs != nil && !cs.flow.add(int32(f.Increment)) {
+			return http2StreamError{f.StreamID, http2ErrCodeFlowControl}
+		}
+		return nil
+	case *http2PingFrame:
+		if f.IsAck() {
+			return nil
+		}
+		return cc.writeFrame(func(fr *http2Framer) error {
+			return fr.WritePing(true, f.Data)
+		})
+	case *http2RSTStreamFrame:
+		cc.mu.Lock()
+		cs := cc.streams[f.StreamID]
+		cc.mu.Unlock()
+		if cs != nil {
+			err := http2errStreamReset
+			if f.ErrCode != http2ErrCodeNo {
+				err = http2StreamError{f.StreamID, f.ErrCode}
+			}
+			cs.abortStream(err)
+		}
+		return nil
+	case *http2GoAwayFrame:
+		// The frame's buffer is reused by the next ReadFrame.
+		ga := *f
+		ga.DebugData = append([]byte(nil), f.DebugData...)
+		cc.mu.Lock()
+		cc.goAway = &ga
+		var refused []*http2clientStream
+		for id, cs := range cc.streams {
+			if id > f.LastStreamID {
+				refused = append(refused, cs)
+			}
+		}
+		cc.cond.Broadcast()
+		cc.mu.Unlock()
+		for _, cs := range refused {
+			cs.abortStream(http2GoAwayError{
+				LastStreamID: f.LastStreamID,
+				Code:         f.ErrCode,
+				DebugData:    string(f.DebugData),
+			})
+		}
+		return nil
+	case *http2PushPromiseFrame:
+		// SETTINGS_ENABLE_PUSH is 0.
+		return http2ConnectionError(http2ErrCodeProtocol)
+	}
+	// PRIORITY and unknown frames are ignored.
+	return nil
+}
+
+func (cc *http2ClientConn) processSettings(f *http2SettingsFrame) error {
+	if f.IsAck() {
+		return nil
+	}
+	var tableSize uint32
+	var setTableSize bool
+	cc.mu.Lock()
+	for _, s := range f.Settings {
+		switch s.ID {
+		case http2SettingHeaderTableSize:
+			tableSize, setTableSize = s.Val, true
+		case http2SettingMaxConcurrentStreams:
+			cc.maxConcurrentStreams = s.Val
+		case http2SettingInitialWindowSize:
+			growth := int32(s.Val) - cc.initialWindowSize
+			cc.initialWindowSize = int32(s.Val)
+			for _, cs := range cc.streams {
+				if !cs.flow.add(growth) {
+					cc.mu.Unlock()
+					return http2ConnectionError(http2ErrCodeFlowControl)
+				}
+			}
+		case http2SettingMaxFrameSize:
+			cc.peerMaxFrameSize = s.Val
+		}
+	}
+	cc.cond.Broadcast()
+	cc.mu.Unlock()
+	return cc.writeFrame(func(fr *http2Framer) error {
+		if setTableSize {
+			cc.henc.SetMaxDynamicTableSize(tableSize)
+		}
+		return fr.WriteSettingsAck()
+	})
+}
+
+func (cc *http2ClientConn) processHeaders(f *http2HeadersFrame) error {
+	cc.mu.Lock()
+	cs := cc.streams[f.StreamID]
+	if cs == nil && f.StreamID >= cc.nextStreamID {
+		cc.mu.Unlock()
+		return http2ConnectionError(http2ErrCodeProtocol)
+	}
+	cc.mu.Unlock()
+	if cs == nil {
+		// A stream we have already reset.
+		return nil
+	}
+	if cs.pastHeaders {
+		return cc.processTrailers(cs, f)
+	}
+	if !cs.gotHeaders {
+		cs.gotHeaders = true
+		if cs.trace != nil && cs.trace.GotFirstResponseByte != nil {
+			cs.trace.GotFirstResponseByte()
+		}
+	}
+
+	status := f.PseudoValue("status")
+	code, err := strconv.Atoi(status)
+	if status == "" || err != nil {
+		return http2StreamError{f.StreamID, http2ErrCodeProtocol}
+	}
+	if code >= 100 && code <= 199 {
+		// Informational responses, such as 100 Continue, are
+		// skipped.
+		return nil
+	}
+	fields := f.RegularFields()
+	if !http2validHeaderFields(fields) {
+		return http2StreamError{f.StreamID, http2ErrCodeProtocol}
+	}
+	cs.pastHeaders = true
+
+	header := make(Header)
+	for _, hf := range fields {
+		header.Add(CanonicalHeaderKey(hf.Name), hf.Value)
+	}
+	res := &Response{
+		Status:     status + " " + StatusText(code),
+		StatusCode: code,
+		Proto:      "HTTP/2.0",
+		ProtoMajor: 2,
+		ProtoMinor: 0,
+		Header:     header,
+		Request:    cs.req,
+		TLS:        cc.tlsState,
+	}
+	if vv, ok := header["Trailer"]; ok {
+		res.Trailer = make(Header)
+		for _, v := range vv {
+			foreachHeaderElement(v, func(key string) {
+				res.Trailer[CanonicalHeaderKey(key)] = nil
+			})
+		}
+	}
+	cs.resp = res
+
+	res.ContentLength = -1
+	if cl := header.Get("Content-Length"); cl != "" {
+		if v, err := strconv.ParseInt(cl, 10, 64); err == nil && v >= 0 {
+			res.ContentLength = v
+		}
+	}
+
+	if f.StreamEnded() {
+		res.ContentLength = 0
+		res.Body = eofReader
+		cc.mu.Lock()
+		cs.remoteClosed = true
+		cc.mu.Unlock()
+		cc.forgetStream(cs)
+	} else {
+		cs.body = http2newPipe()
+		cs.body.onRead = func(n int) { cc.sendWindowUpdate(cs, int32(n)) }
+		res.Body = &http2transportResponseBody{cs: cs}
+		if cs.requestedGzip && header.Get("Content-Encoding") == "gzip" {
+			header.Del("Content-Encoding")
+			header.Del("Content-Length")
+			res.ContentLength = -1
+			res.Body = &gzipReader{body: res.Body}
+		}
+	}
+	cs.resc <- responseAndError{res: res}
+	return nil
+}
+
+func (cc *http2ClientConn) processTrailers(cs *http2clientStream, f *http2HeadersFrame) error {
+	if !f.StreamEnded() || len(f.Fields) != len(f.RegularFields()) {
+		return http2StreamError{f.StreamID, http2ErrCodeProtocol}
+	}
+	trailer := make(Header)
+	for _, hf := range f.Fields {
+		key := CanonicalHeaderKey(hf.Name)
+		trailer[key] = append(trailer[key], hf.Value)
+	}
+	cs.resp.Trailer = trailer
+	cc.endResponse(cs)
+	return nil
+}
+
+// endResponse is called when the server ends the stream normally.
+func (cc *http2ClientConn) endResponse(cs *http2clientStream) {
+	cc.mu.Lock()
+	cs.remoteClosed = true
+	cc.mu.Unlock()
+	cs.body.CloseWithError(io.EOF)
+	cc.forgetStream(cs)
+}
+
+func (cc *http2ClientConn) processData(f *http2DataFrame) error {
+	cc.mu.Lock()
+	n := int32(f.Length)
+	if n > cc.inflow {
+		cc.mu.Unlock()
+		return http2ConnectionError(http2ErrCodeFlowControl)
+	}
+	cc.inflow -= n
+	cs := cc.streams[f.StreamID]
+	if cs == nil || cs.body == nil {
+		known := f.StreamID < cc.nextStreamID
+		cc.inflow += n
+		cc.mu.Unlock()
+		if !known || cs != nil {
+			// DATA before HEADERS, or on a stream never opened.
+			return http2ConnectionError(http2ErrCodeProtocol)
+		}
+		// Data for a stream we reset; return the
+		// connection-level flow for it.
+		if n > 0 {
+			cc.writeFrame(func(fr *http2Framer) error {
+				return fr.WriteWindowUpdate(0, uint32(n))
+			})
+		}
+		return nil
+	}
+	if n > cs.inflow {
+		cc.mu.Unlock()
+		return http2StreamError{f.StreamID, http2ErrCodeFlowControl}
+	}
+	cs.inflow -= n
+	cc.mu.Unlock()
+
+	if len(f.Data) > 0 {
+		if _, err := cs.body.Write(f.Data); err != nil {
+			// The body was closed; the data is discarded.
+			cc.sendWindowUpdate(nil, int32(len(f.Data)))
+		}
+	}
+	if pad := n - int32(len(f.Data)); pad > 0 {
+		cc.sendWindowUpdate(cs, pad)
+	}
+	if f.StreamEnded() {
+		cc.endResponse(cs)
+	}
+	return nil
+}
+
+// http2transportResponseBody is the Body of a Response received over
+// HTTP/2.
+type http2transportResponseBody struct {
+	cs     *http2clientStream
+	closed bool
+}
+
+func (b *http2transportResponseBody) Read(p []byte) (n int, err error) {
+	if b.closed {
+		return 0, http2errClosedBody
+	}
+	n, err = b.cs.body.Read(p)
+	if err == io.EOF {
+		b.cs.cc.t.setReqCanceler(b.cs.req, nil)
+	}
+	return n, err
+}
+
+func (b *http2transportResponseBody) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	cs := b.cs
+	cs.cc.t.setReqCanceler(cs.req, nil)
+	cs.cc.mu.Lock()
+	done := cs.remoteClosed
+	cs.cc.mu.Unlock()
+	if !done {
+		// Tell the server to stop sending the rest.
+		cs.reset(http2ErrCodeCancel, http2errClosedBody)
+		return nil
+	}
+	n := cs.body.BreakWithError(http2errClosedBody)
+	cs.cc.sendWindowUpdate(nil, int32(n))
+	return nil
+}
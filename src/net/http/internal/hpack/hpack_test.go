@@ -0,0 +1,137 @@
+// Copyright 2014 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hpack
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(strings.Replace(s, " ", "", -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func pair(name, value string) HeaderField {
+	return HeaderField{Name: name, Value: value}
+}
+
+// Test vectors from RFC 7541, Appendix C.4: requests with Huffman coding.
+func TestDecodeRFCHuffmanRequests(t *testing.T) {
+	d := NewDecoder(4096, nil)
+	tests := []struct {
+		in   string
+		want []HeaderField
+	}{
+		{
+			"8286 8441 8cf1 e3c2 e5f2 3a6b a0ab 90f4 ff",
+			[]HeaderField{
+				pair(":method", "GET"),
+				pair(":scheme", "http"),
+				pair(":path", "/"),
+				pair(":authority", "www.example.com"),
+			},
+		},
+		{
+			"8286 84be 5886 a8eb 1064 9cbf",
+			[]HeaderField{
+				pair(":method", "GET"),
+				pair(":scheme", "http"),
+				pair(":path", "/"),
+				pair(":authority", "www.example.com"),
+				pair("cache-control", "no-cache"),
+			},
+		},
+		{
+			"8287 85bf 4088 25a8 49e9 5ba9 7d7f 8925 a849 e95b b8e8 b4bf",
+			[]HeaderField{
+				pair(":method", "GET"),
+				pair(":scheme", "https"),
+				pair(":path", "/index.html"),
+				pair(":authority", "www.example.com"),
+				pair("custom-key", "custom-value"),
+			},
+		},
+	}
+	for i, tt := range tests {
+		got, err := d.DecodeFull(mustDecodeHex(t, tt.in))
+		if err != nil {
+			t.Fatalf("%d. DecodeFull: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%d. DecodeFull = %v; want %v", i, got, tt.want)
+		}
+	}
+	if got, want := d.dynTab.table.len(), 3; got != want {
+		t.Errorf("dynamic table length = %d; want %d", got, want)
+	}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	d := NewDecoder(4096, nil)
+	blocks := [][]HeaderField{
+		{
+			pair(":method", "GET"),
+			pair(":path", "/some/long/path"),
+			pair("user-agent", "Go-http-client/2.0"),
+			{Name: "authorization", Value: "secret", Sensitive: true},
+		},
+		{
+			pair(":method", "GET"),
+			pair(":path", "/some/long/path"),
+			pair("user-agent", "Go-http-client/2.0"),
+			pair("x-custom", strings.Repeat("x", 300)),
+		},
+	}
+	for i, fields := range blocks {
+		buf.Reset()
+		for _, f := range fields {
+			if err := e.WriteField(f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := d.DecodeFull(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%d. DecodeFull: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, fields) {
+			t.Errorf("%d. round trip = %v; want %v", i, got, fields)
+		}
+	}
+}
+
+func TestHuffmanRoundTrip(t *testing.T) {
+	for _, s := range []string{"", "a", "www.example.com", "no-cache", "\x00\xff binary \x7f"} {
+		enc := AppendHuffmanString(nil, s)
+		if got, want := uint64(len(enc)), HuffmanEncodeLength(s); got != want {
+			t.Errorf("HuffmanEncodeLength(%q) = %d; encoded length %d", s, want, got)
+		}
+		dec, err := HuffmanDecodeToString(enc)
+		if err != nil {
+			t.Errorf("HuffmanDecodeToString(%q): %v", s, err)
+			continue
+		}
+		if dec != s {
+			t.Errorf("Huffman round trip = %q; want %q", dec, s)
+		}
+	}
+}
+
+func TestDecodeInvalidIndex(t *testing.T) {
+	d := NewDecoder(4096, nil)
+	// Indexed header field with index 70: beyond the static table
+	// and the empty dynamic table.
+	if _, err := d.DecodeFull([]byte{0x80 | 70}); err == nil {
+		t.Error("DecodeFull of invalid index succeeded")
+	}
+}
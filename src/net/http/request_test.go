@@ -7,6 +7,7 @@ package http_test
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -676,3 +677,28 @@ func BenchmarkReadRequestWrk(b *testing.B) {
 Host: localhost:8080
 `)
 }
+
+func TestRequestWithContext(t *testing.T) {
+	req, err := NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Context() != context.Background() {
+		t.Errorf("default Context = %v; want context.Background()", req.Context())
+	}
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "v")
+	req2 := req.WithContext(ctx)
+	if req2 == req {
+		t.Fatal("WithContext returned the same Request")
+	}
+	if req2.Context() != ctx {
+		t.Errorf("req2.Context() = %v; want %v", req2.Context(), ctx)
+	}
+	if req.Context() != context.Background() {
+		t.Error("WithContext modified the original Request")
+	}
+	if req2.URL != req.URL || req2.Method != req.Method {
+		t.Error("WithContext did not make a shallow copy")
+	}
+}
@@ -9,6 +9,7 @@ package http_test
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -1762,6 +1763,66 @@ For:
 	ts.Close()
 }
 
+func TestServerRequestContextClientGone(t *testing.T) {
+	defer afterTest(t)
+	gotReq := make(chan bool, 1)
+	sawCancel := make(chan error, 1)
+	ts := httptest.NewServer(HandlerFunc(func(rw ResponseWriter, req *Request) {
+		gotReq <- true
+		<-req.Context().Done()
+		sawCancel <- req.Context().Err()
+	}))
+	defer ts.Close()
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("error dialing: %v", err)
+	}
+	if _, err := fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: foo\r\n\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-gotReq:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for request")
+	}
+	conn.Close()
+	select {
+	case err := <-sawCancel:
+		if err != context.Canceled {
+			t.Errorf("request context Err = %v; want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for request context cancelation")
+	}
+}
+
+func TestServerRequestContextCanceledAfterServeHTTP(t *testing.T) {
+	defer afterTest(t)
+	ctxc := make(chan context.Context, 1)
+	ts := httptest.NewServer(HandlerFunc(func(rw ResponseWriter, req *Request) {
+		ctx := req.Context()
+		if srv, ok := ctx.Value(ServerContextKey).(*Server); !ok || srv == nil {
+			t.Errorf("ServerContextKey value = %v; want *Server", ctx.Value(ServerContextKey))
+		}
+		if addr, ok := ctx.Value(LocalAddrContextKey).(net.Addr); !ok || addr == nil {
+			t.Errorf("LocalAddrContextKey value = %v; want net.Addr", ctx.Value(LocalAddrContextKey))
+		}
+		ctxc <- ctx
+	}))
+	defer ts.Close()
+	res, err := Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	ctx := <-ctxc
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("request context not canceled after ServeHTTP returned")
+	}
+}
+
 func TestCloseNotifierChanLeak(t *testing.T) {
 	defer afterTest(t)
 	req := reqBytes("GET / HTTP/1.0\nHost: golang.org")
@@ -2762,6 +2823,162 @@ func TestServerKeepAliveAfterWriteError(t *testing.T) {
 	}
 }
 
+func TestServerShutdown(t *testing.T) {
+	defer afterTest(t)
+	started := make(chan bool)
+	release := make(chan bool)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		if r.URL.Path == "/slow" {
+			started <- true
+			<-release
+		}
+		io.WriteString(w, r.URL.Path)
+	}))
+	defer ts.Close()
+	var hookRan int32
+	ts.Config.RegisterOnShutdown(func() { atomic.StoreInt32(&hookRan, 1) })
+
+	// An idle keep-alive connection, which Shutdown should close.
+	tr := &Transport{}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+	res, err := c.Get(ts.URL + "/fast")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	slowDone := make(chan error, 1)
+	go func() {
+		res, err := Get(ts.URL + "/slow")
+		if err == nil {
+			var slurp []byte
+			slurp, err = ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			if err == nil && string(slurp) != "/slow" {
+				err = fmt.Errorf("body = %q", slurp)
+			}
+		}
+		slowDone <- err
+	}()
+	<-started
+
+	shutdownDone := make(chan error, 1)
+	go func() { shutdownDone <- ts.Config.Shutdown(context.Background()) }()
+	select {
+	case err := <-shutdownDone:
+		t.Fatalf("Shutdown returned with a request in flight: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if atomic.LoadInt32(&hookRan) == 0 {
+		t.Error("RegisterOnShutdown function not called")
+	}
+	close(release)
+	if err := <-slowDone; err != nil {
+		t.Errorf("in-flight request: %v", err)
+	}
+	select {
+	case err := <-shutdownDone:
+		if err != nil {
+			t.Errorf("Shutdown = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not return after the request finished")
+	}
+	if _, err := Get(ts.URL + "/after"); err == nil {
+		t.Error("request after Shutdown succeeded")
+	}
+}
+
+func TestServerShutdownContextExpired(t *testing.T) {
+	defer afterTest(t)
+	started := make(chan bool)
+	release := make(chan bool)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		started <- true
+		<-release
+	}))
+	defer ts.Close()
+	go func() {
+		res, err := Get(ts.URL)
+		if err == nil {
+			res.Body.Close()
+		}
+	}()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := ts.Config.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown = %v; want context.DeadlineExceeded", err)
+	}
+	close(release)
+}
+
+func TestServerClose(t *testing.T) {
+	defer afterTest(t)
+	started := make(chan bool)
+	release := make(chan bool)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		started <- true
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+	errc := make(chan error, 1)
+	go func() {
+		res, err := Get(ts.URL)
+		if err == nil {
+			res.Body.Close()
+		}
+		errc <- err
+	}()
+	<-started
+	if err := ts.Config.Close(); err != nil {
+		t.Fatalf("Close = %v", err)
+	}
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("in-flight request succeeded after Close")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("in-flight request not interrupted by Close")
+	}
+}
+
+func TestServerServeAfterShutdown(t *testing.T) {
+	defer afterTest(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{Handler: HandlerFunc(func(w ResponseWriter, r *Request) {})}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+	// Wait for Serve to be accepting.
+	for i := 0; ; i++ {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err == nil {
+			c.Close()
+			break
+		}
+		if i == 100 {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown = %v", err)
+	}
+	if err := <-errc; err != ErrServerClosed {
+		t.Errorf("Serve = %v; want ErrServerClosed", err)
+	}
+	if err := srv.ListenAndServe(); err != ErrServerClosed {
+		t.Errorf("ListenAndServe after Shutdown = %v; want ErrServerClosed", err)
+	}
+}
+
 func BenchmarkClientServer(b *testing.B) {
 	b.ReportAllocs()
 	b.StopTimer()
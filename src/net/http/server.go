@@ -8,6 +8,7 @@ package http
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -35,6 +36,28 @@ var (
 	ErrContentLength   = errors.New("Conn.Write wrote more than the declared Content-Length")
 )
 
+// contextKey is a value for use with context.WithValue. It's used as
+// a pointer so it fits in an interface{} without allocation.
+type contextKey struct {
+	name string
+}
+
+func (k *contextKey) String() string { return "net/http context value " + k.name }
+
+var (
+	// ServerContextKey is a context key. It can be used in HTTP
+	// handlers with Request.Context().Value to access the server
+	// that started the handler. The associated value will be of
+	// type *Server.
+	ServerContextKey = &contextKey{"http-server"}
+
+	// LocalAddrContextKey is a context key. It can be used in
+	// HTTP handlers with Request.Context().Value to access the
+	// local address the connection arrived on.
+	// The associated value will be of type net.Addr.
+	LocalAddrContextKey = &contextKey{"local-addr"}
+)
+
 // Objects implementing the Handler interface can be
 // registered to serve a particular path or subtree
 // in the HTTP server.
@@ -98,6 +121,10 @@ type Hijacker interface {
 	// will not do anything else with the connection.
 	// It becomes the caller's responsibility to manage
 	// and close the connection.
+	//
+	// Hijack fails if the handler has already used CloseNotify
+	// or waited on the Done channel of the request's Context,
+	// since both watch the connection for the client going away.
 	Hijack() (net.Conn, *bufio.ReadWriter, error)
 }
 
@@ -112,6 +139,37 @@ type CloseNotifier interface {
 	CloseNotify() <-chan bool
 }
 
+// Pusher is the interface implemented by ResponseWriters that support
+// HTTP/2 server push. For more background, see RFC 7540, section 8.2.
+type Pusher interface {
+	// Push initiates an HTTP/2 server push. This constructs a
+	// synthetic request using the given target and options,
+	// serializes that request into a PUSH_PROMISE frame, then
+	// dispatches that request using the server's request handler.
+	// If opts is nil, default options are used.
+	//
+	// The target must either be an absolute path (like "/path")
+	// or an absolute URL that contains a valid host and the same
+	// scheme as the parent request.
+	//
+	// Push returns ErrNotSupported if the client has disabled
+	// push or if push is not supported on the underlying
+	// connection.
+	Push(target string, opts *PushOptions) error
+}
+
+// PushOptions describes options for Pusher.Push.
+type PushOptions struct {
+	// Method specifies the HTTP method for the promised request.
+	// If set, it must be "GET" or "HEAD". Empty means "GET".
+	Method string
+
+	// Header specifies additional promised request headers.
+	// This cannot include HTTP/2 pseudo header fields like
+	// ":path" and ":scheme", which will be added automatically.
+	Header Header
+}
+
 // A conn represents the server side of an HTTP connection.
 type conn struct {
 	remoteAddr string               // network address of remote side
@@ -124,10 +182,13 @@ type conn struct {
 	buf        *bufio.ReadWriter    // buffered(lr,rwc), reading from bufio->limitReader->sr->rwc
 	tlsState   *tls.ConnectionState // or nil when not using TLS
 
-	mu           sync.Mutex // guards the following
-	clientGone   bool       // if client has disconnected mid-request
-	closeNotifyc chan bool  // made lazily
-	hijackedv    bool       // connection has been hijacked by handler
+	mu           sync.Mutex         // guards the following
+	clientGone   bool               // if client has disconnected mid-request
+	closeNotifyc chan bool          // made lazily
+	hijackedv    bool               // connection has been hijacked by handler
+	cancelCtx    context.CancelFunc // cancels the current request's context
+
+	curState ConnState // guarded by server.mu
 }
 
 func (c *conn) hijacked() bool {
@@ -143,7 +204,7 @@ func (c *conn) hijack() (rwc net.Conn, buf *bufio.ReadWriter, err error) {
 		return nil, nil, ErrHijacked
 	}
 	if c.closeNotifyc != nil {
-		return nil, nil, errors.New("http: Hijack is incompatible with use of CloseNotifier")
+		return nil, nil, errors.New("http: Hijack is incompatible with use of CloseNotifier or Request.Context().Done()")
 	}
 	c.hijackedv = true
 	rwc = c.rwc
@@ -188,9 +249,51 @@ func (c *conn) noteClientGone() {
 	if c.closeNotifyc != nil && !c.clientGone {
 		c.closeNotifyc <- true
 	}
+	if c.cancelCtx != nil {
+		c.cancelCtx()
+	}
 	c.clientGone = true
 }
 
+// setCancelCtx records the cancel func of the current request's
+// context so that noteClientGone can cancel it. If the client is
+// already known to be gone, cancel is called immediately.
+func (c *conn) setCancelCtx(cancel context.CancelFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cancelCtx = cancel
+	if cancel != nil && c.clientGone {
+		cancel()
+	}
+}
+
+// A requestContext is the Context of a request received by the
+// server. Watching the connection for the client going away is
+// costly and incompatible with Hijack, so it is started lazily, the
+// first time the Done channel is requested, as with CloseNotify.
+type requestContext struct {
+	context.Context
+	conn *conn
+	once sync.Once
+}
+
+func (rc *requestContext) Done() <-chan struct{} {
+	rc.once.Do(func() { rc.conn.closeNotify() })
+	return rc.Context.Done()
+}
+
+// cancelRequestCtx cancels the context of the request currently
+// being served, if any.
+func (c *conn) cancelRequestCtx() {
+	c.mu.Lock()
+	cancel := c.cancelCtx
+	c.cancelCtx = nil
+	c.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
 // A switchReader can have its Reader changed at runtime.
 // It's not safe for concurrent Reads and switches.
 type switchReader struct {
@@ -627,6 +730,12 @@ func (c *conn) readRequest() (w *response, err error) {
 	req.RemoteAddr = c.remoteAddr
 	req.TLS = c.tlsState
 
+	ctx := context.WithValue(context.Background(), ServerContextKey, c.server)
+	ctx = context.WithValue(ctx, LocalAddrContextKey, c.rwc.LocalAddr())
+	ctx, cancel := context.WithCancel(ctx)
+	req.ctx = &requestContext{Context: ctx, conn: c}
+	c.setCancelCtx(cancel)
+
 	w = &response{
 		conn:          c,
 		req:           req,
@@ -1172,7 +1281,20 @@ func validNPN(proto string) bool {
 }
 
 func (c *conn) setState(nc net.Conn, state ConnState) {
-	if hook := c.server.ConnState; hook != nil {
+	srv := c.server
+	srv.mu.Lock()
+	c.curState = state
+	switch state {
+	case StateNew:
+		if srv.activeConn == nil {
+			srv.activeConn = make(map[*conn]net.Conn)
+		}
+		srv.activeConn[c] = nc
+	case StateHijacked, StateClosed:
+		delete(srv.activeConn, c)
+	}
+	srv.mu.Unlock()
+	if hook := srv.ConnState; hook != nil {
 		hook(nc, state)
 	}
 }
@@ -1187,6 +1309,7 @@ func (c *conn) serve() {
 			buf = buf[:runtime.Stack(buf, false)]
 			c.server.logf("http: panic serving %v: %v\n%s", c.remoteAddr, err, buf)
 		}
+		c.cancelRequestCtx()
 		if !c.hijacked() {
 			c.close()
 			c.setState(origConn, StateClosed)
@@ -1208,6 +1331,9 @@ func (c *conn) serve() {
 		*c.tlsState = tlsConn.ConnectionState()
 		if proto := c.tlsState.NegotiatedProtocol; validNPN(proto) {
 			if fn := c.server.TLSNextProto[proto]; fn != nil {
+				// The connection belongs to the protocol handler
+				// now; it is never idle in the HTTP/1 sense.
+				c.setState(c.rwc, StateActive)
 				h := initNPNRequest{tlsConn, serverHandler{c.server}}
 				fn(c.server, tlsConn, h)
 			}
@@ -1259,6 +1385,7 @@ func (c *conn) serve() {
 		// [*] Not strictly true: HTTP pipelining.  We could let them all process
 		// in parallel even if their responses need to be serialized.
 		serverHandler{c.server}.ServeHTTP(w, w.req)
+		c.cancelRequestCtx()
 		if c.hijacked() {
 			return
 		}
@@ -1674,12 +1801,15 @@ type Server struct {
 	TLSConfig      *tls.Config   // optional TLS config, used by ListenAndServeTLS
 
 	// TLSNextProto optionally specifies a function to take over
-	// ownership of the provided TLS connection when an NPN
+	// ownership of the provided TLS connection when an NPN/ALPN
 	// protocol upgrade has occurred.  The map key is the protocol
 	// name negotiated. The Handler argument should be used to
 	// handle HTTP requests and will initialize the Request's TLS
 	// and RemoteAddr if not already set.  The connection is
 	// automatically closed when the function returns.
+	// If TLSNextProto is nil, HTTP/2 support is enabled
+	// automatically by ListenAndServeTLS. To disable HTTP/2, set
+	// TLSNextProto to a non-nil, empty map.
 	TLSNextProto map[string]func(*Server, *tls.Conn, Handler)
 
 	// ConnState specifies an optional callback function that is
@@ -1693,7 +1823,187 @@ type Server struct {
 	// standard logger.
 	ErrorLog *log.Logger
 
-	disableKeepAlives int32 // accessed atomically.
+	disableKeepAlives int32     // accessed atomically.
+	inShutdown        int32     // accessed atomically (non-zero means we're in Shutdown)
+	nextProtoOnce     sync.Once // guards onceSetNextProtoDefaults
+
+	mu         sync.Mutex
+	listeners  map[net.Listener]bool
+	activeConn map[*conn]net.Conn // conn to the net.Conn it was accepted as
+	doneChan   chan struct{}
+	onShutdown []func()
+}
+
+// ErrServerClosed is returned by the Server's Serve, ListenAndServe
+// and ListenAndServeTLS methods after a call to Shutdown or Close.
+var ErrServerClosed = errors.New("http: Server closed")
+
+func (srv *Server) getDoneChan() <-chan struct{} {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.getDoneChanLocked()
+}
+
+func (srv *Server) getDoneChanLocked() chan struct{} {
+	if srv.doneChan == nil {
+		srv.doneChan = make(chan struct{})
+	}
+	return srv.doneChan
+}
+
+func (srv *Server) closeDoneChanLocked() {
+	ch := srv.getDoneChanLocked()
+	select {
+	case <-ch:
+		// Already closed. Don't close again.
+	default:
+		close(ch)
+	}
+}
+
+// Close immediately closes all active listeners and all
+// connections in state StateNew, StateActive, or StateIdle. For a
+// graceful shutdown, use Shutdown.
+//
+// Close does not attempt to close (and does not even know about)
+// any hijacked connections, such as WebSockets.
+//
+// Close returns any error returned from closing the Server's
+// underlying Listener(s).
+func (srv *Server) Close() error {
+	atomic.StoreInt32(&srv.inShutdown, 1)
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.closeDoneChanLocked()
+	err := srv.closeListenersLocked()
+	for c, nc := range srv.activeConn {
+		nc.Close()
+		delete(srv.activeConn, c)
+	}
+	return err
+}
+
+// shutdownPollInterval is how often we poll for quiescence
+// during Server.Shutdown.
+var shutdownPollInterval = 500 * time.Millisecond
+
+// Shutdown gracefully shuts down the server without interrupting any
+// active connections. Shutdown works by first closing all open
+// listeners, then closing all idle connections, and then waiting
+// indefinitely for connections to return to idle and then shut down.
+// If the provided context expires before the shutdown is complete,
+// Shutdown returns the context's error, otherwise it returns any
+// error returned from closing the Server's underlying Listener(s).
+//
+// When Shutdown is called, Serve, ListenAndServe, and
+// ListenAndServeTLS immediately return ErrServerClosed. Make sure the
+// program doesn't exit and waits instead for Shutdown to return.
+//
+// Shutdown does not attempt to close nor wait for hijacked
+// connections such as WebSockets. The caller of Shutdown should
+// separately notify such long-lived connections of shutdown and wait
+// for them to close, if desired. See RegisterOnShutdown for a way to
+// register shutdown notification functions.
+//
+// HTTP/2 connections are sent a GOAWAY frame and closed once their
+// in-flight streams finish.
+//
+// Once Shutdown has been called on a server, it may not be reused;
+// future calls to methods such as Serve will return ErrServerClosed.
+func (srv *Server) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&srv.inShutdown, 1)
+
+	srv.mu.Lock()
+	lnerr := srv.closeListenersLocked()
+	srv.closeDoneChanLocked()
+	for _, f := range srv.onShutdown {
+		go f()
+	}
+	srv.mu.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if srv.closeIdleConns() {
+			return lnerr
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RegisterOnShutdown registers a function to call on Shutdown.
+// This can be used to gracefully shutdown connections that have
+// undergone NPN/ALPN protocol upgrade or that have been hijacked.
+// This function should start protocol-specific graceful shutdown,
+// but should not wait for shutdown to complete.
+func (srv *Server) RegisterOnShutdown(f func()) {
+	srv.mu.Lock()
+	srv.onShutdown = append(srv.onShutdown, f)
+	srv.mu.Unlock()
+}
+
+// closeIdleConns closes all idle connections and reports whether the
+// server is quiescent.
+func (srv *Server) closeIdleConns() bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	quiescent := true
+	for c, nc := range srv.activeConn {
+		if c.curState != StateIdle {
+			quiescent = false
+			continue
+		}
+		nc.Close()
+		delete(srv.activeConn, c)
+	}
+	return quiescent
+}
+
+func (srv *Server) closeListenersLocked() error {
+	var err error
+	for ln := range srv.listeners {
+		if cerr := ln.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(srv.listeners, ln)
+	}
+	return err
+}
+
+func (srv *Server) shuttingDown() bool {
+	return atomic.LoadInt32(&srv.inShutdown) != 0
+}
+
+// trackListener adds or removes l from the set of listeners closed
+// by Shutdown and Close. It reports false if the server is already
+// shutting down.
+func (srv *Server) trackListener(l net.Listener, add bool) bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if add {
+		if srv.shuttingDown() {
+			return false
+		}
+		if srv.listeners == nil {
+			srv.listeners = make(map[net.Listener]bool)
+		}
+		srv.listeners[l] = true
+	} else {
+		delete(srv.listeners, l)
+	}
+	return true
+}
+
+// onceSetNextProtoDefaults enables HTTP/2 unless the user has
+// configured TLSNextProto or turned it off with GODEBUG=http2server=0.
+func (srv *Server) onceSetNextProtoDefaults() {
+	if srv.TLSNextProto == nil && !http2godebugDisabled("http2server") {
+		http2ConfigureServer(srv, nil)
+	}
 }
 
 // A ConnState represents the state of a client connection to a server.
@@ -1763,7 +2073,11 @@ func (sh serverHandler) ServeHTTP(rw ResponseWriter, req *Request) {
 // ListenAndServe listens on the TCP network address srv.Addr and then
 // calls Serve to handle requests on incoming connections.  If
 // srv.Addr is blank, ":http" is used.
+// After Shutdown or Close, the returned error is ErrServerClosed.
 func (srv *Server) ListenAndServe() error {
+	if srv.shuttingDown() {
+		return ErrServerClosed
+	}
 	addr := srv.Addr
 	if addr == "" {
 		addr = ":http"
@@ -1778,12 +2092,24 @@ func (srv *Server) ListenAndServe() error {
 // Serve accepts incoming connections on the Listener l, creating a
 // new service goroutine for each.  The service goroutines read requests and
 // then call srv.Handler to reply to them.
+//
+// Serve always returns a non-nil error. After Shutdown or Close, the
+// returned error is ErrServerClosed.
 func (srv *Server) Serve(l net.Listener) error {
 	defer l.Close()
+	if !srv.trackListener(l, true) {
+		return ErrServerClosed
+	}
+	defer srv.trackListener(l, false)
 	var tempDelay time.Duration // how long to sleep on accept failure
 	for {
 		rw, e := l.Accept()
 		if e != nil {
+			select {
+			case <-srv.getDoneChan():
+				return ErrServerClosed
+			default:
+			}
 			if ne, ok := e.(net.Error); ok && ne.Temporary() {
 				if tempDelay == 0 {
 					tempDelay = 5 * time.Millisecond
@@ -1810,7 +2136,7 @@ func (srv *Server) Serve(l net.Listener) error {
 }
 
 func (s *Server) doKeepAlives() bool {
-	return atomic.LoadInt32(&s.disableKeepAlives) == 0
+	return atomic.LoadInt32(&s.disableKeepAlives) == 0 && !s.shuttingDown()
 }
 
 // SetKeepAlivesEnabled controls whether HTTP keep-alives are enabled.
@@ -1907,11 +2233,16 @@ func ListenAndServeTLS(addr string, certFile string, keyFile string, handler Han
 // of the server's certificate followed by the CA's certificate.
 //
 // If srv.Addr is blank, ":https" is used.
+// After Shutdown or Close, the returned error is ErrServerClosed.
 func (srv *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	if srv.shuttingDown() {
+		return ErrServerClosed
+	}
 	addr := srv.Addr
 	if addr == "" {
 		addr = ":https"
 	}
+	srv.nextProtoOnce.Do(srv.onceSetNextProtoDefaults)
 	config := &tls.Config{}
 	if srv.TLSConfig != nil {
 		*config = *srv.TLSConfig
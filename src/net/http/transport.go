@@ -12,12 +12,15 @@ package http
 import (
 	"bufio"
 	"compress/gzip"
+	"container/list"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
+	"net/http/httptrace"
 	"net/url"
 	"os"
 	"strings"
@@ -36,7 +39,10 @@ var DefaultTransport RoundTripper = &Transport{
 		Timeout:   30 * time.Second,
 		KeepAlive: 30 * time.Second,
 	}).Dial,
-	TLSHandshakeTimeout: 10 * time.Second,
+	MaxIdleConns:          100,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
 }
 
 // DefaultMaxIdleConnsPerHost is the default value of Transport's
@@ -48,9 +54,15 @@ const DefaultMaxIdleConnsPerHost = 2
 // Transport can also cache connections for future re-use.
 type Transport struct {
 	idleMu     sync.Mutex
-	wantIdle   bool // user has requested to close all idle conns
-	idleConn   map[connectMethodKey][]*persistConn
+	wantIdle   bool                                // user has requested to close all idle conns
+	idleConn   map[connectMethodKey][]*persistConn // most recently used at end
 	idleConnCh map[connectMethodKey]chan *persistConn
+	idleLRU    connLRU
+	altConn    map[connectMethodKey][]*persistConn // connections shared by an alternate protocol
+
+	connCountMu      sync.Mutex
+	connPerHostCount map[connectMethodKey]int
+	connPerHostWait  map[connectMethodKey][]chan struct{} // oldest first
 
 	reqMu       sync.Mutex
 	reqCanceler map[*Request]func()
@@ -58,6 +70,8 @@ type Transport struct {
 	altMu    sync.RWMutex
 	altProto map[string]RoundTripper // nil or map of URI scheme => RoundTripper
 
+	nextProtoOnce sync.Once // guards initialization of TLSNextProto (onceSetNextProtoDefaults)
+
 	// Proxy specifies a function to return a proxy for a given
 	// Request. If the function returns a non-nil error, the
 	// request is aborted with the provided error.
@@ -66,7 +80,9 @@ type Transport struct {
 
 	// Dial specifies the dial function for creating unencrypted
 	// TCP connections.
-	// If Dial is nil, net.Dial is used.
+	// If Dial is nil, the request's context is passed to
+	// net.Dialer's DialContext, so that canceling the request also
+	// abandons a dial in progress.
 	Dial func(network, addr string) (net.Conn, error)
 
 	// DialTLS specifies an optional dial function for creating
@@ -102,19 +118,64 @@ type Transport struct {
 	// uncompressed.
 	DisableCompression bool
 
+	// MaxIdleConns controls the maximum number of idle (keep-alive)
+	// connections across all hosts. Zero means no limit.
+	MaxIdleConns int
+
 	// MaxIdleConnsPerHost, if non-zero, controls the maximum idle
 	// (keep-alive) to keep per-host.  If zero,
 	// DefaultMaxIdleConnsPerHost is used.
 	MaxIdleConnsPerHost int
 
+	// MaxConnsPerHost optionally limits the total number of
+	// connections per host, including connections in the dialing,
+	// active, and idle states. On limit violation, dials will block
+	// until a connection is closed or handed back, or the request
+	// is canceled.
+	//
+	// Connections taken over by an alternate protocol such as
+	// HTTP/2 stop counting against the limit once established.
+	//
+	// Zero means no limit.
+	MaxConnsPerHost int
+
+	// IdleConnTimeout is the maximum amount of time an idle
+	// (keep-alive) connection will remain idle before closing
+	// itself.
+	// Zero means no limit.
+	IdleConnTimeout time.Duration
+
 	// ResponseHeaderTimeout, if non-zero, specifies the amount of
 	// time to wait for a server's response headers after fully
 	// writing the request (including its body, if any). This
 	// time does not include the time to read the response body.
 	ResponseHeaderTimeout time.Duration
 
-	// TODO: tunable on global max cached connections
-	// TODO: tunable on timeout on cached connections
+	// ExpectContinueTimeout, if non-zero, specifies the amount of
+	// time to wait for a server's first response headers after fully
+	// writing the request headers if the request has an
+	// "Expect: 100-continue" header. Zero means no timeout and
+	// causes the body to be sent immediately, without
+	// waiting for the server to approve.
+	// This time does not include the time to send the request header.
+	ExpectContinueTimeout time.Duration
+
+	// TLSNextProto specifies how the Transport switches to an
+	// alternate protocol (such as HTTP/2) after a TLS ALPN
+	// protocol negotiation. If Transport dials a TLS connection
+	// with a non-empty protocol name and TLSNextProto contains a
+	// map entry for that key (such as "h2"), then the func is
+	// called with the request's authority (such as "example.com"
+	// or "example.com:1234") and the TLS connection. The function
+	// must return a RoundTripper that then handles the request,
+	// and further requests to the same host for as long as the
+	// connection is usable.
+	//
+	// If TLSNextProto is nil, HTTP/2 support is enabled
+	// automatically for https requests that do not use a proxy
+	// and when DialTLS is nil. To disable HTTP/2, set
+	// TLSNextProto to a non-nil, empty map.
+	TLSNextProto map[string]func(authority string, c *tls.Conn) RoundTripper
 }
 
 // ProxyFromEnvironment returns the URL of the proxy to use for a
@@ -171,10 +232,11 @@ func ProxyURL(fixedURL *url.URL) func(*Request) (*url.URL, error) {
 }
 
 // transportRequest is a wrapper around a *Request that adds
-// optional extra headers to write.
+// optional extra headers to write and the request's trace hooks.
 type transportRequest struct {
-	*Request        // original request, not to be mutated
-	extra    Header // extra headers to write, or nil
+	*Request                        // original request, not to be mutated
+	extra    Header                 // extra headers to write, or nil
+	trace    *httptrace.ClientTrace // optional
 }
 
 func (tr *transportRequest) extraHeaders() Header {
@@ -186,9 +248,14 @@ func (tr *transportRequest) extraHeaders() Header {
 
 // RoundTrip implements the RoundTripper interface.
 //
+// If a request without a body and with an idempotent method fails
+// because the server closed a reused keep-alive connection, RoundTrip
+// sends it again on another connection.
+//
 // For higher-level HTTP client support (such as handling of cookies
 // and redirects), see Get, Post, and the Client type.
 func (t *Transport) RoundTrip(req *Request) (resp *Response, err error) {
+	t.nextProtoOnce.Do(t.onceSetNextProtoDefaults)
 	if req.URL == nil {
 		req.closeBody()
 		return nil, errors.New("http: nil Request.URL")
@@ -214,7 +281,7 @@ func (t *Transport) RoundTrip(req *Request) (resp *Response, err error) {
 		req.closeBody()
 		return nil, errors.New("http: no Host in request URL")
 	}
-	treq := &transportRequest{Request: req}
+	treq := &transportRequest{Request: req, trace: httptrace.ContextClientTrace(req.Context())}
 	cm, err := t.connectMethodForRequest(treq)
 	if err != nil {
 		req.closeBody()
@@ -225,16 +292,97 @@ func (t *Transport) RoundTrip(req *Request) (resp *Response, err error) {
 	// host (for http or https), the http proxy, or the http proxy
 	// pre-CONNECTed to https server.  In any case, we'll be ready
 	// to send it requests.
-	pconn, err := t.getConn(req, cm)
-	if err != nil {
-		t.setReqCanceler(req, nil)
-		req.closeBody()
-		return nil, err
+	for {
+		pconn, err := t.getConn(treq, cm)
+		if err != nil {
+			t.setReqCanceler(req, nil)
+			req.closeBody()
+			return nil, err
+		}
+		if pconn.alt == nil {
+			resp, err := pconn.roundTrip(treq)
+			if err == nil || !pconn.shouldRetryRequest(req, err) {
+				// nothingWrittenError is only for deciding
+				// whether to retry; callers see the write error.
+				if e, ok := err.(nothingWrittenError); ok {
+					err = e.error
+				}
+				return resp, err
+			}
+			testHookRoundTripRetried()
+			continue
+		}
+		t.setReqCanceler(req, nil) // the alternate protocol registers its own
+		resp, err := pconn.alt.RoundTrip(req)
+		if err == http2errClientConnUnusable {
+			// Nothing was sent; try another connection.
+			t.removeAltConn(pconn)
+			continue
+		}
+		return resp, err
+	}
+}
+
+// shouldRetryRequest reports whether we should retry sending a failed
+// HTTP request on a new connection. The non-nil input error is the
+// error from roundTrip.
+func (pc *persistConn) shouldRetryRequest(req *Request, err error) bool {
+	if !pc.isReused() {
+		// This was a fresh connection. There's no reason the server
+		// should've hung up on us.
+		return false
+	}
+	if _, ok := err.(nothingWrittenError); ok && req.Body == nil {
+		// We never wrote anything, so it's safe to retry.
+		return true
 	}
+	if !req.isReplayable() {
+		// Don't retry non-idempotent requests.
+		return false
+	}
+	// The server closed the connection before sending any response
+	// bytes. Probably an unfortunately timed keep-alive timeout,
+	// just as the client was writing a request.
+	return err == errServerClosedIdle
+}
+
+var (
+	errServerClosedIdle = errors.New("http: server closed idle connection")
+	errIdleConnTimeout  = errors.New("http: idle connection timeout")
+)
 
-	return pconn.roundTrip(treq)
+// nothingWrittenError wraps a write error which ended up writing zero
+// bytes to the connection.
+type nothingWrittenError struct {
+	error
 }
 
+var testHookRoundTripRetried = func() {}
+
+// onceSetNextProtoDefaults enables HTTP/2 unless the user has
+// configured TLSNextProto or DialTLS, or has turned it off with
+// GODEBUG=http2client=0.
+func (t *Transport) onceSetNextProtoDefaults() {
+	if t.TLSNextProto != nil || t.DialTLS != nil || http2godebugDisabled("http2client") {
+		return
+	}
+	t.TLSNextProto = map[string]func(string, *tls.Conn) RoundTripper{
+		http2NextProtoTLS: func(authority string, c *tls.Conn) RoundTripper {
+			cc, err := t.http2newClientConn(c)
+			if err != nil {
+				c.Close()
+				return erringRoundTripper{err}
+			}
+			return cc
+		},
+	}
+}
+
+// erringRoundTripper is a RoundTripper whose RoundTrip always fails.
+type erringRoundTripper struct{ err error }
+
+func (rt erringRoundTripper) RoundTrip(*Request) (*Response, error) { return nil, rt.err }
+
 // RegisterProtocol registers a new protocol with scheme.
 // The Transport will pass requests using the given scheme to rt.
 // It is rt's responsibility to simulate HTTP request semantics.
@@ -266,16 +414,31 @@ func (t *Transport) CloseIdleConnections() {
 	t.idleConn = nil
 	t.idleConnCh = nil
 	t.wantIdle = true
+	t.idleLRU = connLRU{}
+	alt := t.altConn
+	t.altConn = nil
 	t.idleMu.Unlock()
 	for _, conns := range m {
 		for _, pconn := range conns {
 			pconn.close()
 		}
 	}
+	// Connections shared by an alternate protocol are idle only
+	// once they carry no requests; busy ones are kept.
+	for _, conns := range alt {
+		for _, pconn := range conns {
+			if cc, ok := pconn.alt.(*http2ClientConn); ok && !cc.closeIfIdle() {
+				t.putAltConn(pconn)
+			}
+		}
+	}
 }
 
 // CancelRequest cancels an in-flight request by closing its
 // connection.
+//
+// Requests may also be canceled by canceling the Context they
+// carry; see Request.WithContext.
 func (t *Transport) CancelRequest(req *Request) {
 	t.reqMu.Lock()
 	cancel := t.reqCanceler[req]
@@ -365,6 +528,7 @@ func (t *Transport) putIdleConn(pconn *persistConn) bool {
 	if pconn.isBroken() {
 		return false
 	}
+	pconn.markReused()
 	key := pconn.cacheKey
 	max := t.MaxIdleConnsPerHost
 	if max == 0 {
@@ -407,11 +571,49 @@ func (t *Transport) putIdleConn(pconn *persistConn) bool {
 			log.Fatalf("dup idle pconn %p in freelist", pconn)
 		}
 	}
+	pconn.idleAt = time.Now()
 	t.idleConn[key] = append(t.idleConn[key], pconn)
+	t.idleLRU.add(pconn)
+	var evicted *persistConn
+	if t.MaxIdleConns != 0 && t.idleLRU.len() > t.MaxIdleConns {
+		evicted = t.idleLRU.removeOldest()
+		t.removeIdleConnLocked(evicted)
+	}
+	if t.IdleConnTimeout > 0 {
+		if pconn.idleTimer != nil {
+			pconn.idleTimer.Reset(t.IdleConnTimeout)
+		} else {
+			pconn.idleTimer = time.AfterFunc(t.IdleConnTimeout, pconn.closeConnIfStillIdle)
+		}
+	}
 	t.idleMu.Unlock()
+	if evicted != nil {
+		evicted.close()
+	}
 	return true
 }
 
+// removeIdleConnLocked removes pconn from the idle list of its host.
+// t.idleMu must be held.
+func (t *Transport) removeIdleConnLocked(pconn *persistConn) {
+	if pconn.idleTimer != nil {
+		pconn.idleTimer.Stop()
+	}
+	key := pconn.cacheKey
+	pconns := t.idleConn[key]
+	for i, v := range pconns {
+		if v == pconn {
+			pconns = append(pconns[:i:i], pconns[i+1:]...)
+			break
+		}
+	}
+	if len(pconns) == 0 {
+		delete(t.idleConn, key)
+	} else {
+		t.idleConn[key] = pconns
+	}
+}
+
 // getIdleConnCh returns a channel to receive and return idle
 // persistent connection for the given connectMethod.
 // It may return nil, if persistent connections are not being used.
@@ -434,17 +636,19 @@ func (t *Transport) getIdleConnCh(cm connectMethod) chan *persistConn {
 	return ch
 }
 
-func (t *Transport) getIdleConn(cm connectMethod) (pconn *persistConn) {
+// getIdleConn returns an idle connection to cm, if any, and the time
+// at which it became idle.
+func (t *Transport) getIdleConn(cm connectMethod) (pconn *persistConn, idleSince time.Time) {
 	key := cm.key()
 	t.idleMu.Lock()
 	defer t.idleMu.Unlock()
 	if t.idleConn == nil {
-		return nil
+		return nil, time.Time{}
 	}
 	for {
 		pconns, ok := t.idleConn[key]
 		if !ok {
-			return nil
+			return nil, time.Time{}
 		}
 		if len(pconns) == 1 {
 			pconn = pconns[0]
@@ -455,12 +659,64 @@ func (t *Transport) getIdleConn(cm connectMethod) (pconn *persistConn) {
 			pconn = pconns[len(pconns)-1]
 			t.idleConn[key] = pconns[:len(pconns)-1]
 		}
+		t.idleLRU.remove(pconn)
+		if pconn.idleTimer != nil {
+			// If the timer already fired, closeConnIfStillIdle
+			// finds pconn gone from the LRU and leaves it be.
+			pconn.idleTimer.Stop()
+		}
 		if !pconn.isBroken() {
-			return
+			return pconn, pconn.idleAt
 		}
 	}
 }
 
+// getAltConn returns a connection to cm taken over by an alternate
+// protocol that can accept another request, or nil. Such
+// connections are shared, so they stay in t.altConn.
+func (t *Transport) getAltConn(cm connectMethod) *persistConn {
+	key := cm.key()
+	t.idleMu.Lock()
+	defer t.idleMu.Unlock()
+	pconns := t.altConn[key]
+	for len(pconns) > 0 {
+		pc := pconns[0]
+		if cc, ok := pc.alt.(*http2ClientConn); !ok || cc.canTakeNewRequest() {
+			t.altConn[key] = pconns
+			return pc
+		}
+		pconns = pconns[1:]
+	}
+	delete(t.altConn, key)
+	return nil
+}
+
+func (t *Transport) putAltConn(pconn *persistConn) {
+	t.idleMu.Lock()
+	defer t.idleMu.Unlock()
+	if t.altConn == nil {
+		t.altConn = make(map[connectMethodKey][]*persistConn)
+	}
+	t.altConn[pconn.cacheKey] = append(t.altConn[pconn.cacheKey], pconn)
+}
+
+func (t *Transport) removeAltConn(pconn *persistConn) {
+	t.idleMu.Lock()
+	defer t.idleMu.Unlock()
+	pconns := t.altConn[pconn.cacheKey]
+	for i, pc := range pconns {
+		if pc == pconn {
+			pconns = append(pconns[:i:i], pconns[i+1:]...)
+			break
+		}
+	}
+	if len(pconns) == 0 {
+		delete(t.altConn, pconn.cacheKey)
+	} else {
+		t.altConn[pconn.cacheKey] = pconns
+	}
+}
+
 func (t *Transport) setReqCanceler(r *Request, fn func()) {
 	t.reqMu.Lock()
 	defer t.reqMu.Unlock()
@@ -474,11 +730,12 @@ func (t *Transport) setReqCanceler(r *Request, fn func()) {
 	}
 }
 
-func (t *Transport) dial(network, addr string) (c net.Conn, err error) {
+func (t *Transport) dial(ctx context.Context, network, addr string) (c net.Conn, err error) {
 	if t.Dial != nil {
 		return t.Dial(network, addr)
 	}
-	return net.Dial(network, addr)
+	var d net.Dialer
+	return d.DialContext(ctx, network, addr)
 }
 
 // Testing hooks:
@@ -488,8 +745,22 @@ var prePendingDial, postPendingDial func()
 // specified in the connectMethod.  This includes doing a proxy CONNECT
 // and/or setting up TLS.  If this doesn't return an error, the persistConn
 // is ready to write requests to.
-func (t *Transport) getConn(req *Request, cm connectMethod) (*persistConn, error) {
-	if pc := t.getIdleConn(cm); pc != nil {
+func (t *Transport) getConn(treq *transportRequest, cm connectMethod) (*persistConn, error) {
+	req := treq.Request
+	trace := treq.trace
+	if trace != nil && trace.GetConn != nil {
+		trace.GetConn(cm.addr())
+	}
+	if pc := t.getAltConn(cm); pc != nil {
+		if trace != nil && trace.GotConn != nil {
+			trace.GotConn(httptrace.GotConnInfo{Conn: pc.conn, Reused: true})
+		}
+		return pc, nil
+	}
+	if pc, idleSince := t.getIdleConn(cm); pc != nil {
+		if trace != nil && trace.GotConn != nil {
+			trace.GotConn(pc.gotIdleConnTrace(idleSince))
+		}
 		return pc, nil
 	}
 
@@ -505,7 +776,11 @@ func (t *Transport) getConn(req *Request, cm connectMethod) (*persistConn, error
 		}
 		go func() {
 			if v := <-dialc; v.err == nil {
-				t.putIdleConn(v.pc)
+				if v.pc.alt != nil {
+					t.putAltConn(v.pc)
+				} else {
+					t.putIdleConn(v.pc)
+				}
 			}
 			if postPendingDial != nil {
 				postPendingDial()
@@ -516,15 +791,51 @@ func (t *Transport) getConn(req *Request, cm connectMethod) (*persistConn, error
 	cancelc := make(chan struct{})
 	t.setReqCanceler(req, func() { close(cancelc) })
 
+	ctx := req.Context()
+	idleConnCh := t.getIdleConnCh(cm)
+
+	// Wait for room under MaxConnsPerHost, unless a connection
+	// becomes idle first.
+	cmKey := cm.key()
+	slotc := t.incHostConnCount(cmKey)
+	select {
+	case <-slotc:
+		// count below conn per host limit; proceed
+	case pc := <-idleConnCh:
+		t.abandonHostConnCount(cmKey, slotc)
+		if trace != nil && trace.GotConn != nil {
+			trace.GotConn(httptrace.GotConnInfo{Conn: pc.conn, Reused: pc.isReused()})
+		}
+		return pc, nil
+	case <-cancelc:
+		t.abandonHostConnCount(cmKey, slotc)
+		return nil, errors.New("net/http: request canceled while waiting for connection")
+	case <-ctx.Done():
+		t.abandonHostConnCount(cmKey, slotc)
+		return nil, ctx.Err()
+	}
+
 	go func() {
-		pc, err := t.dialConn(cm)
+		pc, err := t.dialConn(ctx, cm)
+		if err != nil {
+			t.decHostConnCount(cmKey)
+		} else if pc.alt != nil {
+			// The alternate protocol owns the connection now.
+			t.decHostConnCount(cmKey)
+		}
 		dialc <- dialRes{pc, err}
 	}()
 
-	idleConnCh := t.getIdleConnCh(cm)
 	select {
 	case v := <-dialc:
 		// Our dial finished.
+		if v.err == nil && v.pc.alt != nil {
+			// Let other requests share it.
+			t.putAltConn(v.pc)
+		}
+		if v.err == nil && trace != nil && trace.GotConn != nil {
+			trace.GotConn(httptrace.GotConnInfo{Conn: v.pc.conn})
+		}
 		return v.pc, v.err
 	case pc := <-idleConnCh:
 		// Another request finished first and its net.Conn
@@ -533,14 +844,115 @@ func (t *Transport) getConn(req *Request, cm connectMethod) (*persistConn, error
 		// But our dial is still going, so give it away
 		// when it finishes:
 		handlePendingDial()
+		if trace != nil && trace.GotConn != nil {
+			trace.GotConn(httptrace.GotConnInfo{Conn: pc.conn, Reused: pc.isReused()})
+		}
 		return pc, nil
 	case <-cancelc:
 		handlePendingDial()
 		return nil, errors.New("net/http: request canceled while waiting for connection")
+	case <-ctx.Done():
+		handlePendingDial()
+		return nil, ctx.Err()
+	}
+}
+
+var connsPerHostClosedCh = make(chan struct{})
+
+func init() {
+	close(connsPerHostClosedCh)
+}
+
+// incHostConnCount reserves a connection slot for a given host
+// under MaxConnsPerHost. It returns an already-closed channel if a
+// slot was free; otherwise it queues the caller and returns a
+// channel that receives once a slot is handed over. A caller that
+// stops waiting must call abandonHostConnCount with that channel.
+func (t *Transport) incHostConnCount(cmKey connectMethodKey) <-chan struct{} {
+	if t.MaxConnsPerHost <= 0 {
+		return connsPerHostClosedCh
+	}
+	t.connCountMu.Lock()
+	defer t.connCountMu.Unlock()
+	if t.connPerHostCount[cmKey] < t.MaxConnsPerHost {
+		if t.connPerHostCount == nil {
+			t.connPerHostCount = make(map[connectMethodKey]int)
+		}
+		t.connPerHostCount[cmKey]++
+		return connsPerHostClosedCh
+	}
+	if t.connPerHostWait == nil {
+		t.connPerHostWait = make(map[connectMethodKey][]chan struct{})
+	}
+	ch := make(chan struct{}, 1)
+	t.connPerHostWait[cmKey] = append(t.connPerHostWait[cmKey], ch)
+	return ch
+}
+
+// abandonHostConnCount releases the reservation made by
+// incHostConnCount, which returned ch, for a caller that did not
+// end up dialing.
+func (t *Transport) abandonHostConnCount(cmKey connectMethodKey, ch <-chan struct{}) {
+	if t.MaxConnsPerHost <= 0 {
+		return
 	}
+	if ch != connsPerHostClosedCh {
+		t.connCountMu.Lock()
+		waiters := t.connPerHostWait[cmKey]
+		for i, w := range waiters {
+			if w == ch {
+				t.removeHostConnWaiterLocked(cmKey, i)
+				t.connCountMu.Unlock()
+				return
+			}
+		}
+		t.connCountMu.Unlock()
+		// No longer queued: a slot was handed to us
+		// after all, so give it back.
+	}
+	t.decHostConnCount(cmKey)
 }
 
-func (t *Transport) dialConn(cm connectMethod) (*persistConn, error) {
+// decHostConnCount releases a connection slot for a given host.
+// See Transport.MaxConnsPerHost.
+func (t *Transport) decHostConnCount(cmKey connectMethodKey) {
+	if t.MaxConnsPerHost <= 0 {
+		return
+	}
+	t.connCountMu.Lock()
+	defer t.connCountMu.Unlock()
+	if waiters := t.connPerHostWait[cmKey]; len(waiters) > 0 {
+		// Hand the slot to the oldest waiter; the count
+		// stays the same.
+		waiters[0] <- struct{}{}
+		t.removeHostConnWaiterLocked(cmKey, 0)
+		return
+	}
+	if t.connPerHostCount == nil {
+		// MaxConnsPerHost was set after this connection was
+		// made, so it never took a slot.
+		return
+	}
+	t.connPerHostCount[cmKey]--
+	if t.connPerHostCount[cmKey] <= 0 {
+		delete(t.connPerHostCount, cmKey)
+	}
+}
+
+// removeHostConnWaiterLocked removes the i'th waiter for cmKey.
+// t.connCountMu must be held.
+func (t *Transport) removeHostConnWaiterLocked(cmKey connectMethodKey, i int) {
+	waiters := t.connPerHostWait[cmKey]
+	waiters = append(waiters[:i:i], waiters[i+1:]...)
+	if len(waiters) == 0 {
+		delete(t.connPerHostWait, cmKey)
+	} else {
+		t.connPerHostWait[cmKey] = waiters
+	}
+}
+
+func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (*persistConn, error) {
+	trace := httptrace.ContextClientTrace(ctx)
 	pconn := &persistConn{
 		t:          t,
 		cacheKey:   cm.key(),
@@ -552,16 +964,25 @@ func (t *Transport) dialConn(cm connectMethod) (*persistConn, error) {
 	tlsDial := t.DialTLS != nil && cm.targetScheme == "https" && cm.proxyURL == nil
 	if tlsDial {
 		var err error
+		if trace != nil && trace.TLSHandshakeStart != nil {
+			trace.TLSHandshakeStart()
+		}
 		pconn.conn, err = t.DialTLS("tcp", cm.addr())
 		if err != nil {
+			if trace != nil && trace.TLSHandshakeDone != nil {
+				trace.TLSHandshakeDone(tls.ConnectionState{}, err)
+			}
 			return nil, err
 		}
 		if tc, ok := pconn.conn.(*tls.Conn); ok {
 			cs := tc.ConnectionState()
+			if trace != nil && trace.TLSHandshakeDone != nil {
+				trace.TLSHandshakeDone(cs, nil)
+			}
 			pconn.tlsState = &cs
 		}
 	} else {
-		conn, err := t.dial("tcp", cm.addr())
+		conn, err := t.dial(ctx, "tcp", cm.addr())
 		if err != nil {
 			if cm.proxyURL != nil {
 				err = fmt.Errorf("http: error connecting to proxy %s: %v", cm.proxyURL, err)
@@ -624,6 +1045,12 @@ func (t *Transport) dialConn(cm connectMethod) (*persistConn, error) {
 				cfg = &clone
 			}
 		}
+		if _, ok := t.TLSNextProto[http2NextProtoTLS]; ok && cm.proxyURL == nil && len(cfg.NextProtos) == 0 {
+			// Offer HTTP/2 through ALPN.
+			clone := *cfg
+			clone.NextProtos = []string{http2NextProtoTLS, "http/1.1"}
+			cfg = &clone
+		}
 		plainConn := pconn.conn
 		tlsConn := tls.Client(plainConn, cfg)
 		errc := make(chan error, 2)
@@ -633,6 +1060,9 @@ func (t *Transport) dialConn(cm connectMethod) (*persistConn, error) {
 				errc <- tlsHandshakeTimeoutError{}
 			})
 		}
+		if trace != nil && trace.TLSHandshakeStart != nil {
+			trace.TLSHandshakeStart()
+		}
 		go func() {
 			err := tlsConn.Handshake()
 			if timer != nil {
@@ -642,21 +1072,40 @@ func (t *Transport) dialConn(cm connectMethod) (*persistConn, error) {
 		}()
 		if err := <-errc; err != nil {
 			plainConn.Close()
+			if trace != nil && trace.TLSHandshakeDone != nil {
+				trace.TLSHandshakeDone(tls.ConnectionState{}, err)
+			}
 			return nil, err
 		}
 		if !cfg.InsecureSkipVerify {
 			if err := tlsConn.VerifyHostname(cfg.ServerName); err != nil {
 				plainConn.Close()
+				if trace != nil && trace.TLSHandshakeDone != nil {
+					trace.TLSHandshakeDone(tls.ConnectionState{}, err)
+				}
 				return nil, err
 			}
 		}
 		cs := tlsConn.ConnectionState()
+		if trace != nil && trace.TLSHandshakeDone != nil {
+			trace.TLSHandshakeDone(cs, nil)
+		}
 		pconn.tlsState = &cs
 		pconn.conn = tlsConn
 	}
 
+	if s := pconn.tlsState; s != nil && s.NegotiatedProtocolIsMutual && s.NegotiatedProtocol != "" {
+		if next, ok := t.TLSNextProto[s.NegotiatedProtocol]; ok {
+			if tc, ok := pconn.conn.(*tls.Conn); ok {
+				alt := next(cm.targetAddr, tc)
+				return &persistConn{t: t, cacheKey: pconn.cacheKey, conn: tc, alt: alt}, nil
+			}
+		}
+	}
+
+	pconn.countsAgainstHostLimit = t.MaxConnsPerHost > 0
 	pconn.br = bufio.NewReader(noteEOFReader{pconn.conn, &pconn.sawEOF})
-	pconn.bw = bufio.NewWriter(pconn.conn)
+	pconn.bw = bufio.NewWriter(persistConnWriter{pconn})
 	go pconn.readLoop()
 	go pconn.writeLoop()
 	return pconn, nil
@@ -784,6 +1233,12 @@ func (k connectMethodKey) String() string {
 // persistConn wraps a connection, usually a persistent one
 // (but may be used for non-keep-alive requests as well)
 type persistConn struct {
+	// alt optionally specifies the TLS NextProto RoundTripper.
+	// This is used for HTTP/2 today and future protocols later.
+	// If it's non-nil, the rest of the fields are unused,
+	// except conn, which is reported to GotConn trace hooks.
+	alt RoundTripper
+
 	t        *Transport
 	cacheKey connectMethodKey
 	conn     net.Conn
@@ -801,10 +1256,20 @@ type persistConn struct {
 	// whether or not a connection can be reused. Issue 7569.
 	writeErrCh chan error
 
+	idleAt    time.Time   // time it last became idle; guarded by Transport.idleMu
+	idleTimer *time.Timer // holding an AfterFunc to close it; guarded by Transport.idleMu
+
+	nwrite int64 // bytes written; owned by writeLoop
+
+	// countsAgainstHostLimit is whether closing this connection
+	// frees a slot under Transport.MaxConnsPerHost.
+	countsAgainstHostLimit bool
+
 	lk                   sync.Mutex // guards following fields
 	numExpectedResponses int
 	closed               bool // whether conn has been closed
 	broken               bool // an error has happened on this connection; marked broken so it's not reused.
+	reused               bool // whether conn has had successful request/response and is being reused.
 	// mutateHeaderFunc is an optional func to modify extra
 	// headers on each outbound request before it's written. (the
 	// original Request given to RoundTrip is not modified)
@@ -819,6 +1284,50 @@ func (pc *persistConn) isBroken() bool {
 	return b
 }
 
+// isReused reports whether this connection has been used for a
+// previous request.
+func (pc *persistConn) isReused() bool {
+	pc.lk.Lock()
+	r := pc.reused
+	pc.lk.Unlock()
+	return r
+}
+
+// markReused marks this connection as having been successfully used
+// for a request and response.
+func (pc *persistConn) markReused() {
+	pc.lk.Lock()
+	pc.reused = true
+	pc.lk.Unlock()
+}
+
+// closeConnIfStillIdle closes the connection if it's still sitting idle.
+// This is what's called by the persistConn's idleTimer, and is run in its
+// own goroutine.
+func (pc *persistConn) closeConnIfStillIdle() {
+	t := pc.t
+	t.idleMu.Lock()
+	if _, ok := t.idleLRU.m[pc]; !ok {
+		// Not idle.
+		t.idleMu.Unlock()
+		return
+	}
+	t.idleLRU.remove(pc)
+	t.removeIdleConnLocked(pc)
+	t.idleMu.Unlock()
+	pc.close()
+}
+
+func (pc *persistConn) gotIdleConnTrace(idleAt time.Time) (t httptrace.GotConnInfo) {
+	t.Reused = pc.isReused()
+	t.Conn = pc.conn
+	t.WasIdle = true
+	if !idleAt.IsZero() {
+		t.IdleTime = time.Since(idleAt)
+	}
+	return
+}
+
 func (pc *persistConn) cancelRequest() {
 	pc.conn.Close()
 }
@@ -856,22 +1365,16 @@ func (pc *persistConn) readLoop() {
 		pc.lk.Unlock()
 
 		rc := <-pc.reqch
+		trace := httptrace.ContextClientTrace(rc.req.Context())
+		if err == nil && trace != nil && trace.GotFirstResponseByte != nil {
+			trace.GotFirstResponseByte()
+		}
 
 		var resp *Response
 		if err == nil {
-			resp, err = ReadResponse(pc.br, rc.req)
-			if err == nil && resp.StatusCode == 100 {
-				// Skip any 100-continue for now.
-				// TODO(bradfitz): if rc.req had "Expect: 100-continue",
-				// actually block the request body write and signal the
-				// writeLoop now to begin sending it. (Issue 2184) For now we
-				// eat it, since we're never expecting one.
-				resp, err = ReadResponse(pc.br, rc.req)
-			}
-		}
-
-		if resp != nil {
-			resp.TLS = pc.tlsState
+			resp, err = pc.readResponse(rc)
+		} else if err == io.EOF {
+			err = errServerClosedIdle
 		}
 
 		hasBody := resp != nil && rc.req.Method != "HEAD" && resp.ContentLength != 0
@@ -920,6 +1423,12 @@ func (pc *persistConn) readLoop() {
 				pc.t.putIdleConn(pc)
 		}
 
+		if err != nil {
+			// Clear the canceler before handing back the error:
+			// the caller may retry the same *Request on another
+			// connection, which registers its own canceler.
+			pc.t.setReqCanceler(rc.req, nil)
+		}
 		rc.ch <- responseAndError{resp, err}
 
 		// Wait for the just-returned response body to be fully consumed
@@ -929,10 +1438,17 @@ func (pc *persistConn) readLoop() {
 			case alive = <-waitForBodyRead:
 			case <-pc.closech:
 				alive = false
+			case <-rc.req.Context().Done():
+				// The caller gave up on the request while
+				// still reading the body; closing the
+				// connection below aborts that read.
+				alive = false
 			}
 		}
 
-		pc.t.setReqCanceler(rc.req, nil)
+		if err == nil {
+			pc.t.setReqCanceler(rc.req, nil)
+		}
 
 		if !alive {
 			pc.close()
@@ -940,6 +1456,58 @@ func (pc *persistConn) readLoop() {
 	}
 }
 
+// readResponse reads the response to rc.req, consuming any
+// "100 Continue" response and signaling the writeLoop about it.
+func (pc *persistConn) readResponse(rc requestAndChan) (resp *Response, err error) {
+	resp, err = ReadResponse(pc.br, rc.req)
+	if err != nil {
+		return
+	}
+	if rc.continueCh != nil {
+		if resp.StatusCode == 100 {
+			rc.continueCh <- struct{}{}
+		} else {
+			close(rc.continueCh)
+		}
+	}
+	if resp.StatusCode == 100 {
+		resp, err = ReadResponse(pc.br, rc.req)
+		if err != nil {
+			return
+		}
+	}
+	resp.TLS = pc.tlsState
+	return
+}
+
+// waitForContinue returns the function to block until
+// any response, timeout or connection close. After any of them,
+// the function returns a bool which indicates if the body should be sent.
+func (pc *persistConn) waitForContinue(continueCh <-chan struct{}) func() bool {
+	if continueCh == nil {
+		return nil
+	}
+	return func() bool {
+		timer := time.NewTimer(pc.t.ExpectContinueTimeout)
+		defer timer.Stop()
+
+		select {
+		case _, ok := <-continueCh:
+			if !ok {
+				// The server replied without asking for
+				// the body, which we therefore never send.
+				// The connection can't be reused.
+				pc.markBroken()
+			}
+			return ok
+		case <-timer.C:
+			return true
+		case <-pc.closech:
+			return false
+		}
+	}
+}
+
 func (pc *persistConn) writeLoop() {
 	for {
 		select {
@@ -948,10 +1516,17 @@ func (pc *persistConn) writeLoop() {
 				wr.ch <- errors.New("http: can't write HTTP request on broken connection")
 				continue
 			}
-			err := wr.req.Request.write(pc.bw, pc.isProxy, wr.req.extra)
+			startBytesWritten := pc.nwrite
+			err := wr.req.Request.write(pc.bw, pc.isProxy, wr.req.extra, pc.waitForContinue(wr.continueCh))
 			if err == nil {
 				err = pc.bw.Flush()
 			}
+			if trace := wr.req.trace; trace != nil && trace.WroteRequest != nil {
+				trace.WroteRequest(httptrace.WroteRequestInfo{Err: err})
+			}
+			if err != nil && pc.nwrite == startBytesWritten {
+				err = nothingWrittenError{err}
+			}
 			if err != nil {
 				pc.markBroken()
 				wr.req.Request.closeBody()
@@ -1005,6 +1580,12 @@ type requestAndChan struct {
 	// Accept-Encoding gzip header? only if it we set it do
 	// we transparently decode the gzip.
 	addedGzip bool
+
+	// Optional blocking chan for Expect: 100-continue (for send).
+	// If the request has an "Expect: 100-continue" header and
+	// the server responds 100 Continue, readLoop send a value
+	// to writeLoop via this chan.
+	continueCh chan<- struct{}
 }
 
 // A writeRequest is sent by the readLoop's goroutine to the
@@ -1014,6 +1595,11 @@ type requestAndChan struct {
 type writeRequest struct {
 	req *transportRequest
 	ch  chan<- error
+
+	// Optional blocking chan for Expect: 100-continue (for receive).
+	// If not nil, writeLoop blocks sending request body until
+	// it receives from this chan.
+	continueCh <-chan struct{}
 }
 
 type httpError struct {
@@ -1068,22 +1654,32 @@ func (pc *persistConn) roundTrip(req *transportRequest) (resp *Response, err err
 		req.extraHeaders().Set("Connection", "close")
 	}
 
+	var continueCh chan struct{}
+	if pc.t.ExpectContinueTimeout != 0 && req.Body != nil && req.expectsContinue() {
+		continueCh = make(chan struct{}, 1)
+	}
+
 	// Write the request concurrently with waiting for a response,
 	// in case the server decides to reply before reading our full
 	// request body.
 	writeErrCh := make(chan error, 1)
-	pc.writech <- writeRequest{req, writeErrCh}
+	pc.writech <- writeRequest{req, writeErrCh, continueCh}
 
 	resc := make(chan responseAndError, 1)
-	pc.reqch <- requestAndChan{req.Request, resc, requestedGzip}
+	pc.reqch <- requestAndChan{req.Request, resc, requestedGzip, continueCh}
 
 	var re responseAndError
 	var pconnDeadCh = pc.closech
 	var failTicker <-chan time.Time
 	var respHeaderTimer <-chan time.Time
+	ctx := req.Request.Context()
 WaitResponse:
 	for {
 		select {
+		case <-ctx.Done():
+			pc.close()
+			re = responseAndError{err: ctx.Err()}
+			break WaitResponse
 		case err := <-writeErrCh:
 			if err != nil {
 				re = responseAndError{nil, err}
@@ -1153,10 +1749,68 @@ func (pc *persistConn) closeLocked() {
 		pc.conn.Close()
 		pc.closed = true
 		close(pc.closech)
+		if pc.countsAgainstHostLimit {
+			pc.t.decHostConnCount(pc.cacheKey)
+		}
 	}
 	pc.mutateHeaderFunc = nil
 }
 
+// persistConnWriter is the io.Writer written to by pc.bw.
+// It accumulates the number of bytes written to the underlying conn,
+// so the retry logic can determine whether any bytes made it across
+// the wire.
+// This is exactly 1 pointer field wide so it can go into an interface
+// without allocation.
+type persistConnWriter struct {
+	pc *persistConn
+}
+
+func (w persistConnWriter) Write(p []byte) (n int, err error) {
+	n, err = w.pc.conn.Write(p)
+	w.pc.nwrite += int64(n)
+	return
+}
+
+type connLRU struct {
+	ll *list.List // list.Element.Value type is of *persistConn
+	m  map[*persistConn]*list.Element
+}
+
+// add adds pc to the head of the linked list.
+func (cl *connLRU) add(pc *persistConn) {
+	if cl.ll == nil {
+		cl.ll = list.New()
+		cl.m = make(map[*persistConn]*list.Element)
+	}
+	ele := cl.ll.PushFront(pc)
+	if _, ok := cl.m[pc]; ok {
+		panic("persistConn was already in LRU")
+	}
+	cl.m[pc] = ele
+}
+
+func (cl *connLRU) removeOldest() *persistConn {
+	ele := cl.ll.Back()
+	pc := ele.Value.(*persistConn)
+	cl.ll.Remove(ele)
+	delete(cl.m, pc)
+	return pc
+}
+
+// remove removes pc from cl.
+func (cl *connLRU) remove(pc *persistConn) {
+	if ele, ok := cl.m[pc]; ok {
+		cl.ll.Remove(ele)
+		delete(cl.m, pc)
+	}
+}
+
+// len returns the number of items in the cache.
+func (cl *connLRU) len() int {
+	return len(cl.m)
+}
+
 var portMap = map[string]string{
 	"http":  "80",
 	"https": "443",
@@ -10,6 +10,7 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
+	"context"
 	"crypto/rand"
 	"crypto/tls"
 	"errors"
@@ -21,12 +22,16 @@ import (
 	"net/http"
 	. "net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
 	"net/url"
 	"os"
+	"reflect"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -1394,6 +1399,55 @@ func TestTransportCancelRequest(t *testing.T) {
 	}
 }
 
+func TestTransportCancelRequestWithContext(t *testing.T) {
+	defer afterTest(t)
+	unblockc := make(chan bool)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		<-unblockc
+	}))
+	defer ts.Close()
+	defer close(unblockc)
+
+	tr := &Transport{}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := NewRequest("GET", ts.URL, nil)
+	req = req.WithContext(ctx)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	_, err := c.Do(req)
+	if err == nil {
+		t.Fatal("expected an error from a canceled request")
+	}
+	if !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Errorf("Do error = %v; want one mentioning %v", err, context.Canceled)
+	}
+}
+
+func TestTransportCanceledContextBeforeDial(t *testing.T) {
+	defer afterTest(t)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		t.Error("handler unexpectedly called")
+	}))
+	defer ts.Close()
+
+	tr := &Transport{}
+	defer tr.CloseIdleConnections()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := NewRequest("GET", ts.URL, nil)
+	res, err := tr.RoundTrip(req.WithContext(ctx))
+	if err == nil {
+		res.Body.Close()
+		t.Fatal("expected an error from a request with an already-canceled context")
+	}
+}
+
 func TestTransportCancelRequestInDial(t *testing.T) {
 	defer afterTest(t)
 	if testing.Short() {
@@ -2348,3 +2402,537 @@ var rgz = []byte{
 	0x00, 0x00, 0x3d, 0xb1, 0x20, 0x85, 0xfa, 0x00,
 	0x00, 0x00,
 }
+
+func TestTransportEventTrace(t *testing.T) {
+	defer afterTest(t)
+	const resBody = "some body"
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, resBody)
+	}))
+	defer ts.Close()
+	tr := &Transport{}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+
+	// Dial "localhost" rather than the server's IP literal
+	// so that the DNS hooks fire too.
+	_, port, err := net.SplitHostPort(ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://localhost:" + port
+
+	var mu sync.Mutex
+	var buf bytes.Buffer
+	logf := func(format string, args ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(&buf, format, args...)
+		buf.WriteByte('\n')
+	}
+	trace := &httptrace.ClientTrace{
+		GetConn: func(hostPort string) { logf("Getting conn for %v ...", hostPort) },
+		GotConn: func(ci httptrace.GotConnInfo) {
+			logf("got conn: reused=%v wasIdle=%v", ci.Reused, ci.WasIdle)
+		},
+		DNSStart:     func(e httptrace.DNSStartInfo) { logf("DNS start: %v", e.Host) },
+		DNSDone:      func(e httptrace.DNSDoneInfo) { logf("DNS done: %d addrs, err=%v", len(e.Addrs), e.Err) },
+		ConnectStart: func(network, addr string) { logf("ConnectStart: Connecting to %s %s ...", network, addr) },
+		ConnectDone: func(network, addr string, err error) {
+			logf("ConnectDone: connected to %s %s = %v", network, addr, err)
+		},
+		WroteRequest:         func(e httptrace.WroteRequestInfo) { logf("WroteRequest: %+v", e) },
+		GotFirstResponseByte: func() { logf("first response byte") },
+	}
+
+	for i := 0; i < 2; i++ {
+		req, _ := NewRequest("GET", url, nil)
+		req = req.WithContext(httptrace.WithClientTrace(context.Background(), trace))
+		res, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slurp, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(slurp) != resBody {
+			t.Errorf("body = %q; want %q", slurp, resBody)
+		}
+	}
+
+	mu.Lock()
+	got := buf.String()
+	mu.Unlock()
+
+	wantOnce := func(sub string) {
+		if strings.Count(got, sub) != 1 {
+			t.Errorf("expected substring %q exactly once in output.", sub)
+		}
+	}
+	wantOnceOrMore := func(sub string) {
+		if strings.Count(got, sub) == 0 {
+			t.Errorf("expected substring %q at least once in output.", sub)
+		}
+	}
+	if strings.Count(got, "Getting conn for localhost:"+port+" ...") != 2 {
+		t.Errorf("expected GetConn for each request")
+	}
+	wantOnce("DNS start: localhost")
+	wantOnce("DNS done: 1 addrs, err=<nil>")
+	wantOnceOrMore("ConnectStart: Connecting to tcp 127.0.0.1:" + port)
+	wantOnceOrMore("ConnectDone: connected to tcp 127.0.0.1:" + port + " = <nil>")
+	wantOnce("got conn: reused=false wasIdle=false")
+	wantOnce("got conn: reused=true wasIdle=true")
+	if strings.Count(got, "WroteRequest: {Err:<nil>}") != 2 {
+		t.Errorf("expected WroteRequest for each request")
+	}
+	if strings.Count(got, "first response byte") != 2 {
+		t.Errorf("expected GotFirstResponseByte for each request")
+	}
+	if t.Failed() {
+		t.Errorf("Output:\n%s", got)
+	}
+}
+
+func TestTransportEventTraceTLS(t *testing.T) {
+	defer afterTest(t)
+	ts := httptest.NewTLSServer(HandlerFunc(func(w ResponseWriter, r *Request) {}))
+	defer ts.Close()
+	tr := &Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+
+	var mu sync.Mutex
+	var started, done int
+	var state tls.ConnectionState
+	trace := &httptrace.ClientTrace{
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			started++
+			mu.Unlock()
+		},
+		TLSHandshakeDone: func(cs tls.ConnectionState, err error) {
+			if err != nil {
+				t.Errorf("TLSHandshakeDone error: %v", err)
+			}
+			mu.Lock()
+			done++
+			state = cs
+			mu.Unlock()
+		},
+	}
+	req, _ := NewRequest("GET", ts.URL, nil)
+	req = req.WithContext(httptrace.WithClientTrace(context.Background(), trace))
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if started != 1 || done != 1 {
+		t.Errorf("TLSHandshakeStart called %d times, TLSHandshakeDone %d times; want 1 each", started, done)
+	}
+	if !state.HandshakeComplete {
+		t.Error("TLSHandshakeDone got incomplete handshake state")
+	}
+}
+
+func TestTransportMaxConnsPerHost(t *testing.T) {
+	defer afterTest(t)
+	const maxConns = 2
+	var (
+		mu        sync.Mutex
+		active    int
+		maxActive int
+	)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		mu.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		active--
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	for _, keepAlive := range []bool{true, false} {
+		var dials int32
+		tr := &Transport{
+			MaxConnsPerHost:   maxConns,
+			DisableKeepAlives: !keepAlive,
+			Dial: func(network, addr string) (net.Conn, error) {
+				atomic.AddInt32(&dials, 1)
+				return net.Dial(network, addr)
+			},
+		}
+		c := &Client{Transport: tr}
+
+		const n = 8
+		var wg sync.WaitGroup
+		errc := make(chan error, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res, err := c.Get(ts.URL)
+				if err != nil {
+					errc <- err
+					return
+				}
+				ioutil.ReadAll(res.Body)
+				res.Body.Close()
+			}()
+		}
+		wg.Wait()
+		tr.CloseIdleConnections()
+		close(errc)
+		for err := range errc {
+			t.Errorf("keepAlive=%v: Get: %v", keepAlive, err)
+		}
+		mu.Lock()
+		if maxActive > maxConns {
+			t.Errorf("keepAlive=%v: saw %d concurrent requests; want at most %d", keepAlive, maxActive, maxConns)
+		}
+		maxActive = 0
+		mu.Unlock()
+		if got := atomic.LoadInt32(&dials); keepAlive && got > maxConns {
+			t.Errorf("keepAlive=%v: dialed %d times; want at most %d", keepAlive, got, maxConns)
+		} else if !keepAlive && got != n {
+			t.Errorf("keepAlive=%v: dialed %d times; want %d", keepAlive, got, n)
+		}
+	}
+}
+
+func TestTransportMaxConnsPerHostCancelWaiting(t *testing.T) {
+	defer afterTest(t)
+	release := make(chan struct{})
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		<-release
+	}))
+	defer ts.Close()
+	tr := &Transport{MaxConnsPerHost: 1}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+
+	firstDone := make(chan error, 1)
+	go func() {
+		res, err := c.Get(ts.URL)
+		if err == nil {
+			res.Body.Close()
+		}
+		firstDone <- err
+	}()
+
+	// Wait for the first request to hold the only connection.
+	for tries := 0; ; tries++ {
+		if tr.NumPendingRequestsForTesting() == 1 {
+			break
+		}
+		if tries == 100 {
+			t.Fatal("first request never started")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := NewRequest("GET", ts.URL, nil)
+	if _, err := c.Do(req.WithContext(ctx)); err == nil {
+		t.Error("second request succeeded; want it to give up waiting for a connection")
+	}
+
+	close(release)
+	if err := <-firstDone; err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	// The abandoned wait must not have leaked the slot.
+	res, err := c.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("third request: %v", err)
+	}
+	res.Body.Close()
+}
+
+// Setting MaxConnsPerHost while a dial is in flight must not panic
+// when that dial, which took no slot, fails.
+func TestTransportMaxConnsPerHostSetDuringDial(t *testing.T) {
+	defer afterTest(t)
+	tr := &Transport{}
+	tr.Dial = func(n, addr string) (net.Conn, error) {
+		tr.MaxConnsPerHost = 1
+		return nil, errors.New("dial failed")
+	}
+	c := &Client{Transport: tr}
+	if _, err := c.Get("http://dial-fails.golang/"); err == nil {
+		t.Fatal("GET succeeded; want dial error")
+	}
+}
+
+func TestTransportMaxIdleConns(t *testing.T) {
+	defer afterTest(t)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {}))
+	defer ts.Close()
+	tr := &Transport{
+		MaxIdleConns: 4,
+		Dial: func(network, addr string) (net.Conn, error) {
+			return net.Dial(network, ts.Listener.Addr().String())
+		},
+	}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+
+	hitHost := func(n int) {
+		res, err := c.Get(fmt.Sprintf("http://host-%d.dns-is-faked.golang:80", n))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(res.Body)
+		res.Body.Close()
+	}
+	for i := 0; i < 4; i++ {
+		hitHost(i)
+	}
+	want := []string{
+		"|http|host-0.dns-is-faked.golang:80",
+		"|http|host-1.dns-is-faked.golang:80",
+		"|http|host-2.dns-is-faked.golang:80",
+		"|http|host-3.dns-is-faked.golang:80",
+	}
+	if got := tr.IdleConnKeysForTesting(); !reflect.DeepEqual(sortedStrings(got), want) {
+		t.Fatalf("idle conn keys mismatch.\n got: %q\nwant: %q\n", got, want)
+	}
+
+	// Now hitting the 5th host should kick out the first host:
+	hitHost(4)
+	want = []string{
+		"|http|host-1.dns-is-faked.golang:80",
+		"|http|host-2.dns-is-faked.golang:80",
+		"|http|host-3.dns-is-faked.golang:80",
+		"|http|host-4.dns-is-faked.golang:80",
+	}
+	if got := tr.IdleConnKeysForTesting(); !reflect.DeepEqual(sortedStrings(got), want) {
+		t.Fatalf("idle conn keys mismatch after 5th host.\n got: %q\nwant: %q\n", got, want)
+	}
+}
+
+func sortedStrings(s []string) []string {
+	sort.Strings(s)
+	return s
+}
+
+func TestTransportIdleConnTimeout(t *testing.T) {
+	defer afterTest(t)
+	const timeout = 50 * time.Millisecond
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {}))
+	defer ts.Close()
+	tr := &Transport{IdleConnTimeout: timeout}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+
+	for i := 0; i < 3; i++ {
+		res, err := c.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if got := len(tr.IdleConnKeysForTesting()); got != 1 {
+			t.Fatalf("request %d: %d idle conn keys; want 1", i, got)
+		}
+		// Idle for longer than the timeout, then check
+		// that the connection went away.
+		deadline := time.Now().Add(2 * time.Second)
+		for len(tr.IdleConnKeysForTesting()) != 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("request %d: idle conn not closed after %v", i, timeout)
+			}
+			time.Sleep(timeout / 2)
+		}
+	}
+}
+
+func TestTransportExpectContinue(t *testing.T) {
+	defer afterTest(t)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		switch r.URL.Path {
+		case "/accept":
+			slurp, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				t.Errorf("server reading body: %v", err)
+			}
+			io.WriteString(w, string(slurp))
+		case "/reject":
+			w.WriteHeader(StatusForbidden)
+		}
+	}))
+	defer ts.Close()
+	tr := &Transport{ExpectContinueTimeout: 5 * time.Second}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantRead   bool
+	}{
+		{"/accept", StatusOK, true},
+		{"/reject", StatusForbidden, false},
+	}
+	for _, tt := range tests {
+		var read int32
+		body := readerFunc(func(p []byte) (int, error) {
+			if atomic.AddInt32(&read, 1) > 1 {
+				return 0, io.EOF
+			}
+			return copy(p, "some body"), nil
+		})
+		req, _ := NewRequest("PUT", ts.URL+tt.path, ioutil.NopCloser(body))
+		req.ContentLength = int64(len("some body"))
+		req.Header.Set("Expect", "100-continue")
+		start := time.Now()
+		res, err := c.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tt.wantStatus {
+			t.Errorf("%s: status = %d; want %d", tt.path, res.StatusCode, tt.wantStatus)
+		}
+		if got := atomic.LoadInt32(&read) > 0; got != tt.wantRead {
+			t.Errorf("%s: body read = %v; want %v", tt.path, got, tt.wantRead)
+		}
+		if d := time.Since(start); d > 2*time.Second {
+			t.Errorf("%s: took %v; want the client not to wait for the timeout", tt.path, d)
+		}
+	}
+}
+
+type readerFunc func([]byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) { return f(p) }
+
+// closingIdleServer accepts connections on ln and serves each with
+// one successful response. It then reads the next request on that
+// connection and closes it without replying, like a server whose
+// keep-alive timeout fires just as the client reuses the connection.
+func closingIdleServer(t *testing.T, ln net.Listener) {
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func(c net.Conn) {
+			defer c.Close()
+			br := bufio.NewReader(c)
+			req, err := ReadRequest(br)
+			if err != nil {
+				return
+			}
+			io.Copy(ioutil.Discard, req.Body)
+			io.WriteString(c, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+			if req, err = ReadRequest(br); err == nil {
+				io.Copy(ioutil.Discard, req.Body)
+			}
+		}(c)
+	}
+}
+
+// writeErrConn is a net.Conn whose writes fail with err.
+type writeErrConn struct {
+	net.Conn
+	err error
+}
+
+func (c writeErrConn) Write([]byte) (int, error) { return 0, c.err }
+
+// A request write that fails before writing anything must
+// report the write error itself, not an internal wrapper of it.
+func TestTransportWriteErrorType(t *testing.T) {
+	defer afterTest(t)
+	writeErr := &net.OpError{Op: "write", Net: "tcp", Err: errors.New("write failed")}
+	tr := &Transport{
+		Dial: func(n, addr string) (net.Conn, error) {
+			c, s := net.Pipe()
+			go ioutil.ReadAll(s)
+			return writeErrConn{c, writeErr}, nil
+		},
+	}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+
+	var traceErr error
+	req, _ := NewRequest("GET", "http://example.com/", nil)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		WroteRequest: func(info httptrace.WroteRequestInfo) { traceErr = info.Err },
+	}))
+	_, err := c.Do(req)
+	ue, ok := err.(*url.Error)
+	if !ok {
+		t.Fatalf("got error %T %v; want *url.Error", err, err)
+	}
+	if ue.Err != writeErr {
+		t.Errorf("url.Error.Err = %T %v; want %v", ue.Err, ue.Err, writeErr)
+	}
+	if _, ok := ue.Err.(net.Error); !ok {
+		t.Errorf("url.Error.Err = %T; want a net.Error", ue.Err)
+	}
+	if traceErr != writeErr {
+		t.Errorf("WroteRequest error = %T %v; want %v", traceErr, traceErr, writeErr)
+	}
+}
+
+func TestTransportRetryIdempotentOnServerClose(t *testing.T) {
+	defer afterTest(t)
+	ln := newLocalListener(t)
+	defer ln.Close()
+	go closingIdleServer(t, ln)
+
+	var retried int32
+	defer SetRoundTripRetried(func() { atomic.AddInt32(&retried, 1) })()
+
+	tr := &Transport{}
+	defer tr.CloseIdleConnections()
+	c := &Client{Transport: tr}
+	url := "http://" + ln.Addr().String()
+
+	for i := 0; i < 3; i++ {
+		res, err := c.Get(url)
+		if err != nil {
+			t.Fatalf("GET %d: %v", i, err)
+		}
+		slurp, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil || string(slurp) != "ok" {
+			t.Fatalf("GET %d: body = %q, %v; want \"ok\"", i, slurp, err)
+		}
+	}
+	if got := atomic.LoadInt32(&retried); got != 2 {
+		t.Errorf("retried %d times; want 2", got)
+	}
+
+	// A POST with a body isn't replayable and must not be retried.
+	atomic.StoreInt32(&retried, 0)
+	tr.CloseIdleConnections()
+	res, err := c.Post(url, "text/plain", strings.NewReader("x"))
+	if err != nil {
+		t.Fatalf("first POST: %v", err)
+	}
+	ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if _, err := c.Post(url, "text/plain", strings.NewReader("x")); err == nil {
+		t.Error("second POST succeeded; want error from closed connection")
+	}
+	if got := atomic.LoadInt32(&retried); got != 0 {
+		t.Errorf("retried POST %d times; want 0", got)
+	}
+}
@@ -4,6 +4,8 @@
 
 package net
 
+import "context"
+
 // IPAddr represents the address of an IP end point.
 type IPAddr struct {
 	IP   IP
@@ -46,7 +48,7 @@ func ResolveIPAddr(net, addr string) (*IPAddr, error) {
 	default:
 		return nil, UnknownNetworkError(net)
 	}
-	a, err := resolveInternetAddr(afnet, addr, noDeadline)
+	a, err := DefaultResolver.resolveInternetAddr(context.Background(), afnet, addr, noDeadline)
 	if err != nil {
 		return nil, err
 	}
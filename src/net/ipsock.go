@@ -7,7 +7,9 @@
 package net
 
 import (
+	"context"
 	"errors"
+	"internal/nettrace"
 	"time"
 )
 
@@ -234,7 +236,10 @@ func JoinHostPort(host, port string) string {
 // address family addresses when addr is a DNS name and the name has
 // multiple address family records. The result contains at least one
 // address when error is nil.
-func resolveInternetAddr(net, addr string, deadline time.Time) (netaddr, error) {
+//
+// If ctx carries a *nettrace.Trace, its DNS hooks are called around
+// any name lookup.
+func (r *Resolver) resolveInternetAddr(ctx context.Context, net, addr string, deadline time.Time) (netaddr, error) {
 	var (
 		err              error
 		host, port, zone string
@@ -282,7 +287,18 @@ func resolveInternetAddr(net, addr string, deadline time.Time) (netaddr, error)
 	}
 	// Try as a DNS name.
 	host, zone = splitHostZone(host)
-	ips, err := lookupIPDeadline(host, deadline)
+	trace, _ := ctx.Value(nettrace.TraceKey{}).(*nettrace.Trace)
+	if trace != nil && trace.DNSStart != nil {
+		trace.DNSStart(host)
+	}
+	ips, shared, err := r.lookupIPMerge(ctx, host, deadline)
+	if trace != nil && trace.DNSDone != nil {
+		addrs := make([]interface{}, len(ips))
+		for i, ip := range ips {
+			addrs[i] = ip
+		}
+		trace.DNSDone(addrs, shared, err)
+	}
 	if err != nil {
 		return nil, err
 	}
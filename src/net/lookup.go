@@ -4,7 +4,10 @@
 
 package net
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // protocols contains minimal mappings between internet protocol
 // names and numbers for platforms that don't have a complete list of
@@ -19,28 +22,130 @@ var protocols = map[string]int{
 	"ipv6-icmp": 58, "IPV6-ICMP": 58, "IPv6-ICMP": 58,
 }
 
+// DefaultResolver is the resolver used by the package-level Lookup
+// functions and by Dialers without a specified Resolver.
+var DefaultResolver = &Resolver{}
+
+// A Resolver looks up names and numbers.
+//
+// A nil *Resolver is equivalent to a zero Resolver.
+type Resolver struct {
+	// PreferGo controls whether Go's built-in DNS resolver is
+	// preferred on platforms where it's available, instead of the
+	// C library's resolver.
+	PreferGo bool
+
+	// Dial optionally specifies an alternate dialer for use by
+	// Go's built-in DNS resolver to make TCP and UDP connections
+	// to DNS services. The host in the address parameter will
+	// always be a literal IP address and not a host name, and the
+	// port in the address parameter will be a literal port number
+	// and not a service name.
+	// If the Conn returned is also a PacketConn, sent and received
+	// DNS messages must adhere to RFC 1035 section 4.2.1, "UDP
+	// usage". Otherwise, DNS messages transmitted over Conn must
+	// be prefixed with their two-byte length, as in RFC 1035
+	// section 4.2.2, "TCP usage".
+	// If nil, the default dialer is used.
+	//
+	// Setting Dial implies PreferGo.
+	Dial func(ctx context.Context, network, address string) (Conn, error)
+
+	// lookupGroup merges LookupIPAddr calls together for lookups
+	// for the same host. The lookupGroup key is the host name.
+	lookupGroup singleflight
+}
+
+func (r *Resolver) preferGo() bool { return r != nil && (r.PreferGo || r.Dial != nil) }
+
+func (r *Resolver) getLookupGroup() *singleflight {
+	if r == nil {
+		return &DefaultResolver.lookupGroup
+	}
+	return &r.lookupGroup
+}
+
 // LookupHost looks up the given host using the local resolver.
 // It returns an array of that host's addresses.
 func LookupHost(host string) (addrs []string, err error) {
-	return lookupHost(host)
+	return DefaultResolver.LookupHost(context.Background(), host)
+}
+
+// LookupHost looks up the given host using the local resolver.
+// It returns a slice of that host's addresses.
+func (r *Resolver) LookupHost(ctx context.Context, host string) (addrs []string, err error) {
+	return r.lookupHost(ctx, host)
 }
 
 // LookupIP looks up host using the local resolver.
 // It returns an array of that host's IPv4 and IPv6 addresses.
 func LookupIP(host string) (addrs []IP, err error) {
-	return lookupIPMerge(host)
+	addrs, _, err = DefaultResolver.lookupIPMerge(context.Background(), host, noDeadline)
+	return
 }
 
-var lookupGroup singleflight
+// LookupIPAddr looks up host using the local resolver.
+// It returns a slice of that host's IPv4 and IPv6 addresses.
+func (r *Resolver) LookupIPAddr(ctx context.Context, host string) ([]IPAddr, error) {
+	ips, _, err := r.lookupIPMerge(ctx, host, noDeadline)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]IPAddr, len(ips))
+	for i, ip := range ips {
+		addrs[i] = IPAddr{IP: ip}
+	}
+	return addrs, nil
+}
 
 // lookupIPMerge wraps lookupIP, but makes sure that for any given
 // host, only one lookup is in-flight at a time. The returned memory
-// is always owned by the caller.
-func lookupIPMerge(host string) (addrs []IP, err error) {
-	addrsi, err, shared := lookupGroup.Do(host, func() (interface{}, error) {
-		return lookupIP(host)
+// is always owned by the caller. The returned shared reports whether
+// the result was shared with another caller looking up the same host
+// concurrently.
+//
+// The lookup gives up when ctx is done or, if deadline is non-zero,
+// at deadline.
+func (r *Resolver) lookupIPMerge(ctx context.Context, host string, deadline time.Time) (addrs []IP, shared bool, err error) {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		// We could push the deadline down into the name resolution
+		// functions.  However, the most commonly used implementation
+		// calls getaddrinfo, which has no timeout.
+		d := deadline.Sub(time.Now())
+		if d <= 0 {
+			return nil, false, errTimeout
+		}
+		t := time.NewTimer(d)
+		defer t.Stop()
+		timeout = t.C
+	}
+
+	group := r.getLookupGroup()
+	ch := group.DoChan(host, func() (interface{}, error) {
+		// The lookup is shared by all callers waiting on
+		// host, so it must not inherit any one caller's
+		// context.
+		return r.lookupIP(context.Background(), host)
 	})
-	return lookupIPReturn(addrsi, err, shared)
+
+	select {
+	case <-timeout:
+		// The DNS lookup timed out for some reason.  Force
+		// future requests to start the DNS lookup again
+		// rather than waiting for the current lookup to
+		// complete.  See issue 8602.
+		group.Forget(host)
+		return nil, false, errTimeout
+
+	case <-ctx.Done():
+		group.Forget(host)
+		return nil, false, mapErr(ctx.Err())
+
+	case res := <-ch:
+		addrs, err = lookupIPReturn(res.v, res.err, res.shared)
+		return addrs, res.shared, err
+	}
 }
 
 // lookupIPReturn turns the return values from singleflight.Do into
@@ -60,43 +165,18 @@ func lookupIPReturn(addrsi interface{}, err error, shared bool) ([]IP, error) {
 
 // lookupIPDeadline looks up a hostname with a deadline.
 func lookupIPDeadline(host string, deadline time.Time) (addrs []IP, err error) {
-	if deadline.IsZero() {
-		return lookupIPMerge(host)
-	}
-
-	// We could push the deadline down into the name resolution
-	// functions.  However, the most commonly used implementation
-	// calls getaddrinfo, which has no timeout.
-
-	timeout := deadline.Sub(time.Now())
-	if timeout <= 0 {
-		return nil, errTimeout
-	}
-	t := time.NewTimer(timeout)
-	defer t.Stop()
-
-	ch := lookupGroup.DoChan(host, func() (interface{}, error) {
-		return lookupIP(host)
-	})
-
-	select {
-	case <-t.C:
-		// The DNS lookup timed out for some reason.  Force
-		// future requests to start the DNS lookup again
-		// rather than waiting for the current lookup to
-		// complete.  See issue 8602.
-		lookupGroup.Forget(host)
-
-		return nil, errTimeout
-
-	case r := <-ch:
-		return lookupIPReturn(r.v, r.err, r.shared)
-	}
+	addrs, _, err = DefaultResolver.lookupIPMerge(context.Background(), host, deadline)
+	return
 }
 
 // LookupPort looks up the port for the given network and service.
 func LookupPort(network, service string) (port int, err error) {
-	return lookupPort(network, service)
+	return DefaultResolver.LookupPort(context.Background(), network, service)
+}
+
+// LookupPort looks up the port for the given network and service.
+func (r *Resolver) LookupPort(ctx context.Context, network, service string) (port int, err error) {
+	return r.lookupPort(ctx, network, service)
 }
 
 // LookupCNAME returns the canonical DNS host for the given name.
@@ -104,7 +184,15 @@ func LookupPort(network, service string) (port int, err error) {
 // LookupHost or LookupIP directly; both take care of resolving
 // the canonical name as part of the lookup.
 func LookupCNAME(name string) (cname string, err error) {
-	return lookupCNAME(name)
+	return DefaultResolver.LookupCNAME(context.Background(), name)
+}
+
+// LookupCNAME returns the canonical DNS host for the given name.
+// Callers that do not care about the canonical name can call
+// LookupHost or LookupIPAddr directly; both take care of resolving
+// the canonical name as part of the lookup.
+func (r *Resolver) LookupCNAME(ctx context.Context, name string) (cname string, err error) {
+	return r.lookupCNAME(ctx, name)
 }
 
 // LookupSRV tries to resolve an SRV query of the given service,
@@ -117,26 +205,54 @@ func LookupCNAME(name string) (cname string, err error) {
 // publishing SRV records under non-standard names, if both service
 // and proto are empty strings, LookupSRV looks up name directly.
 func LookupSRV(service, proto, name string) (cname string, addrs []*SRV, err error) {
-	return lookupSRV(service, proto, name)
+	return DefaultResolver.LookupSRV(context.Background(), service, proto, name)
+}
+
+// LookupSRV tries to resolve an SRV query of the given service,
+// protocol, and domain name. See the package-level LookupSRV for
+// details.
+func (r *Resolver) LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*SRV, err error) {
+	return r.lookupSRV(ctx, service, proto, name)
 }
 
 // LookupMX returns the DNS MX records for the given domain name sorted by preference.
 func LookupMX(name string) (mx []*MX, err error) {
-	return lookupMX(name)
+	return DefaultResolver.LookupMX(context.Background(), name)
+}
+
+// LookupMX returns the DNS MX records for the given domain name sorted by preference.
+func (r *Resolver) LookupMX(ctx context.Context, name string) (mx []*MX, err error) {
+	return r.lookupMX(ctx, name)
 }
 
 // LookupNS returns the DNS NS records for the given domain name.
 func LookupNS(name string) (ns []*NS, err error) {
-	return lookupNS(name)
+	return DefaultResolver.LookupNS(context.Background(), name)
+}
+
+// LookupNS returns the DNS NS records for the given domain name.
+func (r *Resolver) LookupNS(ctx context.Context, name string) (ns []*NS, err error) {
+	return r.lookupNS(ctx, name)
 }
 
 // LookupTXT returns the DNS TXT records for the given domain name.
 func LookupTXT(name string) (txt []string, err error) {
-	return lookupTXT(name)
+	return DefaultResolver.LookupTXT(context.Background(), name)
+}
+
+// LookupTXT returns the DNS TXT records for the given domain name.
+func (r *Resolver) LookupTXT(ctx context.Context, name string) (txt []string, err error) {
+	return r.lookupTXT(ctx, name)
 }
 
 // LookupAddr performs a reverse lookup for the given address, returning a list
 // of names mapping to that address.
 func LookupAddr(addr string) (name []string, err error) {
-	return lookupAddr(addr)
+	return DefaultResolver.LookupAddr(context.Background(), addr)
+}
+
+// LookupAddr performs a reverse lookup for the given address, returning a list
+// of names mapping to that address.
+func (r *Resolver) LookupAddr(ctx context.Context, addr string) (name []string, err error) {
+	return r.lookupAddr(ctx, addr)
 }
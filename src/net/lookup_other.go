@@ -0,0 +1,48 @@
+// Copyright 2015 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build nacl plan9 windows
+
+package net
+
+import "context"
+
+// These systems have no built-in Go DNS resolver; a Resolver always
+// uses the system's, and its PreferGo and Dial fields are ignored.
+
+func (r *Resolver) lookupHost(ctx context.Context, host string) (addrs []string, err error) {
+	return lookupHost(host)
+}
+
+func (r *Resolver) lookupIP(ctx context.Context, host string) (addrs []IP, err error) {
+	return lookupIP(host)
+}
+
+func (r *Resolver) lookupPort(ctx context.Context, network, service string) (port int, err error) {
+	return lookupPort(network, service)
+}
+
+func (r *Resolver) lookupCNAME(ctx context.Context, name string) (cname string, err error) {
+	return lookupCNAME(name)
+}
+
+func (r *Resolver) lookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*SRV, err error) {
+	return lookupSRV(service, proto, name)
+}
+
+func (r *Resolver) lookupMX(ctx context.Context, name string) (mx []*MX, err error) {
+	return lookupMX(name)
+}
+
+func (r *Resolver) lookupNS(ctx context.Context, name string) (ns []*NS, err error) {
+	return lookupNS(name)
+}
+
+func (r *Resolver) lookupTXT(ctx context.Context, name string) (txt []string, err error) {
+	return lookupTXT(name)
+}
+
+func (r *Resolver) lookupAddr(ctx context.Context, addr string) (name []string, err error) {
+	return lookupAddr(addr)
+}
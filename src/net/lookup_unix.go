@@ -7,6 +7,7 @@
 package net
 
 import (
+	"context"
 	"errors"
 	"sync"
 )
@@ -52,39 +53,43 @@ func lookupProtocol(name string) (proto int, err error) {
 	return
 }
 
-func lookupHost(host string) (addrs []string, err error) {
-	addrs, err, ok := cgoLookupHost(host)
-	if !ok {
-		addrs, err = goLookupHost(host)
+func (r *Resolver) lookupHost(ctx context.Context, host string) (addrs []string, err error) {
+	if !r.preferGo() {
+		if addrs, err, ok := cgoLookupHost(host); ok {
+			return addrs, err
+		}
 	}
-	return
+	return r.goLookupHost(ctx, host)
 }
 
-func lookupIP(host string) (addrs []IP, err error) {
-	addrs, err, ok := cgoLookupIP(host)
-	if !ok {
-		addrs, err = goLookupIP(host)
+func (r *Resolver) lookupIP(ctx context.Context, host string) (addrs []IP, err error) {
+	if !r.preferGo() {
+		if addrs, err, ok := cgoLookupIP(host); ok {
+			return addrs, err
+		}
 	}
-	return
+	return r.goLookupIP(ctx, host)
 }
 
-func lookupPort(network, service string) (port int, err error) {
-	port, err, ok := cgoLookupPort(network, service)
-	if !ok {
-		port, err = goLookupPort(network, service)
+func (r *Resolver) lookupPort(ctx context.Context, network, service string) (port int, err error) {
+	if !r.preferGo() {
+		if port, err, ok := cgoLookupPort(network, service); ok {
+			return port, err
+		}
 	}
-	return
+	return goLookupPort(network, service)
 }
 
-func lookupCNAME(name string) (cname string, err error) {
-	cname, err, ok := cgoLookupCNAME(name)
-	if !ok {
-		cname, err = goLookupCNAME(name)
+func (r *Resolver) lookupCNAME(ctx context.Context, name string) (cname string, err error) {
+	if !r.preferGo() {
+		if cname, err, ok := cgoLookupCNAME(name); ok {
+			return cname, err
+		}
 	}
-	return
+	return r.goLookupCNAME(ctx, name)
 }
 
-func lookupSRV(service, proto, name string) (cname string, addrs []*SRV, err error) {
+func (r *Resolver) lookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*SRV, err error) {
 	var target string
 	if service == "" && proto == "" {
 		target = name
@@ -92,7 +97,7 @@ func lookupSRV(service, proto, name string) (cname string, addrs []*SRV, err err
 		target = "_" + service + "._" + proto + "." + name
 	}
 	var records []dnsRR
-	cname, records, err = lookup(target, dnsTypeSRV)
+	cname, records, err = r.lookup(ctx, target, dnsTypeSRV)
 	if err != nil {
 		return
 	}
@@ -105,8 +110,8 @@ func lookupSRV(service, proto, name string) (cname string, addrs []*SRV, err err
 	return
 }
 
-func lookupMX(name string) (mx []*MX, err error) {
-	_, records, err := lookup(name, dnsTypeMX)
+func (r *Resolver) lookupMX(ctx context.Context, name string) (mx []*MX, err error) {
+	_, records, err := r.lookup(ctx, name, dnsTypeMX)
 	if err != nil {
 		return
 	}
@@ -119,8 +124,8 @@ func lookupMX(name string) (mx []*MX, err error) {
 	return
 }
 
-func lookupNS(name string) (ns []*NS, err error) {
-	_, records, err := lookup(name, dnsTypeNS)
+func (r *Resolver) lookupNS(ctx context.Context, name string) (ns []*NS, err error) {
+	_, records, err := r.lookup(ctx, name, dnsTypeNS)
 	if err != nil {
 		return
 	}
@@ -132,8 +137,8 @@ func lookupNS(name string) (ns []*NS, err error) {
 	return
 }
 
-func lookupTXT(name string) (txt []string, err error) {
-	_, records, err := lookup(name, dnsTypeTXT)
+func (r *Resolver) lookupTXT(ctx context.Context, name string) (txt []string, err error) {
+	_, records, err := r.lookup(ctx, name, dnsTypeTXT)
 	if err != nil {
 		return
 	}
@@ -144,7 +149,7 @@ func lookupTXT(name string) (txt []string, err error) {
 	return
 }
 
-func lookupAddr(addr string) (name []string, err error) {
+func (r *Resolver) lookupAddr(ctx context.Context, addr string) (name []string, err error) {
 	name = lookupStaticAddr(addr)
 	if len(name) > 0 {
 		return
@@ -155,7 +160,7 @@ func lookupAddr(addr string) (name []string, err error) {
 		return
 	}
 	var records []dnsRR
-	_, records, err = lookup(arpa, dnsTypePTR)
+	_, records, err = r.lookup(ctx, arpa, dnsTypePTR)
 	if err != nil {
 		return
 	}
@@ -4,6 +4,8 @@
 
 package net
 
+import "context"
+
 // TCPAddr represents the address of a TCP end point.
 type TCPAddr struct {
 	IP   IP
@@ -46,7 +48,7 @@ func ResolveTCPAddr(net, addr string) (*TCPAddr, error) {
 	default:
 		return nil, UnknownNetworkError(net)
 	}
-	a, err := resolveInternetAddr(net, addr, noDeadline)
+	a, err := DefaultResolver.resolveInternetAddr(context.Background(), net, addr, noDeadline)
 	if err != nil {
 		return nil, err
 	}
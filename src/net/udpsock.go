@@ -4,6 +4,8 @@
 
 package net
 
+import "context"
+
 // UDPAddr represents the address of a UDP end point.
 type UDPAddr struct {
 	IP   IP
@@ -46,7 +48,7 @@ func ResolveUDPAddr(net, addr string) (*UDPAddr, error) {
 	default:
 		return nil, UnknownNetworkError(net)
 	}
-	a, err := resolveInternetAddr(net, addr, noDeadline)
+	a, err := DefaultResolver.resolveInternetAddr(context.Background(), net, addr, noDeadline)
 	if err != nil {
 		return nil, err
 	}
@@ -340,7 +340,7 @@ func gogc(force int32) {
 			go backgroundgc()
 		} else if bggc.working == 0 {
 			bggc.working = 1
-			ready(bggc.g)
+			ready(bggc.g, 0)
 		}
 		unlock(&bggc.lock)
 	} else {
@@ -352,6 +352,10 @@ func gcwork(force int32) {
 
 	semacquire(&worldsema, false)
 
+	if trace.enabled {
+		traceGCStart()
+	}
+
 	// Pick up the remaining unswept/not being swept spans concurrently
 	for gosweepone() != ^uintptr(0) {
 		sweep.nbgsweep++
@@ -428,6 +432,10 @@ func gcwork(force int32) {
 		gctimer.cycle.sweep = nanotime()
 	}
 
+	if trace.enabled {
+		traceGCDone()
+	}
+
 	semrelease(&worldsema)
 
 	if force == 0 {
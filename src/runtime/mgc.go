@@ -1408,6 +1408,10 @@ func gcscan_m() {
 	casgstatus(mastergp, _Grunning, _Gwaiting)
 	mastergp.waitreason = "garbage collection scan"
 
+	if trace.enabled {
+		traceGCScanStart()
+	}
+
 	// Span sweeping has been done by finishsweep_m.
 	// Long term we will want to make this goroutine runnable
 	// by placing it onto a scanenqueue state and then calling
@@ -1440,6 +1444,10 @@ func gcscan_m() {
 	}
 	unlock(&allglock)
 
+	if trace.enabled {
+		traceGCScanDone()
+	}
+
 	casgstatus(mastergp, _Gwaiting, _Grunning)
 	// Let the g that called us continue to run.
 }
@@ -1532,10 +1540,18 @@ func gc(start_time int64, eagersweep bool) {
 		t2 = nanotime()
 	}
 
+	if trace.enabled {
+		traceGCScanStart()
+	}
+
 	gchelperstart()
 	parfordo(work.markfor)
 	scanblock(0, 0, nil)
 
+	if trace.enabled {
+		traceGCScanDone()
+	}
+
 	if work.full != 0 {
 		throw("work.full != 0")
 	}
@@ -1562,6 +1578,9 @@ func gc(start_time int64, eagersweep bool) {
 	// conservatively set next_gc to high value assuming that everything is live
 	// concurrent/lazy sweep will reduce this number while discovering new garbage
 	memstats.next_gc = memstats.heap_alloc + memstats.heap_alloc*uint64(gcpercent)/100
+	if trace.enabled {
+		traceNextGC()
+	}
 
 	t4 := nanotime()
 	atomicstore64(&memstats.last_gc, uint64(unixnanotime())) // must be Unix time to make sense to user
@@ -1633,7 +1652,7 @@ func gc(start_time int64, eagersweep bool) {
 			sweep.started = true
 		} else if sweep.parked {
 			sweep.parked = false
-			ready(sweep.g)
+			ready(sweep.g, 0)
 		}
 		unlock(&gclock)
 	} else {